@@ -0,0 +1,583 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"net/http"
+	"net/smtp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	minPasswordLength       = 8
+	verificationCodeTTL     = 15 * time.Minute
+	maxVerificationAttempts = 5
+	defaultAccessTokenTTL   = 15 * time.Minute
+	defaultRefreshTokenTTL  = 7 * 24 * time.Hour
+)
+
+// Token types carried in the "typ" claim
+const (
+	accessTokenType  = "access"
+	refreshTokenType = "refresh"
+)
+
+// UserAccount is a login account, linked to the participant it acts for
+type UserAccount struct {
+	ID            string
+	Email         string
+	PasswordHash  []byte `json:"-"`
+	ParticipantID string
+	EmailVerified bool
+	CreatedAt     time.Time
+}
+
+// Principal is the authenticated caller attached to a request
+type Principal struct {
+	UserID        string
+	Email         string
+	ParticipantID string
+}
+
+// TokenPair holds the tokens issued on login or refresh
+type TokenPair struct {
+	AccessToken  string    `json:"access_token"`
+	RefreshToken string    `json:"refresh_token"`
+	ExpiresAt    time.Time `json:"expires_at"`
+}
+
+// tokenClaims are the JWT claims issued by the AuthService
+type tokenClaims struct {
+	Subject       string `json:"sub"`
+	Email         string `json:"email"`
+	ParticipantID string `json:"pid,omitempty"`
+	Type          string `json:"typ"`
+	ID            string `json:"jti"`
+	IssuedAt      int64  `json:"iat"`
+	ExpiresAt     int64  `json:"exp"`
+}
+
+// verificationCode is a pending email verification code
+type verificationCode struct {
+	hash      [32]byte
+	expiresAt time.Time
+	attempts  int
+}
+
+// refreshSession is an active refresh token
+type refreshSession struct {
+	userID    string
+	expiresAt time.Time
+}
+
+// CodeSender delivers email verification codes
+type CodeSender interface {
+	SendVerificationCode(email, code string) error
+}
+
+// LogCodeSender is a CodeSender that writes codes to the log for local development
+type LogCodeSender struct{}
+
+// SendVerificationCode logs the verification code
+func (LogCodeSender) SendVerificationCode(email, code string) error {
+	log.Printf("Verification code for %s: %s", email, code)
+	return nil
+}
+
+// SMTPCodeSender is a CodeSender that emails codes through an SMTP relay
+type SMTPCodeSender struct {
+	Addr string // host:port of the relay
+	From string
+	Auth smtp.Auth // nil for relays that do not authenticate
+}
+
+// NewSMTPCodeSender creates a new SMTPCodeSender. Credentials are optional.
+func NewSMTPCodeSender(host string, port int, username, password, from string) (*SMTPCodeSender, error) {
+	if host == "" || from == "" {
+		return nil, errors.New("smtp host and from address are required")
+	}
+	if port == 0 {
+		port = 587
+	}
+	sender := &SMTPCodeSender{Addr: fmt.Sprintf("%s:%d", host, port), From: from}
+	if username != "" {
+		sender.Auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender, nil
+}
+
+// SendVerificationCode emails the verification code
+func (s *SMTPCodeSender) SendVerificationCode(email, code string) error {
+	msg := "From: " + s.From + "\r\n" +
+		"To: " + email + "\r\n" +
+		"Subject: Your verification code\r\n\r\n" +
+		"Your verification code is " + code + "\r\n"
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{email}, []byte(msg))
+}
+
+// AuthService manages user accounts, email verification and JWT sessions
+type AuthService struct {
+	signingKey []byte
+	sender     CodeSender
+	accessTTL  time.Duration
+	refreshTTL time.Duration
+
+	accounts      map[string]*UserAccount     // userID -> account
+	byEmail       map[string]string           // email -> userID
+	codes         map[string]verificationCode // userID -> pending code
+	refreshTokens map[string]refreshSession   // refresh jti -> session, removed when used or revoked
+	mutex         sync.Mutex
+}
+
+// NewAuthService creates a new AuthService signing tokens with the given
+// HMAC key
+func NewAuthService(signingKey []byte, sender CodeSender) (*AuthService, error) {
+	if len(signingKey) < 32 {
+		return nil, errors.New("signing key must be at least 32 bytes")
+	}
+	if sender == nil {
+		return nil, errors.New("a verification code sender is required")
+	}
+	return &AuthService{
+		signingKey:    signingKey,
+		sender:        sender,
+		accessTTL:     defaultAccessTokenTTL,
+		refreshTTL:    defaultRefreshTokenTTL,
+		accounts:      make(map[string]*UserAccount),
+		byEmail:       make(map[string]string),
+		codes:         make(map[string]verificationCode),
+		refreshTokens: make(map[string]refreshSession),
+	}, nil
+}
+
+// normalizeEmail lowercases and trims an email address
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+// Register creates an unverified account and sends an email verification code
+func (as *AuthService) Register(email, password string) (UserAccount, error) {
+	email = normalizeEmail(email)
+	if !strings.Contains(email, "@") {
+		return UserAccount{}, errors.New("invalid email address")
+	}
+	if len(password) < minPasswordLength {
+		return UserAccount{}, fmt.Errorf("password must be at least %d characters", minPasswordLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return UserAccount{}, err
+	}
+
+	as.mutex.Lock()
+	if _, exists := as.byEmail[email]; exists {
+		as.mutex.Unlock()
+		return UserAccount{}, errors.New("email already registered")
+	}
+	account := &UserAccount{
+		ID:           uuid.New().String(),
+		Email:        email,
+		PasswordHash: hash,
+		CreatedAt:    time.Now(),
+	}
+	as.accounts[account.ID] = account
+	as.byEmail[email] = account.ID
+	code, err := as.issueCode(account.ID)
+	as.mutex.Unlock()
+	if err != nil {
+		return UserAccount{}, err
+	}
+
+	if err := as.sender.SendVerificationCode(email, code); err != nil {
+		log.Printf("Failed to send verification code to %s: %v", email, err)
+	}
+	log.Printf("User account registered: %s", account.ID)
+	return *account, nil
+}
+
+// issueCode generates a six digit verification code for an account. Must be
+// called with the mutex held.
+func (as *AuthService) issueCode(userID string) (string, error) {
+	n, err := rand.Int(rand.Reader, big.NewInt(1000000))
+	if err != nil {
+		return "", err
+	}
+	code := fmt.Sprintf("%06d", n.Int64())
+	as.codes[userID] = verificationCode{
+		hash:      sha256.Sum256([]byte(code)),
+		expiresAt: time.Now().Add(verificationCodeTTL),
+	}
+	return code, nil
+}
+
+// ResendVerificationCode issues a fresh verification code, replacing any pending one
+func (as *AuthService) ResendVerificationCode(email string) error {
+	email = normalizeEmail(email)
+	as.mutex.Lock()
+	userID, exists := as.byEmail[email]
+	if !exists {
+		as.mutex.Unlock()
+		return errors.New("account not found")
+	}
+	if as.accounts[userID].EmailVerified {
+		as.mutex.Unlock()
+		return errors.New("email already verified")
+	}
+	code, err := as.issueCode(userID)
+	as.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return as.sender.SendVerificationCode(email, code)
+}
+
+// VerifyEmail confirms an account's email address with its verification code
+func (as *AuthService) VerifyEmail(email, code string) error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	userID, exists := as.byEmail[normalizeEmail(email)]
+	if !exists {
+		return errors.New("account not found")
+	}
+	pending, exists := as.codes[userID]
+	if !exists {
+		return errors.New("no verification pending")
+	}
+	if time.Now().After(pending.expiresAt) || pending.attempts >= maxVerificationAttempts {
+		delete(as.codes, userID)
+		return errors.New("verification code expired")
+	}
+	hash := sha256.Sum256([]byte(strings.TrimSpace(code)))
+	if subtle.ConstantTimeCompare(hash[:], pending.hash[:]) != 1 {
+		pending.attempts++
+		as.codes[userID] = pending
+		return errors.New("invalid verification code")
+	}
+	delete(as.codes, userID)
+	as.accounts[userID].EmailVerified = true
+	return nil
+}
+
+// LinkParticipant links an account to the marketplace participant it acts for
+func (as *AuthService) LinkParticipant(userID, participantID string) error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	account, exists := as.accounts[userID]
+	if !exists {
+		return errors.New("account not found")
+	}
+	if account.ParticipantID != "" && account.ParticipantID != participantID {
+		return errors.New("account already linked to a participant")
+	}
+	account.ParticipantID = participantID
+	return nil
+}
+
+// UnlinkParticipant detaches an account from its participant and revokes its
+// refresh tokens, so it can no longer obtain tokens acting for that participant
+func (as *AuthService) UnlinkParticipant(userID string) error {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	account, exists := as.accounts[userID]
+	if !exists {
+		return errors.New("account not found")
+	}
+	account.ParticipantID = ""
+	as.revokeSessions(userID)
+	return nil
+}
+
+// DeleteAccount removes an account and its pending codes and sessions
+func (as *AuthService) DeleteAccount(userID string) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if account, exists := as.accounts[userID]; exists {
+		delete(as.byEmail, account.Email)
+		delete(as.accounts, userID)
+	}
+	delete(as.codes, userID)
+	as.revokeSessions(userID)
+}
+
+// revokeSessions revokes every refresh token of an account. Must be called
+// with the mutex held.
+func (as *AuthService) revokeSessions(userID string) {
+	for id, session := range as.refreshTokens {
+		if session.userID == userID {
+			delete(as.refreshTokens, id)
+		}
+	}
+}
+
+// GetAccount returns a user account
+func (as *AuthService) GetAccount(userID string) (UserAccount, error) {
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	account, exists := as.accounts[userID]
+	if !exists {
+		return UserAccount{}, errors.New("account not found")
+	}
+	return *account, nil
+}
+
+// Login checks an account's credentials and issues a token pair
+func (as *AuthService) Login(email, password string) (TokenPair, error) {
+	as.mutex.Lock()
+	userID, exists := as.byEmail[normalizeEmail(email)]
+	hash := dummyPasswordHash()
+	if exists {
+		hash = as.accounts[userID].PasswordHash
+	}
+	as.mutex.Unlock()
+
+	// The hash is compared outside the lock, and against a dummy hash for
+	// unknown emails so they take as long to reject as wrong passwords
+	if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil || !exists {
+		return TokenPair{}, errors.New("invalid email or password")
+	}
+
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	// The account may have been deleted or its password changed meanwhile
+	account, exists := as.accounts[userID]
+	if !exists || subtle.ConstantTimeCompare(account.PasswordHash, hash) != 1 {
+		return TokenPair{}, errors.New("invalid email or password")
+	}
+	if !account.EmailVerified {
+		return TokenPair{}, errors.New("email address not verified")
+	}
+	return as.issueTokens(account)
+}
+
+var (
+	dummyHashOnce sync.Once
+	dummyHash     []byte
+)
+
+// dummyPasswordHash returns a bcrypt hash at the registration cost that no
+// password is checked against successfully
+func dummyPasswordHash() []byte {
+	dummyHashOnce.Do(func() {
+		secret := make([]byte, 32)
+		rand.Read(secret)
+		dummyHash, _ = bcrypt.GenerateFromPassword([]byte(base64.StdEncoding.EncodeToString(secret)), bcrypt.DefaultCost)
+	})
+	return dummyHash
+}
+
+// Refresh exchanges a refresh token for a new token pair. Each refresh token
+// can be used once.
+func (as *AuthService) Refresh(refreshToken string) (TokenPair, error) {
+	claims, err := as.parseToken(refreshToken, refreshTokenType)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+
+	if _, active := as.refreshTokens[claims.ID]; !active {
+		return TokenPair{}, errors.New("refresh token revoked")
+	}
+	delete(as.refreshTokens, claims.ID)
+	account, exists := as.accounts[claims.Subject]
+	if !exists {
+		return TokenPair{}, errors.New("account not found")
+	}
+	return as.issueTokens(account)
+}
+
+// Logout revokes a refresh token
+func (as *AuthService) Logout(refreshToken string) error {
+	claims, err := as.parseToken(refreshToken, refreshTokenType)
+	if err != nil {
+		return err
+	}
+	as.mutex.Lock()
+	defer as.mutex.Unlock()
+	delete(as.refreshTokens, claims.ID)
+	return nil
+}
+
+// issueTokens signs an access and refresh token for an account. Must be
+// called with the mutex held.
+func (as *AuthService) issueTokens(account *UserAccount) (TokenPair, error) {
+	now := time.Now()
+	claims := tokenClaims{
+		Subject:       account.ID,
+		Email:         account.Email,
+		ParticipantID: account.ParticipantID,
+		Type:          accessTokenType,
+		ID:            uuid.New().String(),
+		IssuedAt:      now.Unix(),
+		ExpiresAt:     now.Add(as.accessTTL).Unix(),
+	}
+	access, err := as.signToken(claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+
+	claims.Type = refreshTokenType
+	claims.ID = uuid.New().String()
+	claims.ExpiresAt = now.Add(as.refreshTTL).Unix()
+	refresh, err := as.signToken(claims)
+	if err != nil {
+		return TokenPair{}, err
+	}
+	as.refreshTokens[claims.ID] = refreshSession{userID: account.ID, expiresAt: now.Add(as.refreshTTL)}
+
+	// Drop expired refresh sessions
+	for id, session := range as.refreshTokens {
+		if now.After(session.expiresAt) {
+			delete(as.refreshTokens, id)
+		}
+	}
+	return TokenPair{
+		AccessToken:  access,
+		RefreshToken: refresh,
+		ExpiresAt:    now.Add(as.accessTTL),
+	}, nil
+}
+
+// jwtHeader is the fixed header for HS256 tokens
+var jwtHeader = base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+
+// signToken encodes and signs claims as an HS256 JWT
+func (as *AuthService) signToken(claims tokenClaims) (string, error) {
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := jwtHeader + "." + base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, as.signingKey)
+	mac.Write([]byte(signingInput))
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// parseToken verifies a JWT's signature, expiry and type and returns its claims
+func (as *AuthService) parseToken(token, tokenType string) (tokenClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 || parts[0] != jwtHeader {
+		return tokenClaims{}, errors.New("malformed token")
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return tokenClaims{}, errors.New("malformed token")
+	}
+	mac := hmac.New(sha256.New, as.signingKey)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return tokenClaims{}, errors.New("invalid token signature")
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return tokenClaims{}, errors.New("malformed token")
+	}
+	var claims tokenClaims
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return tokenClaims{}, errors.New("malformed token")
+	}
+	if claims.Type != tokenType {
+		return tokenClaims{}, errors.New("wrong token type")
+	}
+	if time.Now().Unix() >= claims.ExpiresAt {
+		return tokenClaims{}, errors.New("token expired")
+	}
+	return claims, nil
+}
+
+// Authenticate validates an access token and returns its principal
+func (as *AuthService) Authenticate(accessToken string) (Principal, error) {
+	claims, err := as.parseToken(accessToken, accessTokenType)
+	if err != nil {
+		return Principal{}, err
+	}
+	return Principal{
+		UserID:        claims.Subject,
+		Email:         claims.Email,
+		ParticipantID: claims.ParticipantID,
+	}, nil
+}
+
+// principalKey is the request context key for the authenticated Principal
+type principalKey struct{}
+
+// PrincipalFromContext returns the authenticated principal of a request
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// authPublicPrefixes are paths served without authentication
+var authPublicPrefixes = []string{"/auth/", "/docs"}
+
+// Middleware requires a valid bearer access token on every request outside
+// the public paths and attaches the caller's Principal to the request context
+func (as *AuthService) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, prefix := range authPublicPrefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" || token == r.Header.Get("Authorization") {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		}
+		principal, err := as.Authenticate(token)
+		if err != nil {
+			http.Error(w, "Invalid token: "+err.Error(), http.StatusUnauthorized)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), principalKey{}, principal)))
+	})
+}
+
+// actingParticipant resolves the participant a request acts for. When the
+// request is authenticated this is always the caller's own participant and a
+// different ID in the request is refused. With organizations enabled the
+// participant is the one the caller's organization owns, and the caller's
+// roles must grant perm.
+func actingParticipant(r *http.Request, orgs *OrganizationService, claimed string, perm Permission) (string, error) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok {
+		return claimed, nil
+	}
+	participantID := principal.ParticipantID
+	if orgs != nil {
+		var err error
+		participantID, err = orgs.Authorize(principal.UserID, perm)
+		if err != nil {
+			return "", err
+		}
+	}
+	if participantID == "" {
+		return "", errors.New("account is not linked to a participant")
+	}
+	if claimed != "" && claimed != participantID {
+		return "", errors.New("cannot act on behalf of another participant")
+	}
+	return participantID, nil
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// captureSender records verification codes instead of emailing them
+type captureSender struct {
+	codes map[string]string
+}
+
+func (cs *captureSender) SendVerificationCode(email, code string) error {
+	cs.codes[email] = code
+	return nil
+}
+
+func newTestAuthService(t *testing.T) (*AuthService, *captureSender) {
+	sender := &captureSender{codes: make(map[string]string)}
+	auth, err := NewAuthService([]byte(strings.Repeat("k", 32)), sender)
+	if err != nil {
+		t.Fatalf("NewAuthService failed: %v", err)
+	}
+	return auth, sender
+}
+
+func TestAuthService_RegisterVerifyLogin(t *testing.T) {
+	auth, sender := newTestAuthService(t)
+
+	if _, err := auth.Register("user@example.com", "short"); err == nil {
+		t.Errorf("Expected error for short password")
+	}
+	account, err := auth.Register("User@Example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Register failed: %v", err)
+	}
+	if _, err := auth.Register("user@example.com", "another password"); err == nil {
+		t.Errorf("Expected error for duplicate email")
+	}
+	if _, err := auth.Login("user@example.com", "correct horse"); err == nil {
+		t.Errorf("Expected login to fail before email verification")
+	}
+
+	if err := auth.VerifyEmail("user@example.com", "not-the-code"); err == nil {
+		t.Errorf("Expected error for wrong verification code")
+	}
+	if err := auth.VerifyEmail("user@example.com", sender.codes["user@example.com"]); err != nil {
+		t.Fatalf("VerifyEmail failed: %v", err)
+	}
+	auth.LinkParticipant(account.ID, "participant1")
+
+	if _, err := auth.Login("user@example.com", "wrong password"); err == nil {
+		t.Errorf("Expected login to fail with wrong password")
+	}
+	if _, err := auth.Login("nobody@example.com", "correct horse"); err == nil || err.Error() != "invalid email or password" {
+		t.Errorf("Expected an unknown email to fail like a wrong password, got %v", err)
+	}
+	tokens, err := auth.Login("user@example.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	principal, err := auth.Authenticate(tokens.AccessToken)
+	if err != nil {
+		t.Fatalf("Authenticate failed: %v", err)
+	}
+	if principal.UserID != account.ID || principal.ParticipantID != "participant1" {
+		t.Errorf("Unexpected principal %+v", principal)
+	}
+	if _, err := auth.Authenticate(tokens.RefreshToken); err == nil {
+		t.Errorf("Refresh token should not be accepted as an access token")
+	}
+	if _, err := auth.Authenticate(tokens.AccessToken + "x"); err == nil {
+		t.Errorf("Expected tampered token to be rejected")
+	}
+
+	// Refresh tokens rotate and cannot be reused
+	refreshed, err := auth.Refresh(tokens.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh failed: %v", err)
+	}
+	if _, err := auth.Refresh(tokens.RefreshToken); err == nil {
+		t.Errorf("Expected reused refresh token to be rejected")
+	}
+	if err := auth.Logout(refreshed.RefreshToken); err != nil {
+		t.Fatalf("Logout failed: %v", err)
+	}
+	if _, err := auth.Refresh(refreshed.RefreshToken); err == nil {
+		t.Errorf("Expected logged out refresh token to be rejected")
+	}
+}
+
+func TestAuthService_MiddlewareAttachesPrincipal(t *testing.T) {
+	auth, sender := newTestAuthService(t)
+	marketplace := NewMarketplace(NewBlockchain())
+	router := SetupRouter(marketplace, nil, auth)
+
+	post := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := post("/auth/register", "", map[string]string{
+		"email": "carrier@example.com", "password": "correct horse", "name": "Carrier1", "type": "Carrier",
+	})
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Register returned %d: %s", rr.Code, rr.Body.String())
+	}
+	post("/auth/verify-email", "", map[string]string{"email": "carrier@example.com", "code": sender.codes["carrier@example.com"]})
+	rr = post("/auth/login", "", map[string]string{"email": "carrier@example.com", "password": "correct horse"})
+	var tokens TokenPair
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Login returned %d: %v", rr.Code, err)
+	}
+
+	if rr := post("/bids", "", map[string]interface{}{"quote_id": "q1"}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without token, got %d", rr.Code)
+	}
+	if rr := post("/bids", tokens.AccessToken, map[string]interface{}{"quote_id": "q1", "carrier_id": "someone-else"}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 acting for another participant, got %d", rr.Code)
+	}
+	// Authenticated and acting for itself, the bid reaches the marketplace
+	rr = post("/bids", tokens.AccessToken, map[string]interface{}{"quote_id": "q1", "bid_amount": 100})
+	if rr.Code != http.StatusBadRequest || !strings.Contains(rr.Body.String(), "quote not found") {
+		t.Errorf("Expected marketplace error for unknown quote, got %d: %s", rr.Code, rr.Body.String())
+	}
+}
+
+func TestSetupRouter_AdminRoutesResolveCaller(t *testing.T) {
+	auth, sender := newTestAuthService(t)
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.SmartContract = NewSmartContract(marketplace)
+	router := SetupRouter(marketplace, nil, auth)
+
+	post := func(path, token string, body interface{}) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(body)
+		req := httptest.NewRequest("POST", path, bytes.NewReader(data))
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	post("/auth/register", "", map[string]string{
+		"email": "ops@example.com", "password": "correct horse", "name": "Ops", "type": "Shipper",
+	})
+	post("/auth/verify-email", "", map[string]string{"email": "ops@example.com", "code": sender.codes["ops@example.com"]})
+	rr := post("/auth/login", "", map[string]string{"email": "ops@example.com", "password": "correct horse"})
+	var tokens TokenPair
+	if err := json.NewDecoder(rr.Body).Decode(&tokens); err != nil || tokens.AccessToken == "" {
+		t.Fatalf("Login returned %d: %v", rr.Code, err)
+	}
+	principal, _ := auth.Authenticate(tokens.AccessToken)
+	participantID := principal.ParticipantID
+
+	// A body naming a participant does not make the caller an admin
+	if rr := post("/tokens/mint", tokens.AccessToken, map[string]interface{}{"participant_id": participantID, "token_id": "TOKEN1", "amount": 100}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 minting without the Admin role, got %d", rr.Code)
+	}
+	if rr := post("/roles/assign", tokens.AccessToken, map[string]string{"user_id": participantID, "role": "Admin"}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 self-assigning Admin, got %d", rr.Code)
+	}
+	if rr := post("/escrow/release", tokens.AccessToken, map[string]interface{}{"participant_id": participantID, "token_id": "TOKEN1", "amount": 1}); rr.Code != http.StatusForbidden {
+		t.Errorf("Expected 403 releasing escrow without the Admin role, got %d", rr.Code)
+	}
+	if rr := post("/tokens/mint", "", map[string]interface{}{"participant_id": participantID, "amount": 100}); rr.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 minting unauthenticated, got %d", rr.Code)
+	}
+
+	marketplace.AccessControl.AssignRole(participantID, AdminRole)
+	if rr := post("/tokens/mint", tokens.AccessToken, map[string]interface{}{"participant_id": "carrier-1", "token_id": "TOKEN1", "amount": 100}); rr.Code != http.StatusOK {
+		t.Errorf("Expected an admin to mint, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if balance := marketplace.SmartContract.TokenLedger.GetBalance("carrier-1", "TOKEN1"); balance != 100 {
+		t.Errorf("Expected 100 minted to the named recipient, got %f", balance)
+	}
+}
+
+func TestNewAuthService_RequiresSender(t *testing.T) {
+	if _, err := NewAuthService([]byte(strings.Repeat("k", 32)), nil); err == nil {
+		t.Errorf("Expected a missing code sender to be rejected")
+	}
+}
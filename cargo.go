@@ -0,0 +1,138 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// RateUnit is the unit a quote's rate is expressed per
+type RateUnit string
+
+const (
+	PerShipment     RateUnit = "shipment"
+	PerKilogram     RateUnit = "kg"  // air chargeable weight
+	PerRevenueTon   RateUnit = "W/M" // sea weight or measure, per ton or CBM
+	PerLoadingMeter RateUnit = "LDM" // road trailer length
+)
+
+const (
+	// airVolumetricDivisor converts cubic centimetres to volumetric kilograms (IATA 1:6000)
+	airVolumetricDivisor = 6000.0
+	// seaKgPerCBM is the W/M ratio: one CBM is charged as one metric ton
+	seaKgPerCBM = 1000.0
+	// trailerWidthM and trailerHeightM are the internal dimensions of a standard semi-trailer
+	trailerWidthM  = 2.4
+	trailerHeightM = 2.7
+	// roadKgPerLDM is the weight one loading metre is charged as
+	roadKgPerLDM = 1850.0
+)
+
+// CargoLineItem is a group of identical pieces in a shipment
+type CargoLineItem struct {
+	Description   string  `json:"description,omitempty"`
+	Pieces        int     `json:"pieces"`
+	GrossWeightKg float64 `json:"gross_weight_kg"` // total for all pieces on the line
+	LengthCm      float64 `json:"length_cm"`       // per piece
+	WidthCm       float64 `json:"width_cm"`
+	HeightCm      float64 `json:"height_cm"`
+	Stackable     bool    `json:"stackable,omitempty"`
+}
+
+// VolumeCBM returns the line's volume in cubic metres
+func (item CargoLineItem) VolumeCBM() float64 {
+	return float64(item.Pieces) * item.LengthCm * item.WidthCm * item.HeightCm / 1e6
+}
+
+// LoadingMeters returns the trailer length the line occupies. Stackable pieces
+// are stacked as high as the trailer allows.
+func (item CargoLineItem) LoadingMeters() float64 {
+	perStack := 1
+	if item.Stackable && item.HeightCm > 0 {
+		perStack = int(math.Max(1, math.Floor(trailerHeightM*100/item.HeightCm)))
+	}
+	stacks := math.Ceil(float64(item.Pieces) / float64(perStack))
+	return stacks * (item.LengthCm / 100) * (item.WidthCm / 100) / trailerWidthM
+}
+
+// ChargeableMeasure is the quantity a shipment is priced on
+type ChargeableMeasure struct {
+	Pieces             int      `json:"pieces"`
+	GrossWeightKg      float64  `json:"gross_weight_kg"`
+	VolumeCBM          float64  `json:"volume_cbm"`
+	LoadingMeters      float64  `json:"loading_meters,omitempty"`
+	ChargeableWeightKg float64  `json:"chargeable_weight_kg"`
+	Quantity           float64  `json:"quantity"` // chargeable quantity in Unit
+	Unit               RateUnit `json:"unit"`
+}
+
+// ValidateCargoItems checks the quote's cargo line items
+func ValidateCargoItems(items []CargoLineItem) error {
+	for i, item := range items {
+		if item.Pieces <= 0 {
+			return fmt.Errorf("line %d: pieces must be positive", i+1)
+		}
+		if item.GrossWeightKg <= 0 {
+			return fmt.Errorf("line %d: gross weight must be positive", i+1)
+		}
+		if item.LengthCm <= 0 || item.WidthCm <= 0 || item.HeightCm <= 0 {
+			return fmt.Errorf("line %d: dimensions must be positive", i+1)
+		}
+	}
+	return nil
+}
+
+// ChargeableFor computes the chargeable measure of cargo line items under the
+// mode's rules: air volumetric weight at 1:6000, sea W/M and road loading metres
+func ChargeableFor(mode TransportationMode, items []CargoLineItem) (ChargeableMeasure, error) {
+	if len(items) == 0 {
+		return ChargeableMeasure{Quantity: 1, Unit: PerShipment}, nil
+	}
+	if err := ValidateCargoItems(items); err != nil {
+		return ChargeableMeasure{}, err
+	}
+
+	measure := ChargeableMeasure{}
+	volumeCm3 := 0.0
+	for _, item := range items {
+		measure.Pieces += item.Pieces
+		measure.GrossWeightKg += item.GrossWeightKg
+		volumeCm3 += float64(item.Pieces) * item.LengthCm * item.WidthCm * item.HeightCm
+		measure.LoadingMeters += item.LoadingMeters()
+	}
+	measure.VolumeCBM = roundMeasure(volumeCm3 / 1e6)
+	measure.GrossWeightKg = roundMeasure(measure.GrossWeightKg)
+
+	switch mode {
+	case Air:
+		// IATA rounds chargeable weight up to the next half kilogram
+		weight := math.Max(measure.GrossWeightKg, volumeCm3/airVolumetricDivisor)
+		measure.ChargeableWeightKg = math.Ceil(weight*2) / 2
+		measure.LoadingMeters = 0
+		measure.Quantity, measure.Unit = measure.ChargeableWeightKg, PerKilogram
+	case Sea, Rail:
+		// Rail groupage is charged weight or measure like sea
+		revenueTons := math.Max(measure.GrossWeightKg/seaKgPerCBM, volumeCm3/1e6)
+		measure.ChargeableWeightKg = roundMeasure(revenueTons * seaKgPerCBM)
+		measure.LoadingMeters = 0
+		measure.Quantity, measure.Unit = roundMeasure(revenueTons), PerRevenueTon
+	case Land, Road:
+		measure.LoadingMeters = roundMeasure(measure.LoadingMeters)
+		measure.ChargeableWeightKg = roundMeasure(math.Max(measure.GrossWeightKg, measure.LoadingMeters*roadKgPerLDM))
+		// Dense loads are charged the loading metres their weight is worth
+		measure.Quantity, measure.Unit = roundMeasure(measure.ChargeableWeightKg/roadKgPerLDM), PerLoadingMeter
+	case Multimodal:
+		// Each leg is priced by its own carrier's bid; the route is one shipment
+		measure.LoadingMeters = 0
+		measure.ChargeableWeightKg = measure.GrossWeightKg
+		measure.Quantity, measure.Unit = 1, PerShipment
+	default:
+		return ChargeableMeasure{}, errors.New("no chargeable weight rules for mode " + string(mode))
+	}
+	return measure, nil
+}
+
+// roundMeasure rounds a weight or volume to three decimal places
+func roundMeasure(value float64) float64 {
+	return math.Round(value*1000) / 1000
+}
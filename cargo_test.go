@@ -0,0 +1,76 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestChargeableFor(t *testing.T) {
+	// Two light, bulky cartons of 60x50x40 cm
+	bulky := []CargoLineItem{{Pieces: 2, GrossWeightKg: 20, LengthCm: 60, WidthCm: 50, HeightCm: 40}}
+	// Four dense, non-stackable euro pallets of 120x80x100 cm
+	pallets := []CargoLineItem{{Pieces: 4, GrossWeightKg: 3200, LengthCm: 120, WidthCm: 80, HeightCm: 100}}
+
+	tests := []struct {
+		name       string
+		mode       TransportationMode
+		items      []CargoLineItem
+		quantity   float64
+		unit       RateUnit
+		chargeable float64
+	}{
+		{"air volumetric", Air, bulky, 40, PerKilogram, 40},                // 240000 cm3 / 6000
+		{"air actual", Air, pallets, 3200, PerKilogram, 3200},              // 3.84 CBM is 640 kg volumetric
+		{"sea measure", Sea, bulky, 0.24, PerRevenueTon, 240},              // 0.24 CBM beats 0.02 t
+		{"sea weight", Sea, pallets, 3.84, PerRevenueTon, 3840},            // 3.84 CBM beats 3.2 t
+		{"road loading metres", Road, bulky, 0.25, PerLoadingMeter, 462.5}, // 2 x 0.3 m2 / 2.4 m
+		{"road dense load", Land, pallets, 1.73, PerLoadingMeter, 3200},    // 1.6 LDM carries 2960 kg
+		{"no line items", Sea, nil, 1, PerShipment, 0},
+	}
+	for _, tt := range tests {
+		measure, err := ChargeableFor(tt.mode, tt.items)
+		if err != nil {
+			t.Fatalf("%s: ChargeableFor failed: %v", tt.name, err)
+		}
+		if measure.Quantity != tt.quantity || measure.Unit != tt.unit || measure.ChargeableWeightKg != tt.chargeable {
+			t.Errorf("%s: expected %v %s (%v kg), got %+v", tt.name, tt.quantity, tt.unit, tt.chargeable, measure)
+		}
+	}
+
+	// Air chargeable weight rounds up to the next half kilogram
+	measure, _ := ChargeableFor(Air, []CargoLineItem{{Pieces: 1, GrossWeightKg: 10.2, LengthCm: 10, WidthCm: 10, HeightCm: 10}})
+	if measure.ChargeableWeightKg != 10.5 {
+		t.Errorf("Expected 10.5 kg chargeable, got %v", measure.ChargeableWeightKg)
+	}
+	// Stacking the pallets two high halves the trailer length they take
+	stacked := []CargoLineItem{pallets[0]}
+	stacked[0].Stackable = true
+	if measure, _ := ChargeableFor(Land, stacked); measure.LoadingMeters != 0.8 {
+		t.Errorf("Expected 0.8 LDM for stacked pallets, got %v", measure.LoadingMeters)
+	}
+	if _, err := ChargeableFor(Air, []CargoLineItem{{Pieces: 1, GrossWeightKg: 10}}); err == nil {
+		t.Errorf("Expected error for line items without dimensions")
+	}
+}
+
+func TestMarketplace_QuoteTotalsFromChargeableWeight(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	cargo := CargoDetails{Items: []CargoLineItem{
+		{Description: "cartons", Pieces: 10, GrossWeightKg: 150, LengthCm: 50, WidthCm: 40, HeightCm: 30},
+		{Description: "crate", Pieces: 1, GrossWeightKg: 90, LengthCm: 100, WidthCm: 80, HeightCm: 60},
+	}}
+	quote, err := marketplace.CreateFreightQuoteWithCargo(shipper.ID, Export, GeneralCargo, Loose, "JFK", "LHR", Air, 2.5, "USD", time.Now().Add(24*time.Hour), cargo)
+	if err != nil {
+		t.Fatalf("CreateFreightQuoteWithCargo failed: %v", err)
+	}
+	// 0.6 + 0.48 CBM is 180 kg volumetric against 240 kg actual
+	if quote.RateUnit != PerKilogram || quote.Chargeable.ChargeableWeightKg != 240 || quote.Total != 600 {
+		t.Errorf("Unexpected pricing: %s %+v total %.2f", quote.RateUnit, quote.Chargeable, quote.Total)
+	}
+
+	flat, _ := marketplace.CreateFreightQuote(shipper.ID, Export, GeneralCargo, Loose, "JFK", "LHR", Air, 1200, "USD", time.Now().Add(24*time.Hour))
+	if flat.RateUnit != PerShipment || flat.Total != 1200 {
+		t.Errorf("Expected a per-shipment rate without line items, got %s total %.2f", flat.RateUnit, flat.Total)
+	}
+}
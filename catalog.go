@@ -0,0 +1,294 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// subCategoryItems lists every service the marketplace offers, in catalog order
+var subCategoryItems = []SubCategoryItem{
+	ImportAirContainerGeneralCargo, ImportAirLooseGeneralCargo, ImportAirPalletGeneralCargo,
+	ImportAirContainerHazardousCargo, ImportAirLooseHazardousCargo, ImportAirPalletHazardousCargo,
+	ImportAirContainerBulkCargo, ImportAirLooseBulkCargo, ImportAirPalletBulkCargo, ImportAirContainerLiveCargo,
+	ImportAirLooseLiveCargo, ImportAirPalletLiveCargo, ImportAirContainerLiquidCargo, ImportAirLooseLiquidCargo,
+	ImportAirPalletLiquidCargo,
+
+	ImportSeaContainerGeneralCargo, ImportSeaLooseGeneralCargo, ImportSeaPalletGeneralCargo,
+	ImportSeaContainerHazardousCargo, ImportSeaLooseHazardousCargo, ImportSeaPalletHazardousCargo,
+	ImportSeaContainerBulkCargo, ImportSeaLooseBulkCargo, ImportSeaPalletBulkCargo, ImportSeaContainerLCLcargo,
+	ImportSeaLooseLCLcargo, ImportSeaPalletLCLcargo, ImportSeaContainerLiveCargo, ImportSeaLooseLiveCargo,
+	ImportSeaPalletLiveCargo, ImportSeaContainerLiquidCargo, ImportSeaLooseLiquidCargo,
+	ImportSeaPalletLiquidCargo,
+
+	ImportLandContainerGeneralCargo, ImportLandLooseGeneralCargo, ImportLandPalletGeneralCargo,
+	ImportLandContainerHazardousCargo, ImportLandLooseHazardousCargo, ImportLandPalletHazardousCargo,
+	ImportLandContainerBulkCargo, ImportLandLooseBulkCargo, ImportLandPalletBulkCargo,
+	ImportLandContainerLCLcargo, ImportLandLooseLCLcargo, ImportLandPalletLCLcargo,
+	ImportLandContainerLiveCargo, ImportLandLooseLiveCargo, ImportLandPalletLiveCargo,
+	ImportLandContainerLiquidCargo, ImportLandLooseLiquidCargo, ImportLandPalletLiquidCargo,
+
+	ExportAirContainerGeneralCargo, ExportAirLooseGeneralCargo, ExportAirPalletGeneralCargo,
+	ExportAirContainerHazardousCargo, ExportAirLooseHazardousCargo, ExportAirPalletHazardousCargo,
+	ExportAirContainerBulkCargo, ExportAirLooseBulkCargo, ExportAirPalletBulkCargo, ExportAirContainerLiveCargo,
+	ExportAirLooseLiveCargo, ExportAirPalletLiveCargo, ExportAirContainerLiquidCargo, ExportAirLooseLiquidCargo,
+	ExportAirPalletLiquidCargo,
+
+	ExportSeaContainerGeneralCargo, ExportSeaLooseGeneralCargo, ExportSeaPalletGeneralCargo,
+	ExportSeaContainerHazardousCargo, ExportSeaLooseHazardousCargo, ExportSeaPalletHazardousCargo,
+	ExportSeaContainerBulkCargo, ExportSeaLooseBulkCargo, ExportSeaPalletBulkCargo, ExportSeaContainerLCLcargo,
+	ExportSeaLooseLCLcargo, ExportSeaPalletLCLcargo, ExportSeaContainerLiveCargo, ExportSeaLooseLiveCargo,
+	ExportSeaPalletLiveCargo, ExportSeaContainerLiquidCargo, ExportSeaLooseLiquidCargo,
+	ExportSeaPalletLiquidCargo,
+
+	ExportLandContainerGeneralCargo, ExportLandLooseGeneralCargo, ExportLandPalletGeneralCargo,
+	ExportLandContainerHazardousCargo, ExportLandLooseHazardousCargo, ExportLandPalletHazardousCargo,
+	ExportLandContainerBulkCargo, ExportLandLooseBulkCargo, ExportLandPalletBulkCargo,
+	ExportLandContainerLCLcargo, ExportLandLooseLCLcargo, ExportLandPalletLCLcargo,
+	ExportLandContainerLiveCargo, ExportLandLooseLiveCargo, ExportLandPalletLiveCargo,
+	ExportLandContainerLiquidCargo, ExportLandLooseLiquidCargo, ExportLandPalletLiquidCargo,
+
+	TransitAirContainerGeneralCargo, TransitAirLooseGeneralCargo, TransitAirPalletGeneralCargo,
+	TransitAirContainerHazardousCargo, TransitAirLooseHazardousCargo, TransitAirPalletHazardousCargo,
+	TransitAirContainerBulkCargo, TransitAirLooseBulkCargo, TransitAirPalletBulkCargo,
+	TransitAirContainerLiveCargo, TransitAirLooseLiveCargo, TransitAirPalletLiveCargo,
+	TransitAirContainerLiquidCargo, TransitAirLooseLiquidCargo, TransitAirPalletLiquidCargo,
+
+	TransitSeaContainerGeneralCargo, TransitSeaLooseGeneralCargo, TransitSeaPalletGeneralCargo,
+	TransitSeaContainerHazardousCargo, TransitSeaLooseHazardousCargo, TransitSeaPalletHazardousCargo,
+	TransitSeaContainerBulkCargo, TransitSeaLooseBulkCargo, TransitSeaPalletBulkCargo,
+	TransitSeaContainerLCLcargo, TransitSeaLooseLCLcargo, TransitSeaPalletLCLcargo,
+	TransitSeaContainerLiveCargo, TransitSeaLooseLiveCargo, TransitSeaPalletLiveCargo,
+	TransitSeaContainerLiquidCargo, TransitSeaLooseLiquidCargo, TransitSeaPalletLiquidCargo,
+
+	TransshipmentAirContainerGeneralCargo, TransshipmentAirLooseGeneralCargo,
+	TransshipmentAirPalletGeneralCargo, TransshipmentAirContainerHazardousCargo,
+	TransshipmentAirLooseHazardousCargo, TransshipmentAirPalletHazardousCargo,
+	TransshipmentAirContainerBulkCargo, TransshipmentAirLooseBulkCargo, TransshipmentAirPalletBulkCargo,
+	TransshipmentAirContainerLiveCargo, TransshipmentAirLooseLiveCargo, TransshipmentAirPalletLiveCargo,
+	TransshipmentAirContainerLiquidCargo, TransshipmentAirLooseLiquidCargo, TransshipmentAirPalletLiquidCargo,
+
+	TransshipmentSeaContainerGeneralCargo, TransshipmentSeaLooseGeneralCargo,
+	TransshipmentSeaPalletGeneralCargo, TransshipmentSeaContainerHazardousCargo,
+	TransshipmentSeaLooseHazardousCargo, TransshipmentSeaPalletHazardousCargo,
+	TransshipmentSeaContainerBulkCargo, TransshipmentSeaLooseBulkCargo, TransshipmentSeaPalletBulkCargo,
+	TransshipmentSeaContainerLCLcargo, TransshipmentSeaLooseLCLcargo, TransshipmentSeaPalletLCLcargo,
+	TransshipmentSeaContainerLiveCargo, TransshipmentSeaLooseLiveCargo, TransshipmentSeaPalletLiveCargo,
+	TransshipmentSeaContainerLiquidCargo, TransshipmentSeaLooseLiquidCargo, TransshipmentSeaPalletLiquidCargo,
+
+	TransshipmentLandContainerGeneralCargo, TransshipmentLandLooseGeneralCargo,
+	TransshipmentLandPalletGeneralCargo, TransshipmentLandContainerHazardousCargo,
+	TransshipmentLandLooseHazardousCargo, TransshipmentLandPalletHazardousCargo,
+	TransshipmentLandContainerBulkCargo, TransshipmentLandLooseBulkCargo, TransshipmentLandPalletBulkCargo,
+	TransshipmentLandContainerLCLcargo, TransshipmentLandLooseLCLcargo, TransshipmentLandPalletLCLcargo,
+	TransshipmentLandContainerLiveCargo, TransshipmentLandLooseLiveCargo, TransshipmentLandPalletLiveCargo,
+	TransshipmentLandContainerLiquidCargo, TransshipmentLandLooseLiquidCargo,
+	TransshipmentLandPalletLiquidCargo,
+}
+
+// cargoClassTypes maps the cargo class ending a catalog item name to the
+// quote cargo types it serves
+var cargoClassTypes = map[string][]CargoType{
+	"GeneralCargo":   {GeneralCargo, Perishable, Fragile},
+	"HazardousCargo": {Hazardous},
+	"BulkCargo":      {BulkCargo},
+	"LCLcargo":       {LCLCargo},
+	"LiveCargo":      {LiveCargo},
+	"LiquidCargo":    {LiquidCargo},
+}
+
+// CatalogItem is one service in the catalog: a category, mode, packaging and
+// cargo combination carriers can serve and shippers can quote
+type CatalogItem struct {
+	Item            SubCategoryItem    `json:"item"`
+	ServiceCategory ServiceCategory    `json:"service_category"`
+	SubCategory     SubCategory        `json:"sub_category"`
+	Mode            TransportationMode `json:"mode"` // Air, Sea or Land; Land also covers Road and Rail
+	PackagingMode   PackagingMode      `json:"packaging_mode"`
+	CargoClass      string             `json:"cargo_class"`
+	CargoTypes      []CargoType        `json:"cargo_types"`
+}
+
+// CatalogFilter narrows catalog items; empty fields match any value
+type CatalogFilter struct {
+	ServiceCategory ServiceCategory
+	Mode            TransportationMode
+	PackagingMode   PackagingMode
+	CargoType       CargoType
+}
+
+// ServiceCatalog is the catalog of services derived from the SubCategoryItem
+// enumeration
+type ServiceCatalog struct {
+	items  []CatalogItem
+	byItem map[SubCategoryItem]CatalogItem
+}
+
+// NewServiceCatalog builds a catalog from item names of the form
+// <category><mode><packaging><cargo class>, e.g. ImportAirPalletGeneralCargo
+func NewServiceCatalog(items []SubCategoryItem) (*ServiceCatalog, error) {
+	catalog := &ServiceCatalog{byItem: make(map[SubCategoryItem]CatalogItem)}
+	for _, item := range items {
+		entry, err := parseCatalogItem(item)
+		if err != nil {
+			return nil, err
+		}
+		if _, exists := catalog.byItem[item]; exists {
+			return nil, errors.New("duplicate catalog item " + string(item))
+		}
+		catalog.items = append(catalog.items, entry)
+		catalog.byItem[item] = entry
+	}
+	return catalog, nil
+}
+
+var (
+	defaultCatalog     *ServiceCatalog
+	defaultCatalogOnce sync.Once
+)
+
+// Catalog returns the shared service catalog
+func Catalog() *ServiceCatalog {
+	defaultCatalogOnce.Do(func() {
+		catalog, err := NewServiceCatalog(subCategoryItems)
+		if err != nil {
+			log.Fatalf("Invalid service catalog: %v", err)
+		}
+		defaultCatalog = catalog
+	})
+	return defaultCatalog
+}
+
+// parseCatalogItem splits an item name into its category, mode, packaging
+// and cargo class
+func parseCatalogItem(item SubCategoryItem) (CatalogItem, error) {
+	rest := string(item)
+	entry := CatalogItem{Item: item}
+	for _, category := range []ServiceCategory{Transshipment, Transit, Import, Export} {
+		if strings.HasPrefix(rest, string(category)) {
+			entry.ServiceCategory, rest = category, strings.TrimPrefix(rest, string(category))
+			break
+		}
+	}
+	for _, mode := range []TransportationMode{Air, Sea, Land} {
+		if strings.HasPrefix(rest, string(mode)) {
+			entry.Mode, rest = mode, strings.TrimPrefix(rest, string(mode))
+			break
+		}
+	}
+	for _, packaging := range []PackagingMode{Container, Loose, Pallet} {
+		if strings.HasPrefix(rest, string(packaging)) {
+			entry.PackagingMode, rest = packaging, strings.TrimPrefix(rest, string(packaging))
+			break
+		}
+	}
+	entry.CargoClass, entry.CargoTypes = rest, cargoClassTypes[rest]
+	if entry.ServiceCategory == "" || entry.Mode == "" || entry.PackagingMode == "" || entry.CargoTypes == nil {
+		return CatalogItem{}, errors.New("malformed catalog item " + string(item))
+	}
+	entry.SubCategory = SubCategory(string(entry.ServiceCategory) + string(entry.Mode))
+	return entry, nil
+}
+
+// catalogMode is the catalog mode a transportation mode is offered under
+func catalogMode(mode TransportationMode) TransportationMode {
+	if IsLandMode(mode) {
+		return Land
+	}
+	return mode
+}
+
+// Item returns a catalog item by name
+func (sc *ServiceCatalog) Item(item SubCategoryItem) (CatalogItem, bool) {
+	entry, ok := sc.byItem[item]
+	return entry, ok
+}
+
+// Find returns the catalog item a quote combination falls under, or an error
+// when the marketplace offers no such service
+func (sc *ServiceCatalog) Find(category ServiceCategory, mode TransportationMode, packaging PackagingMode, cargoType CargoType) (CatalogItem, error) {
+	if category == "" || mode == "" || packaging == "" || cargoType == "" {
+		return CatalogItem{}, errors.New("service category, mode, packaging and cargo type are required")
+	}
+	for _, entry := range sc.items {
+		if entry.matches(CatalogFilter{category, catalogMode(mode), packaging, cargoType}) {
+			return entry, nil
+		}
+	}
+	return CatalogItem{}, errors.New("no catalog service for " + string(category) + " " + string(mode) + " " + string(packaging) + " " + string(cargoType))
+}
+
+// Items returns the catalog items matching a filter, in catalog order
+func (sc *ServiceCatalog) Items(filter CatalogFilter) []CatalogItem {
+	filter.Mode = catalogMode(filter.Mode)
+	items := []CatalogItem{}
+	for _, entry := range sc.items {
+		if entry.matches(filter) {
+			items = append(items, entry)
+		}
+	}
+	return items
+}
+
+// matches reports whether the item passes a filter
+func (entry CatalogItem) matches(filter CatalogFilter) bool {
+	if filter.ServiceCategory != "" && filter.ServiceCategory != entry.ServiceCategory {
+		return false
+	}
+	if filter.Mode != "" && filter.Mode != entry.Mode {
+		return false
+	}
+	if filter.PackagingMode != "" && filter.PackagingMode != entry.PackagingMode {
+		return false
+	}
+	if filter.CargoType == "" {
+		return true
+	}
+	for _, cargoType := range entry.CargoTypes {
+		if cargoType == filter.CargoType {
+			return true
+		}
+	}
+	return false
+}
+
+// SubscribeCatalogItems replaces the catalog items a carrier serves. A
+// carrier with subscriptions only bids on quotes for those services.
+func (m *Marketplace) SubscribeCatalogItems(participantID string, items []SubCategoryItem) (Participant, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	participant, exists := m.participants[participantID]
+	if !exists {
+		return Participant{}, errors.New("participant not found")
+	}
+	if participant.Type != Carrier {
+		return Participant{}, errors.New("only carriers subscribe to catalog items")
+	}
+	for _, item := range items {
+		if _, ok := Catalog().Item(item); !ok {
+			return Participant{}, errors.New("unknown catalog item: " + string(item))
+		}
+	}
+	participant.ServiceItems = append([]SubCategoryItem(nil), items...)
+	m.participants[participantID] = participant
+	log.Printf("Catalog items subscribed for %s: %d", participantID, len(items))
+	return participant, nil
+}
+
+// CarriersServing returns the carriers subscribed to a catalog item
+func (m *Marketplace) CarriersServing(item SubCategoryItem) []Participant {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	carriers := []Participant{}
+	for _, participant := range m.participants {
+		if participant.Type == Carrier && participant.Serves(item) {
+			carriers = append(carriers, participant)
+		}
+	}
+	sort.Slice(carriers, func(i, j int) bool { return carriers[i].ID < carriers[j].ID })
+	return carriers
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestServiceCatalog_DerivedFromItems(t *testing.T) {
+	catalog, err := NewServiceCatalog(subCategoryItems)
+	if err != nil {
+		t.Fatalf("NewServiceCatalog failed: %v", err)
+	}
+	entry, ok := catalog.Item(TransshipmentLandPalletLCLcargo)
+	if !ok {
+		t.Fatalf("Expected TransshipmentLandPalletLCLcargo in the catalog")
+	}
+	if entry.ServiceCategory != Transshipment || entry.SubCategory != TransshipmentLand || entry.Mode != Land ||
+		entry.PackagingMode != Pallet || len(entry.CargoTypes) != 1 || entry.CargoTypes[0] != LCLCargo {
+		t.Errorf("Unexpected catalog item %+v", entry)
+	}
+	if _, err := NewServiceCatalog([]SubCategoryItem{"ImportAirCrateGeneralCargo"}); err == nil {
+		t.Errorf("Expected malformed item to be rejected")
+	}
+	if _, err := NewServiceCatalog([]SubCategoryItem{ImportAirLooseLiveCargo, ImportAirLooseLiveCargo}); err == nil {
+		t.Errorf("Expected duplicate item to be rejected")
+	}
+}
+
+func TestServiceCatalog_ServicesAllowedByModeRules(t *testing.T) {
+	rules := NewTransportationValidator()
+	for _, item := range Catalog().Items(CatalogFilter{}) {
+		rule, ok := rules.Rule(item.Mode)
+		if !ok {
+			t.Errorf("%s: no mode rules for %s", item.Item, item.Mode)
+			continue
+		}
+		allowed := len(rule.AllowedPackaging) == 0
+		for _, packaging := range rule.AllowedPackaging {
+			allowed = allowed || packaging == item.PackagingMode
+		}
+		if !allowed {
+			t.Errorf("%s: %s rules do not allow %s packaging", item.Item, item.Mode, item.PackagingMode)
+		}
+		if item.CargoClass == "HazardousCargo" && !rule.Hazardous.Allowed {
+			t.Errorf("%s: %s rules do not allow dangerous goods", item.Item, item.Mode)
+		}
+	}
+}
+
+func TestServiceCatalog_FindAndFilter(t *testing.T) {
+	catalog := Catalog()
+	entry, err := catalog.Find(Import, Rail, Pallet, Perishable)
+	if err != nil || entry.Item != ImportLandPalletGeneralCargo {
+		t.Errorf("Expected rail perishables under ImportLandPalletGeneralCargo, got %s (%v)", entry.Item, err)
+	}
+	invalid := []struct {
+		category  ServiceCategory
+		mode      TransportationMode
+		packaging PackagingMode
+		cargo     CargoType
+	}{
+		{Transit, Road, Pallet, GeneralCargo},  // transit is air or sea only
+		{Export, Air, Container, LCLCargo},     // no consolidated air services
+		{Import, Sea, "Crate", GeneralCargo},   // unknown packaging
+		{Import, Sea, Container, ""},           // cargo type required
+		{Import, Multimodal, Loose, Hazardous}, // legs are matched one by one
+	}
+	for _, c := range invalid {
+		if _, err := catalog.Find(c.category, c.mode, c.packaging, c.cargo); err == nil {
+			t.Errorf("Expected no catalog service for %+v", c)
+		}
+	}
+
+	items := catalog.Items(CatalogFilter{ServiceCategory: Transit, CargoType: LCLCargo})
+	if len(items) != 3 {
+		t.Fatalf("Expected 3 transit LCL services, got %d", len(items))
+	}
+	for _, item := range items {
+		if item.Mode != Sea {
+			t.Errorf("Expected only sea LCL transit services, got %s", item.Item)
+		}
+	}
+	if all := catalog.Items(CatalogFilter{}); len(all) != len(subCategoryItems) {
+		t.Errorf("Expected the unfiltered catalog to list every item, got %d", len(all))
+	}
+}
+
+func TestMarketplace_CatalogDrivesQuotesAndBids(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	validUntil := time.Now().Add(24 * time.Hour)
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+
+	if _, err := marketplace.CreateFreightQuote(shipper.ID, Transit, GeneralCargo, Pallet, "DEDUI", "PLWAW", Road, 800.0, "EUR", validUntil); err == nil {
+		t.Errorf("Expected a road transit quote to be rejected")
+	}
+	quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Land, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+	}, 3000.0, "EUR", validUntil, CargoDetails{})
+	if err != nil {
+		t.Fatalf("CreateMultimodalQuote failed: %v", err)
+	}
+	if len(quote.ServiceItems) != 2 || quote.Legs[1].ServiceItem != ImportLandContainerGeneralCargo {
+		t.Fatalf("Unexpected quote services %v / %+v", quote.ServiceItems, quote.Legs)
+	}
+
+	ocean := marketplace.RegisterParticipant("Ocean Line", Carrier)
+	if _, err := marketplace.SubscribeCatalogItems(shipper.ID, []SubCategoryItem{ImportSeaContainerGeneralCargo}); err == nil {
+		t.Errorf("Expected shippers not to subscribe to catalog items")
+	}
+	if _, err := marketplace.SubscribeCatalogItems(ocean.ID, []SubCategoryItem{"ImportSeaCrateGeneralCargo"}); err == nil {
+		t.Errorf("Expected unknown catalog items to be rejected")
+	}
+	if _, err := marketplace.SubscribeCatalogItems(ocean.ID, []SubCategoryItem{ImportSeaContainerGeneralCargo}); err != nil {
+		t.Fatalf("SubscribeCatalogItems failed: %v", err)
+	}
+
+	if _, err := marketplace.PlaceBid(quote.ID, ocean.ID, 2800.0, ""); err == nil {
+		t.Errorf("Expected a sea-only carrier not to bid on the whole route")
+	}
+	if _, err := marketplace.PlaceLegBid(quote.ID, 2, ocean.ID, 600.0, ""); err == nil {
+		t.Errorf("Expected a sea-only carrier not to bid on the land leg")
+	}
+	if _, err := marketplace.PlaceLegBid(quote.ID, 1, ocean.ID, 2000.0, ""); err != nil {
+		t.Errorf("PlaceLegBid failed for a served leg: %v", err)
+	}
+	serving := marketplace.CarriersServing(ImportSeaContainerGeneralCargo)
+	if len(serving) != 1 || serving[0].ID != ocean.ID {
+		t.Errorf("Expected the ocean carrier to serve the sea leg, got %+v", serving)
+	}
+}
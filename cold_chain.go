@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// CarrierCapability is a service capability a carrier declares
+type CarrierCapability string
+
+const (
+	CapabilityReefer CarrierCapability = "Reefer" // temperature-controlled equipment
+)
+
+// ExcursionAction is what happens automatically when a cold-chain limit is breached
+type ExcursionAction string
+
+const (
+	ExcursionOpenDispute  ExcursionAction = "dispute"
+	ExcursionApplyPenalty ExcursionAction = "penalty"
+)
+
+// ExcursionKind identifies the breached cold-chain limit
+type ExcursionKind string
+
+const (
+	TemperatureExcursion ExcursionKind = "temperature"
+	HumidityExcursion    ExcursionKind = "humidity"
+	TransitTimeExcursion ExcursionKind = "transit-time"
+)
+
+// coldChainMonitorID raises disputes opened by the monitor
+const coldChainMonitorID = "cold-chain-monitor"
+
+// ColdChainRequirements are the conditions a perishable shipment must be kept in
+type ColdChainRequirements struct {
+	MinTemperature  float64         `json:"min_temperature_c"`
+	MaxTemperature  float64         `json:"max_temperature_c"`
+	MinHumidity     float64         `json:"min_humidity,omitempty"` // percent relative humidity; zero range is unmonitored
+	MaxHumidity     float64         `json:"max_humidity,omitempty"`
+	MaxTransitHours int             `json:"max_transit_hours"`
+	OnExcursion     ExcursionAction `json:"on_excursion"`
+	PenaltyPercent  float64         `json:"penalty_percent,omitempty"` // of the freight charge, per excursion
+}
+
+// monitorsHumidity reports whether the requirements set a humidity range
+func (req ColdChainRequirements) monitorsHumidity() bool {
+	return req.MinHumidity != 0 || req.MaxHumidity != 0
+}
+
+// ValidateColdChain checks a quote's cold-chain requirements. Perishable
+// quotes must carry them.
+func ValidateColdChain(cargoType CargoType, req *ColdChainRequirements) error {
+	if req == nil {
+		if cargoType == Perishable {
+			return errors.New("perishable quotes require cold-chain requirements")
+		}
+		return nil
+	}
+	if req.MinTemperature >= req.MaxTemperature {
+		return errors.New("minimum temperature must be below maximum temperature")
+	}
+	if req.monitorsHumidity() && (req.MinHumidity < 0 || req.MaxHumidity > 100 || req.MinHumidity >= req.MaxHumidity) {
+		return errors.New("humidity range must be within 0-100% with minimum below maximum")
+	}
+	if req.MaxTransitHours <= 0 {
+		return errors.New("maximum transit time must be positive")
+	}
+	switch req.OnExcursion {
+	case ExcursionOpenDispute:
+	case ExcursionApplyPenalty:
+		if req.PenaltyPercent <= 0 || req.PenaltyPercent > 100 {
+			return errors.New("penalty percent must be between 0 and 100")
+		}
+	default:
+		return errors.New("excursion action must be dispute or penalty")
+	}
+	return nil
+}
+
+// SensorReading is an IoT temperature and humidity reading from a shipment
+type SensorReading struct {
+	DeviceID    string    `json:"device_id"`
+	Temperature float64   `json:"temperature_c"`
+	Humidity    *float64  `json:"humidity,omitempty"`
+	RecordedAt  time.Time `json:"recorded_at"`
+}
+
+// Excursion is a breach of a shipment's cold-chain requirements
+type Excursion struct {
+	ID         string
+	BookingID  string
+	Kind       ExcursionKind
+	Value      float64
+	Limit      string
+	DeviceID   string
+	DetectedAt time.Time
+	Action     ExcursionAction
+	DisputeID  string  // dispute opened for the excursion
+	Penalty    float64 // penalty applied for the excursion, in the booking currency
+}
+
+// ColdChainStatus is the monitoring state of a booked shipment
+type ColdChainStatus struct {
+	BookingID    string
+	Requirements ColdChainRequirements
+	StartedAt    time.Time
+	Readings     []SensorReading
+	Excursions   []Excursion
+	Penalties    float64
+	Currency     string
+}
+
+// coldChainShipment tracks readings and open breaches for one booking
+type coldChainShipment struct {
+	status        ColdChainStatus
+	freightCharge float64
+	breached      map[ExcursionKind]bool // limits currently out of range
+}
+
+// ColdChainMonitor checks IoT readings of booked perishable shipments
+// against their quote's requirements and acts on excursions
+type ColdChainMonitor struct {
+	blockchain *Blockchain
+	disputes   *DisputeService
+
+	shipments map[string]*coldChainShipment // bookingID -> shipment
+	mutex     sync.RWMutex
+}
+
+// NewColdChainMonitor creates a new ColdChainMonitor instance
+func NewColdChainMonitor(bc *Blockchain, disputes *DisputeService) *ColdChainMonitor {
+	return &ColdChainMonitor{
+		blockchain: bc,
+		disputes:   disputes,
+		shipments:  make(map[string]*coldChainShipment),
+	}
+}
+
+// StartMonitoring begins monitoring a booking under the given requirements
+func (ccm *ColdChainMonitor) StartMonitoring(booking Booking, req ColdChainRequirements, freightCharge float64, currency string) error {
+	ccm.mutex.Lock()
+	defer ccm.mutex.Unlock()
+
+	if _, exists := ccm.shipments[booking.ID]; exists {
+		return errors.New("booking already monitored")
+	}
+	ccm.shipments[booking.ID] = &coldChainShipment{
+		status: ColdChainStatus{
+			BookingID:    booking.ID,
+			Requirements: req,
+			StartedAt:    booking.BookingTime,
+			Currency:     currency,
+		},
+		freightCharge: freightCharge,
+		breached:      make(map[ExcursionKind]bool),
+	}
+	return nil
+}
+
+// limitCheck is a reading's value against one cold-chain limit
+type limitCheck struct {
+	kind     ExcursionKind
+	value    float64
+	breached bool
+	limit    string
+}
+
+// RecordReading stores a sensor reading and returns the excursions it starts.
+// A limit that stays out of range over several readings is one excursion.
+func (ccm *ColdChainMonitor) RecordReading(bookingID string, reading SensorReading) ([]Excursion, error) {
+	if reading.DeviceID == "" {
+		return nil, errors.New("device ID is required")
+	}
+	if reading.RecordedAt.IsZero() {
+		reading.RecordedAt = time.Now()
+	}
+
+	ccm.mutex.Lock()
+	defer ccm.mutex.Unlock()
+
+	shipment, exists := ccm.shipments[bookingID]
+	if !exists {
+		return nil, errors.New("booking is not cold-chain monitored")
+	}
+	req := shipment.status.Requirements
+	shipment.status.Readings = append(shipment.status.Readings, reading)
+
+	checks := []limitCheck{{
+		kind:     TemperatureExcursion,
+		value:    reading.Temperature,
+		breached: reading.Temperature < req.MinTemperature || reading.Temperature > req.MaxTemperature,
+		limit:    fmt.Sprintf("%.1f-%.1f C", req.MinTemperature, req.MaxTemperature),
+	}}
+	if req.monitorsHumidity() && reading.Humidity != nil {
+		checks = append(checks, limitCheck{
+			kind:     HumidityExcursion,
+			value:    *reading.Humidity,
+			breached: *reading.Humidity < req.MinHumidity || *reading.Humidity > req.MaxHumidity,
+			limit:    fmt.Sprintf("%.0f-%.0f%% RH", req.MinHumidity, req.MaxHumidity),
+		})
+	}
+	transitHours := reading.RecordedAt.Sub(shipment.status.StartedAt).Hours()
+	checks = append(checks, limitCheck{
+		kind:     TransitTimeExcursion,
+		value:    transitHours,
+		breached: transitHours > float64(req.MaxTransitHours),
+		limit:    fmt.Sprintf("%d h", req.MaxTransitHours),
+	})
+
+	excursions := []Excursion{}
+	for _, check := range checks {
+		wasBreached := shipment.breached[check.kind]
+		// An exceeded transit time stays exceeded even for late-arriving readings
+		if check.kind == TransitTimeExcursion && wasBreached {
+			continue
+		}
+		shipment.breached[check.kind] = check.breached
+		if !check.breached || wasBreached {
+			continue
+		}
+		excursion, err := ccm.handleExcursion(shipment, Excursion{
+			ID:         uuid.New().String(),
+			BookingID:  bookingID,
+			Kind:       check.kind,
+			Value:      check.value,
+			Limit:      check.limit,
+			DeviceID:   reading.DeviceID,
+			DetectedAt: reading.RecordedAt,
+			Action:     req.OnExcursion,
+		})
+		if err != nil {
+			return excursions, err
+		}
+		excursions = append(excursions, excursion)
+	}
+	return excursions, nil
+}
+
+// handleExcursion opens a dispute or applies the penalty terms for an
+// excursion and anchors it on the chain
+func (ccm *ColdChainMonitor) handleExcursion(shipment *coldChainShipment, excursion Excursion) (Excursion, error) {
+	switch excursion.Action {
+	case ExcursionOpenDispute:
+		if ccm.disputes == nil {
+			return Excursion{}, errors.New("dispute service not configured")
+		}
+		reason := fmt.Sprintf("cold-chain %s excursion: %.1f outside %s (device %s)", excursion.Kind, excursion.Value, excursion.Limit, excursion.DeviceID)
+		dispute, err := ccm.disputes.RaiseDispute(excursion.BookingID, coldChainMonitorID, reason)
+		if err != nil {
+			return Excursion{}, err
+		}
+		excursion.DisputeID = dispute.ID
+	case ExcursionApplyPenalty:
+		excursion.Penalty = roundAmount(shipment.freightCharge * shipment.status.Requirements.PenaltyPercent / 100)
+		shipment.status.Penalties = roundAmount(shipment.status.Penalties + excursion.Penalty)
+	}
+	shipment.status.Excursions = append(shipment.status.Excursions, excursion)
+
+	if ccm.blockchain != nil {
+		data, err := json.Marshal(excursion)
+		if err != nil {
+			log.Printf("Error marshaling excursion: %v", err)
+			return Excursion{}, err
+		}
+		if err := ccm.blockchain.AddBlock(string(data)); err != nil {
+			log.Printf("Error adding excursion to blockchain: %v", err)
+			return Excursion{}, err
+		}
+	}
+
+	log.Printf("Cold-chain %s excursion on booking %s", excursion.Kind, excursion.BookingID)
+	return excursion, nil
+}
+
+// GetStatus returns the monitoring state of a booking
+func (ccm *ColdChainMonitor) GetStatus(bookingID string) (ColdChainStatus, error) {
+	ccm.mutex.RLock()
+	defer ccm.mutex.RUnlock()
+
+	shipment, exists := ccm.shipments[bookingID]
+	if !exists {
+		return ColdChainStatus{}, errors.New("booking is not cold-chain monitored")
+	}
+	status := shipment.status
+	status.Readings = append([]SensorReading(nil), status.Readings...)
+	status.Excursions = append([]Excursion(nil), status.Excursions...)
+	return status, nil
+}
+
+// Penalties returns the total cold-chain penalties applied to a booking
+func (ccm *ColdChainMonitor) Penalties(bookingID string) float64 {
+	ccm.mutex.RLock()
+	defer ccm.mutex.RUnlock()
+
+	if shipment, exists := ccm.shipments[bookingID]; exists {
+		return shipment.status.Penalties
+	}
+	return 0
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateColdChain(t *testing.T) {
+	valid := ColdChainRequirements{MinTemperature: 2, MaxTemperature: 8, MaxTransitHours: 72, OnExcursion: ExcursionOpenDispute}
+	if err := ValidateColdChain(Perishable, nil); err == nil {
+		t.Errorf("Expected perishable quote without requirements to be rejected")
+	}
+	if err := ValidateColdChain(GeneralCargo, nil); err != nil {
+		t.Errorf("Unexpected error for general cargo: %v", err)
+	}
+	if err := ValidateColdChain(Perishable, &valid); err != nil {
+		t.Errorf("Unexpected error for valid requirements: %v", err)
+	}
+
+	invalid := []func(*ColdChainRequirements){
+		func(r *ColdChainRequirements) { r.MinTemperature = 10 },
+		func(r *ColdChainRequirements) { r.MinHumidity, r.MaxHumidity = 60, 40 },
+		func(r *ColdChainRequirements) { r.MaxHumidity = 120 },
+		func(r *ColdChainRequirements) { r.MaxTransitHours = 0 },
+		func(r *ColdChainRequirements) { r.OnExcursion = "" },
+		func(r *ColdChainRequirements) { r.OnExcursion = ExcursionApplyPenalty },
+	}
+	for i, mutate := range invalid {
+		req := valid
+		mutate(&req)
+		if err := ValidateColdChain(Perishable, &req); err == nil {
+			t.Errorf("case %d: expected invalid requirements to be rejected: %+v", i, req)
+		}
+	}
+}
+
+func newColdChainBooking(t *testing.T, req ColdChainRequirements) (*Marketplace, Booking) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Disputes = NewDisputeService()
+	marketplace.ColdChain = NewColdChainMonitor(nil, marketplace.Disputes)
+
+	shipper := marketplace.RegisterParticipant("Pharma Shipper", Shipper)
+	quote, err := marketplace.CreateFreightQuoteWithCargo(shipper.ID, Import, Perishable, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour), CargoDetails{ColdChain: &req})
+	if err != nil {
+		t.Fatalf("CreateFreightQuoteWithCargo failed: %v", err)
+	}
+	dryCarrier := marketplace.RegisterParticipant("Dry Van Carrier", Carrier)
+	reeferCarrier := marketplace.RegisterParticipant("Reefer Carrier", Carrier)
+
+	if _, err := marketplace.PlaceBid(quote.ID, dryCarrier.ID, 800.0, ""); err == nil {
+		t.Errorf("Expected carrier without reefer capability to be refused")
+	}
+	if _, err := marketplace.DeclareCapabilities(shipper.ID, []CarrierCapability{CapabilityReefer}); err == nil {
+		t.Errorf("Expected shippers not to declare capabilities")
+	}
+	if _, err := marketplace.DeclareCapabilities(reeferCarrier.ID, []CarrierCapability{CapabilityReefer}); err != nil {
+		t.Fatalf("DeclareCapabilities failed: %v", err)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, reeferCarrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	return marketplace, booking
+}
+
+func TestColdChain_ExcursionOpensDispute(t *testing.T) {
+	marketplace, booking := newColdChainBooking(t, ColdChainRequirements{
+		MinTemperature: 2, MaxTemperature: 8, MinHumidity: 30, MaxHumidity: 60,
+		MaxTransitHours: 72, OnExcursion: ExcursionOpenDispute,
+	})
+	at := booking.BookingTime
+	humidity := 45.0
+
+	readings := []struct {
+		temperature float64
+		offset      time.Duration
+		excursions  int
+	}{
+		{5, time.Hour, 0},
+		{9.5, 2 * time.Hour, 1}, // excursion starts
+		{10, 3 * time.Hour, 0},  // same excursion continues
+		{6, 4 * time.Hour, 0},   // back in range
+		{1, 5 * time.Hour, 1},   // a new excursion
+		{5, 80 * time.Hour, 1},  // transit time exceeded
+		{5, 81 * time.Hour, 0},
+	}
+	for i, r := range readings {
+		excursions, err := marketplace.ColdChain.RecordReading(booking.ID, SensorReading{DeviceID: "logger-1", Temperature: r.temperature, Humidity: &humidity, RecordedAt: at.Add(r.offset)})
+		if err != nil {
+			t.Fatalf("reading %d: RecordReading failed: %v", i, err)
+		}
+		if len(excursions) != r.excursions {
+			t.Errorf("reading %d: expected %d excursions, got %+v", i, r.excursions, excursions)
+		}
+	}
+
+	status, err := marketplace.ColdChain.GetStatus(booking.ID)
+	if err != nil {
+		t.Fatalf("GetStatus failed: %v", err)
+	}
+	if len(status.Readings) != len(readings) || len(status.Excursions) != 3 {
+		t.Fatalf("Unexpected status: %d readings, %+v", len(status.Readings), status.Excursions)
+	}
+	if status.Excursions[2].Kind != TransitTimeExcursion {
+		t.Errorf("Expected a transit-time excursion, got %s", status.Excursions[2].Kind)
+	}
+	dispute, err := marketplace.Disputes.GetDispute(status.Excursions[0].DisputeID)
+	if err != nil || dispute.BookingID != booking.ID || dispute.Status != "Open" {
+		t.Errorf("Expected an open dispute for the excursion, got %+v (%v)", dispute, err)
+	}
+	if status.Excursions[0].DisputeID == status.Excursions[1].DisputeID {
+		t.Errorf("Expected each excursion to open its own dispute")
+	}
+}
+
+func TestColdChain_PenaltyCreditedOnInvoice(t *testing.T) {
+	marketplace, booking := newColdChainBooking(t, ColdChainRequirements{
+		MinTemperature: -25, MaxTemperature: -18, MaxTransitHours: 48,
+		OnExcursion: ExcursionApplyPenalty, PenaltyPercent: 10,
+	})
+	marketplace.InvoiceService = NewInvoiceService(marketplace, nil)
+
+	if _, err := marketplace.ColdChain.RecordReading(booking.ID, SensorReading{Temperature: -20}); err == nil {
+		t.Errorf("Expected reading without a device ID to be rejected")
+	}
+	excursions, err := marketplace.ColdChain.RecordReading(booking.ID, SensorReading{DeviceID: "logger-1", Temperature: -12})
+	if err != nil || len(excursions) != 1 || excursions[0].Penalty != 90 {
+		t.Fatalf("Expected a 90.00 penalty, got %+v (%v)", excursions, err)
+	}
+
+	invoice, err := marketplace.InvoiceService.GenerateInvoice(booking.ID, time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	last := invoice.LineItems[len(invoice.LineItems)-1]
+	if last.Type != ColdChainPenalty || last.Amount != -90 || invoice.Total != 810 {
+		t.Errorf("Expected penalty credit on the invoice, got %+v total %.2f", last, invoice.Total)
+	}
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// ComplianceEventType classifies a compliance record
+type ComplianceEventType string
+
+const (
+	ComplianceKYCPassed               ComplianceEventType = "kyc-passed"
+	ComplianceKYCRejected             ComplianceEventType = "kyc-rejected"
+	ComplianceSanctionsScreened       ComplianceEventType = "sanctions-screened"
+	ComplianceCustomsDeclarationFiled ComplianceEventType = "customs-declaration-filed"
+	ComplianceDangerousGoodsApproved  ComplianceEventType = "dangerous-goods-approved"
+)
+
+// IsValidComplianceEventType checks a compliance event type
+func IsValidComplianceEventType(t ComplianceEventType) bool {
+	switch t {
+	case ComplianceKYCPassed, ComplianceKYCRejected, ComplianceSanctionsScreened,
+		ComplianceCustomsDeclarationFiled, ComplianceDangerousGoodsApproved:
+		return true
+	}
+	return false
+}
+
+// ComplianceRecord is one entry in the compliance log. Each record's hash
+// covers its content and the previous record's hash, so any edit to history
+// breaks the chain.
+type ComplianceRecord struct {
+	ID            string              `json:"id"`
+	Sequence      int                 `json:"sequence"`
+	Type          ComplianceEventType `json:"type"`
+	ParticipantID string              `json:"participant_id,omitempty"`
+	BookingID     string              `json:"booking_id,omitempty"`
+	Details       string              `json:"details"`
+	RecordedBy    string              `json:"recorded_by,omitempty"`
+	Timestamp     time.Time           `json:"timestamp"`
+	PrevHash      string              `json:"prev_hash"`
+	Hash          string              `json:"hash"`
+}
+
+// ComplianceFilter selects compliance records. Zero fields match everything.
+type ComplianceFilter struct {
+	ParticipantID string
+	BookingID     string
+	Types         []ComplianceEventType
+	From          time.Time
+	To            time.Time
+}
+
+// matches reports whether a record passes the filter
+func (f ComplianceFilter) matches(record ComplianceRecord) bool {
+	if f.ParticipantID != "" && record.ParticipantID != f.ParticipantID {
+		return false
+	}
+	if f.BookingID != "" && record.BookingID != f.BookingID {
+		return false
+	}
+	if !f.From.IsZero() && record.Timestamp.Before(f.From) {
+		return false
+	}
+	if !f.To.IsZero() && record.Timestamp.After(f.To) {
+		return false
+	}
+	if len(f.Types) == 0 {
+		return true
+	}
+	for _, t := range f.Types {
+		if record.Type == t {
+			return true
+		}
+	}
+	return false
+}
+
+// ComplianceLog is an append-only, hash-chained log of compliance events
+// for participants and bookings
+type ComplianceLog struct {
+	blockchain *Blockchain
+	records    []ComplianceRecord
+	mutex      sync.RWMutex
+}
+
+// NewComplianceLog creates a new ComplianceLog. Record hashes are anchored
+// on bc when it is not nil.
+func NewComplianceLog(bc *Blockchain) *ComplianceLog {
+	return &ComplianceLog{blockchain: bc}
+}
+
+// hashComplianceRecord computes a record's chained hash. Each field is
+// length-prefixed so text moved between fields changes the hash.
+func hashComplianceRecord(record ComplianceRecord) string {
+	h := sha256.New()
+	for _, field := range []string{
+		record.ID, strconv.Itoa(record.Sequence), string(record.Type), record.ParticipantID, record.BookingID,
+		record.Details, record.RecordedBy, strconv.FormatInt(record.Timestamp.UnixNano(), 10), record.PrevHash,
+	} {
+		fmt.Fprintf(h, "%d:%s", len(field), field)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// Record appends a compliance event for a participant, a booking or both
+func (cl *ComplianceLog) Record(eventType ComplianceEventType, participantID, bookingID, details, recordedBy string) (ComplianceRecord, error) {
+	if !IsValidComplianceEventType(eventType) {
+		return ComplianceRecord{}, errors.New("invalid compliance event type")
+	}
+	if participantID == "" && bookingID == "" {
+		return ComplianceRecord{}, errors.New("participant or booking is required")
+	}
+
+	cl.mutex.Lock()
+	defer cl.mutex.Unlock()
+
+	record := ComplianceRecord{
+		ID:            uuid.New().String(),
+		Sequence:      len(cl.records) + 1,
+		Type:          eventType,
+		ParticipantID: participantID,
+		BookingID:     bookingID,
+		Details:       details,
+		RecordedBy:    recordedBy,
+		Timestamp:     time.Now().UTC(),
+	}
+	if len(cl.records) > 0 {
+		record.PrevHash = cl.records[len(cl.records)-1].Hash
+	}
+	record.Hash = hashComplianceRecord(record)
+
+	// Anchor the hash on chain before accepting the record
+	if cl.blockchain != nil {
+		data, err := json.Marshal(struct {
+			Type     string `json:"type"`
+			RecordID string `json:"record_id"`
+			Sequence int    `json:"sequence"`
+			Hash     string `json:"hash"`
+		}{"compliance-anchor", record.ID, record.Sequence, record.Hash})
+		if err != nil {
+			return ComplianceRecord{}, err
+		}
+		if err := cl.blockchain.AddBlock(string(data)); err != nil {
+			log.Printf("Error anchoring compliance record: %v", err)
+			return ComplianceRecord{}, err
+		}
+	}
+	cl.records = append(cl.records, record)
+	return record, nil
+}
+
+// Query returns the records matching filter, oldest first
+func (cl *ComplianceLog) Query(filter ComplianceFilter) []ComplianceRecord {
+	cl.mutex.RLock()
+	defer cl.mutex.RUnlock()
+	records := []ComplianceRecord{}
+	for _, record := range cl.records {
+		if filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+// Verify recomputes the hash chain and reports the first broken record
+func (cl *ComplianceLog) Verify() error {
+	cl.mutex.RLock()
+	defer cl.mutex.RUnlock()
+	prev := ""
+	for _, record := range cl.records {
+		if record.PrevHash != prev || hashComplianceRecord(record) != record.Hash {
+			return fmt.Errorf("compliance record %d fails hash verification", record.Sequence)
+		}
+		prev = record.Hash
+	}
+	return nil
+}
+
+// ExportJSON writes the records matching filter as a JSON array
+func (cl *ComplianceLog) ExportJSON(w io.Writer, filter ComplianceFilter) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(cl.Query(filter))
+}
+
+// csvCell neutralises a value a spreadsheet would run as a formula
+func csvCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// ExportCSV writes the records matching filter as CSV with a header row.
+// Free-text cells starting with a formula character are prefixed with a
+// quote so the export is safe to open in a spreadsheet.
+func (cl *ComplianceLog) ExportCSV(w io.Writer, filter ComplianceFilter) error {
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"sequence", "id", "timestamp", "type", "participant_id", "booking_id", "details", "recorded_by", "prev_hash", "hash"})
+	for _, record := range cl.Query(filter) {
+		writer.Write([]string{
+			strconv.Itoa(record.Sequence),
+			record.ID,
+			record.Timestamp.Format(time.RFC3339Nano),
+			string(record.Type),
+			csvCell(record.ParticipantID),
+			csvCell(record.BookingID),
+			csvCell(record.Details),
+			csvCell(record.RecordedBy),
+			record.PrevHash,
+			record.Hash,
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
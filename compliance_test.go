@@ -0,0 +1,126 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"testing"
+)
+
+func TestComplianceLog_HistoryFiltersAndExport(t *testing.T) {
+	cl := NewComplianceLog(NewBlockchain())
+
+	if _, err := cl.Record("made-up", "p1", "", "", ""); err == nil {
+		t.Errorf("Expected error for unknown event type")
+	}
+	if _, err := cl.Record(ComplianceSanctionsScreened, "", "", "", ""); err == nil {
+		t.Errorf("Expected error without participant or booking")
+	}
+	cl.Record(ComplianceKYCPassed, "p1", "", "Shipper verification", "onboarding")
+	cl.Record(ComplianceSanctionsScreened, "p1", "", "no hits, first screening", "screening")
+	cl.Record(ComplianceSanctionsScreened, "p1", "", "no hits, rescreening", "screening")
+	cl.Record(ComplianceCustomsDeclarationFiled, "p2", "b1", "export declaration, with \"quotes\"", "broker")
+
+	// Later records never overwrite earlier ones
+	if records := cl.Query(ComplianceFilter{ParticipantID: "p1"}); len(records) != 3 {
+		t.Errorf("Expected 3 records for p1, got %d", len(records))
+	}
+	screened := cl.Query(ComplianceFilter{ParticipantID: "p1", Types: []ComplianceEventType{ComplianceSanctionsScreened}})
+	if len(screened) != 2 || screened[1].Details != "no hits, rescreening" {
+		t.Errorf("Expected both screenings in order, got %+v", screened)
+	}
+	if records := cl.Query(ComplianceFilter{BookingID: "b1"}); len(records) != 1 || records[0].ParticipantID != "p2" {
+		t.Errorf("Expected one record for booking b1, got %+v", records)
+	}
+
+	var csvOut bytes.Buffer
+	if err := cl.ExportCSV(&csvOut, ComplianceFilter{}); err != nil {
+		t.Fatalf("ExportCSV failed: %v", err)
+	}
+	rows, err := csv.NewReader(&csvOut).ReadAll()
+	if err != nil {
+		t.Fatalf("Exported CSV does not parse: %v", err)
+	}
+	if len(rows) != 5 || rows[0][0] != "sequence" || rows[4][6] != "export declaration, with \"quotes\"" {
+		t.Errorf("Unexpected CSV export: %v", rows)
+	}
+
+	// Cells a spreadsheet would evaluate are exported as text
+	formulas := NewComplianceLog(nil)
+	formulas.Record(ComplianceKYCPassed, "p1", "", "=HYPERLINK(\"http://evil\")", "@admin")
+	csvOut.Reset()
+	formulas.ExportCSV(&csvOut, ComplianceFilter{})
+	rows, _ = csv.NewReader(&csvOut).ReadAll()
+	if len(rows) != 2 || rows[1][6] != "'=HYPERLINK(\"http://evil\")" || rows[1][7] != "'@admin" {
+		t.Errorf("Expected formula cells neutralised, got %v", rows)
+	}
+
+	var jsonOut bytes.Buffer
+	if err := cl.ExportJSON(&jsonOut, ComplianceFilter{BookingID: "b1"}); err != nil {
+		t.Fatalf("ExportJSON failed: %v", err)
+	}
+	var exported []ComplianceRecord
+	if err := json.Unmarshal(jsonOut.Bytes(), &exported); err != nil || len(exported) != 1 {
+		t.Fatalf("Unexpected JSON export: %s", jsonOut.String())
+	}
+	if hashComplianceRecord(exported[0]) != exported[0].Hash {
+		t.Errorf("Expected exported record to verify against its hash")
+	}
+
+	// Moving text between fields changes the hash
+	shifted := exported[0]
+	shifted.Details, shifted.RecordedBy = shifted.Details+"\nbroker", ""
+	if hashComplianceRecord(shifted) == exported[0].Hash {
+		t.Errorf("Expected text moved between fields to change the hash")
+	}
+
+	if err := cl.Verify(); err != nil {
+		t.Fatalf("Verify failed: %v", err)
+	}
+	cl.records[1].Details = "edited"
+	if err := cl.Verify(); err == nil {
+		t.Errorf("Expected verification to detect an edited record")
+	}
+}
+
+func TestComplianceLog_RecordsOnboardingDecisions(t *testing.T) {
+	marketplace := newOnboardingMarketplace()
+	cl := NewComplianceLog(nil)
+	marketplace.Onboarding.SetComplianceLog(cl)
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+
+	completeOnboarding(t, marketplace.Onboarding, shipper.ID, nil)
+	records := cl.Query(ComplianceFilter{ParticipantID: shipper.ID})
+	if len(records) != 1 || records[0].Type != ComplianceKYCPassed {
+		t.Errorf("Expected a kyc-passed record, got %+v", records)
+	}
+
+	if _, err := marketplace.Onboarding.Review(shipper.ID, false, "late rejection"); err == nil {
+		t.Fatalf("Expected rejecting a verified profile to fail")
+	}
+	if records := cl.Query(ComplianceFilter{ParticipantID: shipper.ID}); len(records) != 1 {
+		t.Errorf("Expected a refused decision to leave the log unchanged, got %+v", records)
+	}
+}
+
+func TestMarketplace_AttachDocumentsRecordsCustomsDeclaration(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	cl := NewComplianceLog(nil)
+	marketplace.Compliance = cl
+
+	if _, err := marketplace.AttachDocuments(booking.ID, []ShipmentDocument{CommercialInvoice}); err != nil {
+		t.Fatalf("AttachDocuments failed: %v", err)
+	}
+	if records := cl.Query(ComplianceFilter{BookingID: booking.ID}); len(records) != 0 {
+		t.Errorf("Expected no records before a customs declaration, got %+v", records)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := marketplace.AttachDocuments(booking.ID, []ShipmentDocument{CustomsDeclaration}); err != nil {
+			t.Fatalf("AttachDocuments failed: %v", err)
+		}
+	}
+	records := cl.Query(ComplianceFilter{BookingID: booking.ID})
+	if len(records) != 1 || records[0].Type != ComplianceCustomsDeclarationFiled || records[0].ParticipantID != booking.ShipperID {
+		t.Errorf("Expected one customs-declaration-filed record, got %+v", records)
+	}
+}
@@ -0,0 +1,512 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// SurchargeBasis is what a contract surcharge is charged on
+type SurchargeBasis string
+
+const (
+	SurchargeFlat    SurchargeBasis = "flat"     // per shipment
+	SurchargePercent SurchargeBasis = "percent"  // of the freight charge
+	SurchargePerUnit SurchargeBasis = "per_unit" // per chargeable unit
+)
+
+// SurchargeRule is a surcharge agreed on a contract lane, such as a bunker
+// or peak season surcharge
+type SurchargeRule struct {
+	Code        string         `json:"code"`
+	Description string         `json:"description,omitempty"`
+	Basis       SurchargeBasis `json:"basis"`
+	Amount      float64        `json:"amount"`
+}
+
+// WeightBreak is the rate per chargeable unit from a chargeable quantity up
+// to the next break
+type WeightBreak struct {
+	MinQuantity float64 `json:"min_quantity"`
+	Rate        float64 `json:"rate"`
+}
+
+// ContractLane is the agreed pricing for one origin, destination and mode,
+// with the volume the shipper committed to over the contract
+type ContractLane struct {
+	OriginCode        string             `json:"origin_code"`
+	DestinationCode   string             `json:"destination_code"`
+	Mode              TransportationMode `json:"mode"`
+	WeightBreaks      []WeightBreak      `json:"weight_breaks"` // ascending, the first from zero
+	MinimumCharge     float64            `json:"minimum_charge"`
+	Surcharges        []SurchargeRule    `json:"surcharges,omitempty"`
+	CommittedQuantity float64            `json:"committed_quantity"` // chargeable units over the contract
+	UsedQuantity      float64            `json:"used_quantity"`
+	Shipments         int                `json:"shipments"`
+}
+
+// RateContract is a shipper's contract with a carrier pricing lanes for a
+// validity period, booked directly without bidding once the shipper accepts it
+type RateContract struct {
+	ID         string         `json:"id"`
+	ShipperID  string         `json:"shipper_id"`
+	CarrierID  string         `json:"carrier_id"`
+	Currency   string         `json:"currency"`
+	ValidFrom  time.Time      `json:"valid_from"`
+	ValidUntil time.Time      `json:"valid_until"`
+	Lanes      []ContractLane `json:"lanes"`
+	CreatedAt  time.Time      `json:"created_at"`
+	AcceptedAt time.Time      `json:"accepted_at,omitempty"` // zero until the shipper accepts
+}
+
+// AppliedSurcharge is a surcharge charged on a contract shipment
+type AppliedSurcharge struct {
+	Code   string  `json:"code"`
+	Amount float64 `json:"amount"`
+}
+
+// ContractPrice is a shipment priced on a contract lane
+type ContractPrice struct {
+	Quantity       float64            `json:"quantity"`
+	Unit           RateUnit           `json:"unit"`
+	Rate           float64            `json:"rate"` // rate of the weight break the quantity falls in
+	Freight        float64            `json:"freight"`
+	MinimumApplied bool               `json:"minimum_applied"`
+	Surcharges     []AppliedSurcharge `json:"surcharges,omitempty"`
+	Total          float64            `json:"total"`
+}
+
+// LaneUtilization is how much of a lane's committed volume has been shipped
+type LaneUtilization struct {
+	OriginCode        string             `json:"origin_code"`
+	DestinationCode   string             `json:"destination_code"`
+	Mode              TransportationMode `json:"mode"`
+	CommittedQuantity float64            `json:"committed_quantity"`
+	UsedQuantity      float64            `json:"used_quantity"`
+	Shipments         int                `json:"shipments"`
+	Utilization       float64            `json:"utilization"` // used over committed; 0 without a commitment
+}
+
+// ContractShipment describes a shipment booked against a rate contract
+type ContractShipment struct {
+	ServiceCategory ServiceCategory    `json:"service_category"`
+	CargoType       CargoType          `json:"cargo_type"`
+	PackagingMode   PackagingMode      `json:"packaging_mode"`
+	OriginCode      string             `json:"origin_code"`
+	DestinationCode string             `json:"destination_code"`
+	Mode            TransportationMode `json:"mode"`
+	Cargo           CargoDetails       `json:"cargo"`
+}
+
+// Price prices a shipment's chargeable measure on the lane: the weight break
+// rate times the quantity, at least the minimum charge, plus surcharges
+func (lane ContractLane) Price(measure ChargeableMeasure) ContractPrice {
+	price := ContractPrice{Quantity: measure.Quantity, Unit: measure.Unit}
+	for _, wb := range lane.WeightBreaks {
+		if measure.Quantity >= wb.MinQuantity {
+			price.Rate = wb.Rate
+		}
+	}
+	price.Freight = roundAmount(price.Rate * measure.Quantity)
+	if price.Freight < lane.MinimumCharge {
+		price.Freight = lane.MinimumCharge
+		price.MinimumApplied = true
+	}
+
+	price.Total = price.Freight
+	for _, rule := range lane.Surcharges {
+		amount := rule.Amount
+		switch rule.Basis {
+		case SurchargePercent:
+			amount = price.Freight * rule.Amount / 100
+		case SurchargePerUnit:
+			amount = rule.Amount * measure.Quantity
+		}
+		amount = roundAmount(amount)
+		price.Surcharges = append(price.Surcharges, AppliedSurcharge{Code: rule.Code, Amount: amount})
+		price.Total += amount
+	}
+	price.Total = roundAmount(price.Total)
+	return price
+}
+
+// validate checks a lane's locations, mode, weight breaks and surcharges
+func (lane ContractLane) validate() error {
+	name := lane.OriginCode + "-" + lane.DestinationCode
+	if lane.Mode == Multimodal {
+		return errors.New("lane " + name + ": contract lanes are priced per mode")
+	}
+	if _, err := ParseTransportationMode(string(lane.Mode)); err != nil {
+		return err
+	}
+	for _, code := range []string{lane.OriginCode, lane.DestinationCode} {
+		if err := Locations().ValidateCode(lane.Mode, code); err != nil {
+			return fmt.Errorf("lane %s: %v", name, err)
+		}
+	}
+	if len(lane.WeightBreaks) == 0 || lane.WeightBreaks[0].MinQuantity != 0 {
+		return errors.New("lane " + name + ": weight breaks must start from zero")
+	}
+	for i, wb := range lane.WeightBreaks {
+		if wb.Rate <= 0 {
+			return errors.New("lane " + name + ": weight break rates must be positive")
+		}
+		if i > 0 && wb.MinQuantity <= lane.WeightBreaks[i-1].MinQuantity {
+			return errors.New("lane " + name + ": weight breaks must be in ascending order")
+		}
+	}
+	if lane.MinimumCharge < 0 || lane.CommittedQuantity < 0 {
+		return errors.New("lane " + name + ": minimum charge and commitment may not be negative")
+	}
+	for _, rule := range lane.Surcharges {
+		if rule.Code == "" || rule.Amount <= 0 {
+			return errors.New("lane " + name + ": surcharges need a code and a positive amount")
+		}
+		switch rule.Basis {
+		case SurchargeFlat, SurchargePercent, SurchargePerUnit:
+		default:
+			return errors.New("lane " + name + ": unknown surcharge basis " + string(rule.Basis))
+		}
+	}
+	return nil
+}
+
+// lane returns the index of the contract lane for an origin, destination and mode
+func (c RateContract) lane(origin, destination string, mode TransportationMode) (int, bool) {
+	for i, lane := range c.Lanes {
+		if lane.OriginCode == origin && lane.DestinationCode == destination && lane.Mode == mode {
+			return i, true
+		}
+	}
+	return 0, false
+}
+
+// ContractService keeps rate contracts and their utilization
+type ContractService struct {
+	contracts map[string]RateContract
+	mutex     sync.RWMutex
+}
+
+// NewContractService creates a new ContractService instance
+func NewContractService() *ContractService {
+	return &ContractService{
+		contracts: make(map[string]RateContract),
+	}
+}
+
+// Create validates and stores a rate contract
+func (cs *ContractService) Create(contract RateContract) (RateContract, error) {
+	if contract.ShipperID == "" || contract.CarrierID == "" {
+		return RateContract{}, errors.New("shipper and carrier are required")
+	}
+	if !contract.ValidUntil.After(contract.ValidFrom) {
+		return RateContract{}, errors.New("contract must be valid over a date range")
+	}
+	currency, err := NormalizeCurrencyCode(contract.Currency, DefaultCurrency)
+	if err != nil {
+		return RateContract{}, err
+	}
+	if len(contract.Lanes) == 0 {
+		return RateContract{}, errors.New("contract must price at least one lane")
+	}
+	seen := make(map[string]bool)
+	for i := range contract.Lanes {
+		lane := &contract.Lanes[i]
+		lane.OriginCode = strings.ToUpper(strings.TrimSpace(lane.OriginCode))
+		lane.DestinationCode = strings.ToUpper(strings.TrimSpace(lane.DestinationCode))
+		if err := lane.validate(); err != nil {
+			return RateContract{}, err
+		}
+		key := segmentKey(RouteLeg{Mode: lane.Mode, OriginCode: lane.OriginCode, DestinationCode: lane.DestinationCode})
+		if seen[key] {
+			return RateContract{}, errors.New("duplicate contract lane " + key)
+		}
+		seen[key] = true
+		lane.UsedQuantity, lane.Shipments = 0, 0
+	}
+	contract.ID = uuid.New().String()
+	contract.Currency = currency
+	contract.CreatedAt = time.Now()
+	contract.AcceptedAt = time.Time{}
+
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+	cs.contracts[contract.ID] = contract
+	return contract, nil
+}
+
+// Accept records the shipper's acceptance of a contract the carrier issued
+func (cs *ContractService) Accept(contractID, shipperID string) (RateContract, error) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	contract, exists := cs.contracts[contractID]
+	if !exists {
+		return RateContract{}, errors.New("contract not found")
+	}
+	if contract.ShipperID != shipperID {
+		return RateContract{}, errors.New("only the contract shipper may accept it")
+	}
+	if !contract.AcceptedAt.IsZero() {
+		return RateContract{}, errors.New("contract already accepted")
+	}
+	if time.Now().After(contract.ValidUntil) {
+		return RateContract{}, errors.New("contract has expired")
+	}
+	contract.AcceptedAt = time.Now()
+	cs.contracts[contractID] = contract
+	return contract, nil
+}
+
+// Get returns a rate contract by ID
+func (cs *ContractService) Get(contractID string) (RateContract, error) {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	contract, exists := cs.contracts[contractID]
+	if !exists {
+		return RateContract{}, errors.New("contract not found")
+	}
+	contract.Lanes = append([]ContractLane(nil), contract.Lanes...)
+	return contract, nil
+}
+
+// ForParticipant returns the contracts a shipper or carrier is party to,
+// oldest first
+func (cs *ContractService) ForParticipant(participantID string) []RateContract {
+	cs.mutex.RLock()
+	defer cs.mutex.RUnlock()
+
+	contracts := []RateContract{}
+	for _, contract := range cs.contracts {
+		if contract.ShipperID == participantID || contract.CarrierID == participantID {
+			contracts = append(contracts, contract)
+		}
+	}
+	sort.Slice(contracts, func(i, j int) bool {
+		return contracts[i].CreatedAt.Before(contracts[j].CreatedAt)
+	})
+	return contracts
+}
+
+// Utilization reports each lane's shipped volume against its commitment.
+// Volume is only tracked once the shipper has accepted the contract.
+func (cs *ContractService) Utilization(contractID string) ([]LaneUtilization, error) {
+	contract, err := cs.Get(contractID)
+	if err != nil {
+		return nil, err
+	}
+	if contract.AcceptedAt.IsZero() {
+		return nil, errors.New("contract has not been accepted")
+	}
+	utilization := make([]LaneUtilization, 0, len(contract.Lanes))
+	for _, lane := range contract.Lanes {
+		u := LaneUtilization{
+			OriginCode:        lane.OriginCode,
+			DestinationCode:   lane.DestinationCode,
+			Mode:              lane.Mode,
+			CommittedQuantity: lane.CommittedQuantity,
+			UsedQuantity:      lane.UsedQuantity,
+			Shipments:         lane.Shipments,
+		}
+		if lane.CommittedQuantity > 0 {
+			u.Utilization = roundMeasure(lane.UsedQuantity / lane.CommittedQuantity)
+		}
+		utilization = append(utilization, u)
+	}
+	return utilization, nil
+}
+
+// recordUsage adds a booked shipment to a lane's utilization
+func (cs *ContractService) recordUsage(contractID string, laneIndex int, quantity float64) {
+	cs.mutex.Lock()
+	defer cs.mutex.Unlock()
+
+	contract := cs.contracts[contractID]
+	lanes := append([]ContractLane(nil), contract.Lanes...)
+	lanes[laneIndex].UsedQuantity = roundMeasure(lanes[laneIndex].UsedQuantity + quantity)
+	lanes[laneIndex].Shipments++
+	contract.Lanes = lanes
+	cs.contracts[contractID] = contract
+}
+
+// CreateRateContract records a rate contract between a shipper and a carrier
+func (m *Marketplace) CreateRateContract(contract RateContract) (RateContract, error) {
+	if m.Contracts == nil {
+		return RateContract{}, errors.New("rate contracts not configured")
+	}
+	shipper, err := m.GetParticipant(contract.ShipperID)
+	if err != nil || shipper.Type != Shipper {
+		return RateContract{}, errors.New("contract shipper not found")
+	}
+	if err := m.requireCarrier(contract.CarrierID); err != nil {
+		return RateContract{}, err
+	}
+	contract, err = m.Contracts.Create(contract)
+	if err != nil {
+		return RateContract{}, err
+	}
+
+	// Add to blockchain
+	data, err := json.Marshal(contract)
+	if err != nil {
+		log.Printf("Error marshaling rate contract: %v", err)
+		return RateContract{}, err
+	}
+	if err := m.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding rate contract to blockchain: %v", err)
+		return RateContract{}, err
+	}
+
+	log.Printf("Rate contract created: %s between %s and %s", contract.ID, contract.ShipperID, contract.CarrierID)
+	return contract, nil
+}
+
+// AcceptRateContract records a shipper accepting a rate contract
+func (m *Marketplace) AcceptRateContract(contractID, shipperID string) (RateContract, error) {
+	if m.Contracts == nil {
+		return RateContract{}, errors.New("rate contracts not configured")
+	}
+	contract, err := m.Contracts.Accept(contractID, shipperID)
+	if err != nil {
+		return RateContract{}, err
+	}
+
+	// Add to blockchain
+	data, err := json.Marshal(contract)
+	if err != nil {
+		log.Printf("Error marshaling rate contract: %v", err)
+		return RateContract{}, err
+	}
+	if err := m.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding rate contract to blockchain: %v", err)
+		return RateContract{}, err
+	}
+
+	log.Printf("Rate contract accepted: %s by %s", contract.ID, shipperID)
+	return contract, nil
+}
+
+// BookContract books a shipment directly against a rate contract lane at
+// the contract price. The booking carries an accepted bid from the carrier
+// at that price so it is invoiced and settled like a spot booking.
+func (m *Marketplace) BookContract(contractID, shipperID string, shipment ContractShipment) (Booking, error) {
+	if m.Contracts == nil {
+		return Booking{}, errors.New("rate contracts not configured")
+	}
+	contract, err := m.Contracts.Get(contractID)
+	if err != nil {
+		return Booking{}, err
+	}
+	if contract.ShipperID != shipperID {
+		return Booking{}, errors.New("only the contract shipper may book against it")
+	}
+	if contract.AcceptedAt.IsZero() {
+		return Booking{}, errors.New("contract has not been accepted by the shipper")
+	}
+	now := time.Now()
+	if now.Before(contract.ValidFrom) || now.After(contract.ValidUntil) {
+		return Booking{}, errors.New("contract is not in force")
+	}
+	origin := strings.ToUpper(strings.TrimSpace(shipment.OriginCode))
+	destination := strings.ToUpper(strings.TrimSpace(shipment.DestinationCode))
+	laneIndex, ok := contract.lane(origin, destination, shipment.Mode)
+	if !ok {
+		return Booking{}, errors.New("contract has no rate for " + origin + " to " + destination + " by " + string(shipment.Mode))
+	}
+	lane := contract.Lanes[laneIndex]
+	measure, err := ChargeableFor(shipment.Mode, shipment.Cargo.Items)
+	if err != nil {
+		return Booking{}, err
+	}
+	price := lane.Price(measure)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	// The carrier is held to the same checks as when bidding
+	carrier, ok := m.participants[contract.CarrierID]
+	if !ok {
+		return Booking{}, errors.New("carrier not found")
+	}
+	for _, participantID := range []string{shipperID, contract.CarrierID} {
+		if err := m.checkVerified(participantID); err != nil {
+			return Booking{}, err
+		}
+	}
+	if shipment.Cargo.ColdChain != nil && !carrier.HasCapability(CapabilityReefer) {
+		return Booking{}, errors.New("carrier has not declared reefer capability")
+	}
+	legs := []RouteLeg{{Sequence: 1, Mode: shipment.Mode, OriginCode: origin, DestinationCode: destination, Status: LegPlanned}}
+	// The booking's quote lapses with the contract, but stays within the
+	// longest quote validity the rules allow
+	validUntil := contract.ValidUntil
+	if limit := now.Add(maxQuoteValidity); validUntil.After(limit) {
+		validUntil = limit
+	}
+	quote, err := m.buildFreightQuote(shipment.ServiceCategory, shipment.CargoType, shipment.PackagingMode, origin, destination, shipment.Mode, legs, price.Rate, contract.Currency, validUntil, shipment.Cargo)
+	if err != nil {
+		return Booking{}, err
+	}
+	quote.Total = price.Total
+	quote.ShipperID = shipperID
+	quote.ContractID = contractID
+	for _, participantID := range []string{shipperID, contract.CarrierID} {
+		if err := m.screenParty(participantID, quote.ID); err != nil {
+			return Booking{}, err
+		}
+	}
+	for i := range quote.Legs {
+		quote.Legs[i].CarrierID = contract.CarrierID
+	}
+
+	bid := FreightBid{
+		ID:         uuid.New().String(),
+		QuoteID:    quote.ID,
+		CarrierID:  contract.CarrierID,
+		BidAmount:  price.Total,
+		Currency:   contract.Currency,
+		BidTime:    now,
+		IsAccepted: true,
+	}
+	booking := Booking{
+		ID:          uuid.New().String(),
+		QuoteID:     quote.ID,
+		BidID:       bid.ID,
+		ShipperID:   shipperID,
+		CarrierID:   contract.CarrierID,
+		BookingTime: now,
+		Status:      "Confirmed",
+		ContractID:  contractID,
+	}
+	data, err := json.Marshal(booking)
+	if err != nil {
+		log.Printf("Error marshaling booking: %v", err)
+		return Booking{}, err
+	}
+
+	// The quote and booking are anchored before the bid and booking are
+	// recorded; a quote whose booking fails to anchor is withdrawn
+	if err := m.recordQuote(quote); err != nil {
+		return Booking{}, err
+	}
+	if err := m.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding booking to blockchain: %v", err)
+		delete(m.quotes, quote.ID)
+		return Booking{}, err
+	}
+	m.bids[quote.ID] = append(m.bids[quote.ID], bid)
+	m.bookings[booking.ID] = booking
+	m.startShipmentControls(booking, bid)
+	m.Contracts.recordUsage(contractID, laneIndex, measure.Quantity)
+
+	log.Printf("Booking confirmed against contract %s: %s", contractID, booking.ID)
+	return booking, nil
+}
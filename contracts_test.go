@@ -0,0 +1,196 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestContractLane_PriceAppliesBreaksMinimumAndSurcharges(t *testing.T) {
+	lane := ContractLane{
+		OriginCode:      "JFK",
+		DestinationCode: "MAN",
+		Mode:            Air,
+		WeightBreaks:    []WeightBreak{{MinQuantity: 0, Rate: 4.0}, {MinQuantity: 100, Rate: 3.0}, {MinQuantity: 500, Rate: 2.5}},
+		MinimumCharge:   150,
+		Surcharges: []SurchargeRule{
+			{Code: "FSC", Basis: SurchargePercent, Amount: 10},
+			{Code: "SSC", Basis: SurchargePerUnit, Amount: 0.15},
+			{Code: "DOC", Basis: SurchargeFlat, Amount: 25},
+		},
+	}
+	cases := []struct {
+		quantity float64
+		rate     float64
+		freight  float64
+		minimum  bool
+		total    float64
+	}{
+		{20, 4.0, 150, true, 193},
+		{100, 3.0, 300, false, 370},
+		{600, 2.5, 1500, false, 1765},
+	}
+	for _, c := range cases {
+		price := lane.Price(ChargeableMeasure{Quantity: c.quantity, Unit: PerKilogram})
+		if price.Rate != c.rate || price.Freight != c.freight || price.MinimumApplied != c.minimum || price.Total != c.total {
+			t.Errorf("%v kg: got %+v", c.quantity, price)
+		}
+	}
+}
+
+func TestContractService_CreateValidatesLanes(t *testing.T) {
+	cs := NewContractService()
+	now := time.Now()
+	valid := func() ContractLane {
+		return ContractLane{OriginCode: "JFK", DestinationCode: "MAN", Mode: Air, WeightBreaks: []WeightBreak{{0, 4.0}, {100, 3.0}}}
+	}
+	invalid := map[string]func(*RateContract){
+		"no dates":         func(c *RateContract) { c.ValidUntil = c.ValidFrom },
+		"multimodal lane":  func(c *RateContract) { c.Lanes[0].Mode = Multimodal },
+		"unknown location": func(c *RateContract) { c.Lanes[0].OriginCode = "XXX" },
+		"break from 45":    func(c *RateContract) { c.Lanes[0].WeightBreaks[0].MinQuantity = 45 },
+		"descending":       func(c *RateContract) { c.Lanes[0].WeightBreaks[1].MinQuantity = 0 },
+		"surcharge basis": func(c *RateContract) {
+			c.Lanes[0].Surcharges = []SurchargeRule{{Code: "BAF", Basis: "per_teu", Amount: 10}}
+		},
+		"duplicate lane": func(c *RateContract) { c.Lanes = append(c.Lanes, valid()) },
+	}
+	for name, mutate := range invalid {
+		contract := RateContract{ShipperID: "shipper-1", CarrierID: "carrier-1", ValidFrom: now, ValidUntil: now.Add(365 * 24 * time.Hour), Lanes: []ContractLane{valid()}}
+		mutate(&contract)
+		if _, err := cs.Create(contract); err == nil {
+			t.Errorf("%s: expected the contract to be rejected", name)
+		}
+	}
+}
+
+func TestMarketplace_BookContractTracksUtilization(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Contracts = NewContractService()
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	other := marketplace.RegisterParticipant("Other Importer", Shipper)
+	carrier := marketplace.RegisterParticipant("Contract Haulier", Carrier)
+
+	if _, err := marketplace.CreateRateContract(RateContract{ShipperID: carrier.ID, CarrierID: shipper.ID}); err == nil {
+		t.Errorf("Expected swapped contract parties to be rejected")
+	}
+	contract, err := marketplace.CreateRateContract(RateContract{
+		ShipperID:  shipper.ID,
+		CarrierID:  carrier.ID,
+		Currency:   "eur",
+		ValidFrom:  time.Now().Add(-time.Hour),
+		ValidUntil: time.Now().Add(365 * 24 * time.Hour),
+		Lanes: []ContractLane{{
+			OriginCode:        "nlrtm",
+			DestinationCode:   "PLWAW",
+			Mode:              Road,
+			WeightBreaks:      []WeightBreak{{0, 60}, {10, 50}},
+			MinimumCharge:     200,
+			Surcharges:        []SurchargeRule{{Code: "TOLL", Basis: SurchargeFlat, Amount: 20}},
+			CommittedQuantity: 100,
+		}},
+	})
+	if err != nil {
+		t.Fatalf("CreateRateContract failed: %v", err)
+	}
+	if contract.Currency != "EUR" || contract.Lanes[0].OriginCode != "NLRTM" {
+		t.Errorf("Expected the contract normalized, got %+v", contract)
+	}
+
+	// Ten euro pallets occupy four loading metres
+	shipment := ContractShipment{
+		ServiceCategory: Import,
+		CargoType:       GeneralCargo,
+		PackagingMode:   Pallet,
+		OriginCode:      "NLRTM",
+		DestinationCode: "PLWAW",
+		Mode:            Road,
+		Cargo:           CargoDetails{Items: []CargoLineItem{{Pieces: 10, GrossWeightKg: 4000, LengthCm: 120, WidthCm: 80, HeightCm: 150}}},
+	}
+	if _, err := marketplace.BookContract(contract.ID, other.ID, shipment); err == nil {
+		t.Errorf("Expected another shipper not to book against the contract")
+	}
+
+	// Volume is only booked and tracked once the shipper accepts the contract
+	if _, err := marketplace.BookContract(contract.ID, shipper.ID, shipment); err == nil {
+		t.Errorf("Expected booking before acceptance to be rejected")
+	}
+	if _, err := marketplace.Contracts.Utilization(contract.ID); err == nil {
+		t.Errorf("Expected no utilization before acceptance")
+	}
+	if _, err := marketplace.AcceptRateContract(contract.ID, carrier.ID); err == nil {
+		t.Errorf("Expected the carrier not to accept its own contract")
+	}
+	if accepted, err := marketplace.AcceptRateContract(contract.ID, shipper.ID); err != nil || accepted.AcceptedAt.IsZero() {
+		t.Fatalf("AcceptRateContract failed: %+v (%v)", accepted, err)
+	}
+	if _, err := marketplace.AcceptRateContract(contract.ID, shipper.ID); err == nil {
+		t.Errorf("Expected a second acceptance to be rejected")
+	}
+
+	reversed := shipment
+	reversed.OriginCode, reversed.DestinationCode = "PLWAW", "NLRTM"
+	if _, err := marketplace.BookContract(contract.ID, shipper.ID, reversed); err == nil {
+		t.Errorf("Expected a lane outside the contract to be rejected")
+	}
+	booking, err := marketplace.BookContract(contract.ID, shipper.ID, shipment)
+	if err != nil {
+		t.Fatalf("BookContract failed: %v", err)
+	}
+	if booking.ContractID != contract.ID || booking.CarrierID != carrier.ID || booking.Status != "Confirmed" {
+		t.Errorf("Unexpected contract booking %+v", booking)
+	}
+	quote, _ := marketplace.GetQuote(booking.QuoteID)
+	bid, err := marketplace.GetBid(booking.QuoteID, booking.BidID)
+	if err != nil || !bid.IsAccepted || bid.BidAmount != 260 || quote.Total != 260 || quote.Rate != 60 || quote.ContractID != contract.ID {
+		t.Errorf("Expected 4 LDM at 60 plus the toll, got quote %+v bid %+v (%v)", quote, bid, err)
+	}
+	if quote.ValidUntil.After(time.Now().Add(maxQuoteValidity)) {
+		t.Errorf("Expected the year-long contract's quote capped at the maximum validity, got %s", quote.ValidUntil)
+	}
+
+	utilization, err := marketplace.Contracts.Utilization(contract.ID)
+	if err != nil {
+		t.Fatalf("Utilization failed: %v", err)
+	}
+	if len(utilization) != 1 || utilization[0].UsedQuantity != 4 || utilization[0].Shipments != 1 || utilization[0].Utilization != 0.04 {
+		t.Errorf("Unexpected utilization %+v", utilization)
+	}
+
+	// Cold-chain shipments need a carrier with reefer equipment
+	chilled := shipment
+	chilled.CargoType = Perishable
+	chilled.Cargo.ColdChain = &ColdChainRequirements{MinTemperature: 2, MaxTemperature: 8, MaxTransitHours: 72, OnExcursion: ExcursionOpenDispute}
+	if _, err := marketplace.BookContract(contract.ID, shipper.ID, chilled); err == nil {
+		t.Errorf("Expected a carrier without reefer capability to be rejected")
+	}
+}
+
+func TestMarketplace_BookContractRequiresVerifiedCarrier(t *testing.T) {
+	marketplace := newOnboardingMarketplace()
+	marketplace.Contracts = NewContractService()
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	carrier := marketplace.RegisterParticipant("Contract Haulier", Carrier)
+	completeOnboarding(t, marketplace.Onboarding, shipper.ID, nil)
+
+	contract, err := marketplace.CreateRateContract(RateContract{
+		ShipperID:  shipper.ID,
+		CarrierID:  carrier.ID,
+		ValidFrom:  time.Now().Add(-time.Hour),
+		ValidUntil: time.Now().Add(24 * time.Hour),
+		Lanes:      []ContractLane{{OriginCode: "NLRTM", DestinationCode: "PLWAW", Mode: Road, WeightBreaks: []WeightBreak{{0, 60}}}},
+	})
+	if err != nil {
+		t.Fatalf("CreateRateContract failed: %v", err)
+	}
+	if _, err := marketplace.AcceptRateContract(contract.ID, shipper.ID); err != nil {
+		t.Fatalf("AcceptRateContract failed: %v", err)
+	}
+	shipment := ContractShipment{ServiceCategory: Import, CargoType: GeneralCargo, PackagingMode: Pallet, OriginCode: "NLRTM", DestinationCode: "PLWAW", Mode: Road}
+	if _, err := marketplace.BookContract(contract.ID, shipper.ID, shipment); err == nil {
+		t.Errorf("Expected an unverified carrier to be rejected")
+	}
+	completeOnboarding(t, marketplace.Onboarding, carrier.ID, nil)
+	if _, err := marketplace.BookContract(contract.ID, shipper.ID, shipment); err != nil {
+		t.Errorf("BookContract failed: %v", err)
+	}
+}
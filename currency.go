@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCurrency is assumed for amounts that do not carry a currency code
+const DefaultCurrency = "USD"
+
+// SettlementTokenID is the stable token booking escrow and payments settle
+// in; one token is worth one unit of DefaultCurrency
+const SettlementTokenID = "LMUSD"
+
+// NormalizeCurrencyCode upper-cases a currency code and checks it has the
+// three-letter ISO 4217 shape. An empty code resolves to the fallback.
+func NormalizeCurrencyCode(code, fallback string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if code == "" {
+		code = fallback
+	}
+	if len(code) != 3 {
+		return "", errors.New("currency code must be a 3-letter ISO 4217 code")
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return "", errors.New("currency code must be a 3-letter ISO 4217 code")
+		}
+	}
+	return code, nil
+}
+
+// FXRateProvider supplies foreign exchange rates to the oracle layer
+type FXRateProvider interface {
+	// Rate returns how many units of the quote currency one unit of the base currency buys
+	Rate(base, quote string) (float64, error)
+}
+
+// StaticFXRateProvider serves rates from a fixed table expressed against a
+// single base currency. Cross rates are derived through the base.
+type StaticFXRateProvider struct {
+	base      string
+	rates     map[string]float64 // currency -> units per one unit of base
+	updatedAt time.Time
+	mutex     sync.RWMutex
+}
+
+// NewStaticFXRateProvider creates a provider from a rate table against base
+func NewStaticFXRateProvider(base string, rates map[string]float64) *StaticFXRateProvider {
+	p := &StaticFXRateProvider{
+		base:      strings.ToUpper(base),
+		rates:     make(map[string]float64),
+		updatedAt: time.Now(),
+	}
+	for code, rate := range rates {
+		p.rates[strings.ToUpper(code)] = rate
+	}
+	p.rates[p.base] = 1
+	return p
+}
+
+// NewStubFXRateProvider creates a provider with a fixed table of indicative
+// rates, used when no rate file is configured
+func NewStubFXRateProvider() *StaticFXRateProvider {
+	return NewStaticFXRateProvider("USD", map[string]float64{
+		"EUR": 0.92,
+		"GBP": 0.79,
+		"CNY": 7.24,
+		"JPY": 151.6,
+		"SGD": 1.35,
+		"AED": 3.6725,
+		"INR": 83.4,
+		"HKD": 7.82,
+	})
+}
+
+// fxRatesFile mirrors the common {"base": ..., "rates": {...}} layout used by rate publishers
+type fxRatesFile struct {
+	Base      string             `json:"base"`
+	Rates     map[string]float64 `json:"rates"`
+	Timestamp time.Time          `json:"timestamp"`
+}
+
+// LoadFXRatesFile creates a provider from a JSON rate file on disk
+func LoadFXRatesFile(path string) (*StaticFXRateProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var file fxRatesFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return nil, err
+	}
+	if file.Base == "" || len(file.Rates) == 0 {
+		return nil, errors.New("rate file must define a base currency and rates")
+	}
+	for code, rate := range file.Rates {
+		if rate <= 0 {
+			return nil, errors.New("rate for " + code + " must be positive")
+		}
+	}
+	p := NewStaticFXRateProvider(file.Base, file.Rates)
+	if !file.Timestamp.IsZero() {
+		p.updatedAt = file.Timestamp
+	}
+	return p, nil
+}
+
+// Rate returns the cross rate between two currencies
+func (p *StaticFXRateProvider) Rate(base, quote string) (float64, error) {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+
+	baseRate, ok := p.rates[strings.ToUpper(base)]
+	if !ok {
+		return 0, errors.New("no exchange rate for " + base)
+	}
+	quoteRate, ok := p.rates[strings.ToUpper(quote)]
+	if !ok {
+		return 0, errors.New("no exchange rate for " + quote)
+	}
+	return quoteRate / baseRate, nil
+}
+
+// UpdatedAt returns when the rate table was published
+func (p *StaticFXRateProvider) UpdatedAt() time.Time {
+	p.mutex.RLock()
+	defer p.mutex.RUnlock()
+	return p.updatedAt
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadFXRatesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "rates.json")
+	content := `{"base":"USD","rates":{"EUR":0.5,"GBP":0.25}}`
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+
+	provider, err := LoadFXRatesFile(path)
+	if err != nil {
+		t.Fatalf("LoadFXRatesFile failed: %v", err)
+	}
+	rate, err := provider.Rate("EUR", "GBP")
+	if err != nil {
+		t.Fatalf("Rate failed: %v", err)
+	}
+	if rate != 0.5 {
+		t.Errorf("Expected EUR->GBP cross rate 0.5, got %f", rate)
+	}
+	if _, err := provider.Rate("USD", "XXX"); err == nil {
+		t.Errorf("Expected error for unknown currency")
+	}
+}
+
+func TestMarketplace_NormalizedBids(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Oracle = NewOracleIntegration()
+	marketplace.Oracle.SetFXRateProvider(NewStaticFXRateProvider("USD", map[string]float64{"EUR": 0.5}))
+
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	carrierA := marketplace.RegisterParticipant("CarrierA", Carrier)
+	carrierB := marketplace.RegisterParticipant("CarrierB", Carrier)
+
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Export, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "usd", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	if quote.Currency != "USD" {
+		t.Errorf("Expected currency normalized to USD, got %s", quote.Currency)
+	}
+
+	// 450 EUR is 900 USD, so the 850 USD bid should rank first
+	if _, err := marketplace.PlaceBid(quote.ID, carrierA.ID, 450, "EUR"); err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	usdBid, err := marketplace.PlaceBid(quote.ID, carrierB.ID, 850, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	if usdBid.Currency != "USD" {
+		t.Errorf("Expected bid to default to quote currency, got %s", usdBid.Currency)
+	}
+	if _, err := marketplace.PlaceBid(quote.ID, carrierB.ID, 850, "EURO"); err == nil {
+		t.Errorf("Expected error for malformed currency code")
+	}
+
+	bids, err := marketplace.NormalizedBids(quote.ID)
+	if err != nil {
+		t.Fatalf("NormalizedBids failed: %v", err)
+	}
+	if len(bids) != 2 || bids[0].Bid.ID != usdBid.ID {
+		t.Fatalf("Expected USD bid to rank first, got %+v", bids)
+	}
+	if bids[1].Amount != 900 || bids[1].FXRate != 2 {
+		t.Errorf("Expected EUR bid normalized to 900 at rate 2, got %f at %f", bids[1].Amount, bids[1].FXRate)
+	}
+}
+
+func TestInvoiceService_SettlementRateLocked(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	oracle := NewOracleIntegration()
+	oracle.SetFXRateProvider(NewStaticFXRateProvider("USD", map[string]float64{"EUR": 0.5}))
+
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Export, GeneralCargo, Container, "DEHAM", "USNYC", Sea, 1000.0, "EUR", time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 800, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+
+	is := NewInvoiceService(marketplace, oracle)
+	invoice, err := is.GenerateInvoice(booking.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if invoice.Currency != "EUR" {
+		t.Fatalf("Expected invoice in bid currency EUR, got %s", invoice.Currency)
+	}
+
+	// 800 USD settles 400 EUR at the locked EUR->USD rate of 2
+	invoice, err = is.ApplyBookingPayment(booking.ID, 800, "TOKEN1")
+	if err != nil {
+		t.Fatalf("ApplyBookingPayment failed: %v", err)
+	}
+	if invoice.SettlementRate != 2 || invoice.AmountPaid != 400 {
+		t.Fatalf("Expected rate 2 and 400 EUR paid, got rate %f and %f paid", invoice.SettlementRate, invoice.AmountPaid)
+	}
+
+	// A rate move after the lock must not change later settlements
+	oracle.SetFXRateProvider(NewStaticFXRateProvider("USD", map[string]float64{"EUR": 1}))
+	invoice, err = is.ApplyBookingPayment(booking.ID, 800, "TOKEN1")
+	if err != nil {
+		t.Fatalf("ApplyBookingPayment failed: %v", err)
+	}
+	if invoice.AmountPaid != 800 || invoice.SettlementRate != 2 {
+		t.Errorf("Expected 800 EUR paid at locked rate 2, got %f at %f", invoice.AmountPaid, invoice.SettlementRate)
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// ModeRestriction is how a transport mode's regulations treat a dangerous good
+type ModeRestriction string
+
+const (
+	ModeAllowed           ModeRestriction = ""
+	ModeCargoAircraftOnly ModeRestriction = "CargoAircraftOnly" // forbidden on passenger aircraft
+	ModeForbidden         ModeRestriction = "Forbidden"
+)
+
+// DangerousGoodsEntry is a row of the dangerous goods table
+type DangerousGoodsEntry struct {
+	UNNumber           string
+	ProperShippingName string
+	Class              string
+	PackingGroups      []string        // empty when the entry has no packing group
+	Air                ModeRestriction // IATA DGR
+	Sea                ModeRestriction // IMDG Code
+}
+
+// DangerousGoodsItem is a shipper's declaration of one dangerous good on a quote
+type DangerousGoodsItem struct {
+	UNNumber           string `json:"un_number"`
+	Class              string `json:"class"`
+	PackingGroup       string `json:"packing_group,omitempty"`
+	ProperShippingName string `json:"proper_shipping_name"`
+	// CargoAircraftOnly confirms air shipments will be routed on cargo aircraft
+	CargoAircraftOnly bool `json:"cargo_aircraft_only,omitempty"`
+}
+
+// dangerousGoodsTable is the bundled excerpt of the UN dangerous goods list
+// with the IATA DGR and IMDG restrictions the marketplace enforces
+var dangerousGoodsTable = map[string]DangerousGoodsEntry{
+	"UN0004": {"UN0004", "AMMONIUM PICRATE", "1.1D", []string{"II"}, ModeForbidden, ModeAllowed},
+	"UN1005": {"UN1005", "AMMONIA, ANHYDROUS", "2.3", nil, ModeForbidden, ModeAllowed},
+	"UN1090": {"UN1090", "ACETONE", "3", []string{"II"}, ModeAllowed, ModeAllowed},
+	"UN1203": {"UN1203", "GASOLINE", "3", []string{"II"}, ModeAllowed, ModeAllowed},
+	"UN1263": {"UN1263", "PAINT", "3", []string{"I", "II", "III"}, ModeAllowed, ModeAllowed},
+	"UN1381": {"UN1381", "PHOSPHORUS, WHITE", "4.2", []string{"I"}, ModeForbidden, ModeAllowed},
+	"UN1428": {"UN1428", "SODIUM", "4.3", []string{"I"}, ModeCargoAircraftOnly, ModeAllowed},
+	"UN1789": {"UN1789", "HYDROCHLORIC ACID", "8", []string{"II", "III"}, ModeAllowed, ModeAllowed},
+	"UN1830": {"UN1830", "SULPHURIC ACID", "8", []string{"II"}, ModeAllowed, ModeAllowed},
+	"UN1845": {"UN1845", "CARBON DIOXIDE, SOLID", "9", nil, ModeAllowed, ModeAllowed},
+	"UN1950": {"UN1950", "AEROSOLS", "2.1", nil, ModeAllowed, ModeAllowed},
+	"UN2814": {"UN2814", "INFECTIOUS SUBSTANCE, AFFECTING HUMANS", "6.2", nil, ModeAllowed, ModeAllowed},
+	"UN2990": {"UN2990", "LIFE-SAVING APPLIANCES, SELF-INFLATING", "9", nil, ModeAllowed, ModeAllowed},
+	"UN3480": {"UN3480", "LITHIUM ION BATTERIES", "9", nil, ModeCargoAircraftOnly, ModeAllowed},
+	"UN3481": {"UN3481", "LITHIUM ION BATTERIES CONTAINED IN EQUIPMENT", "9", nil, ModeAllowed, ModeAllowed},
+}
+
+// unNumberPattern matches a UN number such as UN1203
+var unNumberPattern = regexp.MustCompile(`^UN[0-9]{4}$`)
+
+// ValidateDangerousGoods checks a quote's dangerous goods declarations. Hazardous
+// quotes must declare at least one item, other cargo types none.
+func ValidateDangerousGoods(cargoType CargoType, mode TransportationMode, items []DangerousGoodsItem) error {
+	if cargoType != Hazardous {
+		if len(items) > 0 {
+			return errors.New("dangerous goods declared on a non-hazardous quote")
+		}
+		return nil
+	}
+	if len(items) == 0 {
+		return errors.New("hazardous quotes require a dangerous goods declaration")
+	}
+	for _, item := range items {
+		if err := validateDangerousGoodsItem(mode, item); err != nil {
+			return fmt.Errorf("%s: %v", item.UNNumber, err)
+		}
+	}
+	return nil
+}
+
+// validateDangerousGoodsItem checks one declaration against the table and mode rules
+func validateDangerousGoodsItem(mode TransportationMode, item DangerousGoodsItem) error {
+	if !unNumberPattern.MatchString(item.UNNumber) {
+		return errors.New("UN number must be UN followed by four digits")
+	}
+	if item.Class == "" || item.ProperShippingName == "" {
+		return errors.New("class and proper shipping name are required")
+	}
+	entry, ok := dangerousGoodsTable[item.UNNumber]
+	if !ok {
+		return errors.New("not in the dangerous goods table")
+	}
+	if item.Class != entry.Class {
+		return fmt.Errorf("class %s does not match table class %s", item.Class, entry.Class)
+	}
+	if !strings.EqualFold(strings.TrimSpace(item.ProperShippingName), entry.ProperShippingName) {
+		return fmt.Errorf("proper shipping name must be %q", entry.ProperShippingName)
+	}
+	if len(entry.PackingGroups) == 0 {
+		if item.PackingGroup != "" {
+			return errors.New("entry has no packing group")
+		}
+	} else {
+		valid := false
+		for _, pg := range entry.PackingGroups {
+			valid = valid || pg == item.PackingGroup
+		}
+		if !valid {
+			return fmt.Errorf("packing group must be one of %s", strings.Join(entry.PackingGroups, ", "))
+		}
+	}
+
+	switch mode {
+	case Air:
+		switch entry.Air {
+		case ModeForbidden:
+			return errors.New("forbidden for air transport under IATA DGR")
+		case ModeCargoAircraftOnly:
+			if !item.CargoAircraftOnly {
+				return errors.New("forbidden on passenger aircraft; must be booked cargo aircraft only")
+			}
+		}
+	case Sea:
+		if entry.Sea == ModeForbidden {
+			return errors.New("forbidden for sea transport under the IMDG Code")
+		}
+	}
+	return nil
+}
+
+// dangerousGoodsSummary lists declared items for compliance records
+func dangerousGoodsSummary(items []DangerousGoodsItem) string {
+	parts := make([]string, 0, len(items))
+	for _, item := range items {
+		part := item.UNNumber + " " + strings.ToUpper(item.ProperShippingName) + ", class " + item.Class
+		if item.PackingGroup != "" {
+			part += ", PG " + item.PackingGroup
+		}
+		parts = append(parts, part)
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidateDangerousGoods(t *testing.T) {
+	gasoline := DangerousGoodsItem{UNNumber: "UN1203", Class: "3", PackingGroup: "II", ProperShippingName: "Gasoline"}
+	batteries := DangerousGoodsItem{UNNumber: "UN3480", Class: "9", ProperShippingName: "Lithium ion batteries"}
+	ammonia := DangerousGoodsItem{UNNumber: "UN1005", Class: "2.3", ProperShippingName: "Ammonia, anhydrous"}
+
+	tests := []struct {
+		name      string
+		cargoType CargoType
+		mode      TransportationMode
+		items     []DangerousGoodsItem
+		wantErr   string
+	}{
+		{"general cargo", GeneralCargo, Sea, nil, ""},
+		{"declaration on general cargo", GeneralCargo, Sea, []DangerousGoodsItem{gasoline}, "non-hazardous"},
+		{"missing declaration", Hazardous, Sea, nil, "require"},
+		{"valid sea", Hazardous, Sea, []DangerousGoodsItem{gasoline, ammonia}, ""},
+		{"bad UN number", Hazardous, Sea, []DangerousGoodsItem{{UNNumber: "1203", Class: "3", PackingGroup: "II", ProperShippingName: "Gasoline"}}, "four digits"},
+		{"unknown UN number", Hazardous, Sea, []DangerousGoodsItem{{UNNumber: "UN9999", Class: "3", ProperShippingName: "Mystery"}}, "not in"},
+		{"wrong class", Hazardous, Sea, []DangerousGoodsItem{{UNNumber: "UN1203", Class: "8", PackingGroup: "II", ProperShippingName: "Gasoline"}}, "class"},
+		{"wrong packing group", Hazardous, Sea, []DangerousGoodsItem{{UNNumber: "UN1203", Class: "3", PackingGroup: "I", ProperShippingName: "Gasoline"}}, "packing group"},
+		{"wrong shipping name", Hazardous, Sea, []DangerousGoodsItem{{UNNumber: "UN1203", Class: "3", PackingGroup: "II", ProperShippingName: "Petrol cans"}}, "proper shipping name"},
+		{"forbidden by air", Hazardous, Air, []DangerousGoodsItem{ammonia}, "IATA"},
+		{"passenger aircraft", Hazardous, Air, []DangerousGoodsItem{batteries}, "passenger aircraft"},
+		{"cargo aircraft only", Hazardous, Air, []DangerousGoodsItem{{UNNumber: "UN3480", Class: "9", ProperShippingName: "Lithium ion batteries", CargoAircraftOnly: true}}, ""},
+	}
+	for _, tt := range tests {
+		err := ValidateDangerousGoods(tt.cargoType, tt.mode, tt.items)
+		if tt.wantErr == "" && err != nil {
+			t.Errorf("%s: unexpected error %v", tt.name, err)
+		}
+		if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.wantErr, err)
+		}
+	}
+}
+
+func TestMarketplace_HazardousQuoteAndBooking(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Compliance = NewComplianceLog(nil)
+	validUntil := time.Now().Add(24 * time.Hour)
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+
+	if _, err := marketplace.CreateFreightQuote(shipper.ID, Export, Hazardous, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil); err == nil {
+		t.Errorf("Expected hazardous quote without a declaration to be rejected")
+	}
+	cargo := CargoDetails{DangerousGoods: []DangerousGoodsItem{{UNNumber: "UN1263", Class: "3", PackingGroup: "III", ProperShippingName: "Paint"}}}
+	quote, err := marketplace.CreateFreightQuoteWithCargo(shipper.ID, Export, Hazardous, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil, cargo)
+	if err != nil {
+		t.Fatalf("CreateFreightQuoteWithCargo failed: %v", err)
+	}
+
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	bid, _ := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	records := marketplace.Compliance.Query(ComplianceFilter{BookingID: booking.ID})
+	if len(records) != 1 || records[0].Type != ComplianceDangerousGoodsApproved || !strings.Contains(records[0].Details, "UN1263") {
+		t.Errorf("Expected a dangerous goods approval record, got %+v", records)
+	}
+}
@@ -4,18 +4,21 @@ import (
 	"errors"
 	"sync"
 	"time"
+
+	"github.com/google/uuid"
 )
 
 // Dispute represents a dispute in the system
 type Dispute struct {
-	ID          string
-	BookingID   string
-	RaiserID    string
-	Reason      string
-	Resolution  string
-	Status      string // e.g., "Open", "Resolved", "Rejected"
-	CreatedAt   time.Time
-	ResolvedAt  *time.Time
+	ID         string
+	BookingID  string
+	RaiserID   string
+	Reason     string
+	Resolution string
+	Status     string // e.g., "Open", "Resolved", "Rejected"
+	LiableID   string // party the dispute was resolved against, if any
+	CreatedAt  time.Time
+	ResolvedAt *time.Time
 }
 
 // DisputeService manages disputes
@@ -73,6 +76,23 @@ func (ds *DisputeService) ResolveDispute(disputeID, resolution string) error {
 	return nil
 }
 
+// AssignLiability records the party a resolved dispute was decided against
+func (ds *DisputeService) AssignLiability(disputeID, participantID string) error {
+	ds.mutex.Lock()
+	defer ds.mutex.Unlock()
+
+	dispute, exists := ds.disputes[disputeID]
+	if !exists {
+		return errors.New("dispute not found")
+	}
+	if dispute.Status != "Resolved" {
+		return errors.New("dispute is not resolved")
+	}
+	dispute.LiableID = participantID
+	ds.disputes[disputeID] = dispute
+	return nil
+}
+
 // GetDispute returns a dispute by ID
 func (ds *DisputeService) GetDispute(disputeID string) (Dispute, error) {
 	ds.mutex.RLock()
@@ -85,8 +105,20 @@ func (ds *DisputeService) GetDispute(disputeID string) (Dispute, error) {
 	return dispute, nil
 }
 
-// generateUUID generates a UUID string (placeholder)
+// Disputes returns every dispute raised
+func (ds *DisputeService) Disputes() []Dispute {
+	ds.mutex.RLock()
+	defer ds.mutex.RUnlock()
+
+	disputes := make([]Dispute, 0, len(ds.disputes))
+	for _, dispute := range ds.disputes {
+		disputes = append(disputes, dispute)
+	}
+	return disputes
+}
+
+// generateUUID generates a dispute ID; disputes raised in the same second
+// must not collide
 func generateUUID() string {
-	// Use github.com/google/uuid or similar in real implementation
-	return "dispute-" + time.Now().Format("20060102150405")
+	return "dispute-" + uuid.New().String()
 }
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// Feature identifies a runtime capability granted by a benefit
+type Feature string
+
+const (
+	FeaturePriorityListing Feature = "PriorityListing" // bids listed ahead of non-priority bids
+	FeatureReducedFees     Feature = "ReducedFees"     // Value is the fee discount in percent
+	FeatureFreeBids        Feature = "FreeBids"        // Quota bids per period without a bid fee
+	FeatureExtendedEscrow  Feature = "ExtendedEscrow"  // Value is the extra escrow hold in days
+)
+
+// Entitlement describes what a benefit grants when it is enforced
+type Entitlement struct {
+	Feature Feature
+	Quota   int     // uses allowed per billing period; 0 means unlimited
+	Value   float64 // feature parameter, e.g. discount percent or extra days
+}
+
+// FeeSchedule defines the platform fees charged on marketplace actions
+type FeeSchedule struct {
+	BidFee  float64 // tokens charged per bid
+	TokenID string
+}
+
+// BidCharge records how a bid fee was paid, so it can be refunded
+type BidCharge struct {
+	Fee     float64 // tokens charged
+	FreeBid bool    // a free bid from the period's quota was used instead
+}
+
+// entitlementUsage counts quota use within one membership billing period
+type entitlementUsage struct {
+	periodEnd time.Time
+	counts    map[Feature]int
+}
+
+// EntitlementService enforces membership benefits at runtime and charges
+// platform fees
+type EntitlementService struct {
+	contract    *SmartContract
+	tokenLedger *TokenLedger
+	fees        FeeSchedule
+	treasuryID  string
+	rules       *MarketplaceRules
+
+	usage map[string]*entitlementUsage // participantID -> current period usage
+	mutex sync.Mutex
+}
+
+// NewEntitlementService creates a new EntitlementService. A nil ledger
+// disables fee collection.
+func NewEntitlementService(contract *SmartContract, ledger *TokenLedger, fees FeeSchedule) *EntitlementService {
+	if fees.TokenID == "" {
+		fees.TokenID = PlatformTokenID
+	}
+	return &EntitlementService{
+		contract:    contract,
+		tokenLedger: ledger,
+		fees:        fees,
+		treasuryID:  defaultTreasuryID,
+		usage:       make(map[string]*entitlementUsage),
+	}
+}
+
+// entitlements resolves the entitlements granted by a participant's active
+// membership. When several benefits grant the same feature the most
+// generous quota and value apply.
+func (es *EntitlementService) entitlements(participantID string) (map[Feature]Entitlement, Membership) {
+	granted := make(map[Feature]Entitlement)
+	benefits, err := es.contract.MembershipBenefits(participantID)
+	if err != nil {
+		return granted, Membership{}
+	}
+	membership, _ := es.contract.membershipManager.GetMembership(participantID)
+	for _, b := range benefits {
+		if b.Entitlement == nil {
+			continue
+		}
+		e := *b.Entitlement
+		if current, ok := granted[e.Feature]; ok {
+			if current.Quota == 0 || (e.Quota != 0 && current.Quota > e.Quota) {
+				e.Quota = current.Quota
+			}
+			if current.Value > e.Value {
+				e.Value = current.Value
+			}
+		}
+		granted[e.Feature] = e
+	}
+	return granted, membership
+}
+
+// GetEntitlement returns a participant's entitlement to a feature
+func (es *EntitlementService) GetEntitlement(participantID string, feature Feature) (Entitlement, bool) {
+	granted, _ := es.entitlements(participantID)
+	e, ok := granted[feature]
+	return e, ok
+}
+
+// HasFeature reports whether a participant is entitled to a feature
+func (es *EntitlementService) HasFeature(participantID string, feature Feature) bool {
+	_, ok := es.GetEntitlement(participantID, feature)
+	return ok
+}
+
+// periodUsage returns the usage counters for the membership's current billing
+// period, resetting them when the membership has renewed. Must be called with
+// the mutex held.
+func (es *EntitlementService) periodUsage(participantID string, membership Membership) *entitlementUsage {
+	usage, exists := es.usage[participantID]
+	if !exists || !usage.periodEnd.Equal(membership.ExpiresAt) {
+		usage = &entitlementUsage{
+			periodEnd: membership.ExpiresAt,
+			counts:    make(map[Feature]int),
+		}
+		es.usage[participantID] = usage
+	}
+	return usage
+}
+
+// Remaining returns the uses of a quota feature left in the current period,
+// or -1 when the entitlement is unlimited
+func (es *EntitlementService) Remaining(participantID string, feature Feature) (int, error) {
+	granted, membership := es.entitlements(participantID)
+	e, ok := granted[feature]
+	if !ok {
+		return 0, errors.New("participant is not entitled to " + string(feature))
+	}
+	if e.Quota == 0 {
+		return -1, nil
+	}
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	return e.Quota - es.periodUsage(participantID, membership).counts[feature], nil
+}
+
+// Consume records one use of a feature, failing when the participant is not
+// entitled to it or has exhausted the period's quota
+func (es *EntitlementService) Consume(participantID string, feature Feature) error {
+	granted, membership := es.entitlements(participantID)
+	e, ok := granted[feature]
+	if !ok {
+		return errors.New("participant is not entitled to " + string(feature))
+	}
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	usage := es.periodUsage(participantID, membership)
+	if e.Quota > 0 && usage.counts[feature] >= e.Quota {
+		return errors.New(string(feature) + " quota exhausted for this period")
+	}
+	usage.counts[feature]++
+	return nil
+}
+
+// release returns one use of a quota feature to the current period
+func (es *EntitlementService) release(participantID string, feature Feature) {
+	_, membership := es.entitlements(participantID)
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+
+	usage := es.periodUsage(participantID, membership)
+	if usage.counts[feature] > 0 {
+		usage.counts[feature]--
+	}
+}
+
+// FeeDiscount returns the fee discount in percent a participant is entitled to
+func (es *EntitlementService) FeeDiscount(participantID string) float64 {
+	e, ok := es.GetEntitlement(participantID, FeatureReducedFees)
+	if !ok || e.Value <= 0 {
+		return 0
+	}
+	if e.Value > 100 {
+		return 100
+	}
+	return e.Value
+}
+
+// SetRules routes fee calculation through the upgradeable fee rules
+func (es *EntitlementService) SetRules(rules *MarketplaceRules) {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	es.rules = rules
+}
+
+// feeRules returns the active fee rules
+func (es *EntitlementService) feeRules() FeeRules {
+	es.mutex.Lock()
+	defer es.mutex.Unlock()
+	if es.rules == nil {
+		return FeeRulesV1{}
+	}
+	return es.rules.Fees()
+}
+
+// ChargeBidFee charges the platform bid fee to a participant. Bids covered by
+// a free bid quota cost nothing; otherwise any fee discount applies.
+func (es *EntitlementService) ChargeBidFee(participantID string) (BidCharge, error) {
+	if es.tokenLedger == nil || es.fees.BidFee <= 0 {
+		return BidCharge{}, nil
+	}
+	if es.Consume(participantID, FeatureFreeBids) == nil {
+		return BidCharge{FreeBid: true}, nil
+	}
+
+	fee := roundAmount(es.feeRules().BidFee(es.fees.BidFee, es.FeeDiscount(participantID)))
+	if fee <= 0 {
+		return BidCharge{}, nil
+	}
+	err := es.tokenLedger.TransferTokens(participantID, es.treasuryID, es.fees.TokenID, fee)
+	if err != nil {
+		return BidCharge{}, errors.New("unable to pay bid fee: " + err.Error())
+	}
+	log.Printf("Bid fee of %.2f charged to %s", fee, participantID)
+	return BidCharge{Fee: fee}, nil
+}
+
+// RefundBidFee returns the fee or free bid charged for a bid that was not placed
+func (es *EntitlementService) RefundBidFee(participantID string, charge BidCharge) error {
+	if charge.FreeBid {
+		es.release(participantID, FeatureFreeBids)
+		return nil
+	}
+	if es.tokenLedger == nil || charge.Fee <= 0 {
+		return nil
+	}
+	return es.tokenLedger.TransferTokens(es.treasuryID, participantID, es.fees.TokenID, charge.Fee)
+}
+
+// EscrowLockDuration extends a base escrow hold by a participant's extended
+// escrow entitlement
+func (es *EntitlementService) EscrowLockDuration(participantID string, base time.Duration) time.Duration {
+	e, ok := es.GetEntitlement(participantID, FeatureExtendedEscrow)
+	if !ok || e.Value <= 0 {
+		return base
+	}
+	return base + time.Duration(e.Value*24*float64(time.Hour))
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newEntitlementFixture(t *testing.T, bidFee float64) (*SmartContract, *EntitlementService, *TokenLedger) {
+	marketplace := NewMarketplace(NewBlockchain())
+	sc := NewSmartContract(marketplace)
+	sc.InitializeServices()
+	if err := sc.RegisterDefaultBenefits(); err != nil {
+		t.Fatalf("RegisterDefaultBenefits failed: %v", err)
+	}
+	// Free plans so tests control membership without billing
+	for _, mType := range []MembershipType{MembershipCarrier, MembershipFreightForwarder} {
+		plan, _ := marketplace.MembershipManager.GetPlan(mType)
+		plan.Price = 0
+		marketplace.MembershipManager.SetPlan(plan)
+	}
+	ledger := NewTokenLedger()
+	es := NewEntitlementService(sc, ledger, FeeSchedule{BidFee: bidFee})
+	marketplace.Entitlements = es
+	return sc, es, ledger
+}
+
+func TestEntitlementService_FreeBidsQuota(t *testing.T) {
+	sc, es, ledger := newEntitlementFixture(t, 10)
+	if err := sc.SubscribeMembership("carrier1", MembershipCarrier); err != nil {
+		t.Fatalf("SubscribeMembership failed: %v", err)
+	}
+	ledger.MintTokens("carrier1", PlatformTokenID, 100)
+
+	for i := 0; i < 10; i++ {
+		charge, err := es.ChargeBidFee("carrier1")
+		if err != nil || charge.Fee != 0 || !charge.FreeBid {
+			t.Fatalf("Expected free bid %d, got %+v err %v", i, charge, err)
+		}
+	}
+	if remaining, _ := es.Remaining("carrier1", FeatureFreeBids); remaining != 0 {
+		t.Errorf("Expected quota exhausted, got %d remaining", remaining)
+	}
+	charge, err := es.ChargeBidFee("carrier1")
+	if err != nil || charge.Fee != 10 {
+		t.Fatalf("Expected full fee after quota, got %+v err %v", charge, err)
+	}
+	if balance := ledger.GetBalance("carrier1", PlatformTokenID); balance != 90 {
+		t.Errorf("Expected balance 90, got %f", balance)
+	}
+
+	// A refunded free bid returns to the quota
+	es.RefundBidFee("carrier1", BidCharge{FreeBid: true})
+	if remaining, _ := es.Remaining("carrier1", FeatureFreeBids); remaining != 1 {
+		t.Errorf("Expected a refunded free bid back in the quota, got %d", remaining)
+	}
+
+	// Renewal starts a new period and resets the quota
+	sc.membershipManager.extend("carrier1", time.Now())
+	if remaining, _ := es.Remaining("carrier1", FeatureFreeBids); remaining != 10 {
+		t.Errorf("Expected quota reset after renewal, got %d", remaining)
+	}
+}
+
+func TestEntitlementService_DiscountAndEscrow(t *testing.T) {
+	sc, es, ledger := newEntitlementFixture(t, 10)
+	if err := sc.SubscribeMembership("forwarder1", MembershipFreightForwarder); err != nil {
+		t.Fatalf("SubscribeMembership failed: %v", err)
+	}
+	ledger.MintTokens("forwarder1", PlatformTokenID, 100)
+	ledger.MintTokens("outsider", PlatformTokenID, 100)
+
+	if charge, err := es.ChargeBidFee("forwarder1"); err != nil || charge.Fee != 7.5 {
+		t.Errorf("Expected discounted fee 7.5, got %+v err %v", charge, err)
+	}
+	if charge, err := es.ChargeBidFee("outsider"); err != nil || charge.Fee != 10 {
+		t.Errorf("Expected full fee for non-member, got %+v err %v", charge, err)
+	}
+	if es.HasFeature("forwarder1", FeaturePriorityListing) {
+		t.Errorf("Forwarder should not have priority listing")
+	}
+
+	base := 72 * time.Hour
+	if d := es.EscrowLockDuration("forwarder1", base); d != base+7*24*time.Hour {
+		t.Errorf("Expected extended escrow, got %s", d)
+	}
+	if d := es.EscrowLockDuration("outsider", base); d != base {
+		t.Errorf("Expected base escrow for non-member, got %s", d)
+	}
+}
+
+func TestMarketplace_PriorityListingBids(t *testing.T) {
+	sc, _, _ := newEntitlementFixture(t, 0)
+	marketplace := sc.Marketplace
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	priority := marketplace.RegisterParticipant("Carrier1", Carrier)
+	standard := marketplace.RegisterParticipant("Carrier2", Carrier)
+	if err := sc.SubscribeMembership(priority.ID, MembershipCarrier); err != nil {
+		t.Fatalf("SubscribeMembership failed: %v", err)
+	}
+
+	validUntil := time.Now().Add(24 * time.Hour)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	marketplace.PlaceBid(quote.ID, standard.ID, 800.0, "")
+	marketplace.PlaceBid(quote.ID, priority.ID, 900.0, "")
+
+	bids, err := marketplace.NormalizedBids(quote.ID)
+	if err != nil {
+		t.Fatalf("NormalizedBids failed: %v", err)
+	}
+	if len(bids) != 2 || bids[0].Bid.CarrierID != priority.ID || !bids[0].Priority {
+		t.Errorf("Expected priority carrier listed first, got %+v", bids)
+	}
+}
+
+func TestMarketplace_PlaceBidChargesFee(t *testing.T) {
+	sc, _, ledger := newEntitlementFixture(t, 5)
+	marketplace := sc.Marketplace
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+
+	validUntil := time.Now().Add(24 * time.Hour)
+	quote, _ := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, ""); err == nil {
+		t.Errorf("Expected bid to fail without tokens for the bid fee")
+	}
+	ledger.MintTokens(carrier.ID, PlatformTokenID, 5)
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, ""); err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	if balance := ledger.GetBalance(carrier.ID, PlatformTokenID); balance != 0 {
+		t.Errorf("Expected bid fee deducted, got balance %f", balance)
+	}
+}
+
+func TestMarketplace_ConfirmBookingOpensEscrow(t *testing.T) {
+	sc, _, ledger := newEntitlementFixture(t, 5)
+	marketplace := sc.Marketplace
+	marketplace.SmartContract = sc
+	shipper := marketplace.RegisterParticipant("Forwarder1", FreightForwarder)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	if err := sc.SubscribeMembership(shipper.ID, MembershipFreightForwarder); err != nil {
+		t.Fatalf("SubscribeMembership failed: %v", err)
+	}
+	ledger.MintTokens(carrier.ID, PlatformTokenID, 5)
+
+	quote, _ := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "US"); err == nil {
+		t.Errorf("Expected a bid in an invalid currency to be rejected")
+	}
+	if balance := ledger.GetBalance(carrier.ID, PlatformTokenID); balance != 5 {
+		t.Errorf("Expected no fee for a rejected bid, got balance %f", balance)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err == nil {
+		t.Errorf("Expected booking to fail without settlement tokens to escrow")
+	}
+	sc.TokenLedger.MintTokens(shipper.ID, SettlementTokenID, 1000)
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	if held := sc.TokenLedger.EscrowedBalance(shipper.ID, SettlementTokenID); held != 900 {
+		t.Errorf("Expected the bid amount locked in escrow, got %f", held)
+	}
+	if balance := sc.TokenLedger.GetBalance(shipper.ID, SettlementTokenID); balance != 100 {
+		t.Errorf("Expected 100 settlement tokens left, got %f", balance)
+	}
+	escrow, err := marketplace.BookingEscrow(booking.ID)
+	if err != nil {
+		t.Fatalf("BookingEscrow failed: %v", err)
+	}
+	// 72 hours plus the forwarder's 7 days of extended escrow
+	hold := time.Until(escrow.ReleaseAt())
+	if hold < defaultEscrowLock+7*24*time.Hour-time.Minute || !booking.EscrowReleaseAt.Equal(escrow.ReleaseAt()) {
+		t.Errorf("Expected an extended escrow hold, got %s", hold)
+	}
+	if err := escrow.Release(); err == nil {
+		t.Errorf("Expected escrow to stay locked before its release time")
+	}
+}
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"sync"
 	"time"
@@ -20,7 +19,7 @@ func NewFreightQuotationSystem(marketplace *Marketplace) *FreightQuotationSystem
 	}
 }
 
-func (fqs *FreightQuotationSystem) CreateQuote(serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, originCode, destinationCode string, transportationMode TransportationMode, rate float64, validUntil time.Time) (FreightQuote, error) {
+func (fqs *FreightQuotationSystem) CreateQuote(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, originCode, destinationCode string, transportationMode TransportationMode, rate float64, currency string, validUntil time.Time) (FreightQuote, error) {
 	fqs.mutex.Lock()
 	defer fqs.mutex.Unlock()
 
@@ -40,27 +39,33 @@ func (fqs *FreightQuotationSystem) CreateQuote(serviceCategory ServiceCategory,
 
 	// Validate origin and destination codes based on transportation mode
 	if transportationMode == Air {
-		if !validIATAAirportCodes[originCode] {
+		if !Locations().IsAirport(originCode) {
 			return FreightQuote{}, errors.New("origin code is not a valid IATA airport code")
 		}
-		if !validIATAAirportCodes[destinationCode] {
+		if !Locations().IsAirport(destinationCode) {
 			return FreightQuote{}, errors.New("destination code is not a valid IATA airport code")
 		}
 	} else if transportationMode == Sea {
-		if !validIMOSeraportCodes[originCode] {
+		if !Locations().IsSeaport(originCode) {
 			return FreightQuote{}, errors.New("origin code is not a valid IMO seaport code")
 		}
-		if !validIMOSeraportCodes[destinationCode] {
+		if !Locations().IsSeaport(destinationCode) {
 			return FreightQuote{}, errors.New("destination code is not a valid IMO seaport code")
 		}
+	} else if IsLandMode(transportationMode) {
+		if !Locations().IsLandLocation(originCode) {
+			return FreightQuote{}, errors.New("origin code is not a valid UN/LOCODE land location")
+		}
+		if !Locations().IsLandLocation(destinationCode) {
+			return FreightQuote{}, errors.New("destination code is not a valid UN/LOCODE land location")
+		}
 	}
 
-	quote := fqs.marketplace.CreateFreightQuote(serviceCategory, cargoType, packagingMode, originCode, destinationCode, transportationMode, rate, validUntil)
-	return quote, nil
+	return fqs.marketplace.CreateFreightQuote(shipperID, serviceCategory, cargoType, packagingMode, originCode, destinationCode, transportationMode, rate, currency, validUntil)
 }
 
 // PlaceBid places a bid on a freight quote with validations
-func (fqs *FreightQuotationSystem) PlaceBid(quoteID, carrierID string, bidAmount float64) (FreightBid, error) {
+func (fqs *FreightQuotationSystem) PlaceBid(quoteID, carrierID string, bidAmount float64, currency string) (FreightBid, error) {
 	fqs.mutex.Lock()
 	defer fqs.mutex.Unlock()
 
@@ -77,7 +82,7 @@ func (fqs *FreightQuotationSystem) PlaceBid(quoteID, carrierID string, bidAmount
 		return FreightBid{}, errors.New("quote has expired")
 	}
 
-	bid, err := fqs.marketplace.PlaceBid(quoteID, carrierID, bidAmount)
+	bid, err := fqs.marketplace.PlaceBid(quoteID, carrierID, bidAmount, currency)
 	return bid, err
 }
 
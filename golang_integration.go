@@ -1,9 +1,9 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"log"
+	"strings"
 
 	"github.com/ethereum/go-ethereum/ethclient"
 	"github.com/ipfs/go-ipfs-api"
@@ -42,8 +42,7 @@ func IPFSIntegration() {
 
 // Libp2pIntegration demonstrates creating a libp2p host
 func Libp2pIntegration() {
-	ctx := context.Background()
-	host, err := libp2p.New(ctx)
+	host, err := libp2p.New()
 	if err != nil {
 		log.Fatal(err)
 	}
@@ -3,9 +3,10 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/google/uuid"
 	"sync"
 	"time"
-	"github.com/google/uuid"
 )
 
 // Governance represents blockchain governance module
@@ -74,6 +75,9 @@ func (g *Governance) VoteProposal(proposalID, participantID string, approve bool
 	if !exists {
 		return errors.New("proposal not found")
 	}
+	if proposal.Status == ProposalExecuted {
+		return errors.New("proposal already executed")
+	}
 
 	// Check if participant already voted
 	if _, voted := proposal.Votes[participantID]; voted {
@@ -120,60 +124,26 @@ func (g *Governance) VoteProposal(proposalID, participantID string, approve bool
 	return nil
 }
 
-// ProposalStatus defines status of a governance proposal
-type ProposalStatus string
-
-const (
-	ProposalPending  ProposalStatus = "Pending"
-	ProposalApproved ProposalStatus = "Approved"
-	ProposalRejected ProposalStatus = "Rejected"
-)
-
-// Proposal represents a governance proposal
-type Proposal struct {
-	ID          string
-	Title       string
-	Description string
-	ProposerID  string
-	CreatedAt   time.Time
-	Status      ProposalStatus
-	Votes       map[string]bool // participantID -> vote (true=approve, false=reject)
-}
-
-// NewGovernance creates a new Governance instance
-func NewGovernance(bc *Blockchain) *Governance {
-	return &Governance{
-		blockchain: bc,
-		proposals:  make(map[string]Proposal),
+// ProposeUpgrade creates a proposal to upgrade a contract to a version
+func (g *Governance) ProposeUpgrade(proposerID string, upgrade ContractUpgradePayload) (Proposal, error) {
+	if upgrade.Contract == "" || upgrade.Version == "" {
+		return Proposal{}, errors.New("contract and version are required")
+	}
+	title := fmt.Sprintf("Upgrade %s to %s", upgrade.Contract, upgrade.Version)
+	proposal, err := g.CreateProposal(title, "Contract upgrade", proposerID)
+	if err != nil {
+		return Proposal{}, err
 	}
-}
 
-// CreateProposal creates a new governance proposal
-func (g *Governance) CreateProposal(title, description, proposerID string) Proposal {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
-
-	id := uuid.New().String()
-	proposal := Proposal{
-		ID:          id,
-		Title:       title,
-		Description: description,
-		ProposerID:  proposerID,
-		CreatedAt:   time.Now(),
-		Status:      ProposalPending,
-		Votes:       make(map[string]bool),
-	}
-	g.proposals[id] = proposal
-
-	// Add to blockchain
-	data, _ := json.Marshal(proposal)
-	g.blockchain.AddBlock(string(data))
-
-	return proposal
+	proposal.Upgrade = &upgrade
+	g.proposals[proposal.ID] = proposal
+	return proposal, nil
 }
 
-// VoteProposal casts a vote on a proposal
-func (g *Governance) VoteProposal(proposalID, participantID string, approve bool) error {
+// AuthorizeUpgrade consumes an approved upgrade proposal for exactly this upgrade
+func (g *Governance) AuthorizeUpgrade(proposalID string, upgrade ContractUpgradePayload) error {
 	g.mutex.Lock()
 	defer g.mutex.Unlock()
 
@@ -181,48 +151,35 @@ func (g *Governance) VoteProposal(proposalID, participantID string, approve bool
 	if !exists {
 		return errors.New("proposal not found")
 	}
-
-	// Check if participant already voted
-	if _, voted := proposal.Votes[participantID]; voted {
-		return errors.New("participant already voted")
-	}
-
-	proposal.Votes[participantID] = approve
-
-	// Update proposal status if majority reached (simple majority)
-	approveCount := 0
-	rejectCount := 0
-	for _, v := range proposal.Votes {
-		if v {
-			approveCount++
-		} else {
-			rejectCount++
-		}
+	if proposal.Upgrade == nil || *proposal.Upgrade != upgrade {
+		return errors.New("proposal does not authorize this upgrade")
 	}
-
-	// For simplicity, if votes >= 3, decide
-	if len(proposal.Votes) >= 3 {
-		if approveCount > rejectCount {
-			proposal.Status = ProposalApproved
-		} else {
-			proposal.Status = ProposalRejected
-		}
+	if proposal.Status != ProposalApproved {
+		return errors.New("proposal is not approved")
 	}
-
+	proposal.Status = ProposalExecuted
 	g.proposals[proposalID] = proposal
+	return nil
+}
 
-	// Add vote to blockchain
-	voteData := struct {
-		ProposalID    string
-		ParticipantID string
-		Approve       bool
-	}{
-		ProposalID:    proposalID,
-		ParticipantID: participantID,
-		Approve:       approve,
-	}
-	data, _ := json.Marshal(voteData)
-	g.blockchain.AddBlock(string(data))
+// ProposalStatus defines status of a governance proposal
+type ProposalStatus string
 
-	return nil
+const (
+	ProposalPending  ProposalStatus = "Pending"
+	ProposalApproved ProposalStatus = "Approved"
+	ProposalRejected ProposalStatus = "Rejected"
+	ProposalExecuted ProposalStatus = "Executed"
+)
+
+// Proposal represents a governance proposal
+type Proposal struct {
+	ID          string
+	Title       string
+	Description string
+	ProposerID  string
+	CreatedAt   time.Time
+	Status      ProposalStatus
+	Votes       map[string]bool         // participantID -> vote (true=approve, false=reject)
+	Upgrade     *ContractUpgradePayload // set on contract upgrade proposals
 }
@@ -2,15 +2,41 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/gorilla/mux"
 )
 
-// SetupRouter sets up HTTP routes for the marketplace and governance
-func SetupRouter(marketplace *Marketplace, governance *Governance) *mux.Router {
+// SetupRouter sets up HTTP routes for the marketplace and governance. When
+// auth is set every route outside /auth/ requires a bearer access token.
+func SetupRouter(marketplace *Marketplace, governance *Governance, auth *AuthService) *mux.Router {
 	router := mux.NewRouter()
+	if auth != nil {
+		router.Use(auth.Middleware)
+		setupAuthRoutes(router, marketplace, auth)
+		if marketplace.Organizations != nil {
+			setupOrganizationRoutes(router, marketplace.Organizations, auth)
+		}
+	}
+	if marketplace.MultiSig != nil {
+		setupMultiSigRoutes(router, marketplace)
+	}
+	if marketplace.Rules != nil {
+		setupContractRoutes(router, marketplace, governance)
+	}
+	if marketplace.Compliance != nil {
+		setupComplianceRoutes(router, marketplace.Compliance)
+	}
+	if marketplace.Screening != nil {
+		setupScreeningRoutes(router, marketplace)
+	}
+	if marketplace.ColdChain != nil {
+		setupColdChainRoutes(router, marketplace.ColdChain)
+	}
 
 	// Input validation middleware
 	validateInput := func(next http.HandlerFunc, validateFunc func(r *http.Request) error) http.HandlerFunc {
@@ -35,6 +61,9 @@ func SetupRouter(marketplace *Marketplace, governance *Governance) *mux.Router {
 		if req.Name == "" || req.Type == "" {
 			return errors.New("name and type are required")
 		}
+		if !IsValidParticipantType(ParticipantType(req.Type)) {
+			return errors.New("invalid participant type")
+		}
 		return nil
 	}
 
@@ -53,344 +82,1869 @@ func SetupRouter(marketplace *Marketplace, governance *Governance) *mux.Router {
 		json.NewEncoder(w).Encode(participant)
 	}, validateParticipant)).Methods("POST")
 
-	// Freight quote routes
-	router.HandleFunc("/quotes", func(w http.ResponseWriter, r *http.Request) {
+	// Carriers declare capabilities such as reefer equipment to bid on matching quotes
+	router.HandleFunc("/participants/{participantID}/capabilities", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		var req struct {
-			ServiceCategory    string  `json:"service_category"`
-			CargoType          string  `json:"cargo_type"`
-			PackagingMode      string  `json:"packaging_mode"`
-			Origin             string  `json:"origin"`
-			Destination        string  `json:"destination"`
-			TransportationMode string  `json:"transportation_mode"`
-			Rate               float64 `json:"rate"`
-			ValidUntil         string  `json:"valid_until"`
+			Capabilities []CarrierCapability `json:"capabilities"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		validUntil, err := time.Parse(time.RFC3339, req.ValidUntil)
+		participant, err := marketplace.DeclareCapabilities(participantID, req.Capabilities)
 		if err != nil {
-			http.Error(w, "Invalid date format", http.StatusBadRequest)
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		quote := marketplace.CreateFreightQuote(
-			ServiceCategory(req.ServiceCategory),
-			CargoType(req.CargoType),
-			PackagingMode(req.PackagingMode),
-			req.Origin,
-			req.Destination,
-			TransportationMode(req.TransportationMode),
-			req.Rate,
-			validUntil,
-		)
-		json.NewEncoder(w).Encode(quote)
+		json.NewEncoder(w).Encode(participant)
 	}).Methods("POST")
 
-	// Place bid route
-	router.HandleFunc("/bids", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/participants/{participantID}/catalog-items", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		var req struct {
-			QuoteID   string  `json:"quote_id"`
-			CarrierID string  `json:"carrier_id"`
-			BidAmount float64 `json:"bid_amount"`
+			Items []SubCategoryItem `json:"items"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		bid, err := marketplace.PlaceBid(req.QuoteID, req.CarrierID, req.BidAmount)
+		participant, err := marketplace.SubscribeCatalogItems(participantID, req.Items)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		json.NewEncoder(w).Encode(bid)
+		json.NewEncoder(w).Encode(participant)
 	}).Methods("POST")
 
-	// Confirm booking route
-	router.HandleFunc("/bookings", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			QuoteID   string `json:"quote_id"`
-			BidID     string `json:"bid_id"`
-			ShipperID string `json:"shipper_id"`
+	// Carriers publish lanes and capacity and are notified of matching quotes
+	router.HandleFunc("/participants/{participantID}/lanes", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var lane Lane
+		if err := json.NewDecoder(r.Body).Decode(&lane); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		booking, err := marketplace.ConfirmBooking(req.QuoteID, req.BidID, req.ShipperID)
+		lane, err = marketplace.PublishLane(participantID, lane)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		json.NewEncoder(w).Encode(booking)
+		json.NewEncoder(w).Encode(lane)
 	}).Methods("POST")
 
-	// Governance routes
-	router.HandleFunc("/proposals", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			Title       string `json:"title"`
-			Description string `json:"description"`
-			ProposerID  string `json:"proposer_id"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+	router.HandleFunc("/participants/{participantID}/lanes", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermView)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
-		proposal := governance.CreateProposal(req.Title, req.Description, req.ProposerID)
-		json.NewEncoder(w).Encode(proposal)
-	}).Methods("POST")
+		json.NewEncoder(w).Encode(marketplace.Lanes.Lanes(participantID))
+	}).Methods("GET")
 
-	router.HandleFunc("/proposals/{id}/vote", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		proposalID := vars["id"]
+	router.HandleFunc("/participants/{participantID}/lanes/{laneID}", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := marketplace.Lanes.RemoveLane(participantID, mux.Vars(r)["laneID"]); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	}).Methods("DELETE")
 
-		var req struct {
-			ParticipantID string `json:"participant_id"`
-			Approve      bool   `json:"approve"`
+	router.HandleFunc("/participants/{participantID}/capacity", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		var offer CapacityOffer
+		if err := json.NewDecoder(r.Body).Decode(&offer); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := governance.VoteProposal(proposalID, req.ParticipantID, req.Approve)
+		offer, err = marketplace.PublishCapacity(participantID, offer)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(offer)
 	}).Methods("POST")
 
-	// Role assignment route
-	router.HandleFunc("/roles/assign", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/participants/{participantID}/capacity", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermView)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(marketplace.Lanes.Capacity(participantID))
+	}).Methods("GET")
+
+	router.HandleFunc("/participants/{participantID}/matches", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermView)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(marketplace.Lanes.Matches(participantID))
+	}).Methods("GET")
+
+	// Onboarding routes
+	router.HandleFunc("/onboarding/{participantID}", func(w http.ResponseWriter, r *http.Request) {
+		profile, err := marketplace.Onboarding.GetProfile(mux.Vars(r)["participantID"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(profile)
+	}).Methods("GET")
+
+	router.HandleFunc("/onboarding/{participantID}/profile", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		var req struct {
-			UserID string `json:"user_id"`
-			Role   string `json:"role"`
+			LegalEntityName    string `json:"legal_entity_name"`
+			RegistrationNumber string `json:"registration_number"`
+			Country            string `json:"country"`
+			Address            string `json:"address"`
+			ContactEmail       string `json:"contact_email"`
+			Licenses           []struct {
+				Type      string    `json:"type"`
+				Number    string    `json:"number"`
+				Issuer    string    `json:"issuer"`
+				ExpiresAt time.Time `json:"expires_at"`
+			} `json:"licenses"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		role := Role(req.Role)
-		if role != AdminRole && role != ShipperRole && role != CarrierRole && role != BrokerRole && role != ForwarderRole {
-			http.Error(w, "Invalid role", http.StatusBadRequest)
+		details := ProfileDetails{
+			LegalEntityName:    req.LegalEntityName,
+			RegistrationNumber: req.RegistrationNumber,
+			Country:            req.Country,
+			Address:            req.Address,
+			ContactEmail:       req.ContactEmail,
+		}
+		for _, l := range req.Licenses {
+			details.Licenses = append(details.Licenses, License{
+				Type:      LicenseType(l.Type),
+				Number:    l.Number,
+				Issuer:    l.Issuer,
+				ExpiresAt: l.ExpiresAt,
+			})
+		}
+		profile, err := marketplace.Onboarding.UpdateProfile(participantID, details)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		marketplace.AccessControl.AssignRole(req.UserID, role)
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(profile)
 	}).Methods("POST")
 
-	// Token routes
-	router.HandleFunc("/tokens/mint", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			ParticipantID string  `json:"participant_id"`
-			TokenID       string  `json:"token_id"`
-			Amount        float64 `json:"amount"`
+	router.HandleFunc("/onboarding/{participantID}/documents", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+		// Multipart upload with a "kind" field and a "file" part
+		if err := r.ParseMultipartForm(maxOnboardingDocumentSize); err != nil {
+			http.Error(w, "Invalid upload", http.StatusBadRequest)
+			return
+		}
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			http.Error(w, "File is required", http.StatusBadRequest)
 			return
 		}
-		// Check role
-		if !marketplace.AccessControl.CheckRole(req.ParticipantID, AdminRole) {
-			http.Error(w, "Unauthorized: Admin role required", http.StatusUnauthorized)
+		defer file.Close()
+		content, err := io.ReadAll(io.LimitReader(file, maxOnboardingDocumentSize+1))
+		if err != nil {
+			http.Error(w, "Unable to read file", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.MintToken(req.ParticipantID, req.Amount)
+		doc, err := marketplace.Onboarding.UploadDocument(participantID, DocumentKind(r.FormValue("kind")),
+			header.Filename, header.Header.Get("Content-Type"), content)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(doc)
 	}).Methods("POST")
 
-	router.HandleFunc("/tokens/transfer", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			FromID  string  `json:"from_id"`
-			ToID    string  `json:"to_id"`
-			TokenID string  `json:"token_id"`
-			Amount  float64 `json:"amount"`
-		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+	router.HandleFunc("/onboarding/{participantID}/submit", func(w http.ResponseWriter, r *http.Request) {
+		participantID, err := actingParticipant(r, marketplace.Organizations, mux.Vars(r)["participantID"], PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
-		err := marketplace.SmartContract.TransferToken(req.FromID, req.ToID, req.Amount)
+		profile, err := marketplace.Onboarding.SubmitForVerification(participantID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(profile)
 	}).Methods("POST")
 
-	// Dispute routes
-	router.HandleFunc("/disputes/raise", func(w http.ResponseWriter, r *http.Request) {
+	router.HandleFunc("/onboarding/{participantID}/review", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			BookingID string `json:"booking_id"`
-			RaiserID  string `json:"raiser_id"`
-			Reason    string `json:"reason"`
+			Approve bool   `json:"approve"`
+			Reason  string `json:"reason"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.RaiseDispute(req.BookingID, req.RaiserID, req.Reason)
+		if principal, ok := PrincipalFromContext(r.Context()); ok && !isPlatformAdmin(marketplace, principal) {
+			http.Error(w, "Unauthorized: Admin role required", http.StatusForbidden)
+			return
+		}
+		profile, err := marketplace.Onboarding.Review(mux.Vars(r)["participantID"], req.Approve, req.Reason)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(profile)
 	}).Methods("POST")
 
-	router.HandleFunc("/disputes/resolve", func(w http.ResponseWriter, r *http.Request) {
+	// Location reference routes; q autocompletes by code or name
+	router.HandleFunc("/locations", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		limit := 10
+		if value := query.Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		json.NewEncoder(w).Encode(Locations().Search(query.Get("q"), TransportationMode(query.Get("mode")), limit))
+	}).Methods("GET")
+
+	// Service catalog, filtered by category, mode, packaging and cargo type
+	router.HandleFunc("/catalog", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		json.NewEncoder(w).Encode(Catalog().Items(CatalogFilter{
+			ServiceCategory: ServiceCategory(query.Get("category")),
+			Mode:            TransportationMode(query.Get("mode")),
+			PackagingMode:   PackagingMode(query.Get("packaging")),
+			CargoType:       CargoType(query.Get("cargo_type")),
+		}))
+	}).Methods("GET")
+
+	router.HandleFunc("/locations/{code}", func(w http.ResponseWriter, r *http.Request) {
+		location, ok := Locations().Lookup(mux.Vars(r)["code"])
+		if !ok {
+			http.Error(w, "location not found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(location)
+	}).Methods("GET")
+
+	// Freight quote routes
+	router.HandleFunc("/quotes", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			DisputeID  string `json:"dispute_id"`
-			ResolverID string `json:"resolver_id"`
-			Resolution string `json:"resolution"`
+			ServiceCategory    string                 `json:"service_category"`
+			CargoType          string                 `json:"cargo_type"`
+			PackagingMode      string                 `json:"packaging_mode"`
+			Origin             string                 `json:"origin"`
+			Destination        string                 `json:"destination"`
+			TransportationMode string                 `json:"transportation_mode"`
+			Rate               float64                `json:"rate"`
+			Currency           string                 `json:"currency"`
+			ValidUntil         string                 `json:"valid_until"`
+			ShipperID          string                 `json:"shipper_id"`
+			Items              []CargoLineItem        `json:"items"`
+			DangerousGoods     []DangerousGoodsItem   `json:"dangerous_goods"`
+			ColdChain          *ColdChainRequirements `json:"cold_chain"`
+			Legs               []RouteLeg             `json:"legs"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.ResolveDispute(req.DisputeID, req.ResolverID, req.Resolution)
+		validUntil, err := time.Parse(time.RFC3339, req.ValidUntil)
+		if err != nil {
+			http.Error(w, "Invalid date format", http.StatusBadRequest)
+			return
+		}
+		shipperID, err := actingParticipant(r, marketplace.Organizations, req.ShipperID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		cargo := CargoDetails{Items: req.Items, DangerousGoods: req.DangerousGoods, ColdChain: req.ColdChain}
+		var quote FreightQuote
+		if len(req.Legs) > 0 {
+			// A multi-leg route takes its origin, destination and mode from the legs
+			quote, err = marketplace.CreateMultimodalQuote(
+				shipperID,
+				ServiceCategory(req.ServiceCategory),
+				CargoType(req.CargoType),
+				PackagingMode(req.PackagingMode),
+				req.Legs,
+				req.Rate,
+				req.Currency,
+				validUntil,
+				cargo,
+			)
+		} else {
+			quote, err = marketplace.CreateFreightQuoteWithCargo(
+				shipperID,
+				ServiceCategory(req.ServiceCategory),
+				CargoType(req.CargoType),
+				PackagingMode(req.PackagingMode),
+				req.Origin,
+				req.Destination,
+				TransportationMode(req.TransportationMode),
+				req.Rate,
+				req.Currency,
+				validUntil,
+				cargo,
+			)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(quote)
 	}).Methods("POST")
 
-	// Transport mode specific logic route
-	router.HandleFunc("/transport/mode", func(w http.ResponseWriter, r *http.Request) {
+	// Place bid route
+	router.HandleFunc("/bids", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			TransportMode string `json:"transport_mode"`
+			QuoteID   string  `json:"quote_id"`
+			CarrierID string  `json:"carrier_id"`
+			BidAmount float64 `json:"bid_amount"`
+			Currency  string  `json:"currency"`
+			Leg       int     `json:"leg"` // route leg to bid on; omitted bids on every leg
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.TransportModeSpecificLogic(req.TransportMode)
+		carrierID, err := actingParticipant(r, marketplace.Organizations, req.CarrierID, PermBid)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var bid FreightBid
+		if req.Leg > 0 {
+			bid, err = marketplace.PlaceLegBid(req.QuoteID, req.Leg, carrierID, req.BidAmount, req.Currency)
+		} else {
+			bid, err = marketplace.PlaceBid(req.QuoteID, carrierID, req.BidAmount, req.Currency)
+		}
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		recordAction(r, marketplace.Organizations, "bid.placed", bid.ID)
+		json.NewEncoder(w).Encode(bid)
 	}).Methods("POST")
 
-	// Escrow routes
-	router.HandleFunc("/escrow/lock", func(w http.ResponseWriter, r *http.Request) {
-		var req struct {
-			ParticipantID string  `json:"participant_id"`
-			TokenID       string  `json:"token_id"`
-			Amount        float64 `json:"amount"`
+	// Bids on a quote, normalized into the quote's currency
+	router.HandleFunc("/quotes/{id}/bids", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		bids, err := marketplace.NormalizedBids(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
-			http.Error(w, "Invalid request", http.StatusBadRequest)
+		json.NewEncoder(w).Encode(bids)
+	}).Methods("GET")
+
+	// Carriers to invite to a quote, ranked by track record on its lanes
+	router.HandleFunc("/quotes/{id}/recommended-carriers", func(w http.ResponseWriter, r *http.Request) {
+		limit := 10
+		if value := r.URL.Query().Get("limit"); value != "" {
+			n, err := strconv.Atoi(value)
+			if err != nil || n <= 0 {
+				http.Error(w, "Invalid limit", http.StatusBadRequest)
+				return
+			}
+			limit = n
+		}
+		recs, err := marketplace.RecommendCarriers(mux.Vars(r)["id"], limit)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(recs)
+	}).Methods("GET")
+
+	// Surcharges a bid amount would carry on top of the freight if accepted now
+	router.HandleFunc("/quotes/{id}/surcharges", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		amount, err := strconv.ParseFloat(query.Get("amount"), 64)
+		if err != nil {
+			http.Error(w, "Invalid amount", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.LockTokensInEscrow(req.ParticipantID, req.TokenID, req.Amount)
+		leg := 0
+		if value := query.Get("leg"); value != "" {
+			if leg, err = strconv.Atoi(value); err != nil || leg < 0 {
+				http.Error(w, "Invalid leg", http.StatusBadRequest)
+				return
+			}
+		}
+		snapshot, err := marketplace.PreviewSurcharges(mux.Vars(r)["id"], amount, query.Get("currency"), leg)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
-	}).Methods("POST")
+		json.NewEncoder(w).Encode(snapshot)
+	}).Methods("GET")
 
-	router.HandleFunc("/escrow/release", func(w http.ResponseWriter, r *http.Request) {
+	// Award a quote to the cheapest bid from a carrier meeting reputation thresholds
+	router.HandleFunc("/quotes/{id}/auto-award", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			ParticipantID string  `json:"participant_id"`
-			TokenID       string  `json:"token_id"`
-			Amount        float64 `json:"amount"`
+			ShipperID string `json:"shipper_id"`
+			AwardRule
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.ReleaseEscrowTokens(req.ParticipantID, req.TokenID, req.Amount)
+		shipperID, err := actingParticipant(r, marketplace.Organizations, req.ShipperID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		booking, err := marketplace.AutoAward(mux.Vars(r)["id"], shipperID, req.AwardRule)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		recordAction(r, marketplace.Organizations, "bid.accept", booking.ID)
+		json.NewEncoder(w).Encode(booking)
 	}).Methods("POST")
 
-	router.HandleFunc("/escrow/refund", func(w http.ResponseWriter, r *http.Request) {
+	// Confirm booking route
+	router.HandleFunc("/bookings", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			ParticipantID string  `json:"participant_id"`
-			TokenID       string  `json:"token_id"`
-			Amount        float64 `json:"amount"`
+			QuoteID   string `json:"quote_id"`
+			BidID     string `json:"bid_id"`
+			ShipperID string `json:"shipper_id"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		err := marketplace.SmartContract.RefundEscrowTokens(req.ParticipantID, req.TokenID, req.Amount)
+		shipperID, err := actingParticipant(r, marketplace.Organizations, req.ShipperID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		booking, err := marketplace.ConfirmBooking(req.QuoteID, req.BidID, shipperID)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		w.WriteHeader(http.StatusOK)
+		recordAction(r, marketplace.Organizations, "booking.confirmed", booking.ID)
+		json.NewEncoder(w).Encode(booking)
 	}).Methods("POST")
 
-	// Membership subscription routes
-	router.HandleFunc("/membership/subscribe", func(w http.ResponseWriter, r *http.Request) {
+	// Per-leg departure and arrival events of a booked route
+	router.HandleFunc("/bookings/{id}/legs/{leg}/events", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		leg, err := strconv.Atoi(vars["leg"])
+		if err != nil {
+			http.Error(w, "Invalid leg", http.StatusBadRequest)
+			return
+		}
 		var req struct {
-			ParticipantID string `json:"participant_id"`
-			Type          string `json:"type"`
+			Status   string `json:"status"`
+			Location string `json:"location"`
+			Time     string `json:"time"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		mType := MembershipType(req.Type)
-		if mType != FreightForwarder && mType != CustomsBroker {
-			http.Error(w, "Invalid membership type", http.StatusBadRequest)
-			return
+		var at time.Time
+		if req.Time != "" {
+			if at, err = time.Parse(time.RFC3339, req.Time); err != nil {
+				http.Error(w, "Invalid date format", http.StatusBadRequest)
+				return
+			}
 		}
-		membership, err := marketplace.MembershipManager.Subscribe(req.ParticipantID, mType)
+		event, err := marketplace.RecordLegEvent(vars["id"], leg, LegStatus(req.Status), req.Location, at)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		json.NewEncoder(w).Encode(membership)
+		recordAction(r, marketplace.Organizations, "booking.tracked", vars["id"])
+		json.NewEncoder(w).Encode(event)
 	}).Methods("POST")
 
-	// Membership status check route
-	router.HandleFunc("/membership/status/{participantID}", func(w http.ResponseWriter, r *http.Request) {
-		vars := mux.Vars(r)
-		participantID := vars["participantID"]
-		active := marketplace.MembershipManager.CheckActive(participantID)
-		json.NewEncoder(w).Encode(map[string]bool{"active": active})
-	}).Methods("GET")
-
-	// Subscription routes
-	router.HandleFunc("/subscription/subscribe", func(w http.ResponseWriter, r *http.Request) {
+	// Transport documents issued for a booking, checked against mode rules at departure
+	router.HandleFunc("/bookings/{id}/documents", func(w http.ResponseWriter, r *http.Request) {
 		var req struct {
-			ParticipantID string `json:"participant_id"`
-			Type          string `json:"type"`
+			Documents []ShipmentDocument `json:"documents"`
 		}
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Invalid request", http.StatusBadRequest)
 			return
 		}
-		mType := MembershipType(req.Type)
-		if mType != FreightForwarder && mType != CustomsBroker {
-			http.Error(w, "Invalid subscription type", http.StatusBadRequest)
-			return
-		}
-		subscription, err := marketplace.SubscriptionService.Subscribe(req.ParticipantID, mType)
+		booking, err := marketplace.AttachDocuments(mux.Vars(r)["id"], req.Documents)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		json.NewEncoder(w).Encode(subscription)
+		recordAction(r, marketplace.Organizations, "booking.documents", booking.ID)
+		json.NewEncoder(w).Encode(booking)
+	}).Methods("POST")
+
+	// Every mode rule a booking and its quote currently break
+	router.HandleFunc("/bookings/{id}/rule-violations", func(w http.ResponseWriter, r *http.Request) {
+		violations, err := marketplace.CheckModeRules(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(violations)
+	}).Methods("GET")
+
+	// Surcharges fixed when the booking was confirmed, as billed on its invoice
+	router.HandleFunc("/bookings/{id}/surcharges", func(w http.ResponseWriter, r *http.Request) {
+		snapshot, err := marketplace.BookingSurcharges(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(snapshot)
+	}).Methods("GET")
+
+	router.HandleFunc("/surcharges/formulas", func(w http.ResponseWriter, r *http.Request) {
+		if marketplace.Surcharges == nil {
+			http.Error(w, "surcharges not configured", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(marketplace.Surcharges.Formulas())
+	}).Methods("GET")
+
+	// Aggregated oracle reading with the sources it was drawn from and those rejected
+	router.HandleFunc("/oracle/feeds/{feed}", func(w http.ResponseWriter, r *http.Request) {
+		if marketplace.Oracle == nil {
+			http.Error(w, "oracle not configured", http.StatusNotFound)
+			return
+		}
+		reading, err := marketplace.Oracle.Reading(OracleFeed(mux.Vars(r)["feed"]), r.URL.Query().Get("key"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadGateway)
+			return
+		}
+		json.NewEncoder(w).Encode(reading)
+	}).Methods("GET")
+
+	router.HandleFunc("/bookings/{id}/tracking", func(w http.ResponseWriter, r *http.Request) {
+		events, err := marketplace.TrackingEvents(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(events)
+	}).Methods("GET")
+
+	// Invoice routes
+	router.HandleFunc("/invoices", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string `json:"participant_id"`
+			BookingID     string `json:"booking_id"`
+			DueDate       string `json:"due_date"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		dueDate, err := time.Parse(time.RFC3339, req.DueDate)
+		if err != nil {
+			http.Error(w, "Invalid date format", http.StatusBadRequest)
+			return
+		}
+		issuerID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		booking, err := marketplace.GetBooking(req.BookingID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if issuerID != booking.ShipperID && issuerID != booking.CarrierID {
+			http.Error(w, "only a party to the booking can invoice it", http.StatusForbidden)
+			return
+		}
+		invoice, err := marketplace.InvoiceService.GenerateInvoice(req.BookingID, dueDate)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "invoice.issue", invoice.ID)
+		json.NewEncoder(w).Encode(invoice)
+	}).Methods("POST")
+
+	router.HandleFunc("/invoices/{id}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		data, err := marketplace.InvoiceService.ExportJSON(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(data)
+	}).Methods("GET")
+
+	router.HandleFunc("/invoices/{id}/ubl", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		data, err := marketplace.InvoiceService.ExportUBL(vars["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/xml")
+		w.Write(data)
+	}).Methods("GET")
+
+	router.HandleFunc("/invoices/{id}/payments", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var req struct {
+			Amount    float64 `json:"amount"`
+			Reference string  `json:"reference"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if _, err := actingParticipant(r, marketplace.Organizations, "", PermPay); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		invoice, err := marketplace.InvoiceService.RecordPayment(vars["id"], req.Amount, req.Reference)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "invoice.payment", invoice.ID)
+		json.NewEncoder(w).Encode(invoice)
+	}).Methods("POST")
+
+	// Token settlement of a booking's invoice by its shipper
+	router.HandleFunc("/bookings/{id}/payments", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			PayerID string  `json:"payer_id"`
+			TokenID string  `json:"token_id"`
+			Amount  float64 `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		payerID, err := actingParticipant(r, marketplace.Organizations, req.PayerID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		bookingID := mux.Vars(r)["id"]
+		if err := marketplace.PayBooking(bookingID, payerID, req.TokenID, req.Amount); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "booking.payment", bookingID)
+		invoice, err := marketplace.InvoiceService.GetInvoiceForBooking(bookingID)
+		if err != nil {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		json.NewEncoder(w).Encode(invoice)
+	}).Methods("POST")
+
+	// Governance routes
+	router.HandleFunc("/proposals", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Title       string                  `json:"title"`
+			Description string                  `json:"description"`
+			ProposerID  string                  `json:"proposer_id"`
+			Upgrade     *ContractUpgradePayload `json:"upgrade"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		proposerID, err := actingParticipant(r, marketplace.Organizations, req.ProposerID, PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if req.Upgrade != nil {
+			proposal, err := governance.ProposeUpgrade(proposerID, *req.Upgrade)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			json.NewEncoder(w).Encode(proposal)
+			return
+		}
+		proposal, err := governance.CreateProposal(req.Title, req.Description, proposerID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(proposal)
+	}).Methods("POST")
+
+	router.HandleFunc("/proposals/{id}/vote", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		proposalID := vars["id"]
+
+		var req struct {
+			ParticipantID string `json:"participant_id"`
+			Approve       bool   `json:"approve"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		participantID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err = governance.VoteProposal(proposalID, participantID, req.Approve)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Role assignment route
+	router.HandleFunc("/roles/assign", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			UserID string `json:"user_id"`
+			Role   string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		role := Role(req.Role)
+		if role != AdminRole && role != ShipperRole && role != CarrierRole && role != BrokerRole && role != ForwarderRole {
+			http.Error(w, "Invalid role", http.StatusBadRequest)
+			return
+		}
+		adminID, err := requireAdmin(r, marketplace)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		marketplace.AccessControl.AssignRole(req.UserID, role)
+		recordAction(r, marketplace.Organizations, "role.assign", adminID+" assigned "+req.Role+" to "+req.UserID)
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Token routes
+	router.HandleFunc("/tokens/mint", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string  `json:"participant_id"`
+			TokenID       string  `json:"token_id"`
+			Amount        float64 `json:"amount"`
+			ProposalID    string  `json:"proposal_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		// The caller is the authenticated admin; the body only names the recipient
+		adminID, err := requireAdmin(r, marketplace)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		mint := func() error {
+			return marketplace.SmartContract.MintTokenID(req.ParticipantID, req.TokenID, req.Amount)
+		}
+		// Large mints, counted over the admin's recent mints, additionally
+		// need an approved multisig proposal
+		if marketplace.MultiSig != nil {
+			payload := MintPayload{ParticipantID: req.ParticipantID, TokenID: req.TokenID, Amount: req.Amount}
+			err = marketplace.MultiSig.Mint(adminID, req.ProposalID, payload, mint)
+		} else {
+			err = mint()
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/tokens/transfer", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			FromID  string  `json:"from_id"`
+			ToID    string  `json:"to_id"`
+			TokenID string  `json:"token_id"`
+			Amount  float64 `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		fromID, err := actingParticipant(r, marketplace.Organizations, req.FromID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err = marketplace.SmartContract.TransferToken(fromID, req.ToID, req.Amount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Dispute routes
+	router.HandleFunc("/disputes/raise", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			BookingID string `json:"booking_id"`
+			RaiserID  string `json:"raiser_id"`
+			Reason    string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		raiserID, err := actingParticipant(r, marketplace.Organizations, req.RaiserID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err = marketplace.SmartContract.RaiseDispute(req.BookingID, raiserID, req.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/disputes/resolve", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			DisputeID  string `json:"dispute_id"`
+			ResolverID string `json:"resolver_id"`
+			Resolution string `json:"resolution"`
+			LiableID   string `json:"liable_id"` // party the dispute is decided against
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		resolverID, err := actingParticipant(r, marketplace.Organizations, req.ResolverID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err = marketplace.SmartContract.ResolveDispute(req.DisputeID, resolverID, req.Resolution)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if req.LiableID != "" && marketplace.Disputes != nil {
+			if err := marketplace.Disputes.AssignLiability(req.DisputeID, req.LiableID); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Rate contract routes; shippers accept a carrier's contract and book its
+	// lanes without bidding
+	router.HandleFunc("/rate-contracts", func(w http.ResponseWriter, r *http.Request) {
+		var contract RateContract
+		if err := json.NewDecoder(r.Body).Decode(&contract); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		carrierID, err := actingParticipant(r, marketplace.Organizations, contract.CarrierID, PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		contract.CarrierID = carrierID
+		contract, err = marketplace.CreateRateContract(contract)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "rate_contract.create", contract.ID)
+		json.NewEncoder(w).Encode(contract)
+	}).Methods("POST")
+
+	router.HandleFunc("/rate-contracts/{id}", func(w http.ResponseWriter, r *http.Request) {
+		contract, err := marketplace.Contracts.Get(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(contract)
+	}).Methods("GET")
+
+	router.HandleFunc("/rate-contracts/{id}/accept", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ShipperID string `json:"shipper_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		shipperID, err := actingParticipant(r, marketplace.Organizations, req.ShipperID, PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		contract, err := marketplace.AcceptRateContract(mux.Vars(r)["id"], shipperID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "rate_contract.accept", contract.ID)
+		json.NewEncoder(w).Encode(contract)
+	}).Methods("POST")
+
+	router.HandleFunc("/rate-contracts/{id}/utilization", func(w http.ResponseWriter, r *http.Request) {
+		utilization, err := marketplace.Contracts.Utilization(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(utilization)
+	}).Methods("GET")
+
+	router.HandleFunc("/rate-contracts/{id}/bookings", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ShipperID string `json:"shipper_id"`
+			ContractShipment
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		shipperID, err := actingParticipant(r, marketplace.Organizations, req.ShipperID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		booking, err := marketplace.BookContract(mux.Vars(r)["id"], shipperID, req.ContractShipment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "rate_contract.book", booking.ID)
+		json.NewEncoder(w).Encode(booking)
+	}).Methods("POST")
+
+	router.HandleFunc("/participants/{participantID}/rate-contracts", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(marketplace.Contracts.ForParticipant(mux.Vars(r)["participantID"]))
+	}).Methods("GET")
+
+	// Reputation routes; booking parties rate each other after delivery
+	router.HandleFunc("/bookings/{id}/ratings", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RaterID string `json:"rater_id"`
+			Score   int    `json:"score"`
+			Comment string `json:"comment"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		raterID, err := actingParticipant(r, marketplace.Organizations, req.RaterID, PermBook)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		rating, err := marketplace.RateCounterparty(mux.Vars(r)["id"], raterID, req.Score, req.Comment)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(rating)
+	}).Methods("POST")
+
+	router.HandleFunc("/participants/{participantID}/reputation", func(w http.ResponseWriter, r *http.Request) {
+		score, ok := marketplace.Reputation.Published(mux.Vars(r)["participantID"])
+		if !ok {
+			http.Error(w, "no published reputation", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(score)
+	}).Methods("GET")
+
+	// Republishes a reputation after disputes or deliveries change it
+	router.HandleFunc("/participants/{participantID}/reputation", func(w http.ResponseWriter, r *http.Request) {
+		score, err := marketplace.PublishReputation(mux.Vars(r)["participantID"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(score)
+	}).Methods("POST")
+
+	router.HandleFunc("/participants/{participantID}/ratings", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(marketplace.Reputation.Received(mux.Vars(r)["participantID"]))
+	}).Methods("GET")
+
+	router.HandleFunc("/ratings/{id}/report", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Reason string `json:"reason"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		rating, err := marketplace.Reputation.Report(mux.Vars(r)["id"], req.Reason)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(rating)
+	}).Methods("POST")
+
+	router.HandleFunc("/ratings/{id}/moderate", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Remove bool   `json:"remove"`
+			Note   string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		rating, err := marketplace.Reputation.Moderate(mux.Vars(r)["id"], req.Remove, req.Note)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(rating)
+	}).Methods("POST")
+
+	// Transport mode specific logic route
+	router.HandleFunc("/transport/mode", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			TransportMode string `json:"transport_mode"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		rule, err := marketplace.SmartContract.TransportModeSpecificLogic(req.TransportMode)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(rule)
+	}).Methods("POST")
+
+	// Escrow routes
+	router.HandleFunc("/escrow/lock", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string  `json:"participant_id"`
+			TokenID       string  `json:"token_id"`
+			Amount        float64 `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		participantID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err = marketplace.SmartContract.LockTokensInEscrow(participantID, req.TokenID, req.Amount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/escrow/release", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string  `json:"participant_id"`
+			TokenID       string  `json:"token_id"`
+			Amount        float64 `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if _, err := requireAdmin(r, marketplace); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err := marketplace.SmartContract.ReleaseEscrowTokens(req.ParticipantID, req.TokenID, req.Amount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/escrow/refund", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string  `json:"participant_id"`
+			TokenID       string  `json:"token_id"`
+			Amount        float64 `json:"amount"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if _, err := requireAdmin(r, marketplace); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		err := marketplace.SmartContract.RefundEscrowTokens(req.ParticipantID, req.TokenID, req.Amount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Membership subscription routes
+	router.HandleFunc("/membership/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string `json:"participant_id"`
+			Type          string `json:"type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		participantID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermManageAccount)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mType := MembershipType(req.Type)
+		if !marketplace.MembershipManager.HasPlan(mType) {
+			http.Error(w, "Invalid membership type", http.StatusBadRequest)
+			return
+		}
+		membership, err := marketplace.MembershipManager.Subscribe(participantID, mType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(membership)
+	}).Methods("POST")
+
+	// Membership status check route
+	router.HandleFunc("/membership/status/{participantID}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		participantID := vars["participantID"]
+		active := marketplace.MembershipManager.CheckActive(participantID)
+		json.NewEncoder(w).Encode(map[string]bool{"active": active})
+	}).Methods("GET")
+
+	// Subscription routes
+	router.HandleFunc("/subscription/subscribe", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string `json:"participant_id"`
+			Type          string `json:"type"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		participantID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		mType := MembershipType(req.Type)
+		if !marketplace.MembershipManager.HasPlan(mType) {
+			http.Error(w, "Invalid subscription type", http.StatusBadRequest)
+			return
+		}
+		subscription, err := marketplace.SubscriptionService.Subscribe(participantID, mType)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(subscription)
 	}).Methods("POST")
 
 	router.HandleFunc("/subscription/status/{participantID}", func(w http.ResponseWriter, r *http.Request) {
 		vars := mux.Vars(r)
-		participantID := vars["participantID"]
-		active := marketplace.SubscriptionService.CheckActive(participantID)
-		json.NewEncoder(w).Encode(map[string]bool{"active": active})
+		participantID := vars["participantID"]
+		active := marketplace.SubscriptionService.CheckActive(participantID)
+		json.NewEncoder(w).Encode(map[string]bool{"active": active})
+	}).Methods("GET")
+
+	router.HandleFunc("/subscription/renew", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ParticipantID string `json:"participant_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		participantID, err := actingParticipant(r, marketplace.Organizations, req.ParticipantID, PermPay)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		membership, err := marketplace.SubscriptionService.Renew(participantID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(membership)
+	}).Methods("POST")
+
+	router.HandleFunc("/subscription/benefits/{participantID}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		benefits, err := marketplace.SmartContract.MembershipBenefits(vars["participantID"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(benefits)
+	}).Methods("GET")
+
+	return router
+}
+
+// setupAuthRoutes registers the account, email verification and token routes
+func setupAuthRoutes(router *mux.Router, marketplace *Marketplace, auth *AuthService) {
+	// Registration creates the account and the participant it acts for
+	router.HandleFunc("/auth/register", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email           string `json:"email"`
+			Password        string `json:"password"`
+			Name            string `json:"name"`
+			Type            string `json:"type"`
+			InvitationToken string `json:"invitation_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		pType := ParticipantType(req.Type)
+		if req.InvitationToken == "" && (req.Name == "" || !IsValidParticipantType(pType)) {
+			http.Error(w, "Valid name and type are required", http.StatusBadRequest)
+			return
+		}
+		invited := req.InvitationToken != "" && marketplace.Organizations != nil
+		if invited {
+			if err := marketplace.Organizations.CheckInvitation(req.InvitationToken, req.Email); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		account, err := auth.Register(req.Email, req.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		// Invited users join the inviting organization's participant
+		var participantID string
+		if invited {
+			if _, err := marketplace.Organizations.AcceptInvitation(req.InvitationToken, account.ID, account.Email); err != nil {
+				auth.DeleteAccount(account.ID)
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			org, _ := marketplace.Organizations.OrganizationForUser(account.ID)
+			participantID = org.ParticipantID
+		} else {
+			participant := marketplace.RegisterParticipant(req.Name, pType)
+			participantID = participant.ID
+			if marketplace.Organizations != nil {
+				if _, err := marketplace.Organizations.CreateOrganization(req.Name, participant.ID, account.ID); err != nil {
+					auth.DeleteAccount(account.ID)
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+		if err := auth.LinkParticipant(account.ID, participantID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		account.ParticipantID = participantID
+		json.NewEncoder(w).Encode(account)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/verify-email", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+			Code  string `json:"code"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := auth.VerifyEmail(req.Email, req.Code); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/resend-code", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string `json:"email"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := auth.ResendVerificationCode(req.Email); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email    string `json:"email"`
+			Password string `json:"password"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		tokens, err := auth.Login(req.Email, req.Password)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tokens)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/refresh", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		tokens, err := auth.Refresh(req.RefreshToken)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(tokens)
+	}).Methods("POST")
+
+	router.HandleFunc("/auth/logout", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := auth.Logout(req.RefreshToken); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	// Existing users accept an invitation, then log in again to act for the organization
+	router.HandleFunc("/invitations/accept", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Token string `json:"token"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		principal, _ := PrincipalFromContext(r.Context())
+		if marketplace.Organizations == nil {
+			http.Error(w, "Organizations not enabled", http.StatusNotFound)
+			return
+		}
+		if principal.ParticipantID != "" {
+			http.Error(w, "Account already acts for a participant", http.StatusBadRequest)
+			return
+		}
+		member, err := marketplace.Organizations.AcceptInvitation(req.Token, principal.UserID, principal.Email)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		org, _ := marketplace.Organizations.GetOrganization(member.OrgID)
+		if err := auth.LinkParticipant(principal.UserID, org.ParticipantID); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(member)
+	}).Methods("POST")
+
+	// Current account, for the frontend AuthContext
+	router.HandleFunc("/account", func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		account, err := auth.GetAccount(principal.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(account)
+	}).Methods("GET")
+}
+
+// setupOrganizationRoutes registers member, invitation and audit routes
+func setupOrganizationRoutes(router *mux.Router, orgs *OrganizationService, auth *AuthService) {
+	// actor returns the authenticated user acting on an organization
+	actor := func(r *http.Request) string {
+		principal, _ := PrincipalFromContext(r.Context())
+		return principal.UserID
+	}
+
+	router.HandleFunc("/organizations/{id}", func(w http.ResponseWriter, r *http.Request) {
+		org, err := orgs.GetOrganization(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		if err := orgs.checkPermission(org.ID, actor(r), PermView); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"organization": org,
+			"members":      orgs.Members(org.ID),
+		})
+	}).Methods("GET")
+
+	router.HandleFunc("/organizations/{id}/invitations", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Email string    `json:"email"`
+			Roles []OrgRole `json:"roles"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		invitation, err := orgs.Invite(mux.Vars(r)["id"], actor(r), req.Email, req.Roles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(invitation)
+	}).Methods("POST")
+
+	router.HandleFunc("/organizations/{id}/members/{userID}/roles", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		var req struct {
+			Roles []OrgRole `json:"roles"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		member, err := orgs.SetMemberRoles(vars["id"], actor(r), vars["userID"], req.Roles)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(member)
+	}).Methods("PUT")
+
+	router.HandleFunc("/organizations/{id}/members/{userID}", func(w http.ResponseWriter, r *http.Request) {
+		vars := mux.Vars(r)
+		if err := orgs.RemoveMember(vars["id"], actor(r), vars["userID"]); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := auth.UnlinkParticipant(vars["userID"]); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("DELETE")
+
+	router.HandleFunc("/organizations/{id}/audit", func(w http.ResponseWriter, r *http.Request) {
+		orgID := mux.Vars(r)["id"]
+		if err := orgs.checkPermission(orgID, actor(r), PermManageMembers); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(orgs.AuditLog(orgID))
 	}).Methods("GET")
+}
 
-	return router
+// setupMultiSigRoutes registers multisig proposal, approval and treasury routes.
+// Signer IDs are user account IDs.
+func setupMultiSigRoutes(router *mux.Router, marketplace *Marketplace) {
+	msa := marketplace.MultiSig
+
+	router.HandleFunc("/multisig/proposals", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ProposerID string            `json:"proposer_id"`
+			Operation  MultiSigOperation `json:"operation"`
+			Payload    json.RawMessage   `json:"payload"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if principal, ok := PrincipalFromContext(r.Context()); ok {
+			req.ProposerID = principal.UserID
+		}
+		payload, err := DecodeMultiSigPayload(req.Operation, req.Payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		proposal, err := msa.Propose(req.ProposerID, req.Operation, payload)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(proposal)
+	}).Methods("POST")
+
+	router.HandleFunc("/multisig/proposals/{id}", func(w http.ResponseWriter, r *http.Request) {
+		proposal, err := msa.GetProposal(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(proposal)
+	}).Methods("GET")
+
+	// Approvals carry an ed25519 signature, base64 encoded, over the proposal digest
+	router.HandleFunc("/multisig/proposals/{id}/approvals", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			SignerID  string `json:"signer_id"`
+			Signature []byte `json:"signature"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if err := msa.Approve(mux.Vars(r)["id"], req.SignerID, req.Signature); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+
+	router.HandleFunc("/treasury/withdraw", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			ProposalID string `json:"proposal_id"`
+			TreasuryWithdrawalPayload
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		if marketplace.SmartContract == nil {
+			http.Error(w, "token ledger not configured", http.StatusServiceUnavailable)
+			return
+		}
+		payload := req.TreasuryWithdrawalPayload
+		err := msa.Execute(req.ProposalID, OpTreasuryWithdrawal, payload, func() error {
+			return marketplace.SmartContract.TokenLedger.TransferTokens(defaultTreasuryID, payload.ToID, payload.TokenID, payload.Amount)
+		})
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "treasury.withdrawn", payload.ToID)
+		w.WriteHeader(http.StatusOK)
+	}).Methods("POST")
+}
+
+// setupContractRoutes registers routes for inspecting and upgrading the
+// marketplace rule set contracts
+func setupContractRoutes(router *mux.Router, marketplace *Marketplace, governance *Governance) {
+	type contractStatus struct {
+		Name    string            `json:"name"`
+		Version string            `json:"version"`
+		Pending *PendingUpgrade   `json:"pending,omitempty"`
+		History []ContractVersion `json:"history"`
+	}
+	status := func(contract *ProxyContract) contractStatus {
+		s := contractStatus{Name: contract.Name(), Version: contract.Version(), History: contract.History()}
+		if pending, ok := contract.Pending(); ok {
+			s.Pending = &pending
+		}
+		return s
+	}
+
+	router.HandleFunc("/contracts", func(w http.ResponseWriter, r *http.Request) {
+		contracts := []contractStatus{}
+		for _, contract := range marketplace.Rules.Contracts() {
+			contracts = append(contracts, status(contract))
+		}
+		json.NewEncoder(w).Encode(contracts)
+	}).Methods("GET")
+
+	// Upgrades are authorized by an approved multisig or governance proposal
+	router.HandleFunc("/contracts/{name}/upgrades", func(w http.ResponseWriter, r *http.Request) {
+		contract, err := marketplace.Rules.Contract(mux.Vars(r)["name"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		var req struct {
+			ProposalID string `json:"proposal_id"`
+			Version    string `json:"version"`
+			Authority  string `json:"authority"` // "multisig" or "governance"
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		var authorizer UpgradeAuthorizer
+		switch {
+		case req.Authority == "multisig" && marketplace.MultiSig != nil:
+			authorizer = marketplace.MultiSig
+		case req.Authority == "governance" && governance != nil:
+			authorizer = governance
+		default:
+			http.Error(w, "Unknown upgrade authority", http.StatusBadRequest)
+			return
+		}
+		pending, err := contract.ScheduleUpgrade(req.ProposalID, req.Version, authorizer)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(pending)
+	}).Methods("POST")
+
+	router.HandleFunc("/contracts/{name}/upgrades/apply", func(w http.ResponseWriter, r *http.Request) {
+		contract, err := marketplace.Rules.Contract(mux.Vars(r)["name"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		version, err := contract.ApplyUpgrade()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(version)
+	}).Methods("POST")
+
+	// Withdraws a scheduled upgrade before its timelock expires
+	router.HandleFunc("/contracts/{name}/upgrades/cancel", func(w http.ResponseWriter, r *http.Request) {
+		contract, err := marketplace.Rules.Contract(mux.Vars(r)["name"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		cancelled, err := contract.CancelUpgrade()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		recordAction(r, marketplace.Organizations, "contract.upgrade.cancel", contract.Name()+" "+cancelled.Version)
+		json.NewEncoder(w).Encode(cancelled)
+	}).Methods("POST")
+}
+
+// setupComplianceRoutes registers compliance log recording, query and export routes
+func setupComplianceRoutes(router *mux.Router, compliance *ComplianceLog) {
+	router.HandleFunc("/compliance/records", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Type          ComplianceEventType `json:"type"`
+			ParticipantID string              `json:"participant_id"`
+			BookingID     string              `json:"booking_id"`
+			Details       string              `json:"details"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		principal, _ := PrincipalFromContext(r.Context())
+		record, err := compliance.Record(req.Type, req.ParticipantID, req.BookingID, req.Details, principal.UserID)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(record)
+	}).Methods("POST")
+
+	// Query filters: participant_id, booking_id, type (repeatable), from and
+	// to (RFC 3339). format=csv exports CSV instead of JSON.
+	router.HandleFunc("/compliance/records", func(w http.ResponseWriter, r *http.Request) {
+		query := r.URL.Query()
+		filter := ComplianceFilter{
+			ParticipantID: query.Get("participant_id"),
+			BookingID:     query.Get("booking_id"),
+		}
+		for _, t := range query["type"] {
+			filter.Types = append(filter.Types, ComplianceEventType(t))
+		}
+		for param, bound := range map[string]*time.Time{"from": &filter.From, "to": &filter.To} {
+			if value := query.Get(param); value != "" {
+				parsed, err := time.Parse(time.RFC3339, value)
+				if err != nil {
+					http.Error(w, "Invalid "+param+" time", http.StatusBadRequest)
+					return
+				}
+				*bound = parsed
+			}
+		}
+		if query.Get("format") == "csv" {
+			w.Header().Set("Content-Type", "text/csv")
+			w.Header().Set("Content-Disposition", `attachment; filename="compliance.csv"`)
+			compliance.ExportCSV(w, filter)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		compliance.ExportJSON(w, filter)
+	}).Methods("GET")
+
+	router.HandleFunc("/compliance/verify", func(w http.ResponseWriter, r *http.Request) {
+		if err := compliance.Verify(); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]bool{"valid": true})
+	}).Methods("GET")
+}
+
+// setupScreeningRoutes registers restricted-party screening and review routes
+func setupScreeningRoutes(router *mux.Router, marketplace *Marketplace) {
+	screening := marketplace.Screening
+
+	router.HandleFunc("/screening/participants/{participantID}", func(w http.ResponseWriter, r *http.Request) {
+		result, err := marketplace.ScreenParticipant(mux.Vars(r)["participantID"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}).Methods("POST")
+
+	router.HandleFunc("/screening/reviews", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(screening.PendingReviews())
+	}).Methods("GET")
+
+	router.HandleFunc("/screening/reviews/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			FalsePositive bool   `json:"false_positive"`
+			Note          string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		principal, _ := PrincipalFromContext(r.Context())
+		result, err := screening.Review(mux.Vars(r)["id"], principal.UserID, req.FalsePositive, req.Note)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(result)
+	}).Methods("POST")
+}
+
+// setupColdChainRoutes registers IoT sensor reading and cold-chain status routes
+func setupColdChainRoutes(router *mux.Router, coldChain *ColdChainMonitor) {
+	router.HandleFunc("/bookings/{id}/readings", func(w http.ResponseWriter, r *http.Request) {
+		var reading SensorReading
+		if err := json.NewDecoder(r.Body).Decode(&reading); err != nil {
+			http.Error(w, "Invalid request", http.StatusBadRequest)
+			return
+		}
+		excursions, err := coldChain.RecordReading(mux.Vars(r)["id"], reading)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		json.NewEncoder(w).Encode(excursions)
+	}).Methods("POST")
+
+	router.HandleFunc("/bookings/{id}/cold-chain", func(w http.ResponseWriter, r *http.Request) {
+		status, err := coldChain.GetStatus(mux.Vars(r)["id"])
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(status)
+	}).Methods("GET")
+}
+
+// requireAdmin resolves the authenticated caller of a platform operation and
+// checks they hold the Admin role. Body-supplied IDs never identify the caller.
+func requireAdmin(r *http.Request, marketplace *Marketplace) (string, error) {
+	principal, ok := PrincipalFromContext(r.Context())
+	if !ok || principal.ParticipantID == "" {
+		return "", errors.New("authentication required")
+	}
+	if !isPlatformAdmin(marketplace, principal) {
+		return "", errors.New("admin role required")
+	}
+	return principal.ParticipantID, nil
+}
+
+// isPlatformAdmin reports whether a principal holds the platform Admin role.
+// The role is granted to a participant, so with organizations enabled only
+// the organization's own admins exercise it.
+func isPlatformAdmin(marketplace *Marketplace, principal Principal) bool {
+	if marketplace.AccessControl == nil || !marketplace.AccessControl.CheckRole(principal.ParticipantID, AdminRole) {
+		return false
+	}
+	return marketplace.Organizations == nil ||
+		marketplace.Organizations.HasMemberRole(principal.UserID, principal.ParticipantID, OrgAdmin)
+}
+
+// recordAction attributes a completed action to the authenticated user in
+// their organization's audit log
+func recordAction(r *http.Request, orgs *OrganizationService, action, details string) {
+	if principal, ok := PrincipalFromContext(r.Context()); ok && orgs != nil {
+		orgs.RecordAction(principal.UserID, action, details)
+	}
+}
+
+// RegisterDocsRoutes serves the list of registered routes and their methods
+func RegisterDocsRoutes(router *mux.Router) {
+	router.HandleFunc("/docs", func(w http.ResponseWriter, r *http.Request) {
+		routes := []map[string]interface{}{}
+		router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+			path, err := route.GetPathTemplate()
+			if err != nil {
+				return nil
+			}
+			methods, _ := route.GetMethods()
+			routes = append(routes, map[string]interface{}{"path": path, "methods": methods})
+			return nil
+		})
+		json.NewEncoder(w).Encode(routes)
+	}).Methods("GET")
 }
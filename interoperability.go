@@ -1,10 +1,8 @@
 package main
 
 import (
-	"errors"
 	"fmt"
 	"sync"
-	"time"
 )
 
 // CrossChainBridge simulates a bridge between two blockchains
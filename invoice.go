@@ -0,0 +1,555 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"log"
+	"math"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// InvoiceStatus defines the settlement status of an invoice
+type InvoiceStatus string
+
+const (
+	InvoiceIssued        InvoiceStatus = "Issued"
+	InvoicePartiallyPaid InvoiceStatus = "PartiallyPaid"
+	InvoicePaid          InvoiceStatus = "Paid"
+)
+
+// LineItemType defines the kind of charge on an invoice line
+type LineItemType string
+
+const (
+	FreightCharge            LineItemType = "Freight"
+	FuelSurcharge            LineItemType = "FuelSurcharge"
+	PortFeeCharge            LineItemType = "PortFee"
+	PeakSeasonSurcharge      LineItemType = "PeakSeasonSurcharge"
+	CurrencyAdjustmentCharge LineItemType = "CurrencyAdjustment"
+	ColdChainPenalty         LineItemType = "ColdChainPenalty"
+)
+
+// InvoiceLineItem represents a single charge on an invoice
+type InvoiceLineItem struct {
+	ID          int
+	Type        LineItemType
+	Description string
+	Quantity    float64
+	UnitPrice   float64
+	Amount      float64
+}
+
+// InvoicePayment represents a payment applied against an invoice
+type InvoicePayment struct {
+	Amount    float64
+	Reference string
+	PaidAt    time.Time
+}
+
+// Invoice represents a bill issued to a shipper for a confirmed booking
+type Invoice struct {
+	ID         string
+	BookingID  string
+	QuoteID    string
+	BidID      string
+	SellerID   string // carrier being paid
+	BuyerID    string // shipper being billed
+	Currency   string // currency of the accepted bid
+	LineItems  []InvoiceLineItem
+	Total      float64
+	AmountPaid float64
+	Payments   []InvoicePayment
+	IssuedAt   time.Time
+	DueDate    time.Time
+	Status     InvoiceStatus
+
+	// Exchange rate locked in at the first token settlement
+	SettlementCurrency string
+	SettlementRate     float64 // settlement currency units per invoice currency unit
+	RateLockedAt       time.Time
+}
+
+// Outstanding returns the amount still owed on the invoice
+func (inv Invoice) Outstanding() float64 {
+	return inv.Total - inv.AmountPaid
+}
+
+// IsOverdue reports whether the invoice is unpaid past its due date
+func (inv Invoice) IsOverdue(now time.Time) bool {
+	return inv.Status != InvoicePaid && now.After(inv.DueDate)
+}
+
+// InvoiceService generates and settles invoices for marketplace bookings
+type InvoiceService struct {
+	marketplace *Marketplace
+	oracle      *OracleIntegration
+
+	// settlementCurrency is the currency token payments are denominated in
+	settlementCurrency string
+
+	invoices  map[string]Invoice
+	byBooking map[string]string // bookingID -> invoiceID
+	mutex     sync.RWMutex
+}
+
+// NewInvoiceService creates a new InvoiceService instance
+func NewInvoiceService(marketplace *Marketplace, oracle *OracleIntegration) *InvoiceService {
+	return &InvoiceService{
+		marketplace:        marketplace,
+		oracle:             oracle,
+		settlementCurrency: DefaultCurrency,
+		invoices:           make(map[string]Invoice),
+		byBooking:          make(map[string]string),
+	}
+}
+
+// GenerateInvoice derives an invoice from a booking and its accepted bid
+func (is *InvoiceService) GenerateInvoice(bookingID string, dueDate time.Time) (Invoice, error) {
+	booking, err := is.marketplace.GetBooking(bookingID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	quote, err := is.marketplace.GetQuote(booking.QuoteID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	bid, err := is.marketplace.GetBid(booking.QuoteID, booking.BidID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if !dueDate.After(booking.BookingTime) {
+		return Invoice{}, errors.New("due date must be after the booking time")
+	}
+
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	if _, exists := is.byBooking[bookingID]; exists {
+		return Invoice{}, errors.New("invoice already issued for booking")
+	}
+
+	currency := bid.Currency
+	if currency == "" {
+		currency = quote.Currency
+	}
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+
+	lineItems, err := is.buildLineItems(quote, booking, bid, currency)
+	if err != nil {
+		return Invoice{}, err
+	}
+	// Cold-chain penalty terms are credited against the freight charge
+	if is.marketplace.ColdChain != nil {
+		if penalty := is.marketplace.ColdChain.Penalties(bookingID); penalty > 0 {
+			lineItems = append(lineItems, InvoiceLineItem{
+				ID:          len(lineItems) + 1,
+				Type:        ColdChainPenalty,
+				Description: "Cold-chain excursion penalty",
+				Quantity:    1,
+				UnitPrice:   -penalty,
+				Amount:      -penalty,
+			})
+		}
+	}
+
+	total := 0.0
+	for _, item := range lineItems {
+		total += item.Amount
+	}
+
+	invoice := Invoice{
+		ID:        uuid.New().String(),
+		BookingID: bookingID,
+		QuoteID:   booking.QuoteID,
+		BidID:     booking.BidID,
+		SellerID:  booking.CarrierID,
+		BuyerID:   booking.ShipperID,
+		Currency:  currency,
+		LineItems: lineItems,
+		Total:     roundAmount(total),
+		IssuedAt:  time.Now(),
+		DueDate:   dueDate,
+		Status:    InvoiceIssued,
+	}
+
+	// Anchor on the blockchain before the invoice is issued
+	data, err := json.Marshal(invoice)
+	if err != nil {
+		log.Printf("Error marshaling invoice: %v", err)
+		return Invoice{}, err
+	}
+	err = is.marketplace.blockchain.AddBlock(string(data))
+	if err != nil {
+		log.Printf("Error adding invoice to blockchain: %v", err)
+		return Invoice{}, err
+	}
+	is.invoices[invoice.ID] = invoice
+	is.byBooking[bookingID] = invoice.ID
+
+	log.Printf("Invoice issued: %s for booking %s", invoice.ID, bookingID)
+	return invoice, nil
+}
+
+// buildLineItems prices the freight and surcharges for a booking. Surcharges
+// are billed from the snapshot taken at confirmation; bookings confirmed
+// without the surcharge engine agreed to none.
+func (is *InvoiceService) buildLineItems(quote FreightQuote, booking Booking, bid FreightBid, currency string) ([]InvoiceLineItem, error) {
+	items := []InvoiceLineItem{{
+		ID:          1,
+		Type:        FreightCharge,
+		Description: "Freight " + quote.OriginCode + " to " + quote.DestinationCode + " (" + string(quote.TransportationMode) + ")",
+		Quantity:    1,
+		UnitPrice:   bid.BidAmount,
+		Amount:      roundAmount(bid.BidAmount),
+	}}
+
+	// Contract rates already include the surcharges the parties agreed
+	if booking.ContractID != "" {
+		return items, nil
+	}
+	if booking.Surcharges != nil {
+		snapshot := *booking.Surcharges
+		if err := snapshot.Verify(); err != nil {
+			return nil, err
+		}
+		if snapshot.Currency != currency {
+			return nil, errors.New("surcharge snapshot is not in the invoice currency")
+		}
+		for _, line := range snapshot.Lines {
+			items = append(items, InvoiceLineItem{
+				ID:          len(items) + 1,
+				Type:        surchargeLineItemTypes[line.Kind],
+				Description: line.Description + " (" + line.Code + ")",
+				Quantity:    line.Quantity,
+				UnitPrice:   surchargeUnitPrice(line),
+				Amount:      line.Amount,
+			})
+		}
+	}
+	return items, nil
+}
+
+// GetInvoice returns an invoice by ID
+func (is *InvoiceService) GetInvoice(invoiceID string) (Invoice, error) {
+	is.mutex.RLock()
+	defer is.mutex.RUnlock()
+
+	invoice, exists := is.invoices[invoiceID]
+	if !exists {
+		return Invoice{}, errors.New("invoice not found")
+	}
+	return invoice, nil
+}
+
+// GetInvoiceForBooking returns the invoice issued for a booking
+func (is *InvoiceService) GetInvoiceForBooking(bookingID string) (Invoice, error) {
+	is.mutex.RLock()
+	invoiceID, exists := is.byBooking[bookingID]
+	is.mutex.RUnlock()
+	if !exists {
+		return Invoice{}, errors.New("no invoice for booking")
+	}
+	return is.GetInvoice(invoiceID)
+}
+
+// RecordPayment applies a full or partial payment to an invoice
+func (is *InvoiceService) RecordPayment(invoiceID string, amount float64, reference string) (Invoice, error) {
+	if amount <= 0 {
+		return Invoice{}, errors.New("amount must be positive")
+	}
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	invoice, exists := is.invoices[invoiceID]
+	if !exists {
+		return Invoice{}, errors.New("invoice not found")
+	}
+	if invoice.Status == InvoicePaid {
+		return Invoice{}, errors.New("invoice already paid")
+	}
+	if roundAmount(amount) > roundAmount(invoice.Outstanding()) {
+		return Invoice{}, errors.New("payment exceeds outstanding amount")
+	}
+
+	invoice.Payments = append(invoice.Payments, InvoicePayment{
+		Amount:    amount,
+		Reference: reference,
+		PaidAt:    time.Now(),
+	})
+	invoice.AmountPaid = roundAmount(invoice.AmountPaid + amount)
+	if invoice.Outstanding() <= 0 {
+		invoice.Status = InvoicePaid
+	} else {
+		invoice.Status = InvoicePartiallyPaid
+	}
+	is.invoices[invoiceID] = invoice
+
+	// Add payment to blockchain
+	paymentData := struct {
+		InvoiceID  string
+		Amount     float64
+		Reference  string
+		AmountPaid float64
+		Status     InvoiceStatus
+	}{
+		InvoiceID:  invoiceID,
+		Amount:     amount,
+		Reference:  reference,
+		AmountPaid: invoice.AmountPaid,
+		Status:     invoice.Status,
+	}
+	data, _ := json.Marshal(paymentData)
+	is.marketplace.blockchain.AddBlock(string(data))
+
+	return invoice, nil
+}
+
+// ApplyBookingPayment records a token settlement against the invoice for a
+// booking. The amount is in the settlement currency; the exchange rate into
+// the invoice currency is locked at the first settlement and reused for any
+// later partial payments.
+func (is *InvoiceService) ApplyBookingPayment(bookingID string, amount float64, reference string) (Invoice, error) {
+	invoice, err := is.GetInvoiceForBooking(bookingID)
+	if err != nil {
+		return Invoice{}, err
+	}
+
+	if invoice.RateLockedAt.IsZero() {
+		rate, err := is.settlementRate(invoice)
+		if err != nil {
+			return Invoice{}, err
+		}
+		invoice, err = is.lockSettlementRate(invoice.ID, rate)
+		if err != nil {
+			return Invoice{}, err
+		}
+	}
+
+	return is.RecordPayment(invoice.ID, amount/invoice.SettlementRate, reference)
+}
+
+// CheckBookingPayment checks a token settlement in the settlement currency
+// could be applied to the invoice for a booking without recording it
+func (is *InvoiceService) CheckBookingPayment(bookingID string, amount float64) (Invoice, error) {
+	if amount <= 0 {
+		return Invoice{}, errors.New("amount must be positive")
+	}
+	invoice, err := is.GetInvoiceForBooking(bookingID)
+	if err != nil {
+		return Invoice{}, err
+	}
+	if invoice.Status == InvoicePaid {
+		return Invoice{}, errors.New("invoice already paid")
+	}
+	rate := invoice.SettlementRate
+	if invoice.RateLockedAt.IsZero() {
+		if rate, err = is.settlementRate(invoice); err != nil {
+			return Invoice{}, err
+		}
+	}
+	if roundAmount(amount/rate) > roundAmount(invoice.Outstanding()) {
+		return Invoice{}, errors.New("payment exceeds outstanding amount")
+	}
+	return invoice, nil
+}
+
+// settlementRate returns the current exchange rate from an invoice's
+// currency into the settlement currency
+func (is *InvoiceService) settlementRate(invoice Invoice) (float64, error) {
+	if invoice.Currency == is.settlementCurrency {
+		return 1, nil
+	}
+	if is.oracle == nil {
+		return 0, errors.New("oracle required to settle in " + is.settlementCurrency)
+	}
+	return is.oracle.FetchExchangeRate(invoice.Currency, is.settlementCurrency)
+}
+
+// lockSettlementRate records the settlement exchange rate unless one is already locked
+func (is *InvoiceService) lockSettlementRate(invoiceID string, rate float64) (Invoice, error) {
+	is.mutex.Lock()
+	defer is.mutex.Unlock()
+
+	invoice, exists := is.invoices[invoiceID]
+	if !exists {
+		return Invoice{}, errors.New("invoice not found")
+	}
+	if !invoice.RateLockedAt.IsZero() {
+		return invoice, nil
+	}
+	invoice.SettlementCurrency = is.settlementCurrency
+	invoice.SettlementRate = rate
+	invoice.RateLockedAt = time.Now()
+	is.invoices[invoiceID] = invoice
+
+	// Add rate lock to blockchain
+	lockData := struct {
+		InvoiceID          string
+		InvoiceCurrency    string
+		SettlementCurrency string
+		SettlementRate     float64
+		LockedAt           time.Time
+	}{
+		InvoiceID:          invoiceID,
+		InvoiceCurrency:    invoice.Currency,
+		SettlementCurrency: invoice.SettlementCurrency,
+		SettlementRate:     rate,
+		LockedAt:           invoice.RateLockedAt,
+	}
+	data, _ := json.Marshal(lockData)
+	is.marketplace.blockchain.AddBlock(string(data))
+
+	return invoice, nil
+}
+
+// ExportJSON renders an invoice as indented JSON
+func (is *InvoiceService) ExportJSON(invoiceID string) ([]byte, error) {
+	invoice, err := is.GetInvoice(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(invoice, "", "  ")
+}
+
+// ExportUBL renders an invoice as a UBL 2.1 Invoice document
+func (is *InvoiceService) ExportUBL(invoiceID string) ([]byte, error) {
+	invoice, err := is.GetInvoice(invoiceID)
+	if err != nil {
+		return nil, err
+	}
+	sellerName := is.participantName(invoice.SellerID)
+	buyerName := is.participantName(invoice.BuyerID)
+
+	doc := ublInvoice{
+		XMLNS:                "urn:oasis:names:specification:ubl:schema:xsd:Invoice-2",
+		XMLNSCac:             "urn:oasis:names:specification:ubl:schema:xsd:CommonAggregateComponents-2",
+		XMLNSCbc:             "urn:oasis:names:specification:ubl:schema:xsd:CommonBasicComponents-2",
+		UBLVersionID:         "2.1",
+		ID:                   invoice.ID,
+		IssueDate:            invoice.IssuedAt.Format("2006-01-02"),
+		DueDate:              invoice.DueDate.Format("2006-01-02"),
+		InvoiceTypeCode:      "380", // commercial invoice
+		DocumentCurrencyCode: invoice.Currency,
+		OrderReference:       ublOrderReference{ID: invoice.BookingID},
+		Supplier:             ublParty{Party: ublPartyDetail{ID: invoice.SellerID, Name: sellerName}},
+		Customer:             ublParty{Party: ublPartyDetail{ID: invoice.BuyerID, Name: buyerName}},
+		MonetaryTotal: ublMonetaryTotal{
+			LineExtensionAmount: newUBLAmount(invoice.Total, invoice.Currency),
+			TaxExclusiveAmount:  newUBLAmount(invoice.Total, invoice.Currency),
+			TaxInclusiveAmount:  newUBLAmount(invoice.Total, invoice.Currency),
+			PrepaidAmount:       newUBLAmount(invoice.AmountPaid, invoice.Currency),
+			PayableAmount:       newUBLAmount(invoice.Outstanding(), invoice.Currency),
+		},
+	}
+	for _, item := range invoice.LineItems {
+		doc.Lines = append(doc.Lines, ublInvoiceLine{
+			ID:                  item.ID,
+			InvoicedQuantity:    ublQuantity{UnitCode: "C62", Value: strconv.FormatFloat(item.Quantity, 'f', -1, 64)},
+			LineExtensionAmount: newUBLAmount(item.Amount, invoice.Currency),
+			Item:                ublItem{Name: string(item.Type), Description: item.Description},
+			Price:               ublPrice{PriceAmount: newUBLAmount(item.UnitPrice, invoice.Currency)},
+		})
+	}
+
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
+
+// participantName looks up a participant's display name, falling back to the ID
+func (is *InvoiceService) participantName(participantID string) string {
+	is.marketplace.mutex.RLock()
+	defer is.marketplace.mutex.RUnlock()
+	if p, ok := is.marketplace.participants[participantID]; ok && p.Name != "" {
+		return p.Name
+	}
+	return participantID
+}
+
+// roundAmount rounds a monetary amount to two decimal places
+func roundAmount(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// UBL 2.1 document structure. Element names carry their namespace prefixes
+// directly since encoding/xml does not manage prefixed namespaces.
+type ublInvoice struct {
+	XMLName              xml.Name          `xml:"Invoice"`
+	XMLNS                string            `xml:"xmlns,attr"`
+	XMLNSCac             string            `xml:"xmlns:cac,attr"`
+	XMLNSCbc             string            `xml:"xmlns:cbc,attr"`
+	UBLVersionID         string            `xml:"cbc:UBLVersionID"`
+	ID                   string            `xml:"cbc:ID"`
+	IssueDate            string            `xml:"cbc:IssueDate"`
+	DueDate              string            `xml:"cbc:DueDate"`
+	InvoiceTypeCode      string            `xml:"cbc:InvoiceTypeCode"`
+	DocumentCurrencyCode string            `xml:"cbc:DocumentCurrencyCode"`
+	OrderReference       ublOrderReference `xml:"cac:OrderReference"`
+	Supplier             ublParty          `xml:"cac:AccountingSupplierParty"`
+	Customer             ublParty          `xml:"cac:AccountingCustomerParty"`
+	MonetaryTotal        ublMonetaryTotal  `xml:"cac:LegalMonetaryTotal"`
+	Lines                []ublInvoiceLine  `xml:"cac:InvoiceLine"`
+}
+
+type ublOrderReference struct {
+	ID string `xml:"cbc:ID"`
+}
+
+type ublParty struct {
+	Party ublPartyDetail `xml:"cac:Party"`
+}
+
+type ublPartyDetail struct {
+	ID   string `xml:"cac:PartyIdentification>cbc:ID"`
+	Name string `xml:"cac:PartyName>cbc:Name"`
+}
+
+// UBL amounts are written as fixed-point decimals; encoding/xml would use
+// exponent notation for large float64 values
+type ublAmount struct {
+	CurrencyID string `xml:"currencyID,attr"`
+	Value      string `xml:",chardata"`
+}
+
+func newUBLAmount(value float64, currency string) ublAmount {
+	return ublAmount{CurrencyID: currency, Value: strconv.FormatFloat(roundAmount(value), 'f', 2, 64)}
+}
+
+type ublMonetaryTotal struct {
+	LineExtensionAmount ublAmount `xml:"cbc:LineExtensionAmount"`
+	TaxExclusiveAmount  ublAmount `xml:"cbc:TaxExclusiveAmount"`
+	TaxInclusiveAmount  ublAmount `xml:"cbc:TaxInclusiveAmount"`
+	PrepaidAmount       ublAmount `xml:"cbc:PrepaidAmount"`
+	PayableAmount       ublAmount `xml:"cbc:PayableAmount"`
+}
+
+type ublQuantity struct {
+	UnitCode string `xml:"unitCode,attr"`
+	Value    string `xml:",chardata"`
+}
+
+type ublItem struct {
+	Description string `xml:"cbc:Description"`
+	Name        string `xml:"cbc:Name"`
+}
+
+type ublPrice struct {
+	PriceAmount ublAmount `xml:"cbc:PriceAmount"`
+}
+
+type ublInvoiceLine struct {
+	ID                  int         `xml:"cbc:ID"`
+	InvoicedQuantity    ublQuantity `xml:"cbc:InvoicedQuantity"`
+	LineExtensionAmount ublAmount   `xml:"cbc:LineExtensionAmount"`
+	Item                ublItem     `xml:"cac:Item"`
+	Price               ublPrice    `xml:"cac:Price"`
+}
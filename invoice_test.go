@@ -0,0 +1,212 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func newBookedMarketplace(t *testing.T) (*Marketplace, Booking) {
+	marketplace := NewMarketplace(NewBlockchain())
+
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+
+	validUntil := time.Now().Add(24 * time.Hour)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	return marketplace, booking
+}
+
+func TestInvoiceService_GenerateInvoice(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	is := NewInvoiceService(marketplace, NewOracleIntegration())
+
+	invoice, err := is.GenerateInvoice(booking.ID, time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	// The booking was confirmed without surcharges, so only freight is billed
+	if len(invoice.LineItems) != 1 {
+		t.Fatalf("Expected only the freight line, got %+v", invoice.LineItems)
+	}
+	if invoice.LineItems[0].Type != FreightCharge || invoice.LineItems[0].Amount != 900 {
+		t.Errorf("Expected freight line of 900, got %+v", invoice.LineItems[0])
+	}
+	if invoice.Total != 900 {
+		t.Errorf("Expected total 900, got %f", invoice.Total)
+	}
+	if invoice.SellerID != booking.CarrierID || invoice.BuyerID != booking.ShipperID {
+		t.Errorf("Invoice parties do not match booking")
+	}
+
+	if _, err := is.GenerateInvoice(booking.ID, time.Now().Add(time.Hour)); err == nil {
+		t.Errorf("Expected error when invoicing a booking twice")
+	}
+}
+
+func TestInvoiceService_PartialPayments(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	is := NewInvoiceService(marketplace, nil)
+
+	invoice, err := is.GenerateInvoice(booking.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	invoice, err = is.RecordPayment(invoice.ID, 400, "wire-1")
+	if err != nil {
+		t.Fatalf("RecordPayment failed: %v", err)
+	}
+	if invoice.Status != InvoicePartiallyPaid || invoice.Outstanding() != 500 {
+		t.Errorf("Expected partially paid with 500 outstanding, got %s with %f", invoice.Status, invoice.Outstanding())
+	}
+
+	if _, err := is.RecordPayment(invoice.ID, 600, "wire-2"); err == nil {
+		t.Errorf("Expected error for overpayment")
+	}
+
+	invoice, err = is.ApplyBookingPayment(booking.ID, 500, SettlementTokenID)
+	if err != nil {
+		t.Fatalf("ApplyBookingPayment failed: %v", err)
+	}
+	if invoice.Status != InvoicePaid {
+		t.Errorf("Expected invoice paid, got %s", invoice.Status)
+	}
+	if invoice.IsOverdue(time.Now().Add(2 * time.Hour)) {
+		t.Errorf("Paid invoice should not be overdue")
+	}
+}
+
+func TestInvoiceService_ExportUBL(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	is := NewInvoiceService(marketplace, nil)
+
+	invoice, err := is.GenerateInvoice(booking.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	data, err := is.ExportUBL(invoice.ID)
+	if err != nil {
+		t.Fatalf("ExportUBL failed: %v", err)
+	}
+	doc := string(data)
+	for _, want := range []string{
+		`xmlns="urn:oasis:names:specification:ubl:schema:xsd:Invoice-2"`,
+		"<cbc:UBLVersionID>2.1</cbc:UBLVersionID>",
+		"<cbc:ID>" + invoice.ID + "</cbc:ID>",
+		"<cbc:Name>Shipper1</cbc:Name>",
+		`<cbc:PayableAmount currencyID="USD">900.00</cbc:PayableAmount>`,
+	} {
+		if !strings.Contains(doc, want) {
+			t.Errorf("Expected UBL output to contain %q", want)
+		}
+	}
+}
+
+func TestInvoiceService_ExportUBLLargeAmounts(t *testing.T) {
+	marketplace, _ := newBookedMarketplace(t)
+	is := NewInvoiceService(marketplace, nil)
+	is.invoices["inv-1"] = Invoice{
+		ID:        "inv-1",
+		Currency:  "USD",
+		LineItems: []InvoiceLineItem{{ID: 1, Type: FreightCharge, Description: "Charter", Quantity: 1, UnitPrice: 1234567.5, Amount: 1234567.5}},
+		Total:     1234567.5,
+	}
+
+	data, err := is.ExportUBL("inv-1")
+	if err != nil {
+		t.Fatalf("ExportUBL failed: %v", err)
+	}
+	if doc := string(data); !strings.Contains(doc, `<cbc:PayableAmount currencyID="USD">1234567.50</cbc:PayableAmount>`) || strings.Contains(doc, "e+06") {
+		t.Errorf("Expected a fixed-point seven digit total, got %s", doc)
+	}
+}
+
+func TestMarketplace_PayBookingValidatesInvoice(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	ledger := NewTokenLedger()
+	ledger.MintTokens(booking.ShipperID, SettlementTokenID, 2000)
+	marketplace.InvoiceService = NewInvoiceService(marketplace, nil)
+	marketplace.Payments = NewTokenPaymentSystem(marketplace.blockchain)
+	marketplace.Payments.SetTokenLedger(ledger)
+	marketplace.Payments.SetInvoiceService(marketplace.InvoiceService)
+
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, SettlementTokenID, 500); err == nil {
+		t.Errorf("Expected payment before invoicing to be rejected")
+	}
+	invoice, err := marketplace.InvoiceService.GenerateInvoice(booking.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, SettlementTokenID, invoice.Total+1); err == nil {
+		t.Errorf("Expected overpayment to be rejected")
+	}
+	if err := marketplace.PayBooking(booking.ID, booking.CarrierID, SettlementTokenID, 100); err == nil {
+		t.Errorf("Expected payment by the carrier to be rejected")
+	}
+	ledger.MintTokens(booking.ShipperID, "TOKEN1", 2000)
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, "TOKEN1", 100); err == nil {
+		t.Errorf("Expected payment in a token other than the settlement token to be rejected")
+	}
+	if ledger.GetBalance(booking.ShipperID, SettlementTokenID) != 2000 {
+		t.Errorf("Expected rejected payments to leave balances untouched")
+	}
+
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, SettlementTokenID, invoice.Total); err != nil {
+		t.Fatalf("PayBooking failed: %v", err)
+	}
+	if ledger.GetBalance(booking.CarrierID, SettlementTokenID) != invoice.Total {
+		t.Errorf("Expected the carrier to receive %v", invoice.Total)
+	}
+	if paid, _ := marketplace.InvoiceService.GetInvoice(invoice.ID); paid.Status != InvoicePaid {
+		t.Errorf("Expected invoice paid, got %s", paid.Status)
+	}
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, SettlementTokenID, 1); err == nil {
+		t.Errorf("Expected payment of a settled invoice to be rejected")
+	}
+}
+
+func TestMarketplace_PayBookingSettlesFromEscrow(t *testing.T) {
+	marketplace, booking := newBookedMarketplace(t)
+	ledger := NewTokenLedger()
+	ledger.MintTokens(booking.ShipperID, SettlementTokenID, 1000)
+	escrow, err := NewEscrow(ledger, SettlementTokenID, 600, booking.ShipperID, booking.CarrierID, time.Hour)
+	if err != nil {
+		t.Fatalf("NewEscrow failed: %v", err)
+	}
+	marketplace.escrows[booking.ID] = escrow
+	marketplace.InvoiceService = NewInvoiceService(marketplace, nil)
+	marketplace.Payments = NewTokenPaymentSystem(marketplace.blockchain)
+	marketplace.Payments.SetTokenLedger(ledger)
+	marketplace.Payments.SetInvoiceService(marketplace.InvoiceService)
+	invoice, err := marketplace.InvoiceService.GenerateInvoice(booking.ID, time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+
+	// 600 comes out of escrow and the remaining 300 from the shipper's balance
+	if err := marketplace.PayBooking(booking.ID, booking.ShipperID, SettlementTokenID, invoice.Total); err != nil {
+		t.Fatalf("PayBooking failed: %v", err)
+	}
+	if balance := ledger.GetBalance(booking.CarrierID, SettlementTokenID); balance != 900 {
+		t.Errorf("Expected the carrier paid 900, got %f", balance)
+	}
+	if balance := ledger.GetBalance(booking.ShipperID, SettlementTokenID); balance != 100 {
+		t.Errorf("Expected 100 left to the shipper, got %f", balance)
+	}
+	if held := ledger.EscrowedBalance(booking.ShipperID, SettlementTokenID); held != 0 || escrow.Held() != 0 {
+		t.Errorf("Expected the escrow drawn down, got %f", held)
+	}
+}
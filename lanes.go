@@ -0,0 +1,518 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Lane is a carrier's preference for the freight it wants to be offered.
+// Regions are UN/LOCODEs, IATA codes or ISO 3166 country codes; empty lists
+// match anything.
+type Lane struct {
+	ID           string               `json:"id"`
+	CarrierID    string               `json:"carrier_id"`
+	Origins      []string             `json:"origins,omitempty"`
+	Destinations []string             `json:"destinations,omitempty"`
+	Modes        []TransportationMode `json:"modes,omitempty"`
+	CargoTypes   []CargoType          `json:"cargo_types,omitempty"`
+	ServiceItems []SubCategoryItem    `json:"service_items,omitempty"`
+	CreatedAt    time.Time            `json:"created_at"`
+}
+
+// CapacityOffer is space a carrier has available on a mode between two dates
+type CapacityOffer struct {
+	ID             string             `json:"id"`
+	CarrierID      string             `json:"carrier_id"`
+	Mode           TransportationMode `json:"mode"`
+	AvailableFrom  time.Time          `json:"available_from"`
+	AvailableUntil time.Time          `json:"available_until"`
+	WeightKg       float64            `json:"weight_kg"`  // remaining payload
+	VolumeCBM      float64            `json:"volume_cbm"` // remaining volume; zero is unconstrained
+}
+
+// LaneMatch is a quote, or one leg of it, matching a carrier's lane
+type LaneMatch struct {
+	ID          string    `json:"id"`
+	CarrierID   string    `json:"carrier_id"`
+	QuoteID     string    `json:"quote_id"`
+	LegSequence int       `json:"leg_sequence,omitempty"` // 0 matches the whole route
+	LaneID      string    `json:"lane_id"`
+	CapacityID  string    `json:"capacity_id,omitempty"` // capacity offer that fits the shipment
+	Score       float64   `json:"score"`                 // fit from 0 to 1
+	Reasons     []string  `json:"reasons"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// MatchNotifier delivers lane match notifications to carriers
+type MatchNotifier interface {
+	NotifyMatch(match LaneMatch) error
+}
+
+// LogMatchNotifier is a MatchNotifier that writes matches to the log
+type LogMatchNotifier struct{}
+
+// NotifyMatch implements MatchNotifier
+func (LogMatchNotifier) NotifyMatch(match LaneMatch) error {
+	log.Printf("Quote %s matches lane %s of carrier %s (score %.2f)", match.QuoteID, match.LaneID, match.CarrierID, match.Score)
+	return nil
+}
+
+// maxLaneScore is the points a lane scores when every criterion matches
+// exactly and capacity fits: origin and destination 3 each, mode, cargo type
+// and service item 2 each and capacity 3
+const maxLaneScore = 15.0
+
+// LaneService keeps carrier lanes and capacity, matches new quotes against
+// them and keeps each carrier's match notifications
+type LaneService struct {
+	notifier MatchNotifier
+
+	lanes    map[string][]Lane          // carrierID -> lanes
+	capacity map[string][]CapacityOffer // carrierID -> capacity offers
+	matches  map[string][]LaneMatch     // carrierID -> notifications
+	mutex    sync.RWMutex
+}
+
+// NewLaneService creates a new LaneService instance
+func NewLaneService(notifier MatchNotifier) *LaneService {
+	if notifier == nil {
+		notifier = LogMatchNotifier{}
+	}
+	return &LaneService{
+		notifier: notifier,
+		lanes:    make(map[string][]Lane),
+		capacity: make(map[string][]CapacityOffer),
+		matches:  make(map[string][]LaneMatch),
+	}
+}
+
+// validateRegions checks lane regions are known locations or country codes
+func validateRegions(regions []string) error {
+	for _, region := range regions {
+		if isCountryCode(region) {
+			continue
+		}
+		if _, ok := Locations().Lookup(region); !ok {
+			return errors.New("unknown region " + region)
+		}
+	}
+	return nil
+}
+
+// isCountryCode reports whether a region is a two-letter ISO 3166 code
+func isCountryCode(region string) bool {
+	if len(region) != 2 {
+		return false
+	}
+	for _, c := range region {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// AddLane publishes a carrier lane
+func (ls *LaneService) AddLane(lane Lane) (Lane, error) {
+	for i := range lane.Origins {
+		lane.Origins[i] = strings.ToUpper(strings.TrimSpace(lane.Origins[i]))
+	}
+	for i := range lane.Destinations {
+		lane.Destinations[i] = strings.ToUpper(strings.TrimSpace(lane.Destinations[i]))
+	}
+	if err := validateRegions(lane.Origins); err != nil {
+		return Lane{}, err
+	}
+	if err := validateRegions(lane.Destinations); err != nil {
+		return Lane{}, err
+	}
+	for _, mode := range lane.Modes {
+		if _, err := ParseTransportationMode(string(mode)); err != nil {
+			return Lane{}, err
+		}
+	}
+	for _, item := range lane.ServiceItems {
+		if _, ok := Catalog().Item(item); !ok {
+			return Lane{}, errors.New("unknown catalog item: " + string(item))
+		}
+	}
+	lane.ID = uuid.New().String()
+	lane.CreatedAt = time.Now()
+
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.lanes[lane.CarrierID] = append(ls.lanes[lane.CarrierID], lane)
+	return lane, nil
+}
+
+// RemoveLane withdraws a carrier lane
+func (ls *LaneService) RemoveLane(carrierID, laneID string) error {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	lanes := ls.lanes[carrierID]
+	for i, lane := range lanes {
+		if lane.ID == laneID {
+			ls.lanes[carrierID] = append(lanes[:i:i], lanes[i+1:]...)
+			return nil
+		}
+	}
+	return errors.New("lane not found")
+}
+
+// Lanes returns a carrier's lanes
+func (ls *LaneService) Lanes(carrierID string) []Lane {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	return append([]Lane{}, ls.lanes[carrierID]...)
+}
+
+// AddCapacity publishes capacity a carrier has available
+func (ls *LaneService) AddCapacity(offer CapacityOffer) (CapacityOffer, error) {
+	if _, err := ParseTransportationMode(string(offer.Mode)); err != nil {
+		return CapacityOffer{}, err
+	}
+	if offer.AvailableFrom.IsZero() || !offer.AvailableUntil.After(offer.AvailableFrom) {
+		return CapacityOffer{}, errors.New("capacity must be available over a date range")
+	}
+	if offer.WeightKg <= 0 || offer.VolumeCBM < 0 {
+		return CapacityOffer{}, errors.New("capacity weight must be positive")
+	}
+	offer.ID = uuid.New().String()
+
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+	ls.capacity[offer.CarrierID] = append(ls.capacity[offer.CarrierID], offer)
+	return offer, nil
+}
+
+// Capacity returns a carrier's capacity offers
+func (ls *LaneService) Capacity(carrierID string) []CapacityOffer {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	return append([]CapacityOffer{}, ls.capacity[carrierID]...)
+}
+
+// ConsumeCapacity takes a booked shipment out of the carrier's capacity offer
+func (ls *LaneService) ConsumeCapacity(carrierID, capacityID string, weightKg, volumeCBM float64) error {
+	ls.mutex.Lock()
+	defer ls.mutex.Unlock()
+
+	offers := ls.capacity[carrierID]
+	for i := range offers {
+		if offers[i].ID != capacityID {
+			continue
+		}
+		if offers[i].WeightKg < weightKg || (offers[i].VolumeCBM > 0 && offers[i].VolumeCBM < volumeCBM) {
+			return errors.New("insufficient capacity")
+		}
+		offers[i].WeightKg = roundMeasure(offers[i].WeightKg - weightKg)
+		if offers[i].VolumeCBM > 0 {
+			offers[i].VolumeCBM = roundMeasure(offers[i].VolumeCBM - volumeCBM)
+		}
+		return nil
+	}
+	return errors.New("capacity offer not found")
+}
+
+// MatchQuote matches a new quote against every carrier's lanes, records a
+// notification for each matching carrier and returns the matches ranked by
+// fit. A multi-leg quote is matched as a whole route and leg by leg.
+func (ls *LaneService) MatchQuote(quote FreightQuote) []LaneMatch {
+	ls.mutex.Lock()
+	matches := []LaneMatch{}
+	for carrierID, lanes := range ls.lanes {
+		best, ok := ls.bestMatch(carrierID, lanes, quote)
+		if !ok {
+			continue
+		}
+		ls.matches[carrierID] = append(ls.matches[carrierID], best)
+		matches = append(matches, best)
+	}
+	ls.mutex.Unlock()
+
+	rankMatches(matches)
+	for _, match := range matches {
+		if err := ls.notifier.NotifyMatch(match); err != nil {
+			log.Printf("Error notifying carrier %s of quote %s: %v", match.CarrierID, match.QuoteID, err)
+		}
+	}
+	return matches
+}
+
+// bestMatch returns a carrier's best-fitting lane for a quote or its legs.
+// Callers hold the lock.
+func (ls *LaneService) bestMatch(carrierID string, lanes []Lane, quote FreightQuote) (LaneMatch, bool) {
+	segments := quoteSegments(quote)
+
+	var best LaneMatch
+	found := false
+	for _, lane := range lanes {
+		for _, segment := range segments {
+			points, reasons, ok := scoreLane(lane, quote, segment)
+			if !ok {
+				continue
+			}
+			capacityID, capacityPoints, capacityReason := ls.fittingCapacity(carrierID, quote, segment)
+			match := LaneMatch{
+				CarrierID:   carrierID,
+				QuoteID:     quote.ID,
+				LegSequence: segment.Sequence,
+				LaneID:      lane.ID,
+				CapacityID:  capacityID,
+				Score:       math.Round((points+capacityPoints)/maxLaneScore*100) / 100,
+				Reasons:     append(reasons, capacityReason),
+			}
+			if !found || match.Score > best.Score {
+				best, found = match, true
+			}
+		}
+	}
+	if found {
+		best.ID = uuid.New().String()
+		best.CreatedAt = time.Now()
+	}
+	return best, found
+}
+
+// quoteSegments returns the segments a quote is matched on: the whole route
+// and, for a multi-leg route, each of its legs
+func quoteSegments(quote FreightQuote) []RouteLeg {
+	segments := []RouteLeg{{
+		Mode:            quote.TransportationMode,
+		OriginCode:      quote.OriginCode,
+		DestinationCode: quote.DestinationCode,
+	}}
+	if len(quote.Legs) > 0 {
+		segments[0].PlannedDeparture = quote.Legs[0].PlannedDeparture
+	}
+	if len(quote.Legs) > 1 {
+		segments = append(segments, quote.Legs...)
+	} else if len(quote.Legs) == 1 {
+		segments[0].ServiceItem = quote.Legs[0].ServiceItem
+	}
+	return segments
+}
+
+// scoreLane scores how well a lane fits a quote segment. Every criterion the
+// lane sets must match; exact matches score higher than broad ones.
+func scoreLane(lane Lane, quote FreightQuote, segment RouteLeg) (float64, []string, bool) {
+	points := 0.0
+	reasons := []string{}
+
+	for _, end := range []struct {
+		name    string
+		regions []string
+		code    string
+	}{
+		{"origin", lane.Origins, segment.OriginCode},
+		{"destination", lane.Destinations, segment.DestinationCode},
+	} {
+		p, reason := regionScore(end.regions, end.code)
+		if p == 0 {
+			return 0, nil, false
+		}
+		points += p
+		reasons = append(reasons, end.name+" "+reason)
+	}
+
+	if len(lane.Modes) == 0 {
+		points++
+	} else if containsMode(lane.Modes, segment.Mode) {
+		points += 2
+		reasons = append(reasons, "mode "+string(segment.Mode))
+	} else {
+		return 0, nil, false
+	}
+
+	if len(lane.CargoTypes) == 0 {
+		points++
+	} else if containsCargoType(lane.CargoTypes, quote.CargoType) {
+		points += 2
+		reasons = append(reasons, "cargo "+string(quote.CargoType))
+	} else {
+		return 0, nil, false
+	}
+
+	items := quote.ServiceItems
+	if segment.ServiceItem != "" {
+		items = []SubCategoryItem{segment.ServiceItem}
+	}
+	if len(lane.ServiceItems) == 0 {
+		points++
+	} else if item, ok := firstServed(lane.ServiceItems, items); ok {
+		points += 2
+		reasons = append(reasons, "service "+string(item))
+	} else {
+		return 0, nil, false
+	}
+	return points, reasons, true
+}
+
+// regionScore scores a location code against lane regions: 3 for the code
+// itself, 2 for its country and 1 for an unrestricted lane; 0 is no match
+func regionScore(regions []string, code string) (float64, string) {
+	if len(regions) == 0 {
+		return 1, "anywhere"
+	}
+	loc, known := Locations().Lookup(code)
+	best, reason := 0.0, ""
+	for _, region := range regions {
+		switch {
+		case strings.EqualFold(region, code):
+			return 3, code
+		case known && !isCountryCode(region):
+			if regionLoc, ok := Locations().Lookup(region); ok && locationKey(regionLoc) == locationKey(loc) {
+				return 3, code
+			}
+		case known && region == loc.Country && best < 2:
+			best, reason = 2, code+" in "+region
+		}
+	}
+	return best, reason
+}
+
+// fittingCapacity finds a carrier capacity offer on the segment's mode that
+// is available at departure and can take the shipment. Callers hold the lock.
+func (ls *LaneService) fittingCapacity(carrierID string, quote FreightQuote, segment RouteLeg) (string, float64, string) {
+	offers := ls.capacity[carrierID]
+	if len(offers) == 0 {
+		return "", 0, "no capacity published"
+	}
+	departure := segment.PlannedDeparture
+	if departure.IsZero() {
+		departure = time.Now()
+	}
+	for _, offer := range offers {
+		if offer.Mode != segment.Mode || departure.Before(offer.AvailableFrom) || departure.After(offer.AvailableUntil) {
+			continue
+		}
+		if offer.WeightKg < quote.Chargeable.GrossWeightKg || (offer.VolumeCBM > 0 && offer.VolumeCBM < quote.Chargeable.VolumeCBM) {
+			continue
+		}
+		return offer.ID, 3, fmt.Sprintf("capacity %.0f kg available", offer.WeightKg)
+	}
+	return "", 0, "no fitting capacity"
+}
+
+// CapacityFor reports whether a carrier published capacity and whether any
+// of it fits the quote, on the whole route or one of its legs
+func (ls *LaneService) CapacityFor(carrierID string, quote FreightQuote) (published, fits bool) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+
+	if len(ls.capacity[carrierID]) == 0 {
+		return false, false
+	}
+	for _, segment := range quoteSegments(quote) {
+		if id, _, _ := ls.fittingCapacity(carrierID, quote, segment); id != "" {
+			return true, true
+		}
+	}
+	return true, false
+}
+
+// rankMatches orders matches by fit, best first
+func rankMatches(matches []LaneMatch) {
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return matches[i].CreatedAt.After(matches[j].CreatedAt)
+	})
+}
+
+// Matches returns a carrier's quote notifications ranked by fit
+func (ls *LaneService) Matches(carrierID string) []LaneMatch {
+	ls.mutex.RLock()
+	matches := append([]LaneMatch{}, ls.matches[carrierID]...)
+	ls.mutex.RUnlock()
+	rankMatches(matches)
+	return matches
+}
+
+// MatchFor returns a carrier's notification for a quote, if it matched
+func (ls *LaneService) MatchFor(carrierID, quoteID string) (LaneMatch, bool) {
+	ls.mutex.RLock()
+	defer ls.mutex.RUnlock()
+	for _, match := range ls.matches[carrierID] {
+		if match.QuoteID == quoteID {
+			return match, true
+		}
+	}
+	return LaneMatch{}, false
+}
+
+func containsMode(modes []TransportationMode, mode TransportationMode) bool {
+	for _, m := range modes {
+		if m == mode {
+			return true
+		}
+	}
+	return false
+}
+
+func containsCargoType(cargoTypes []CargoType, cargoType CargoType) bool {
+	for _, c := range cargoTypes {
+		if c == cargoType {
+			return true
+		}
+	}
+	return false
+}
+
+// firstServed returns the first quote service item a lane covers
+func firstServed(laneItems, items []SubCategoryItem) (SubCategoryItem, bool) {
+	for _, item := range items {
+		for _, laneItem := range laneItems {
+			if item == laneItem {
+				return item, true
+			}
+		}
+	}
+	return "", false
+}
+
+// PublishLane publishes a lane for a carrier
+func (m *Marketplace) PublishLane(carrierID string, lane Lane) (Lane, error) {
+	if m.Lanes == nil {
+		return Lane{}, errors.New("lane matching not configured")
+	}
+	if err := m.requireCarrier(carrierID); err != nil {
+		return Lane{}, err
+	}
+	lane.CarrierID = carrierID
+	return m.Lanes.AddLane(lane)
+}
+
+// PublishCapacity publishes available capacity for a carrier
+func (m *Marketplace) PublishCapacity(carrierID string, offer CapacityOffer) (CapacityOffer, error) {
+	if m.Lanes == nil {
+		return CapacityOffer{}, errors.New("lane matching not configured")
+	}
+	if err := m.requireCarrier(carrierID); err != nil {
+		return CapacityOffer{}, err
+	}
+	offer.CarrierID = carrierID
+	return m.Lanes.AddCapacity(offer)
+}
+
+// requireCarrier checks a participant is a registered carrier
+func (m *Marketplace) requireCarrier(participantID string) error {
+	participant, err := m.GetParticipant(participantID)
+	if err != nil {
+		return err
+	}
+	if participant.Type != Carrier {
+		return errors.New("only carriers publish lanes and capacity")
+	}
+	return nil
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+type recordingMatchNotifier struct {
+	matches []LaneMatch
+}
+
+func (n *recordingMatchNotifier) NotifyMatch(match LaneMatch) error {
+	n.matches = append(n.matches, match)
+	return nil
+}
+
+func TestLaneService_RanksMatchesByFit(t *testing.T) {
+	notifier := &recordingMatchNotifier{}
+	ls := NewLaneService(notifier)
+
+	if _, err := ls.AddLane(Lane{CarrierID: "carrier-1", Origins: []string{"XXNOPE"}}); err == nil {
+		t.Errorf("Expected an unknown region to be rejected")
+	}
+	if _, err := ls.AddCapacity(CapacityOffer{CarrierID: "carrier-1", Mode: Road, AvailableFrom: time.Now(), AvailableUntil: time.Now().Add(-time.Hour), WeightKg: 1000}); err == nil {
+		t.Errorf("Expected an empty availability window to be rejected")
+	}
+
+	specific, err := ls.AddLane(Lane{CarrierID: "carrier-1", Origins: []string{"nlrtm"}, Destinations: []string{"PL"}, Modes: []TransportationMode{Road}})
+	if err != nil {
+		t.Fatalf("AddLane failed: %v", err)
+	}
+	if _, err := ls.AddLane(Lane{CarrierID: "carrier-2"}); err != nil {
+		t.Fatalf("AddLane failed: %v", err)
+	}
+	if _, err := ls.AddLane(Lane{CarrierID: "carrier-3", Modes: []TransportationMode{Air}}); err != nil {
+		t.Fatalf("AddLane failed: %v", err)
+	}
+	if _, err := ls.AddCapacity(CapacityOffer{CarrierID: "carrier-1", Mode: Road, AvailableFrom: time.Now().Add(-time.Hour), AvailableUntil: time.Now().Add(72 * time.Hour), WeightKg: 24000}); err != nil {
+		t.Fatalf("AddCapacity failed: %v", err)
+	}
+
+	quote := FreightQuote{
+		ID:                 "quote-1",
+		CargoType:          GeneralCargo,
+		OriginCode:         "NLRTM",
+		DestinationCode:    "PLWAW",
+		TransportationMode: Road,
+		Chargeable:         ChargeableMeasure{GrossWeightKg: 2000},
+		Legs:               []RouteLeg{{Sequence: 1, Mode: Road, OriginCode: "NLRTM", DestinationCode: "PLWAW", ServiceItem: ImportLandPalletGeneralCargo}},
+		ServiceItems:       []SubCategoryItem{ImportLandPalletGeneralCargo},
+	}
+	matches := ls.MatchQuote(quote)
+	if len(matches) != 2 || len(notifier.matches) != 2 {
+		t.Fatalf("Expected two carriers matched and notified, got %+v", matches)
+	}
+	if matches[0].CarrierID != "carrier-1" || matches[0].LaneID != specific.ID || matches[0].Score != 0.8 || matches[0].CapacityID == "" {
+		t.Errorf("Expected the specific lane with capacity ranked first, got %+v", matches[0])
+	}
+	if matches[1].CarrierID != "carrier-2" || matches[1].Score != 0.33 {
+		t.Errorf("Expected the unrestricted lane ranked second, got %+v", matches[1])
+	}
+
+	// Heavier cargo than the published capacity still matches, without the capacity points
+	quote.ID = "quote-2"
+	quote.Chargeable.GrossWeightKg = 30000
+	ls.MatchQuote(quote)
+	inbox := ls.Matches("carrier-1")
+	if len(inbox) != 2 || inbox[0].QuoteID != "quote-1" || inbox[1].CapacityID != "" || inbox[1].Score != 0.6 {
+		t.Errorf("Unexpected carrier inbox %+v", inbox)
+	}
+}
+
+func TestMarketplace_LaneMatchesLegsAndConsumesCapacity(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Lanes = NewLaneService(&recordingMatchNotifier{})
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	rail := marketplace.RegisterParticipant("Rail Operator", Carrier)
+
+	if _, err := marketplace.PublishLane(shipper.ID, Lane{}); err == nil {
+		t.Errorf("Expected shippers not to publish lanes")
+	}
+	if _, err := marketplace.PublishLane(rail.ID, Lane{Origins: []string{"NL"}, Modes: []TransportationMode{Rail}}); err != nil {
+		t.Fatalf("PublishLane failed: %v", err)
+	}
+	offer, err := marketplace.PublishCapacity(rail.ID, CapacityOffer{Mode: Rail, AvailableFrom: time.Now().Add(-time.Hour), AvailableUntil: time.Now().Add(30 * 24 * time.Hour), WeightKg: 10000, VolumeCBM: 40})
+	if err != nil {
+		t.Fatalf("PublishCapacity failed: %v", err)
+	}
+
+	quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Rail, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+	}, 3000.0, "EUR", time.Now().Add(24*time.Hour), CargoDetails{
+		Items: []CargoLineItem{{Pieces: 2, GrossWeightKg: 4000, LengthCm: 120, WidthCm: 100, HeightCm: 100}},
+	})
+	if err != nil {
+		t.Fatalf("CreateMultimodalQuote failed: %v", err)
+	}
+	matches := marketplace.Lanes.Matches(rail.ID)
+	if len(matches) != 1 || matches[0].QuoteID != quote.ID || matches[0].LegSequence != 2 || matches[0].CapacityID != offer.ID {
+		t.Fatalf("Expected the rail leg matched on the published capacity, got %+v", matches)
+	}
+
+	bid, err := marketplace.PlaceLegBid(quote.ID, 2, rail.ID, 800.0, "")
+	if err != nil {
+		t.Fatalf("PlaceLegBid failed: %v", err)
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	capacity := marketplace.Lanes.Capacity(rail.ID)
+	if len(capacity) != 1 || capacity[0].WeightKg != 6000 || capacity[0].VolumeCBM != 37.6 {
+		t.Errorf("Expected the booking to take 4000 kg and 2.4 CBM, got %+v", capacity)
+	}
+}
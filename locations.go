@@ -0,0 +1,453 @@
+package main
+
+import (
+	"embed"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// bundledLocations holds excerpts of the UN/LOCODE code list, the
+// OurAirports airport list and the World Port Index
+//
+//go:embed data/locations/*.csv
+var bundledLocations embed.FS
+
+// Location is a place freight can be moved from, to or through
+type Location struct {
+	Code           string  `json:"code,omitempty"` // UN/LOCODE, e.g. NLRTM
+	IATA           string  `json:"iata,omitempty"` // IATA airport or city code
+	Name           string  `json:"name"`
+	Country        string  `json:"country"` // ISO 3166-1 alpha-2
+	Subdivision    string  `json:"subdivision,omitempty"`
+	Latitude       float64 `json:"latitude"`
+	Longitude      float64 `json:"longitude"`
+	Seaport        bool    `json:"seaport,omitempty"`
+	RailTerminal   bool    `json:"rail_terminal,omitempty"`
+	RoadTerminal   bool    `json:"road_terminal,omitempty"`
+	Airport        bool    `json:"airport,omitempty"`
+	BorderCrossing bool    `json:"border_crossing,omitempty"`
+}
+
+// LocationMatch is a search result ranked by score in [0,1]
+type LocationMatch struct {
+	Location
+	Score float64 `json:"score"`
+}
+
+// LocationDB is the location reference database quotes are validated against
+type LocationDB struct {
+	byCode map[string]*Location // UN/LOCODE -> location
+	byIATA map[string]*Location // IATA code -> airport, or UN/LOCODE airport without one
+	mutex  sync.RWMutex
+}
+
+// NewLocationDB creates an empty LocationDB instance
+func NewLocationDB() *LocationDB {
+	return &LocationDB{
+		byCode: make(map[string]*Location),
+		byIATA: make(map[string]*Location),
+	}
+}
+
+var (
+	defaultLocations     *LocationDB
+	defaultLocationsOnce sync.Once
+)
+
+// Locations returns the shared location database, loaded from the bundled
+// datasets on first use
+func Locations() *LocationDB {
+	defaultLocationsOnce.Do(func() {
+		defaultLocations = NewLocationDB()
+		loaders := []struct {
+			file string
+			load func(*LocationDB, io.Reader) (int, error)
+		}{
+			{"data/locations/unlocode.csv", (*LocationDB).LoadUNLOCODE},
+			{"data/locations/ports.csv", (*LocationDB).LoadPorts},
+			{"data/locations/airports.csv", (*LocationDB).LoadAirports},
+		}
+		for _, l := range loaders {
+			f, err := bundledLocations.Open(l.file)
+			if err != nil {
+				log.Fatalf("Missing bundled location data %s: %v", l.file, err)
+			}
+			if _, err := l.load(defaultLocations, f); err != nil {
+				log.Fatalf("Invalid bundled location data %s: %v", l.file, err)
+			}
+			f.Close()
+		}
+	})
+	return defaultLocations
+}
+
+// LoadLocationFile loads a UN/LOCODE ("unlocode"), World Port Index ("ports")
+// or OurAirports ("airports") CSV file into the database
+func (db *LocationDB) LoadLocationFile(kind, path string) (int, error) {
+	load := map[string]func(*LocationDB, io.Reader) (int, error){
+		"unlocode": (*LocationDB).LoadUNLOCODE,
+		"ports":    (*LocationDB).LoadPorts,
+		"airports": (*LocationDB).LoadAirports,
+	}[kind]
+	if load == nil {
+		return 0, errors.New("unknown location dataset: " + kind)
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n, err := load(db, f)
+	if err != nil {
+		return n, fmt.Errorf("%s: %v", path, err)
+	}
+	return n, nil
+}
+
+// LoadUNLOCODE loads entries of the UN/LOCODE code list in its published CSV
+// layout: change, country, location, name, name without diacritics,
+// subdivision, function, status, date, IATA, coordinates, remarks
+func (db *LocationDB) LoadUNLOCODE(r io.Reader) (int, error) {
+	records, err := parseCSV(r, ',')
+	if err != nil {
+		return 0, err
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	count := 0
+	for _, record := range records {
+		if len(record) < 11 {
+			return count, errors.New("UN/LOCODE record has fewer than 11 columns")
+		}
+		// Country name rows carry no location code
+		if record[2] == "" || strings.HasPrefix(record[0], "X") {
+			continue
+		}
+		loc := db.location(record[1] + record[2])
+		loc.Name = record[4]
+		loc.Country = record[1]
+		loc.Subdivision = record[5]
+		function := record[6]
+		loc.Seaport = loc.Seaport || functionFlag(function, 0, '1')
+		loc.RailTerminal = functionFlag(function, 1, '2')
+		loc.RoadTerminal = functionFlag(function, 2, '3')
+		loc.Airport = loc.Airport || functionFlag(function, 3, '4')
+		loc.BorderCrossing = functionFlag(function, 7, 'B')
+		// The IATA column is only filled when it differs from the location code
+		if loc.Airport {
+			loc.IATA = record[9]
+			if loc.IATA == "" {
+				loc.IATA = record[2]
+			}
+			if _, taken := db.byIATA[loc.IATA]; !taken {
+				db.byIATA[loc.IATA] = loc
+			}
+		}
+		if lat, lon, ok := parseUNLOCODECoordinates(record[10]); ok {
+			loc.Latitude, loc.Longitude = lat, lon
+		}
+		count++
+	}
+	return count, nil
+}
+
+// LoadPorts loads seaports from a World Port Index CSV export
+func (db *LocationDB) LoadPorts(r io.Reader) (int, error) {
+	records, err := parseCSV(r, ',')
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	cols := headerColumns(records[0])
+	for _, name := range []string{"Main Port Name", "UN/LOCODE", "Latitude", "Longitude"} {
+		if _, ok := cols[name]; !ok {
+			return 0, errors.New("World Port Index file is missing column " + name)
+		}
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	count := 0
+	for _, record := range records[1:] {
+		code := strings.ToUpper(strings.ReplaceAll(csvField(record, cols["UN/LOCODE"]), " ", ""))
+		if len(code) != 5 {
+			continue
+		}
+		loc := db.location(code)
+		if loc.Name == "" {
+			loc.Name = csvField(record, cols["Main Port Name"])
+			loc.Country = code[:2]
+		}
+		loc.Seaport = true
+		// Port positions are more precise than UN/LOCODE's whole minutes
+		lat, latErr := strconv.ParseFloat(csvField(record, cols["Latitude"]), 64)
+		lon, lonErr := strconv.ParseFloat(csvField(record, cols["Longitude"]), 64)
+		if latErr == nil && lonErr == nil {
+			loc.Latitude, loc.Longitude = lat, lon
+		}
+		count++
+	}
+	return count, nil
+}
+
+// LoadAirports loads airports with an IATA code from an OurAirports
+// airports.csv export
+func (db *LocationDB) LoadAirports(r io.Reader) (int, error) {
+	records, err := parseCSV(r, ',')
+	if err != nil {
+		return 0, err
+	}
+	if len(records) == 0 {
+		return 0, nil
+	}
+	cols := headerColumns(records[0])
+	for _, name := range []string{"name", "iata_code", "iso_country", "latitude_deg", "longitude_deg"} {
+		if _, ok := cols[name]; !ok {
+			return 0, errors.New("airports file is missing column " + name)
+		}
+	}
+	db.mutex.Lock()
+	defer db.mutex.Unlock()
+
+	count := 0
+	for _, record := range records[1:] {
+		iata := strings.ToUpper(csvField(record, cols["iata_code"]))
+		if len(iata) != 3 {
+			continue
+		}
+		airport := &Location{
+			IATA:    iata,
+			Name:    csvField(record, cols["name"]),
+			Country: csvField(record, cols["iso_country"]),
+			Airport: true,
+		}
+		if i, ok := cols["iso_region"]; ok {
+			airport.Subdivision = strings.TrimPrefix(csvField(record, i), airport.Country+"-")
+		}
+		airport.Latitude, _ = strconv.ParseFloat(csvField(record, cols["latitude_deg"]), 64)
+		airport.Longitude, _ = strconv.ParseFloat(csvField(record, cols["longitude_deg"]), 64)
+		db.byIATA[iata] = airport
+		count++
+	}
+	return count, nil
+}
+
+// location returns the entry for a UN/LOCODE, creating it if needed.
+// Callers hold the write lock.
+func (db *LocationDB) location(code string) *Location {
+	loc, ok := db.byCode[code]
+	if !ok {
+		loc = &Location{Code: code}
+		db.byCode[code] = loc
+	}
+	return loc
+}
+
+// Lookup returns a location by UN/LOCODE or IATA airport code
+func (db *LocationDB) Lookup(code string) (Location, bool) {
+	code = strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(code), " ", ""))
+	db.mutex.RLock()
+	defer db.mutex.RUnlock()
+
+	if loc, ok := db.byCode[code]; ok {
+		return *loc, true
+	}
+	if loc, ok := db.byIATA[code]; ok {
+		return *loc, true
+	}
+	return Location{}, false
+}
+
+// IsAirport reports whether a code is a known IATA airport or UN/LOCODE airport
+func (db *LocationDB) IsAirport(code string) bool {
+	loc, ok := db.Lookup(code)
+	return ok && loc.Airport
+}
+
+// IsSeaport reports whether a code is a known UN/LOCODE seaport
+func (db *LocationDB) IsSeaport(code string) bool {
+	loc, ok := db.Lookup(code)
+	return ok && loc.Seaport
+}
+
+// IsLandLocation reports whether a code is a known UN/LOCODE road or rail
+// terminal or border crossing
+func (db *LocationDB) IsLandLocation(code string) bool {
+	loc, ok := db.Lookup(code)
+	return ok && (loc.RoadTerminal || loc.RailTerminal || loc.BorderCrossing)
+}
+
+// ValidateCode checks that a code is a known location served by a mode
+func (db *LocationDB) ValidateCode(mode TransportationMode, code string) error {
+	switch mode {
+	case Air:
+		if !db.IsAirport(code) {
+			return fmt.Errorf("%s is not a known IATA airport code", code)
+		}
+	case Sea:
+		if !db.IsSeaport(code) {
+			return fmt.Errorf("%s is not a known UN/LOCODE seaport", code)
+		}
+	case Land:
+		if !db.IsLandLocation(code) {
+			return fmt.Errorf("%s is not a known UN/LOCODE road or rail location", code)
+		}
+	case Road:
+		if loc, ok := db.Lookup(code); !ok || !(loc.RoadTerminal || loc.BorderCrossing) {
+			return fmt.Errorf("%s is not a known UN/LOCODE road location", code)
+		}
+	case Rail:
+		if loc, ok := db.Lookup(code); !ok || !(loc.RailTerminal || loc.BorderCrossing) {
+			return fmt.Errorf("%s is not a known UN/LOCODE rail terminal", code)
+		}
+	default:
+		return errors.New("unsupported transportation mode " + string(mode))
+	}
+	return nil
+}
+
+// Search finds locations by code or name for autocomplete. Exact codes rank
+// first, then name prefixes, then fuzzy name matches. A mode restricts the
+// results to locations it serves.
+func (db *LocationDB) Search(query string, mode TransportationMode, limit int) []LocationMatch {
+	query = strings.TrimSpace(query)
+	if query == "" {
+		return []LocationMatch{}
+	}
+	upper := strings.ToUpper(query)
+
+	db.mutex.RLock()
+	candidates := make([]Location, 0, len(db.byCode)+len(db.byIATA))
+	for _, loc := range db.byCode {
+		candidates = append(candidates, *loc)
+	}
+	for _, loc := range db.byIATA {
+		// UN/LOCODE airports are already candidates under their code
+		if loc.Code == "" {
+			candidates = append(candidates, *loc)
+		}
+	}
+	db.mutex.RUnlock()
+
+	matches := []LocationMatch{}
+	for _, loc := range candidates {
+		if mode != "" && db.ValidateCode(mode, locationKey(loc)) != nil {
+			continue
+		}
+		score := 0.0
+		name := strings.ToUpper(loc.Name)
+		switch {
+		case upper == loc.Code || upper == loc.IATA:
+			score = 1
+		case strings.HasPrefix(name, upper):
+			score = 0.95
+		case strings.Contains(name, upper):
+			score = 0.9
+		default:
+			score = nameMatchScore(query, loc.Name)
+			for _, word := range nameTokens(loc.Name) {
+				if s := jaroWinkler(upper, word); s > score {
+					score = s
+				}
+			}
+		}
+		if score >= 0.8 {
+			matches = append(matches, LocationMatch{Location: loc, Score: score})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Score != matches[j].Score {
+			return matches[i].Score > matches[j].Score
+		}
+		return locationKey(matches[i].Location) < locationKey(matches[j].Location)
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// locationKey returns the code a location is looked up by
+func locationKey(loc Location) string {
+	if loc.Code != "" {
+		return loc.Code
+	}
+	return loc.IATA
+}
+
+// functionFlag reports whether a UN/LOCODE function classifier has a flag set
+func functionFlag(function string, position int, flag byte) bool {
+	return len(function) > position && function[position] == flag
+}
+
+// parseUNLOCODECoordinates converts UN/LOCODE "DDMMN DDDMME" coordinates to
+// decimal degrees
+func parseUNLOCODECoordinates(value string) (float64, float64, bool) {
+	parts := strings.Fields(value)
+	if len(parts) != 2 || len(parts[0]) != 5 || len(parts[1]) != 6 {
+		return 0, 0, false
+	}
+	lat, ok := parseDegreesMinutes(parts[0][:2], parts[0][2:4], parts[0][4], 'S')
+	if !ok {
+		return 0, 0, false
+	}
+	lon, ok := parseDegreesMinutes(parts[1][:3], parts[1][3:5], parts[1][5], 'W')
+	if !ok {
+		return 0, 0, false
+	}
+	return lat, lon, true
+}
+
+// parseDegreesMinutes converts degrees and minutes to signed decimal degrees
+func parseDegreesMinutes(degrees, minutes string, hemisphere, negative byte) (float64, bool) {
+	d, err := strconv.Atoi(degrees)
+	if err != nil {
+		return 0, false
+	}
+	m, err := strconv.Atoi(minutes)
+	if err != nil {
+		return 0, false
+	}
+	value := float64(d) + float64(m)/60
+	if hemisphere == negative {
+		value = -value
+	}
+	return value, true
+}
+
+// headerColumns maps a CSV header row to column indexes
+func headerColumns(header []string) map[string]int {
+	cols := make(map[string]int)
+	for i, name := range header {
+		cols[strings.TrimSpace(strings.TrimPrefix(name, "\ufeff"))] = i
+	}
+	return cols
+}
+
+// csvField returns a trimmed field of a record, or "" when it is short
+func csvField(record []string, index int) string {
+	if index < len(record) {
+		return strings.TrimSpace(record[index])
+	}
+	return ""
+}
+
+// parseCSV reads every record of CSV data
+func parseCSV(r io.Reader, comma rune) ([][]string, error) {
+	reader := csv.NewReader(r)
+	reader.Comma = comma
+	reader.FieldsPerRecord = -1
+	reader.LazyQuotes = true
+	return reader.ReadAll()
+}
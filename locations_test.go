@@ -0,0 +1,109 @@
+package main
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+func TestLocations_BundledLookup(t *testing.T) {
+	db := Locations()
+
+	rotterdam, ok := db.Lookup("nl rtm")
+	if !ok || rotterdam.Name != "Rotterdam" || rotterdam.Country != "NL" || !rotterdam.Seaport || !rotterdam.RailTerminal {
+		t.Errorf("Unexpected Rotterdam entry: %+v", rotterdam)
+	}
+	// Coordinates come from UN/LOCODE degrees and minutes unless a port list is more precise
+	chicago, _ := db.Lookup("USCHI")
+	if math.Abs(chicago.Latitude-41.8833) > 0.001 || math.Abs(chicago.Longitude+87.6167) > 0.001 {
+		t.Errorf("Unexpected Chicago coordinates: %v, %v", chicago.Latitude, chicago.Longitude)
+	}
+	if santos, _ := db.Lookup("BRSSZ"); santos.Latitude != -23.96666667 {
+		t.Errorf("Expected World Port Index position for Santos, got %v", santos.Latitude)
+	}
+
+	tests := []struct {
+		mode  TransportationMode
+		code  string
+		valid bool
+	}{
+		{Air, "JFK", true}, // OurAirports
+		{Air, "LON", true}, // UN/LOCODE city with an airport
+		{Air, "MAN", true}, // UN/LOCODE IATA column
+		{Air, "NLRTM", true},
+		{Air, "XXX", false},
+		{Sea, "NLRTM", true},
+		{Sea, "GRPIR", true}, // World Port Index only
+		{Sea, "USCHI", false},
+		{Sea, "JFK", false},
+		{Land, "USLRD", true},
+		{Land, "MXNLD", true},
+		{Land, "GBFXT", true},
+		{Land, "SGSIN", true},
+		{Land, "GRPIR", false},
+	}
+	for _, tt := range tests {
+		if err := db.ValidateCode(tt.mode, tt.code); (err == nil) != tt.valid {
+			t.Errorf("%s %s: expected valid=%v, got %v", tt.mode, tt.code, tt.valid, err)
+		}
+	}
+}
+
+func TestLocations_Search(t *testing.T) {
+	db := Locations()
+
+	if matches := db.Search("JFK", "", 5); len(matches) == 0 || matches[0].IATA != "JFK" || matches[0].Score != 1 {
+		t.Errorf("Expected exact code match first, got %+v", matches)
+	}
+	if matches := db.Search("rott", Sea, 5); len(matches) != 1 || matches[0].Code != "NLRTM" {
+		t.Errorf("Expected name prefix match, got %+v", matches)
+	}
+	if matches := db.Search("Roterdam", "", 5); len(matches) == 0 || matches[0].Code != "NLRTM" {
+		t.Errorf("Expected fuzzy match for a misspelling, got %+v", matches)
+	}
+	// The mode keeps only locations it serves
+	for _, match := range db.Search("London", Air, 10) {
+		if !match.Airport {
+			t.Errorf("Expected only airports, got %+v", match)
+		}
+	}
+	if matches := db.Search("London", "", 2); len(matches) != 2 {
+		t.Errorf("Expected the limit to apply, got %d matches", len(matches))
+	}
+}
+
+func TestLocations_Loaders(t *testing.T) {
+	db := NewLocationDB()
+	n, err := db.LoadUNLOCODE(strings.NewReader(strings.Join([]string{
+		`,"DE",,".GERMANY",".GERMANY",,,,,,,""`,
+		`,"DE","MUC","München","Munchen","BY","-2345---","AI","0307",,"4808N 01134E",""`,
+		`"X","DE","OLD","Removed","Removed","BY","-2------","XX","0307",,,""`,
+	}, "\n")))
+	if err != nil || n != 1 {
+		t.Fatalf("LoadUNLOCODE loaded %d (%v)", n, err)
+	}
+	if munich, ok := db.Lookup("MUC"); !ok || munich.Code != "DEMUC" || munich.Name != "Munchen" {
+		t.Errorf("Expected Munich by IATA code, got %+v", munich)
+	}
+	if _, ok := db.Lookup("DEOLD"); ok {
+		t.Errorf("Expected removed entries to be skipped")
+	}
+	if _, err := db.LoadPorts(strings.NewReader("Port,Lat\nSomewhere,1\n")); err == nil {
+		t.Errorf("Expected error for a port file without World Port Index columns")
+	}
+	if _, err := db.LoadLocationFile("stations", "stations.csv"); err == nil {
+		t.Errorf("Expected error for an unknown dataset")
+	}
+}
+
+func TestValidateServiceCategory_LandLocations(t *testing.T) {
+	if err := ValidateServiceCategory(Export, Land, "USLRD", "MXNLD"); err != nil {
+		t.Errorf("Unexpected error for a cross-border road move: %v", err)
+	}
+	if err := ValidateServiceCategory(Export, Land, "USLRD", "Nowhere"); err == nil {
+		t.Errorf("Expected unknown land destination to be rejected")
+	}
+	if err := ValidateServiceCategory(Import, Sea, "NLRTM", "USNYC"); err != nil {
+		t.Errorf("Unexpected error for real seaports: %v", err)
+	}
+}
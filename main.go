@@ -1,10 +1,13 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -31,14 +34,58 @@ type Config struct {
 		File  string `yaml:"file"`
 	} `yaml:"logging"`
 	Security struct {
-		EnableTLS    bool   `yaml:"enable_tls"`
-		TLSCertFile  string `yaml:"tls_cert_file"`
-		TLSKeyFile   string `yaml:"tls_key_file"`
+		EnableTLS   bool     `yaml:"enable_tls"`
+		TLSCertFile string   `yaml:"tls_cert_file"`
+		TLSKeyFile  string   `yaml:"tls_key_file"`
+		JWTSecret   string   `yaml:"jwt_secret"`
+		PolicyFile  string   `yaml:"policy_file"`
+		Admins      []string `yaml:"admins"` // participant IDs granted the platform Admin role at startup
 	} `yaml:"security"`
 	Monitoring struct {
-		CloudwatchNamespace  string `yaml:"cloudwatch_namespace"`
-		EnableCustomMetrics  bool   `yaml:"enable_custom_metrics"`
+		CloudwatchNamespace string `yaml:"cloudwatch_namespace"`
+		EnableCustomMetrics bool   `yaml:"enable_custom_metrics"`
 	} `yaml:"monitoring"`
+	Oracle struct {
+		FXRatesFile   string                    `yaml:"fx_rates_file"`
+		SurchargeFile string                    `yaml:"surcharge_file"`
+		Providers     []OracleProviderConfig    `yaml:"providers"`
+		Feeds         map[OracleFeed]FeedConfig `yaml:"feeds"`
+	} `yaml:"oracle"`
+	Fees struct {
+		BidFee float64 `yaml:"bid_fee"`
+	} `yaml:"fees"`
+	MultiSig struct {
+		Threshold       int               `yaml:"threshold"`
+		Signers         map[string]string `yaml:"signers"` // user ID -> hex ed25519 public key
+		ProposalTTL     time.Duration     `yaml:"proposal_ttl"`
+		LargeMintAmount float64           `yaml:"large_mint_amount"`
+		MintWindow      time.Duration     `yaml:"mint_window"` // rolling period mints are totalled over
+	} `yaml:"multisig"`
+	Screening struct {
+		OFACDir        string  `yaml:"ofac_dir"`
+		EUFile         string  `yaml:"eu_file"`
+		FlagThreshold  float64 `yaml:"flag_threshold"`
+		BlockThreshold float64 `yaml:"block_threshold"`
+	} `yaml:"screening"`
+	Upgrades struct {
+		Timelock time.Duration `yaml:"timelock"`
+	} `yaml:"upgrades"`
+	Locations struct {
+		UNLOCODEFile string `yaml:"unlocode_file"`
+		PortsFile    string `yaml:"ports_file"`
+		AirportsFile string `yaml:"airports_file"`
+	} `yaml:"locations"`
+	Transport struct {
+		ModeRulesFile string `yaml:"mode_rules_file"`
+	} `yaml:"transport"`
+	Email struct {
+		SMTPHost    string `yaml:"smtp_host"`
+		SMTPPort    int    `yaml:"smtp_port"`
+		Username    string `yaml:"username"`
+		Password    string `yaml:"password"`
+		From        string `yaml:"from"`
+		DevLogCodes bool   `yaml:"dev_log_codes"` // log verification codes instead of emailing them; local development only
+	} `yaml:"email"`
 }
 
 var config Config
@@ -72,12 +119,85 @@ func main() {
 
 	fmt.Printf("Starting server on port %d\n", config.Server.Port)
 
+	// Extend the bundled location reference data with full datasets
+	for _, dataset := range []struct{ kind, path string }{
+		{"unlocode", config.Locations.UNLOCODEFile},
+		{"ports", config.Locations.PortsFile},
+		{"airports", config.Locations.AirportsFile},
+	} {
+		if dataset.path == "" {
+			continue
+		}
+		n, err := Locations().LoadLocationFile(dataset.kind, dataset.path)
+		if err != nil {
+			log.Fatalf("Failed to load %s locations: %v", dataset.kind, err)
+		}
+		log.Printf("Loaded %d %s locations from %s", n, dataset.kind, dataset.path)
+	}
+
 	// Initialize blockchain
 	blockchain := NewBlockchain()
 
 	// Initialize marketplace service
 	marketplace := NewMarketplace(blockchain)
 
+	// Keep an append-only, chain-anchored compliance history for regulators
+	marketplace.Compliance = NewComplianceLog(blockchain)
+
+	// Screen booking counterparties against restricted-party lists
+	screening := NewScreeningService(marketplace.Compliance, config.Screening.FlagThreshold, config.Screening.BlockThreshold)
+	if config.Screening.OFACDir != "" {
+		parties, err := LoadOFACSDN(config.Screening.OFACDir)
+		if err != nil {
+			log.Fatalf("Failed to load OFAC SDN list: %v", err)
+		}
+		screening.LoadList(ListOFACSDN, parties)
+	}
+	if config.Screening.EUFile != "" {
+		parties, err := LoadEUConsolidated(config.Screening.EUFile)
+		if err != nil {
+			log.Fatalf("Failed to load EU consolidated list: %v", err)
+		}
+		screening.LoadList(ListEUConsolidated, parties)
+	}
+	marketplace.Screening = screening
+
+	// Require KYC/KYB verification before participants can bid or book
+	marketplace.Onboarding = NewOnboardingService(blockchain, NewStubVerifier())
+	marketplace.Onboarding.SetComplianceLog(marketplace.Compliance)
+
+	// Organizations own participant identities for their member users
+	marketplace.Organizations = NewOrganizationService(blockchain)
+
+	// Monitor cold-chain readings of perishable bookings, raising disputes on excursions
+	marketplace.Disputes = NewDisputeService()
+	marketplace.ColdChain = NewColdChainMonitor(blockchain, marketplace.Disputes)
+
+	// Enforce per-mode weight, packaging, hazardous, document and transit rules
+	if config.Transport.ModeRulesFile != "" {
+		transport, err := LoadModeRulesFile(config.Transport.ModeRulesFile)
+		if err != nil {
+			log.Fatalf("Failed to load mode rules: %v", err)
+		}
+		marketplace.Transport = transport
+	} else {
+		marketplace.Transport = NewTransportationValidator()
+	}
+
+	// Notify carriers of new quotes matching their lanes and capacity
+	marketplace.Lanes = NewLaneService(LogMatchNotifier{})
+
+	// Ratings and reputation scores are anchored on chain
+	marketplace.Reputation = NewReputationService(blockchain)
+
+	// Contract rate cards booked alongside spot quotes
+	marketplace.Contracts = NewContractService()
+
+	// Bootstrap the platform admins; further roles are assigned by them
+	for _, participantID := range config.Security.Admins {
+		marketplace.AccessControl.AssignRole(participantID, AdminRole)
+	}
+
 	// Initialize smart contract with marketplace
 	smartContract := NewSmartContract(marketplace)
 	smartContract.InitializeServices()
@@ -85,27 +205,176 @@ func main() {
 	// Assign smart contract to marketplace for reference if needed
 	marketplace.SmartContract = smartContract
 
-	// Initialize governance module
-	governance := NewGovernance(blockchain)
+	// Aggregate oracle feeds from the configured providers, or the stub feeds when none are configured
+	providers := []OracleProvider{}
+	signers := make(map[string]ed25519.PublicKey)
+	for _, providerConfig := range config.Oracle.Providers {
+		provider, err := NewOracleProvider(providerConfig)
+		if err != nil {
+			log.Fatalf("Invalid oracle provider: %v", err)
+		}
+		providers = append(providers, provider)
+		// Configured feeds require signed observations
+		if providerConfig.PublicKey == "" {
+			log.Fatalf("Oracle provider %s has no public key", providerConfig.Name)
+		}
+		key, err := hex.DecodeString(providerConfig.PublicKey)
+		if err != nil {
+			log.Fatalf("Invalid public key for oracle provider %s: %v", providerConfig.Name, err)
+		}
+		signers[providerConfig.Name] = key
+	}
+	oracle := NewOracleIntegration(providers...)
+	for source, key := range signers {
+		if err := oracle.RegisterSigner(source, key); err != nil {
+			log.Fatalf("Failed to register oracle signer: %v", err)
+		}
+	}
+	for feed := range config.Oracle.Feeds {
+		if _, known := defaultFeedConfigs[feed]; !known {
+			log.Fatalf("Invalid oracle feed config: unknown oracle feed %s", feed)
+		}
+	}
+	for feed, feedConfig := range defaultFeedConfigs {
+		if configured, ok := config.Oracle.Feeds[feed]; ok {
+			feedConfig = configured
+		}
+		feedConfig.RequireSignatures = feedConfig.RequireSignatures || len(providers) > 0
+		if err := oracle.SetFeedConfig(feed, feedConfig); err != nil {
+			log.Fatalf("Invalid oracle feed config: %v", err)
+		}
+	}
+
+	// Convert currencies at the rate file, the providers' fx feed, or the stub FX table
+	if config.Oracle.FXRatesFile != "" {
+		fxRates, err := LoadFXRatesFile(config.Oracle.FXRatesFile)
+		if err != nil {
+			log.Fatalf("Failed to load FX rates: %v", err)
+		}
+		oracle.SetFXRateProvider(fxRates)
+	} else if len(providers) > 0 {
+		oracle.SetFXRateProvider(oracle.FeedFXRates())
+	} else {
+		oracle.SetFXRateProvider(NewStubFXRateProvider())
+	}
+	marketplace.Oracle = oracle
+
+	// Price fuel, peak season, port handling and currency surcharges from the oracle feeds
+	if config.Oracle.SurchargeFile != "" {
+		surcharges, err := LoadSurchargeFile(config.Oracle.SurchargeFile, oracle)
+		if err != nil {
+			log.Fatalf("Failed to load surcharge formulas: %v", err)
+		}
+		marketplace.Surcharges = surcharges
+	} else {
+		marketplace.Surcharges = NewSurchargeEngine(oracle)
+	}
+
+	// Initialize invoicing with oracle-fed surcharges and port fees
+	marketplace.InvoiceService = NewInvoiceService(marketplace, oracle)
+
+	// Bill memberships against the smart contract's token ledger
+	marketplace.SubscriptionService.SetTokenLedger(smartContract.TokenLedger)
+
+	// Settle booking invoices in tokens on the same ledger
+	payments := NewTokenPaymentSystem(blockchain)
+	payments.SetTokenLedger(smartContract.TokenLedger)
+	payments.SetInvoiceService(marketplace.InvoiceService)
+	marketplace.Payments = payments
+
+	// Enforce membership benefits and charge platform fees
+	if err := smartContract.RegisterDefaultBenefits(); err != nil {
+		log.Fatalf("Failed to register membership benefits: %v", err)
+	}
+	marketplace.Entitlements = NewEntitlementService(smartContract, smartContract.TokenLedger, FeeSchedule{
+		BidFee: config.Fees.BidFee,
+	})
+
+	// Dispatch validation, fee and auction logic through upgradeable rule sets
+	upgradeTimelock := config.Upgrades.Timelock
+	if upgradeTimelock <= 0 {
+		upgradeTimelock = 48 * time.Hour
+	}
+	marketplace.Rules = NewMarketplaceRules(upgradeTimelock)
+	marketplace.Entitlements.SetRules(marketplace.Rules)
+
+	// Process membership renewals and grace period expiry hourly
+	go func() {
+		for now := range time.Tick(time.Hour) {
+			marketplace.SubscriptionService.ProcessRenewals(now)
+		}
+	}()
+
+	// Require signed M-of-N approval for upgrades, large mints and treasury withdrawals
+	if len(config.MultiSig.Signers) > 0 {
+		signers := make(map[string]ed25519.PublicKey)
+		for signerID, key := range config.MultiSig.Signers {
+			decoded, err := hex.DecodeString(key)
+			if err != nil {
+				log.Fatalf("Invalid public key for multisig signer %s: %v", signerID, err)
+			}
+			signers[signerID] = decoded
+		}
+		msa, err := NewMultiSigAuthorization(blockchain, config.MultiSig.Threshold, signers, config.MultiSig.ProposalTTL)
+		if err != nil {
+			log.Fatalf("Failed to initialize multisig: %v", err)
+		}
+		msa.SetLargeMintAmount(config.MultiSig.LargeMintAmount)
+		msa.SetMintWindow(config.MultiSig.MintWindow)
+		marketplace.MultiSig = msa
+	}
+
+	// Initialize governance module, gated on active subscriptions
+	governance := NewGovernance(blockchain, marketplace.MembershipManager, marketplace.SubscriptionService)
+	smartContract.Governance = governance
+
+	// Initialize user accounts and JWT sessions
+	jwtSecret := []byte(os.Getenv("JWT_SECRET"))
+	if len(jwtSecret) == 0 {
+		jwtSecret = []byte(config.Security.JWTSecret)
+	}
+	var sender CodeSender
+	if config.Email.DevLogCodes {
+		log.Printf("WARNING: verification codes are written to the log (email.dev_log_codes)")
+		sender = LogCodeSender{}
+	} else {
+		smtpPassword := os.Getenv("SMTP_PASSWORD")
+		if smtpPassword == "" {
+			smtpPassword = config.Email.Password
+		}
+		sender, err = NewSMTPCodeSender(config.Email.SMTPHost, config.Email.SMTPPort, config.Email.Username, smtpPassword, config.Email.From)
+		if err != nil {
+			log.Fatalf("Failed to configure verification email: %v", err)
+		}
+	}
+	auth, err := NewAuthService(jwtSecret, sender)
+	if err != nil {
+		log.Fatalf("Failed to initialize authentication: %v", err)
+	}
 
 	// Setup HTTP server and routes
-	router := SetupRouter(marketplace, governance)
+	router := SetupRouter(marketplace, governance, auth)
 
 	// Register docs route
-	handlers.RegisterDocsRoutes(router)
+	RegisterDocsRoutes(router)
 
-	// Initialize OPA evaluator for security policies
-	opaEvaluator, err := middleware.NewOPAEvaluator("pkg/security/policies.rego")
+	// Load the route permission policy and reload it when the file changes
+	policyFile := config.Security.PolicyFile
+	if policyFile == "" {
+		policyFile = "pkg/security/policies.yaml"
+	}
+	policies, err := LoadPolicyEngine(policyFile)
 	if err != nil {
-		log.Fatalf("Failed to initialize OPA evaluator: %v", err)
+		log.Fatalf("Failed to load security policy: %v", err)
 	}
-
-	// Wrap router with OPA authorization middleware
-	securedRouter := middleware.OPAAuthMiddleware(opaEvaluator)(router)
+	RegisterMarketplaceOwnershipRules(policies, marketplace)
+	router.Use(policies.Middleware(MarketplaceRoles(marketplace)))
+	policies.WatchFile(30 * time.Second)
+	defer policies.StopWatching()
 
 	addr := fmt.Sprintf(":%d", config.Server.Port)
 	log.Printf("Starting Blockchain Logistics Marketplace server on %s", addr)
-	if err := http.ListenAndServe(addr, securedRouter); err != nil {
+	if err := http.ListenAndServe(addr, router); err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
 }
@@ -3,7 +3,9 @@ package main
 import (
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log"
+	"sort"
 	"sync"
 	"time"
 
@@ -18,47 +20,48 @@ type Marketplace struct {
 	quotes       map[string]FreightQuote
 	bids         map[string][]FreightBid
 	bookings     map[string]Booking
+	tracking     map[string][]TrackingEvent // bookingID -> leg events
+	escrows      map[string]*Escrow         // bookingID -> payment escrow
 
 	mutex sync.RWMutex
 
 	MembershipManager   *MembershipManager
+	AccessControl       *AccessControl
+	SmartContract       *SmartContract
 	SubscriptionService *SubscriptionService
+	InvoiceService      *InvoiceService
+	Payments            *TokenPaymentSystem
+	Oracle              *OracleIntegration
+	Entitlements        *EntitlementService
+	Onboarding          *OnboardingService
+	Organizations       *OrganizationService
+	MultiSig            *MultiSigAuthorization
+	Rules               *MarketplaceRules
+	Compliance          *ComplianceLog
+	Screening           *ScreeningService
+	Disputes            *DisputeService
+	ColdChain           *ColdChainMonitor
+	Transport           *TransportationValidator
+	Lanes               *LaneService
+	Reputation          *ReputationService
+	Contracts           *ContractService
+	Surcharges          *SurchargeEngine
 }
 
 // NewMarketplace creates a new Marketplace instance
 func NewMarketplace(bc *Blockchain) *Marketplace {
+	membershipManager := NewMembershipManager()
 	return &Marketplace{
 		blockchain:          bc,
 		participants:        make(map[string]Participant),
 		quotes:              make(map[string]FreightQuote),
 		bids:                make(map[string][]FreightBid),
 		bookings:            make(map[string]Booking),
-		MembershipManager:   NewMembershipManager(),
-		SubscriptionService: NewSubscriptionService(),
-	}
-}
-
-// NewMarketplace creates a new Marketplace instance
-func NewMarketplace(bc *Blockchain) *Marketplace {
-	return &Marketplace{
-		blockchain:        bc,
-		participants:      make(map[string]Participant),
-		quotes:            make(map[string]FreightQuote),
-		bids:              make(map[string][]FreightBid),
-		bookings:          make(map[string]Booking),
-		MembershipManager: NewMembershipManager(),
-	}
-}
-
-// NewMarketplace creates a new Marketplace instance
-func NewMarketplace(bc *Blockchain) *Marketplace {
-	return &Marketplace{
-		blockchain:        bc,
-		participants:      make(map[string]Participant),
-		quotes:            make(map[string]FreightQuote),
-		bids:              make(map[string][]FreightBid),
-		bookings:          make(map[string]Booking),
-		MembershipManager: NewMembershipManager(),
+		tracking:            make(map[string][]TrackingEvent),
+		escrows:             make(map[string]*Escrow),
+		MembershipManager:   membershipManager,
+		AccessControl:       NewAccessControl(),
+		SubscriptionService: NewSubscriptionService(membershipManager),
 	}
 }
 
@@ -74,20 +77,205 @@ func (m *Marketplace) RegisterParticipant(name string, pType ParticipantType) Pa
 		Type: pType,
 	}
 	m.participants[id] = participant
+	if m.Onboarding != nil {
+		m.Onboarding.StartOnboarding(participant)
+	}
 	log.Printf("Participant registered: %s (%s)", name, id)
 	return participant
 }
 
-// CreateFreightQuote creates a new freight quote
-func (m *Marketplace) CreateFreightQuote(serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, rate float64, validUntil time.Time) (FreightQuote, error) {
+// DeclareCapabilities replaces the service capabilities a carrier declares
+func (m *Marketplace) DeclareCapabilities(participantID string, capabilities []CarrierCapability) (Participant, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	participant, exists := m.participants[participantID]
+	if !exists {
+		return Participant{}, errors.New("participant not found")
+	}
+	if participant.Type != Carrier {
+		return Participant{}, errors.New("only carriers declare capabilities")
+	}
+	for _, capability := range capabilities {
+		if capability != CapabilityReefer {
+			return Participant{}, errors.New("unknown capability: " + string(capability))
+		}
+	}
+	participant.Capabilities = append([]CarrierCapability(nil), capabilities...)
+	m.participants[participantID] = participant
+	log.Printf("Capabilities declared for %s: %v", participantID, capabilities)
+	return participant, nil
+}
+
+// GetParticipant returns a registered participant
+func (m *Marketplace) GetParticipant(participantID string) (Participant, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	participant, exists := m.participants[participantID]
+	if !exists {
+		return Participant{}, errors.New("participant not found")
+	}
+	return participant, nil
+}
+
+// checkVerified rejects participants that have not completed KYC/KYB
+// verification when onboarding is enabled
+func (m *Marketplace) checkVerified(participantID string) error {
+	if m.Onboarding != nil && !m.Onboarding.IsVerified(participantID) {
+		return errors.New("participant has not completed verification")
+	}
+	return nil
+}
+
+// validationRules returns the active quote validation rules
+func (m *Marketplace) validationRules() ValidationRules {
+	if m.Rules == nil {
+		return ValidationRulesV1{}
+	}
+	return m.Rules.Validation()
+}
+
+// auctionRules returns the active bidding rules
+func (m *Marketplace) auctionRules() AuctionRules {
+	if m.Rules == nil {
+		return AuctionRulesV1{}
+	}
+	return m.Rules.Auction()
+}
+
+// screeningSubject returns the name and country a participant is screened
+// under, preferring its verified legal name. Must be called with the mutex held.
+func (m *Marketplace) screeningSubject(participantID string) (string, string) {
+	name, country := m.participants[participantID].Name, ""
+	if m.Onboarding != nil {
+		if profile, err := m.Onboarding.GetProfile(participantID); err == nil {
+			if profile.LegalEntityName != "" {
+				name = profile.LegalEntityName
+			}
+			country = profile.Country
+		}
+	}
+	return name, country
+}
+
+// ScreenParticipant screens a participant against the restricted-party lists
+func (m *Marketplace) ScreenParticipant(participantID string) (ScreeningResult, error) {
+	if m.Screening == nil {
+		return ScreeningResult{}, errors.New("screening not configured")
+	}
+	m.mutex.RLock()
+	if _, ok := m.participants[participantID]; !ok {
+		m.mutex.RUnlock()
+		return ScreeningResult{}, errors.New("participant not found")
+	}
+	name, country := m.screeningSubject(participantID)
+	m.mutex.RUnlock()
+	return m.Screening.Screen(participantID, name, country, "")
+}
+
+// screenParty screens a booking counterparty for a booking on a quote. Must
+// be called with the mutex held.
+func (m *Marketplace) screenParty(participantID, quoteID string) error {
+	if m.Screening == nil {
+		return nil
+	}
+	name, country := m.screeningSubject(participantID)
+	result, err := m.Screening.Screen(participantID, name, country, quoteID)
+	if err != nil {
+		return err
+	}
+	switch result.Decision {
+	case ScreeningBlocked:
+		return errors.New("booking blocked: " + name + " matches a restricted-party list")
+	case ScreeningFlagged:
+		return errors.New("booking held: " + name + " is pending sanctions review")
+	}
+	return nil
+}
+
+// CreateFreightQuote creates a new freight quote owned by a shipper. Only the
+// owning shipper may accept its bids.
+func (m *Marketplace) CreateFreightQuote(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, rate float64, currency string, validUntil time.Time) (FreightQuote, error) {
+	return m.CreateFreightQuoteWithCargo(shipperID, serviceCategory, cargoType, packagingMode, origin, destination, transportationMode, rate, currency, validUntil, CargoDetails{})
+}
+
+// CreateFreightQuoteWithCargo creates a new freight quote carrying cargo details
+func (m *Marketplace) CreateFreightQuoteWithCargo(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, rate float64, currency string, validUntil time.Time, cargo CargoDetails) (FreightQuote, error) {
+	legs := []RouteLeg{{Sequence: 1, Mode: transportationMode, OriginCode: origin, DestinationCode: destination, Status: LegPlanned}}
+	return m.createFreightQuote(shipperID, serviceCategory, cargoType, packagingMode, origin, destination, transportationMode, legs, rate, currency, validUntil, cargo)
+}
+
+// createFreightQuote validates and records a shipper's quote moving cargo
+// over its route legs
+func (m *Marketplace) createFreightQuote(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, legs []RouteLeg, rate float64, currency string, validUntil time.Time, cargo CargoDetails) (FreightQuote, error) {
+	m.mutex.Lock()
+	if _, ok := m.participants[shipperID]; !ok {
+		m.mutex.Unlock()
+		return FreightQuote{}, errors.New("shipper not found")
+	}
+	quote, err := m.buildFreightQuote(serviceCategory, cargoType, packagingMode, origin, destination, transportationMode, legs, rate, currency, validUntil, cargo)
+	m.mutex.Unlock()
+	if err != nil {
+		return FreightQuote{}, err
+	}
+	quote.ShipperID = shipperID
+
+	// Oracle feeds are read without holding the marketplace lock
+	if m.Surcharges != nil {
+		snapshot, err := m.Surcharges.Calculate(quote, quote.Total, quote.Currency, time.Now())
+		if err != nil {
+			return FreightQuote{}, err
+		}
+		quote.Surcharges = &snapshot
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
+	if err := m.recordQuote(quote); err != nil {
+		return FreightQuote{}, err
+	}
+	if m.Lanes != nil {
+		m.Lanes.MatchQuote(quote)
+	}
+	return quote, nil
+}
 
-	if rate <= 0 {
-		return FreightQuote{}, errors.New("rate must be positive")
+// buildFreightQuote prices a quote and checks it against the catalog and the
+// validation, dangerous goods, cold-chain and mode rules. Must be called with
+// the mutex held.
+func (m *Marketplace) buildFreightQuote(serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, legs []RouteLeg, rate float64, currency string, validUntil time.Time, cargo CargoDetails) (FreightQuote, error) {
+	currency, err := NormalizeCurrencyCode(currency, DefaultCurrency)
+	if err != nil {
+		return FreightQuote{}, err
+	}
+
+	// Every leg must be a service the catalog offers between known locations
+	// its mode serves
+	serviceItems := []SubCategoryItem{}
+	for i := range legs {
+		for _, code := range []string{legs[i].OriginCode, legs[i].DestinationCode} {
+			if err := Locations().ValidateCode(legs[i].Mode, code); err != nil {
+				return FreightQuote{}, fmt.Errorf("leg %d: %v", legs[i].Sequence, err)
+			}
+		}
+		if err := ValidateServiceCategory(serviceCategory, legs[i].Mode, legs[i].OriginCode, legs[i].DestinationCode); err != nil {
+			return FreightQuote{}, fmt.Errorf("leg %d: %v", legs[i].Sequence, err)
+		}
+		entry, err := Catalog().Find(serviceCategory, legs[i].Mode, packagingMode, cargoType)
+		if err != nil {
+			return FreightQuote{}, err
+		}
+		legs[i].ServiceItem = entry.Item
+		if len(serviceItems) == 0 || serviceItems[len(serviceItems)-1] != entry.Item {
+			serviceItems = append(serviceItems, entry.Item)
+		}
 	}
-	if validUntil.Before(time.Now()) {
-		return FreightQuote{}, errors.New("validUntil must be in the future")
+
+	// Rates on quotes with line items are per chargeable unit of the mode
+	chargeable, err := ChargeableFor(transportationMode, cargo.Items)
+	if err != nil {
+		return FreightQuote{}, err
 	}
 
 	id := uuid.New().String()
@@ -96,32 +284,68 @@ func (m *Marketplace) CreateFreightQuote(serviceCategory ServiceCategory, cargoT
 		ServiceCategory:    serviceCategory,
 		CargoType:          cargoType,
 		PackagingMode:      packagingMode,
-		Origin:             origin,
-		Destination:        destination,
+		OriginCode:         origin,
+		DestinationCode:    destination,
 		TransportationMode: transportationMode,
 		Rate:               rate,
+		Currency:           currency,
 		ValidUntil:         validUntil,
+		Cargo:              cargo,
+		RateUnit:           chargeable.Unit,
+		Chargeable:         chargeable,
+		Total:              roundAmount(rate * chargeable.Quantity),
+		Legs:               legs,
+		ServiceItems:       serviceItems,
+	}
+	if err := m.validationRules().ValidateQuote(quote, time.Now()); err != nil {
+		return FreightQuote{}, err
+	}
+	// Dangerous goods rules are regulatory and not part of the upgradable rule sets
+	for _, leg := range legs {
+		if err := ValidateDangerousGoods(cargoType, leg.Mode, cargo.DangerousGoods); err != nil {
+			return FreightQuote{}, err
+		}
+	}
+	if err := ValidateColdChain(cargoType, cargo.ColdChain); err != nil {
+		return FreightQuote{}, err
 	}
-	m.quotes[id] = quote
+	if m.Transport != nil {
+		if err := m.Transport.ApplyModeSpecificLogic(quote, nil); err != nil {
+			return FreightQuote{}, err
+		}
+	}
+	return quote, nil
+}
 
+// recordQuote stores a quote and adds it to the blockchain. Must be called
+// with the mutex held.
+func (m *Marketplace) recordQuote(quote FreightQuote) error {
 	// Add to blockchain
 	data, err := json.Marshal(quote)
 	if err != nil {
 		log.Printf("Error marshaling quote: %v", err)
-		return FreightQuote{}, err
+		return err
 	}
 	err = m.blockchain.AddBlock(string(data))
 	if err != nil {
 		log.Printf("Error adding quote to blockchain: %v", err)
-		return FreightQuote{}, err
+		return err
 	}
+	m.quotes[quote.ID] = quote
 
-	log.Printf("Freight quote created: %s", id)
-	return quote, nil
+	log.Printf("Freight quote created: %s", quote.ID)
+	return nil
 }
 
 // PlaceBid places a bid on a freight quote
-func (m *Marketplace) PlaceBid(quoteID, carrierID string, bidAmount float64) (FreightBid, error) {
+// An empty currency means the bid is in the quote's currency.
+func (m *Marketplace) PlaceBid(quoteID, carrierID string, bidAmount float64, currency string) (FreightBid, error) {
+	return m.placeBid(quoteID, 0, carrierID, bidAmount, currency)
+}
+
+// placeBid places a bid on one leg of a quote's route, or on every leg when
+// legSequence is zero
+func (m *Marketplace) placeBid(quoteID string, legSequence int, carrierID string, bidAmount float64, currency string) (FreightBid, error) {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
@@ -129,37 +353,91 @@ func (m *Marketplace) PlaceBid(quoteID, carrierID string, bidAmount float64) (Fr
 	if !exists {
 		return FreightBid{}, errors.New("quote not found")
 	}
+	if legSequence != 0 {
+		if len(quote.Legs) < 2 {
+			return FreightBid{}, errors.New("quote has a single leg; bid on the whole route")
+		}
+		if legSequence < 0 || legSequence > len(quote.Legs) {
+			return FreightBid{}, errors.New("route leg not found")
+		}
+	}
 
 	// Check if carrier exists
-	if _, ok := m.participants[carrierID]; !ok {
+	carrier, ok := m.participants[carrierID]
+	if !ok {
 		return FreightBid{}, errors.New("carrier not found")
 	}
+	if quote.Cargo.ColdChain != nil && !carrier.HasCapability(CapabilityReefer) {
+		return FreightBid{}, errors.New("carrier has not declared reefer capability")
+	}
+	if err := m.checkVerified(carrierID); err != nil {
+		return FreightBid{}, err
+	}
+	// Carriers that subscribed to catalog items bid only on services they serve
+	if len(carrier.ServiceItems) > 0 {
+		for _, leg := range quote.Legs {
+			if (legSequence == 0 || leg.Sequence == legSequence) && !carrier.Serves(leg.ServiceItem) {
+				return FreightBid{}, errors.New("carrier does not serve catalog item " + string(leg.ServiceItem))
+			}
+		}
+	}
 
-	if bidAmount <= 0 {
-		return FreightBid{}, errors.New("bid amount must be positive")
+	// Leg bids only compete with bids on the same leg
+	competing := []FreightBid{}
+	for _, b := range m.bids[quoteID] {
+		if b.LegSequence == legSequence {
+			competing = append(competing, b)
+		}
+	}
+	currency, err := NormalizeCurrencyCode(currency, quote.Currency)
+	if err != nil {
+		return FreightBid{}, err
 	}
 
 	bid := FreightBid{
-		ID:         uuid.New().String(),
-		QuoteID:    quoteID,
-		CarrierID:  carrierID,
-		BidAmount:  bidAmount,
-		BidTime:    time.Now(),
-		IsAccepted: false,
+		ID:          uuid.New().String(),
+		QuoteID:     quoteID,
+		CarrierID:   carrierID,
+		BidAmount:   bidAmount,
+		Currency:    currency,
+		BidTime:     time.Now(),
+		IsAccepted:  false,
+		LegSequence: legSequence,
+	}
+	var rates ExchangeRates
+	if m.Oracle != nil {
+		rates = m.Oracle
+	}
+	if err := m.auctionRules().ValidateBid(quote, competing, bid, rates, bid.BidTime); err != nil {
+		return FreightBid{}, err
 	}
-	m.bids[quoteID] = append(m.bids[quoteID], bid)
-
-	// Add to blockchain
 	data, err := json.Marshal(bid)
 	if err != nil {
 		log.Printf("Error marshaling bid: %v", err)
 		return FreightBid{}, err
 	}
+
+	// Charge the platform bid fee last, honouring free bid quotas and
+	// discounts, so rejected bids cost nothing
+	var charge BidCharge
+	if m.Entitlements != nil {
+		if charge, err = m.Entitlements.ChargeBidFee(carrierID); err != nil {
+			return FreightBid{}, err
+		}
+	}
+
+	// Add to blockchain
 	err = m.blockchain.AddBlock(string(data))
 	if err != nil {
 		log.Printf("Error adding bid to blockchain: %v", err)
+		if m.Entitlements != nil {
+			if refundErr := m.Entitlements.RefundBidFee(carrierID, charge); refundErr != nil {
+				log.Printf("Error refunding bid fee to %s: %v", carrierID, refundErr)
+			}
+		}
 		return FreightBid{}, err
 	}
+	m.bids[quoteID] = append(m.bids[quoteID], bid)
 
 	log.Printf("Bid placed: %s on quote %s", bid.ID, quoteID)
 	return bid, nil
@@ -167,31 +445,78 @@ func (m *Marketplace) PlaceBid(quoteID, carrierID string, bidAmount float64) (Fr
 
 // ConfirmBooking confirms a booking based on accepted bid
 func (m *Marketplace) ConfirmBooking(quoteID, bidID, shipperID string) (Booking, error) {
+	// Surcharges are fixed at the oracle readings of the moment of booking.
+	// They are priced before the marketplace lock is taken.
+	surcharges, err := m.bidSurcharges(quoteID, bidID)
+	if err != nil {
+		return Booking{}, err
+	}
+	escrowAmount, err := m.bidSettlementAmount(quoteID, bidID)
+	if err != nil {
+		return Booking{}, err
+	}
+
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	// Only verified shippers may book
+	if err := m.checkVerified(shipperID); err != nil {
+		return Booking{}, err
+	}
+
+	quote, ok := m.quotes[quoteID]
+	if !ok {
+		return Booking{}, errors.New("quote not found")
+	}
+	if quote.ShipperID == "" || quote.ShipperID != shipperID {
+		return Booking{}, errors.New("only the shipper who owns the quote may accept bids")
+	}
+
 	bids, exists := m.bids[quoteID]
 	if !exists {
 		return Booking{}, errors.New("no bids for quote")
 	}
 
-	var acceptedBid *FreightBid
+	accepted := -1
 	for i, b := range bids {
 		if b.ID == bidID {
-			acceptedBid = &b
-			m.bids[quoteID][i].IsAccepted = true
+			accepted = i
 			break
 		}
 	}
-	if acceptedBid == nil {
+	if accepted < 0 {
 		return Booking{}, errors.New("bid not found")
 	}
+	acceptedBid := bids[accepted]
+
+	// Each leg of the route is booked at most once
+	for _, b := range bids {
+		if b.IsAccepted && (b.LegSequence == 0 || acceptedBid.LegSequence == 0 || b.LegSequence == acceptedBid.LegSequence) {
+			return Booking{}, errors.New("route leg already booked")
+		}
+	}
 
 	// Check shipper exists
 	if _, ok := m.participants[shipperID]; !ok {
 		return Booking{}, errors.New("shipper not found")
 	}
 
+	// Both counterparties must clear restricted-party screening
+	for _, participantID := range []string{shipperID, acceptedBid.CarrierID} {
+		if err := m.screenParty(participantID, quoteID); err != nil {
+			return Booking{}, err
+		}
+	}
+
+	// The shipper's settlement tokens for the bid are held in a time-locked
+	// escrow, extended for entitled shippers
+	var escrow *Escrow
+	if m.SmartContract != nil {
+		var err error
+		if escrow, err = m.SmartContract.OpenBookingEscrow(shipperID, acceptedBid.CarrierID, escrowAmount); err != nil {
+			return Booking{}, err
+		}
+	}
 	booking := Booking{
 		ID:          uuid.New().String(),
 		QuoteID:     quoteID,
@@ -200,21 +525,233 @@ func (m *Marketplace) ConfirmBooking(quoteID, bidID, shipperID string) (Booking,
 		CarrierID:   acceptedBid.CarrierID,
 		BookingTime: time.Now(),
 		Status:      "Confirmed",
+		LegSequence: acceptedBid.LegSequence,
+		Surcharges:  surcharges,
+	}
+	if escrow != nil {
+		booking.EscrowReleaseAt = escrow.ReleaseAt()
 	}
-	m.bookings[booking.ID] = booking
 
-	// Add to blockchain
+	// Add to blockchain before the booking is recorded, so a failed anchor
+	// leaves the quote open and only the escrow to refund
 	data, err := json.Marshal(booking)
-	if err != nil {
-		log.Printf("Error marshaling booking: %v", err)
-		return Booking{}, err
+	if err == nil {
+		err = m.blockchain.AddBlock(string(data))
 	}
-	err = m.blockchain.AddBlock(string(data))
 	if err != nil {
 		log.Printf("Error adding booking to blockchain: %v", err)
+		if escrow != nil {
+			if refundErr := escrow.Refund(); refundErr != nil {
+				log.Printf("Error refunding escrow for booking %s: %v", booking.ID, refundErr)
+			}
+		}
 		return Booking{}, err
 	}
 
+	m.bids[quoteID][accepted].IsAccepted = true
+	if escrow != nil {
+		m.escrows[booking.ID] = escrow
+	}
+	m.bookings[booking.ID] = booking
+	m.assignLegCarrier(quoteID, acceptedBid.LegSequence, acceptedBid.CarrierID)
+
+	// Capacity the carrier was matched on is taken by the booking
+	if m.Lanes != nil {
+		if match, ok := m.Lanes.MatchFor(acceptedBid.CarrierID, quoteID); ok && match.CapacityID != "" {
+			chargeable := m.quotes[quoteID].Chargeable
+			if err := m.Lanes.ConsumeCapacity(acceptedBid.CarrierID, match.CapacityID, chargeable.GrossWeightKg, chargeable.VolumeCBM); err != nil {
+				log.Printf("Error consuming capacity %s: %v", match.CapacityID, err)
+			}
+		}
+	}
+
+	m.startShipmentControls(booking, acceptedBid)
+
 	log.Printf("Booking confirmed: %s", booking.ID)
 	return booking, nil
 }
+
+// bidSettlementAmount converts a bid's amount into settlement tokens at the
+// current exchange rate. It returns zero without a smart contract or when the
+// bid is not found, which ConfirmBooking reports under the lock.
+func (m *Marketplace) bidSettlementAmount(quoteID, bidID string) (float64, error) {
+	if m.SmartContract == nil {
+		return 0, nil
+	}
+	bid, err := m.GetBid(quoteID, bidID)
+	if err != nil {
+		return 0, nil
+	}
+	currency := bid.Currency
+	if currency == "" {
+		quote, _ := m.GetQuote(quoteID)
+		currency = quote.Currency
+	}
+	if currency == "" || currency == DefaultCurrency {
+		return bid.BidAmount, nil
+	}
+	if m.Oracle == nil {
+		return 0, errors.New("oracle required to escrow a bid in " + currency)
+	}
+	rate, err := m.Oracle.FetchExchangeRate(currency, DefaultCurrency)
+	if err != nil {
+		return 0, err
+	}
+	return roundAmount(bid.BidAmount * rate), nil
+}
+
+// bidSurcharges prices the surcharges a bid carries if it is accepted now.
+// It returns nil without a surcharge engine or when the bid is not found,
+// which ConfirmBooking reports under the lock.
+func (m *Marketplace) bidSurcharges(quoteID, bidID string) (*SurchargeSnapshot, error) {
+	if m.Surcharges == nil {
+		return nil, nil
+	}
+	m.mutex.RLock()
+	quote := m.quotes[quoteID]
+	var bid *FreightBid
+	for _, b := range m.bids[quoteID] {
+		if b.ID == bidID {
+			b := b
+			bid = &b
+		}
+	}
+	m.mutex.RUnlock()
+	if bid == nil {
+		return nil, nil
+	}
+
+	currency := bid.Currency
+	if currency == "" {
+		currency = quote.Currency
+	}
+	snapshot, err := m.Surcharges.Calculate(surchargeView(quote, bid.LegSequence), bid.BidAmount, currency, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	return &snapshot, nil
+}
+
+// startShipmentControls starts cold-chain monitoring and records dangerous
+// goods approval for a new booking. Must be called with the mutex held.
+func (m *Marketplace) startShipmentControls(booking Booking, acceptedBid FreightBid) {
+	quote := m.quotes[booking.QuoteID]
+	if quote.Cargo.ColdChain != nil && m.ColdChain != nil {
+		if err := m.ColdChain.StartMonitoring(booking, *quote.Cargo.ColdChain, acceptedBid.BidAmount, acceptedBid.Currency); err != nil {
+			log.Printf("Error starting cold-chain monitoring: %v", err)
+		}
+	}
+	if m.Compliance != nil && len(quote.Cargo.DangerousGoods) > 0 {
+		if _, err := m.Compliance.Record(ComplianceDangerousGoodsApproved, booking.ShipperID, booking.ID, dangerousGoodsSummary(quote.Cargo.DangerousGoods), "marketplace"); err != nil {
+			log.Printf("Error recording dangerous goods approval: %v", err)
+		}
+	}
+}
+
+// GetQuote returns a freight quote by ID
+func (m *Marketplace) GetQuote(quoteID string) (FreightQuote, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	quote, exists := m.quotes[quoteID]
+	if !exists {
+		return FreightQuote{}, errors.New("quote not found")
+	}
+	return quote, nil
+}
+
+// GetBid returns a bid placed on a freight quote
+func (m *Marketplace) GetBid(quoteID, bidID string) (FreightBid, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	for _, b := range m.bids[quoteID] {
+		if b.ID == bidID {
+			return b, nil
+		}
+	}
+	return FreightBid{}, errors.New("bid not found")
+}
+
+// GetBooking returns a booking by ID
+func (m *Marketplace) GetBooking(bookingID string) (Booking, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	booking, exists := m.bookings[bookingID]
+	if !exists {
+		return Booking{}, errors.New("booking not found")
+	}
+	return booking, nil
+}
+
+// BookingEscrow returns the payment escrow opened when a booking was confirmed
+func (m *Marketplace) BookingEscrow(bookingID string) (*Escrow, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	escrow, exists := m.escrows[bookingID]
+	if !exists {
+		return nil, errors.New("no escrow for booking")
+	}
+	return escrow, nil
+}
+
+// NormalizedBid is a bid restated in a common currency for comparison
+type NormalizedBid struct {
+	Bid      FreightBid
+	Amount   float64 // bid amount in the comparison currency
+	Currency string
+	FXRate   float64 // rate applied from the bid currency
+	Priority bool    // carrier is entitled to priority listing
+
+	Reputation *ReputationScore // carrier's published reputation, if any
+}
+
+// NormalizedBids returns the bids on a quote converted into the quote's
+// currency, priority listings first and then cheapest first
+func (m *Marketplace) NormalizedBids(quoteID string) ([]NormalizedBid, error) {
+	m.mutex.RLock()
+	quote, exists := m.quotes[quoteID]
+	bids := append([]FreightBid(nil), m.bids[quoteID]...)
+	m.mutex.RUnlock()
+
+	if !exists {
+		return nil, errors.New("quote not found")
+	}
+
+	normalized := make([]NormalizedBid, 0, len(bids))
+	for _, b := range bids {
+		rate := 1.0
+		if b.Currency != quote.Currency {
+			if m.Oracle == nil {
+				return nil, errors.New("oracle required to compare bids in different currencies")
+			}
+			var err error
+			rate, err = m.Oracle.FetchExchangeRate(b.Currency, quote.Currency)
+			if err != nil {
+				return nil, err
+			}
+		}
+		nb := NormalizedBid{
+			Bid:      b,
+			Amount:   b.BidAmount * rate,
+			Currency: quote.Currency,
+			FXRate:   rate,
+			Priority: m.Entitlements != nil && m.Entitlements.HasFeature(b.CarrierID, FeaturePriorityListing),
+		}
+		if m.Reputation != nil {
+			if score, ok := m.Reputation.Published(b.CarrierID); ok {
+				nb.Reputation = &score
+			}
+		}
+		normalized = append(normalized, nb)
+	}
+	sort.SliceStable(normalized, func(i, j int) bool {
+		if normalized[i].Priority != normalized[j].Priority {
+			return normalized[i].Priority
+		}
+		return normalized[i].Amount < normalized[j].Amount
+	})
+	return normalized, nil
+}
@@ -21,15 +21,42 @@ func TestMarketplace_RegisterParticipant(t *testing.T) {
 func TestMarketplace_CreateFreightQuote(t *testing.T) {
 	bc := NewBlockchain()
 	marketplace := NewMarketplace(bc)
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(Import, GeneralCargo, Container, "NYC", "LON", Sea, 1000.0, validUntil)
+	if _, err := marketplace.CreateFreightQuote("unknown", Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil); err == nil {
+		t.Errorf("Expected a quote for an unknown shipper to be rejected")
+	}
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
-	if quote.Origin != "NYC" || quote.Destination != "LON" {
+	if quote.OriginCode != "USNYC" || quote.DestinationCode != "GBLON" {
 		t.Errorf("Quote origin or destination mismatch")
 	}
+	if quote.ShipperID != shipper.ID {
+		t.Errorf("Expected the quote owned by its shipper, got %q", quote.ShipperID)
+	}
+}
+
+func TestMarketplace_CreateFreightQuoteValidatesLocations(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	validUntil := time.Now().Add(24 * time.Hour)
+
+	if _, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "XXNOP", "GBLON", Sea, 1000.0, "USD", validUntil); err == nil {
+		t.Errorf("Expected an unknown origin to be rejected")
+	}
+	if _, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "DEFRA", "GBLON", Sea, 1000.0, "USD", validUntil); err == nil {
+		t.Errorf("Expected an inland airport to be rejected as a seaport")
+	}
+	_, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Road, OriginCode: "NLRTM", DestinationCode: "XXNOP"},
+	}, 3000.0, "EUR", validUntil, CargoDetails{})
+	if err == nil {
+		t.Errorf("Expected a leg to an unknown location to be rejected")
+	}
 }
 
 func TestMarketplace_PlaceBid(t *testing.T) {
@@ -40,12 +67,12 @@ func TestMarketplace_PlaceBid(t *testing.T) {
 	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(Import, GeneralCargo, Container, "NYC", "LON", Sea, 1000.0, validUntil)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
 
-	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0)
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
 	if err != nil {
 		t.Fatalf("PlaceBid failed: %v", err)
 	}
@@ -62,12 +89,12 @@ func TestMarketplace_ConfirmBooking(t *testing.T) {
 	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(Import, GeneralCargo, Container, "NYC", "LON", Sea, 1000.0, validUntil)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
 
-	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0)
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
 	if err != nil {
 		t.Fatalf("PlaceBid failed: %v", err)
 	}
@@ -80,3 +107,28 @@ func TestMarketplace_ConfirmBooking(t *testing.T) {
 		t.Errorf("Booking status mismatch")
 	}
 }
+
+func TestMarketplace_ConfirmBookingRequiresQuoteOwner(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	other := marketplace.RegisterParticipant("Shipper2", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, other.ID); err == nil {
+		t.Fatalf("Expected a booking by another shipper to be refused")
+	}
+	if stored, _ := marketplace.GetBid(quote.ID, bid.ID); stored.IsAccepted {
+		t.Errorf("Expected a refused booking to leave the bid open")
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err != nil {
+		t.Errorf("Expected the quote owner to book: %v", err)
+	}
+}
@@ -0,0 +1,311 @@
+package main
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// MembershipType defines the membership plan a participant subscribes to
+type MembershipType string
+
+const (
+	MembershipFreightForwarder MembershipType = "FreightForwarder"
+	MembershipCustomsBroker    MembershipType = "CustomsBroker"
+	MembershipCarrier          MembershipType = "Carrier"
+)
+
+// BillingPeriod defines how often a membership is charged
+type BillingPeriod string
+
+const (
+	MonthlyBilling BillingPeriod = "Monthly"
+	AnnualBilling  BillingPeriod = "Annual"
+)
+
+// next returns the end of a billing period starting at from
+func (bp BillingPeriod) next(from time.Time) time.Time {
+	if bp == AnnualBilling {
+		return from.AddDate(1, 0, 0)
+	}
+	return from.AddDate(0, 1, 0)
+}
+
+// PlatformTokenID is the token memberships are paid in
+const PlatformTokenID = "LMT"
+
+// MembershipPlan describes the price and terms of a membership type
+type MembershipPlan struct {
+	Type          MembershipType
+	Price         float64 // tokens per billing period
+	TokenID       string
+	BillingPeriod BillingPeriod
+	GracePeriod   time.Duration // access kept after expiry while renewal is pending
+	BenefitIDs    []string      // keys into the SmartContract benefit registry
+}
+
+// MembershipStatus defines the lifecycle state of a membership
+type MembershipStatus string
+
+const (
+	MembershipPending   MembershipStatus = "Pending" // awaiting first payment
+	MembershipActive    MembershipStatus = "Active"
+	MembershipExpired   MembershipStatus = "Expired"
+	MembershipCancelled MembershipStatus = "Cancelled"
+)
+
+// Membership represents a participant's subscription to a plan
+type Membership struct {
+	ParticipantID string
+	Type          MembershipType
+	Status        MembershipStatus
+	StartedAt     time.Time
+	ExpiresAt     time.Time
+	AutoRenew     bool
+}
+
+// MembershipManager tracks membership plans and participant memberships
+type MembershipManager struct {
+	plans       map[MembershipType]MembershipPlan
+	memberships map[string]Membership // participantID -> membership
+	mutex       sync.RWMutex
+}
+
+// NewMembershipManager creates a new MembershipManager with the default plans
+func NewMembershipManager() *MembershipManager {
+	mm := &MembershipManager{
+		plans:       make(map[MembershipType]MembershipPlan),
+		memberships: make(map[string]Membership),
+	}
+	for _, plan := range []MembershipPlan{
+		{Type: MembershipFreightForwarder, Price: 100, BillingPeriod: MonthlyBilling, GracePeriod: 7 * 24 * time.Hour},
+		{Type: MembershipCustomsBroker, Price: 80, BillingPeriod: MonthlyBilling, GracePeriod: 7 * 24 * time.Hour},
+		{Type: MembershipCarrier, Price: 120, BillingPeriod: MonthlyBilling, GracePeriod: 7 * 24 * time.Hour},
+	} {
+		plan.TokenID = PlatformTokenID
+		mm.plans[plan.Type] = plan
+	}
+	return mm
+}
+
+// SetPlan adds or replaces a membership plan
+func (mm *MembershipManager) SetPlan(plan MembershipPlan) error {
+	if plan.Type == "" {
+		return errors.New("plan type is required")
+	}
+	if plan.Price < 0 {
+		return errors.New("plan price cannot be negative")
+	}
+	if plan.TokenID == "" {
+		plan.TokenID = PlatformTokenID
+	}
+	if plan.BillingPeriod == "" {
+		plan.BillingPeriod = MonthlyBilling
+	}
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+	mm.plans[plan.Type] = plan
+	return nil
+}
+
+// GetPlan returns the plan for a membership type
+func (mm *MembershipManager) GetPlan(mType MembershipType) (MembershipPlan, error) {
+	mm.mutex.RLock()
+	defer mm.mutex.RUnlock()
+
+	plan, exists := mm.plans[mType]
+	if !exists {
+		return MembershipPlan{}, errors.New("unknown membership type")
+	}
+	return plan, nil
+}
+
+// HasPlan reports whether a plan exists for a membership type
+func (mm *MembershipManager) HasPlan(mType MembershipType) bool {
+	_, err := mm.GetPlan(mType)
+	return err == nil
+}
+
+// AttachBenefit adds a benefit from the SmartContract registry to a plan
+func (mm *MembershipManager) AttachBenefit(mType MembershipType, benefitID string) error {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	plan, exists := mm.plans[mType]
+	if !exists {
+		return errors.New("unknown membership type")
+	}
+	for _, id := range plan.BenefitIDs {
+		if id == benefitID {
+			return nil
+		}
+	}
+	plan.BenefitIDs = append(plan.BenefitIDs, benefitID)
+	mm.plans[mType] = plan
+	return nil
+}
+
+// Subscribe registers a participant for a plan. Free plans are active
+// immediately; paid plans stay pending until the first period is paid
+// through the SubscriptionService.
+func (mm *MembershipManager) Subscribe(participantID string, mType MembershipType) (Membership, error) {
+	if participantID == "" {
+		return Membership{}, errors.New("participant ID is required")
+	}
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	plan, exists := mm.plans[mType]
+	if !exists {
+		return Membership{}, errors.New("unknown membership type")
+	}
+
+	now := time.Now()
+	if existing, ok := mm.memberships[participantID]; ok && mm.isActive(existing, now) {
+		if existing.Type == mType {
+			return existing, nil
+		}
+		return Membership{}, errors.New("participant already has an active membership of another type")
+	}
+
+	membership := Membership{
+		ParticipantID: participantID,
+		Type:          mType,
+		Status:        MembershipPending,
+		AutoRenew:     true,
+	}
+	if plan.Price == 0 {
+		membership.Status = MembershipActive
+		membership.StartedAt = now
+		membership.ExpiresAt = plan.BillingPeriod.next(now)
+	}
+	mm.memberships[participantID] = membership
+	return membership, nil
+}
+
+// GetMembership returns a participant's membership
+func (mm *MembershipManager) GetMembership(participantID string) (Membership, error) {
+	mm.mutex.RLock()
+	defer mm.mutex.RUnlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists {
+		return Membership{}, errors.New("membership not found")
+	}
+	return membership, nil
+}
+
+// CheckActive checks whether a participant has an active membership,
+// including any grace period after expiry
+func (mm *MembershipManager) CheckActive(participantID string) bool {
+	mm.mutex.RLock()
+	defer mm.mutex.RUnlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists {
+		return false
+	}
+	return mm.isActive(membership, time.Now())
+}
+
+// InGracePeriod checks whether a participant's membership has expired but is
+// still within its plan's grace period
+func (mm *MembershipManager) InGracePeriod(participantID string) bool {
+	mm.mutex.RLock()
+	defer mm.mutex.RUnlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists || membership.Status != MembershipActive {
+		return false
+	}
+	now := time.Now()
+	return now.After(membership.ExpiresAt) && mm.isActive(membership, now)
+}
+
+// isActive must be called with the mutex held
+func (mm *MembershipManager) isActive(membership Membership, now time.Time) bool {
+	if membership.Status != MembershipActive {
+		return false
+	}
+	plan := mm.plans[membership.Type]
+	return now.Before(membership.ExpiresAt.Add(plan.GracePeriod))
+}
+
+// extend marks a membership paid for one more billing period. A renewal
+// within the grace period continues from the previous expiry; a lapsed
+// membership restarts from now.
+func (mm *MembershipManager) extend(participantID string, now time.Time) (Membership, error) {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists {
+		return Membership{}, errors.New("membership not found")
+	}
+	if membership.Status == MembershipCancelled {
+		return Membership{}, errors.New("membership has been cancelled")
+	}
+	plan := mm.plans[membership.Type]
+
+	start := membership.ExpiresAt
+	if !mm.isActive(membership, now) {
+		start = now
+		membership.StartedAt = now
+	}
+	membership.Status = MembershipActive
+	membership.ExpiresAt = plan.BillingPeriod.next(start)
+	mm.memberships[participantID] = membership
+	return membership, nil
+}
+
+// expireLapsed marks memberships past their grace period as expired and
+// returns those due for renewal (expired but still within grace)
+func (mm *MembershipManager) expireLapsed(now time.Time) []Membership {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	due := []Membership{}
+	for id, membership := range mm.memberships {
+		if membership.Status != MembershipActive || now.Before(membership.ExpiresAt) {
+			continue
+		}
+		if mm.isActive(membership, now) {
+			if membership.AutoRenew {
+				due = append(due, membership)
+			}
+			continue
+		}
+		membership.Status = MembershipExpired
+		mm.memberships[id] = membership
+	}
+	return due
+}
+
+// SetAutoRenew turns automatic renewal on or off for a membership
+func (mm *MembershipManager) SetAutoRenew(participantID string, autoRenew bool) error {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists {
+		return errors.New("membership not found")
+	}
+	membership.AutoRenew = autoRenew
+	mm.memberships[participantID] = membership
+	return nil
+}
+
+// Cancel cancels a membership immediately
+func (mm *MembershipManager) Cancel(participantID string) error {
+	mm.mutex.Lock()
+	defer mm.mutex.Unlock()
+
+	membership, exists := mm.memberships[participantID]
+	if !exists {
+		return errors.New("membership not found")
+	}
+	membership.Status = MembershipCancelled
+	membership.AutoRenew = false
+	mm.memberships[participantID] = membership
+	return nil
+}
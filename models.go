@@ -1,6 +1,9 @@
 package main
 
-import "time"
+import (
+	"errors"
+	"time"
+)
 
 // ParticipantType defines the type of marketplace participant
 type ParticipantType string
@@ -13,11 +16,42 @@ const (
 	CustomsBroker   ParticipantType = "CustomsBroker"
 )
 
+// IsValidParticipantType checks whether a participant type is supported
+func IsValidParticipantType(pType ParticipantType) bool {
+	switch pType {
+	case Shipper, Consignee, Carrier, FreightForwarder, CustomsBroker:
+		return true
+	}
+	return false
+}
+
 // Participant represents a marketplace participant
 type Participant struct {
-	ID   string
-	Name string
-	Type ParticipantType
+	ID           string
+	Name         string
+	Type         ParticipantType
+	Capabilities []CarrierCapability
+	ServiceItems []SubCategoryItem // catalog items a carrier serves
+}
+
+// HasCapability reports whether the participant declared a capability
+func (p Participant) HasCapability(capability CarrierCapability) bool {
+	for _, c := range p.Capabilities {
+		if c == capability {
+			return true
+		}
+	}
+	return false
+}
+
+// Serves reports whether the participant subscribed to a catalog item
+func (p Participant) Serves(item SubCategoryItem) bool {
+	for _, i := range p.ServiceItems {
+		if i == item {
+			return true
+		}
+	}
+	return false
 }
 
 // ServiceCategory defines the logistics service category
@@ -271,89 +305,25 @@ func ValidateServiceCategory(category ServiceCategory, transportationMode Transp
 	case Import, Export:
 		// For Import and Export, origin and destination codes must be valid for the transportation mode
 		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
+			if !Locations().IsAirport(originCode) {
 				return errors.New("origin code is not a valid IATA airport code for Import/Export")
 			}
-			if !validIATAAirportCodes[destinationCode] {
+			if !Locations().IsAirport(destinationCode) {
 				return errors.New("destination code is not a valid IATA airport code for Import/Export")
 			}
 		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
+			if !Locations().IsSeaport(originCode) {
 				return errors.New("origin code is not a valid IMO seaport code for Import/Export")
 			}
-			if !validIMOSeraportCodes[destinationCode] {
+			if !Locations().IsSeaport(destinationCode) {
 				return errors.New("destination code is not a valid IMO seaport code for Import/Export")
 			}
-		} else {
-			return errors.New("unsupported transportation mode for Import/Export")
-		}
-	case Transit:
-		// Transit can only be Air or Sea
-		if transportationMode != Air && transportationMode != Sea {
-			return errors.New("Transit service category can only be Air or Sea transportation mode")
-		}
-		// Validate origin and destination codes
-		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
-				return errors.New("origin code is not a valid IATA airport code for Transit")
-			}
-			if !validIATAAirportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IATA airport code for Transit")
-			}
-		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
-				return errors.New("origin code is not a valid IMO seaport code for Transit")
-			}
-			if !validIMOSeraportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IMO seaport code for Transit")
-			}
-		}
-	case Transshipment:
-		// Transshipment validation can be similar to Transit or customized as needed
-		// For now, allow all transportation modes and validate codes accordingly
-		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
-				return errors.New("origin code is not a valid IATA airport code for Transshipment")
-			}
-			if !validIATAAirportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IATA airport code for Transshipment")
-			}
-		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
-				return errors.New("origin code is not a valid IMO seaport code for Transshipment")
+		} else if IsLandMode(transportationMode) {
+			if !Locations().IsLandLocation(originCode) {
+				return errors.New("origin code is not a valid UN/LOCODE land location for Import/Export")
 			}
-			if !validIMOSeraportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IMO seaport code for Transshipment")
-			}
-		} else if transportationMode == Land {
-			// Land transportation validation can be added here if needed
-		} else {
-			return errors.New("unsupported transportation mode for Transshipment")
-		}
-	default:
-		return errors.New("unknown service category")
-	}
-	return nil
-}
-
-// ValidateServiceCategory validates the service category and its relation to freight quote and bidding
-func ValidateServiceCategory(category ServiceCategory, transportationMode TransportationMode, originCode, destinationCode string) error {
-	switch category {
-	case Import, Export:
-		// For Import and Export, origin and destination codes must be valid for the transportation mode
-		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
-				return errors.New("origin code is not a valid IATA airport code for Import/Export")
-			}
-			if !validIATAAirportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IATA airport code for Import/Export")
-			}
-		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
-				return errors.New("origin code is not a valid IMO seaport code for Import/Export")
-			}
-			if !validIMOSeraportCodes[destinationCode] {
-				return errors.New("destination code is not a valid IMO seaport code for Import/Export")
+			if !Locations().IsLandLocation(destinationCode) {
+				return errors.New("destination code is not a valid UN/LOCODE land location for Import/Export")
 			}
 		} else {
 			return errors.New("unsupported transportation mode for Import/Export")
@@ -365,17 +335,17 @@ func ValidateServiceCategory(category ServiceCategory, transportationMode Transp
 		}
 		// Validate origin and destination codes
 		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
+			if !Locations().IsAirport(originCode) {
 				return errors.New("origin code is not a valid IATA airport code for Transit")
 			}
-			if !validIATAAirportCodes[destinationCode] {
+			if !Locations().IsAirport(destinationCode) {
 				return errors.New("destination code is not a valid IATA airport code for Transit")
 			}
 		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
+			if !Locations().IsSeaport(originCode) {
 				return errors.New("origin code is not a valid IMO seaport code for Transit")
 			}
-			if !validIMOSeraportCodes[destinationCode] {
+			if !Locations().IsSeaport(destinationCode) {
 				return errors.New("destination code is not a valid IMO seaport code for Transit")
 			}
 		}
@@ -383,21 +353,26 @@ func ValidateServiceCategory(category ServiceCategory, transportationMode Transp
 		// Transshipment validation can be similar to Transit or customized as needed
 		// For now, allow all transportation modes and validate codes accordingly
 		if transportationMode == Air {
-			if !validIATAAirportCodes[originCode] {
+			if !Locations().IsAirport(originCode) {
 				return errors.New("origin code is not a valid IATA airport code for Transshipment")
 			}
-			if !validIATAAirportCodes[destinationCode] {
+			if !Locations().IsAirport(destinationCode) {
 				return errors.New("destination code is not a valid IATA airport code for Transshipment")
 			}
 		} else if transportationMode == Sea {
-			if !validIMOSeraportCodes[originCode] {
+			if !Locations().IsSeaport(originCode) {
 				return errors.New("origin code is not a valid IMO seaport code for Transshipment")
 			}
-			if !validIMOSeraportCodes[destinationCode] {
+			if !Locations().IsSeaport(destinationCode) {
 				return errors.New("destination code is not a valid IMO seaport code for Transshipment")
 			}
-		} else if transportationMode == Land {
-			// Land transportation validation can be added here if needed
+		} else if IsLandMode(transportationMode) {
+			if !Locations().IsLandLocation(originCode) {
+				return errors.New("origin code is not a valid UN/LOCODE land location for Transshipment")
+			}
+			if !Locations().IsLandLocation(destinationCode) {
+				return errors.New("destination code is not a valid UN/LOCODE land location for Transshipment")
+			}
 		} else {
 			return errors.New("unsupported transportation mode for Transshipment")
 		}
@@ -415,6 +390,10 @@ const (
 	Perishable  CargoType = "Perishable"
 	Hazardous   CargoType = "Hazardous"
 	Fragile     CargoType = "Fragile"
+	BulkCargo   CargoType = "BulkCargo"
+	LCLCargo    CargoType = "LCLCargo" // less than container load, consolidated
+	LiveCargo   CargoType = "LiveCargo"
+	LiquidCargo CargoType = "LiquidCargo"
 )
 
 // PackagingMode defines the packaging mode
@@ -432,9 +411,17 @@ type TransportationMode string
 const (
 	Sea TransportationMode = "Sea"
 	Air TransportationMode = "Air"
-	Land TransportationMode = "Land"
+	Land TransportationMode = "Land" // road or rail
+	Road TransportationMode = "Road"
+	Rail TransportationMode = "Rail"
+	Multimodal TransportationMode = "Multimodal" // route legs use more than one mode
 )
 
+// IsLandMode reports whether a mode moves freight overland
+func IsLandMode(mode TransportationMode) bool {
+	return mode == Land || mode == Road || mode == Rail
+}
+
 // FreightQuote represents a freight quotation
 type FreightQuote struct {
 	ID                 string
@@ -445,7 +432,24 @@ type FreightQuote struct {
 	DestinationCode    string // IATA airport code or IMO seaport code
 	TransportationMode TransportationMode
 	Rate               float64
+	RateUnit           RateUnit // unit Rate is charged per, from the mode's chargeable weight rules
+	Currency           string   // ISO 4217 code the rate is expressed in
 	ValidUntil         time.Time
+	ShipperID          string // participant that created and owns the quote
+	Cargo              CargoDetails
+	Chargeable         ChargeableMeasure
+	Total              float64            // Rate times the chargeable quantity
+	Legs               []RouteLeg         // ordered legs from origin to destination
+	ServiceItems       []SubCategoryItem  // catalog services the legs fall under, in route order
+	ContractID         string             // rate contract the quote was priced from, if any
+	Surcharges         *SurchargeSnapshot // surcharges estimated on Total when the quote was created
+}
+
+// CargoDetails describes the goods shipped under a quote
+type CargoDetails struct {
+	Items          []CargoLineItem        `json:"items,omitempty"`
+	DangerousGoods []DangerousGoodsItem   `json:"dangerous_goods,omitempty"`
+	ColdChain      *ColdChainRequirements `json:"cold_chain,omitempty"`
 }
 
 // FreightBid represents a bid on a freight quote
@@ -454,8 +458,10 @@ type FreightBid struct {
 	QuoteID     string
 	CarrierID   string
 	BidAmount   float64
+	Currency    string // ISO 4217 code the bid is expressed in
 	BidTime     time.Time
 	IsAccepted  bool
+	LegSequence int // route leg the bid covers; 0 bids on every leg
 }
 
 // Booking represents a confirmed cargo booking
@@ -467,4 +473,10 @@ type Booking struct {
 	CarrierID   string
 	BookingTime time.Time
 	Status      string
+	LegSequence int                // route leg the booking covers; 0 books every leg
+	Documents   []ShipmentDocument // transport documents issued for the shipment
+	ContractID  string             // rate contract booked against instead of a spot bid
+	Surcharges  *SurchargeSnapshot // surcharges on the accepted bid, fixed at confirmation
+
+	EscrowReleaseAt time.Time // when the payment escrow opened at confirmation unlocks
 }
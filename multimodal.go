@@ -0,0 +1,238 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+)
+
+// LegStatus is the tracking status of a route leg
+type LegStatus string
+
+const (
+	LegPlanned  LegStatus = "Planned"
+	LegDeparted LegStatus = "Departed"
+	LegArrived  LegStatus = "Arrived"
+)
+
+// RouteLeg is one leg of a shipment's route, moved by a single mode and carrier
+type RouteLeg struct {
+	Sequence         int                `json:"sequence"` // 1-based position in the route
+	Mode             TransportationMode `json:"mode"`
+	OriginCode       string             `json:"origin"`
+	DestinationCode  string             `json:"destination"`
+	PlannedDeparture time.Time          `json:"planned_departure,omitempty"`
+	PlannedArrival   time.Time          `json:"planned_arrival,omitempty"`
+	ServiceItem      SubCategoryItem    `json:"service_item,omitempty"` // catalog service the leg falls under
+	CarrierID        string             `json:"carrier_id,omitempty"`   // assigned when the leg is booked
+	Status           LegStatus          `json:"status"`
+	DepartedAt       time.Time          `json:"departed_at,omitempty"`
+	ArrivedAt        time.Time          `json:"arrived_at,omitempty"`
+}
+
+// TrackingEvent records a leg of a booked shipment departing or arriving
+type TrackingEvent struct {
+	BookingID   string
+	QuoteID     string
+	LegSequence int
+	Status      LegStatus
+	Location    string
+	CarrierID   string
+	Time        time.Time
+}
+
+// ValidateRoute checks that legs form a connected route between known
+// locations, each transshipment point joining one leg's destination to the
+// next leg's origin
+func ValidateRoute(legs []RouteLeg) error {
+	if len(legs) == 0 {
+		return errors.New("route requires at least one leg")
+	}
+	locations := Locations()
+	for i, leg := range legs {
+		if leg.OriginCode == leg.DestinationCode {
+			return fmt.Errorf("leg %d: origin and destination must differ", i+1)
+		}
+		if err := locations.ValidateCode(leg.Mode, leg.OriginCode); err != nil {
+			return fmt.Errorf("leg %d: %v", i+1, err)
+		}
+		if err := locations.ValidateCode(leg.Mode, leg.DestinationCode); err != nil {
+			return fmt.Errorf("leg %d: %v", i+1, err)
+		}
+		if i > 0 && legs[i-1].DestinationCode != leg.OriginCode {
+			return fmt.Errorf("leg %d: must start at %s where leg %d ends", i+1, legs[i-1].DestinationCode, i)
+		}
+		if i > 0 && !leg.PlannedArrival.IsZero() && leg.PlannedArrival.Before(legs[i-1].PlannedArrival) {
+			return fmt.Errorf("leg %d: planned arrival precedes the previous leg's", i+1)
+		}
+	}
+	return nil
+}
+
+// routeMode returns the legs' common mode, or Multimodal when they differ
+func routeMode(legs []RouteLeg) TransportationMode {
+	for _, leg := range legs[1:] {
+		if leg.Mode != legs[0].Mode {
+			return Multimodal
+		}
+	}
+	return legs[0].Mode
+}
+
+// CreateMultimodalQuote creates a freight quote over an ordered route of
+// legs, such as Sea to a transshipment hub then Land to the consignee
+func (m *Marketplace) CreateMultimodalQuote(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, legs []RouteLeg, rate float64, currency string, validUntil time.Time, cargo CargoDetails) (FreightQuote, error) {
+	if err := ValidateRoute(legs); err != nil {
+		return FreightQuote{}, err
+	}
+	route := make([]RouteLeg, len(legs))
+	for i, leg := range legs {
+		route[i] = RouteLeg{
+			Sequence:         i + 1,
+			Mode:             leg.Mode,
+			OriginCode:       leg.OriginCode,
+			DestinationCode:  leg.DestinationCode,
+			PlannedDeparture: leg.PlannedDeparture,
+			PlannedArrival:   leg.PlannedArrival,
+			Status:           LegPlanned,
+		}
+	}
+	origin, destination := route[0].OriginCode, route[len(route)-1].DestinationCode
+	return m.createFreightQuote(shipperID, serviceCategory, cargoType, packagingMode, origin, destination, routeMode(route), route, rate, currency, validUntil, cargo)
+}
+
+// PlaceLegBid places a bid on a single leg of a multi-leg quote
+func (m *Marketplace) PlaceLegBid(quoteID string, legSequence int, carrierID string, bidAmount float64, currency string) (FreightBid, error) {
+	if legSequence <= 0 {
+		return FreightBid{}, errors.New("leg sequence must be positive")
+	}
+	return m.placeBid(quoteID, legSequence, carrierID, bidAmount, currency)
+}
+
+// assignLegCarrier records the carrier booked for one leg, or every leg when
+// legSequence is zero. Callers hold the write lock.
+func (m *Marketplace) assignLegCarrier(quoteID string, legSequence int, carrierID string) {
+	quote := m.quotes[quoteID]
+	legs := append([]RouteLeg(nil), quote.Legs...)
+	for i := range legs {
+		if legSequence == 0 || legs[i].Sequence == legSequence {
+			legs[i].CarrierID = carrierID
+		}
+	}
+	quote.Legs = legs
+	m.quotes[quoteID] = quote
+}
+
+// RecordLegEvent records a booked leg departing or arriving. A leg departs
+// only after the previous leg has arrived at the transshipment point, and the
+// booking is delivered once every leg it covers has arrived.
+func (m *Marketplace) RecordLegEvent(bookingID string, legSequence int, status LegStatus, location string, at time.Time) (TrackingEvent, error) {
+	if at.IsZero() {
+		at = time.Now()
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	booking, exists := m.bookings[bookingID]
+	if !exists {
+		return TrackingEvent{}, errors.New("booking not found")
+	}
+	if booking.LegSequence != 0 && booking.LegSequence != legSequence {
+		return TrackingEvent{}, errors.New("booking does not cover this leg")
+	}
+	quote := m.quotes[booking.QuoteID]
+	if legSequence < 1 || legSequence > len(quote.Legs) {
+		return TrackingEvent{}, errors.New("route leg not found")
+	}
+	legs := append([]RouteLeg(nil), quote.Legs...)
+	leg := &legs[legSequence-1]
+
+	switch status {
+	case LegDeparted:
+		if leg.Status != LegPlanned {
+			return TrackingEvent{}, errors.New("leg has already departed")
+		}
+		if legSequence > 1 && legs[legSequence-2].Status != LegArrived {
+			return TrackingEvent{}, errors.New("previous leg has not arrived at the transshipment point")
+		}
+		// The leg's mode rules must be met, including its transport documents
+		if m.Transport != nil {
+			legBooking := booking
+			legBooking.LegSequence = legSequence
+			if err := m.Transport.ApplyModeSpecificLogic(quote, &legBooking); err != nil {
+				return TrackingEvent{}, err
+			}
+		}
+		if location == "" {
+			location = leg.OriginCode
+		}
+		leg.DepartedAt = at
+	case LegArrived:
+		if leg.Status != LegDeparted {
+			return TrackingEvent{}, errors.New("leg has not departed")
+		}
+		if location == "" {
+			location = leg.DestinationCode
+		}
+		leg.ArrivedAt = at
+	default:
+		return TrackingEvent{}, errors.New("leg status must be Departed or Arrived")
+	}
+	leg.Status = status
+	quote.Legs = legs
+
+	event := TrackingEvent{
+		BookingID:   bookingID,
+		QuoteID:     booking.QuoteID,
+		LegSequence: legSequence,
+		Status:      status,
+		Location:    location,
+		CarrierID:   booking.CarrierID,
+		Time:        at,
+	}
+
+	// Add to blockchain
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Error marshaling tracking event: %v", err)
+		return TrackingEvent{}, err
+	}
+	if err := m.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding tracking event to blockchain: %v", err)
+		return TrackingEvent{}, err
+	}
+
+	m.quotes[booking.QuoteID] = quote
+	m.tracking[bookingID] = append(m.tracking[bookingID], event)
+	if bookingDelivered(booking, legs) {
+		booking.Status = "Delivered"
+		m.bookings[bookingID] = booking
+	}
+
+	log.Printf("Booking %s leg %d %s at %s", bookingID, legSequence, status, location)
+	return event, nil
+}
+
+// bookingDelivered reports whether every leg a booking covers has arrived
+func bookingDelivered(booking Booking, legs []RouteLeg) bool {
+	for _, leg := range legs {
+		if (booking.LegSequence == 0 || booking.LegSequence == leg.Sequence) && leg.Status != LegArrived {
+			return false
+		}
+	}
+	return true
+}
+
+// TrackingEvents returns the leg events recorded for a booking, oldest first
+func (m *Marketplace) TrackingEvents(bookingID string) ([]TrackingEvent, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	if _, exists := m.bookings[bookingID]; !exists {
+		return nil, errors.New("booking not found")
+	}
+	return append([]TrackingEvent{}, m.tracking[bookingID]...), nil
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestValidateRoute(t *testing.T) {
+	valid := []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Land, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+	}
+	if err := ValidateRoute(valid); err != nil {
+		t.Errorf("Unexpected error for valid route: %v", err)
+	}
+	if routeMode(valid) != Multimodal || routeMode(valid[:1]) != Sea {
+		t.Errorf("Unexpected route modes %s and %s", routeMode(valid), routeMode(valid[:1]))
+	}
+
+	invalid := map[string][]RouteLeg{
+		"empty":          {},
+		"disconnected":   {valid[0], {Mode: Land, OriginCode: "DEDUI", DestinationCode: "PLWAW"}},
+		"wrong mode":     {{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "PLWAW"}},
+		"same endpoints": {{Mode: Land, OriginCode: "PLWAW", DestinationCode: "PLWAW"}},
+		"multimodal leg": {{Mode: Multimodal, OriginCode: "CNSHA", DestinationCode: "NLRTM"}},
+	}
+	for name, legs := range invalid {
+		if err := ValidateRoute(legs); err == nil {
+			t.Errorf("%s: expected route to be rejected", name)
+		}
+	}
+}
+
+func TestMultimodal_LegBiddingAndTracking(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Land, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+	}, 3000.0, "EUR", time.Now().Add(24*time.Hour), CargoDetails{})
+	if err != nil {
+		t.Fatalf("CreateMultimodalQuote failed: %v", err)
+	}
+	if quote.TransportationMode != Multimodal || quote.Legs[1].Sequence != 2 || quote.Legs[1].Status != LegPlanned {
+		t.Fatalf("Unexpected quote: %+v", quote)
+	}
+
+	oceanCarrier := marketplace.RegisterParticipant("Ocean Line", Carrier)
+	truckCarrier := marketplace.RegisterParticipant("Road Haulier", Carrier)
+
+	if _, err := marketplace.PlaceLegBid(quote.ID, 3, truckCarrier.ID, 500.0, ""); err == nil {
+		t.Errorf("Expected bid on a missing leg to be rejected")
+	}
+	seaBid, err := marketplace.PlaceLegBid(quote.ID, 1, oceanCarrier.ID, 2000.0, "")
+	if err != nil {
+		t.Fatalf("PlaceLegBid failed: %v", err)
+	}
+	roadBid, err := marketplace.PlaceLegBid(quote.ID, 2, truckCarrier.ID, 800.0, "")
+	if err != nil {
+		t.Fatalf("PlaceLegBid failed: %v", err)
+	}
+	bundleBid, err := marketplace.PlaceBid(quote.ID, oceanCarrier.ID, 2700.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+
+	seaBooking, err := marketplace.ConfirmBooking(quote.ID, seaBid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, bundleBid.ID, shipper.ID); err == nil {
+		t.Errorf("Expected a whole-route bid to conflict with a booked leg")
+	}
+	roadBooking, err := marketplace.ConfirmBooking(quote.ID, roadBid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	legs := marketplace.quotes[quote.ID].Legs
+	if legs[0].CarrierID != oceanCarrier.ID || legs[1].CarrierID != truckCarrier.ID {
+		t.Errorf("Expected each leg assigned to its carrier, got %+v", legs)
+	}
+
+	if _, err := marketplace.RecordLegEvent(roadBooking.ID, 2, LegDeparted, "", time.Time{}); err == nil {
+		t.Errorf("Expected road leg not to depart before the sea leg arrives")
+	}
+	if _, err := marketplace.RecordLegEvent(seaBooking.ID, 2, LegDeparted, "", time.Time{}); err == nil {
+		t.Errorf("Expected booking not to track a leg it does not cover")
+	}
+	if _, err := marketplace.RecordLegEvent(seaBooking.ID, 1, LegArrived, "", time.Time{}); err == nil {
+		t.Errorf("Expected leg not to arrive before departing")
+	}
+	steps := []struct {
+		booking Booking
+		leg     int
+		status  LegStatus
+	}{
+		{seaBooking, 1, LegDeparted},
+		{seaBooking, 1, LegArrived},
+		{roadBooking, 2, LegDeparted},
+		{roadBooking, 2, LegArrived},
+	}
+	for i, step := range steps {
+		if _, err := marketplace.RecordLegEvent(step.booking.ID, step.leg, step.status, "", time.Time{}); err != nil {
+			t.Fatalf("step %d: RecordLegEvent failed: %v", i, err)
+		}
+	}
+
+	events, err := marketplace.TrackingEvents(seaBooking.ID)
+	if err != nil || len(events) != 2 || events[1].Location != "NLRTM" {
+		t.Errorf("Unexpected sea leg events %+v (%v)", events, err)
+	}
+	for _, booking := range []Booking{seaBooking, roadBooking} {
+		if status := marketplace.bookings[booking.ID].Status; status != "Delivered" {
+			t.Errorf("Expected booking %s delivered, got %s", booking.ID, status)
+		}
+	}
+}
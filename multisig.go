@@ -0,0 +1,387 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// MultiSigOperation identifies the kind of action a multisig proposal authorizes
+type MultiSigOperation string
+
+const (
+	OpContractUpgrade    MultiSigOperation = "contract-upgrade"
+	OpLargeMint          MultiSigOperation = "large-mint"
+	OpTreasuryWithdrawal MultiSigOperation = "treasury-withdrawal"
+)
+
+// defaultProposalTTL is how long a proposal may collect approvals
+const defaultProposalTTL = 72 * time.Hour
+
+// defaultMintWindow is the rolling period over which an admin's mints are
+// totalled against the large mint amount
+const defaultMintWindow = 24 * time.Hour
+
+// ContractUpgradePayload is the operation approved by an OpContractUpgrade proposal
+type ContractUpgradePayload struct {
+	Contract string `json:"contract"`
+	Version  string `json:"version"`
+}
+
+// MintPayload is the operation approved by an OpLargeMint proposal
+type MintPayload struct {
+	ParticipantID string  `json:"participant_id"`
+	TokenID       string  `json:"token_id"`
+	Amount        float64 `json:"amount"`
+}
+
+// TreasuryWithdrawalPayload is the operation approved by an OpTreasuryWithdrawal proposal
+type TreasuryWithdrawalPayload struct {
+	ToID    string  `json:"to_id"`
+	TokenID string  `json:"token_id"`
+	Amount  float64 `json:"amount"`
+}
+
+// MultiSigProposal is a pending or executed request to perform one concrete
+// operation. Signers approve it by signing its Digest.
+type MultiSigProposal struct {
+	ID         string            `json:"id"`
+	Operation  MultiSigOperation `json:"operation"`
+	Payload    json.RawMessage   `json:"payload"`
+	Digest     []byte            `json:"digest"`
+	ProposerID string            `json:"proposer_id"`
+	CreatedAt  time.Time         `json:"created_at"`
+	ExpiresAt  time.Time         `json:"expires_at"`
+	Approvals  map[string][]byte `json:"approvals"` // signerID -> signature
+	Executed   bool              `json:"executed"`
+	ExecutedAt time.Time         `json:"executed_at,omitempty"`
+}
+
+// MultiSigAuthorization authorizes sensitive operations once an M-of-N
+// threshold of configured signers has signed a proposal for them
+type MultiSigAuthorization struct {
+	blockchain      *Blockchain
+	threshold       int
+	signers         map[string]ed25519.PublicKey
+	ttl             time.Duration
+	largeMintAmount float64
+	mintWindow      time.Duration
+	mints           map[string][]mintRecord // admin ID -> mints within the window
+	proposals       map[string]*MultiSigProposal
+	mutex           sync.Mutex
+}
+
+// mintRecord is a mint made without a proposal
+type mintRecord struct {
+	at     time.Time
+	amount float64
+}
+
+// NewMultiSigAuthorization creates a MultiSigAuthorization requiring threshold
+// approvals from the given signer set. A zero ttl uses defaultProposalTTL.
+func NewMultiSigAuthorization(bc *Blockchain, threshold int, signers map[string]ed25519.PublicKey, ttl time.Duration) (*MultiSigAuthorization, error) {
+	if threshold <= 0 {
+		return nil, errors.New("threshold must be greater than zero")
+	}
+	if threshold > len(signers) {
+		return nil, fmt.Errorf("threshold %d exceeds %d signers", threshold, len(signers))
+	}
+	keys := make(map[string]ed25519.PublicKey, len(signers))
+	for signerID, key := range signers {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("invalid public key for signer %s", signerID)
+		}
+		keys[signerID] = key
+	}
+	if ttl <= 0 {
+		ttl = defaultProposalTTL
+	}
+	return &MultiSigAuthorization{
+		blockchain: bc,
+		threshold:  threshold,
+		signers:    keys,
+		ttl:        ttl,
+		mintWindow: defaultMintWindow,
+		mints:      make(map[string][]mintRecord),
+		proposals:  make(map[string]*MultiSigProposal),
+	}, nil
+}
+
+// SetLargeMintAmount sets the mint amount at or above which minting needs
+// an approved proposal. Zero disables the requirement.
+func (msa *MultiSigAuthorization) SetLargeMintAmount(amount float64) {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+	msa.largeMintAmount = amount
+}
+
+// SetMintWindow sets the rolling period over which an admin's mints are
+// totalled. A zero window uses defaultMintWindow.
+func (msa *MultiSigAuthorization) SetMintWindow(window time.Duration) {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+	if window <= 0 {
+		window = defaultMintWindow
+	}
+	msa.mintWindow = window
+}
+
+// Mint runs mint on behalf of adminID. Once the admin's mints within the
+// mint window, including this one, reach the large mint amount, the mint
+// instead needs an approved OpLargeMint proposal for payload, so a large
+// mint cannot be split into smaller ones. Approved mints are not counted.
+func (msa *MultiSigAuthorization) Mint(adminID, proposalID string, payload MintPayload, mint func() error) error {
+	needsApproval, err := msa.mintWithinLimit(adminID, payload.Amount, mint)
+	if !needsApproval {
+		return err
+	}
+	return msa.Execute(proposalID, OpLargeMint, payload, mint)
+}
+
+// mintWithinLimit runs and records mint if it keeps the admin's rolling
+// total below the large mint amount. It runs under the mutex so concurrent
+// mints are counted against each other.
+func (msa *MultiSigAuthorization) mintWithinLimit(adminID string, amount float64, mint func() error) (bool, error) {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+
+	now := time.Now()
+	recent := []mintRecord{}
+	total := amount
+	for _, record := range msa.mints[adminID] {
+		if now.Sub(record.at) < msa.mintWindow {
+			recent = append(recent, record)
+			total += record.amount
+		}
+	}
+	msa.mints[adminID] = recent
+	if msa.largeMintAmount > 0 && total >= msa.largeMintAmount {
+		return true, nil
+	}
+	if err := mint(); err != nil {
+		return false, err
+	}
+	msa.mints[adminID] = append(recent, mintRecord{at: now, amount: amount})
+	return false, nil
+}
+
+// IsSigner reports whether signerID belongs to the signer set
+func (msa *MultiSigAuthorization) IsSigner(signerID string) bool {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+	_, exists := msa.signers[signerID]
+	return exists
+}
+
+// DecodeMultiSigPayload parses a JSON payload into the typed payload for op,
+// rejecting unknown fields
+func DecodeMultiSigPayload(op MultiSigOperation, data []byte) (interface{}, error) {
+	decode := func(payload interface{}) error {
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(payload); err != nil {
+			return fmt.Errorf("invalid %s payload: %v", op, err)
+		}
+		return nil
+	}
+	switch op {
+	case OpContractUpgrade:
+		var payload ContractUpgradePayload
+		return payload, decode(&payload)
+	case OpLargeMint:
+		var payload MintPayload
+		return payload, decode(&payload)
+	case OpTreasuryWithdrawal:
+		var payload TreasuryWithdrawalPayload
+		return payload, decode(&payload)
+	}
+	return nil, errors.New("unknown multisig operation")
+}
+
+// proposalDigest is the message signers sign to approve a proposal
+func proposalDigest(id string, op MultiSigOperation, payload []byte, expiresAt time.Time) []byte {
+	h := sha256.New()
+	fmt.Fprintf(h, "multisig:%s\n%s\n%d\n", id, op, expiresAt.Unix())
+	h.Write(payload)
+	return h.Sum(nil)
+}
+
+// Propose opens a proposal for op with the given payload. Only signers may propose.
+func (msa *MultiSigAuthorization) Propose(proposerID string, op MultiSigOperation, payload interface{}) (MultiSigProposal, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return MultiSigProposal{}, err
+	}
+	if _, err := DecodeMultiSigPayload(op, data); err != nil {
+		return MultiSigProposal{}, err
+	}
+
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+
+	if _, exists := msa.signers[proposerID]; !exists {
+		return MultiSigProposal{}, errors.New("proposer is not a multisig signer")
+	}
+	now := time.Now()
+	proposal := &MultiSigProposal{
+		ID:         uuid.New().String(),
+		Operation:  op,
+		Payload:    data,
+		ProposerID: proposerID,
+		CreatedAt:  now,
+		ExpiresAt:  now.Add(msa.ttl),
+		Approvals:  make(map[string][]byte),
+	}
+	proposal.Digest = proposalDigest(proposal.ID, op, data, proposal.ExpiresAt)
+	msa.proposals[proposal.ID] = proposal
+	msa.record("proposed", proposal, proposerID)
+	return copyProposal(proposal), nil
+}
+
+// Approve adds a signer's signature over the proposal digest
+func (msa *MultiSigAuthorization) Approve(proposalID, signerID string, signature []byte) error {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+
+	proposal, exists := msa.proposals[proposalID]
+	if !exists {
+		return errors.New("proposal not found")
+	}
+	key, exists := msa.signers[signerID]
+	if !exists {
+		return errors.New("not a multisig signer")
+	}
+	if proposal.Executed {
+		return errors.New("proposal already executed")
+	}
+	if time.Now().After(proposal.ExpiresAt) {
+		return errors.New("proposal expired")
+	}
+	if _, signed := proposal.Approvals[signerID]; signed {
+		return errors.New("signer already approved proposal")
+	}
+	if !ed25519.Verify(key, proposal.Digest, signature) {
+		return errors.New("invalid signature")
+	}
+	proposal.Approvals[signerID] = signature
+	msa.record("approved", proposal, signerID)
+	return nil
+}
+
+// GetProposal retrieves a proposal by ID
+func (msa *MultiSigAuthorization) GetProposal(proposalID string) (MultiSigProposal, error) {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+	proposal, exists := msa.proposals[proposalID]
+	if !exists {
+		return MultiSigProposal{}, errors.New("proposal not found")
+	}
+	return copyProposal(proposal), nil
+}
+
+// IsApproved reports whether a live proposal has reached the threshold
+func (msa *MultiSigAuthorization) IsApproved(proposalID string) bool {
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+	proposal, exists := msa.proposals[proposalID]
+	return exists && msa.approved(proposal) == nil
+}
+
+// approved must be called with the mutex held
+func (msa *MultiSigAuthorization) approved(proposal *MultiSigProposal) error {
+	if proposal.Executed {
+		return errors.New("proposal already executed")
+	}
+	if time.Now().After(proposal.ExpiresAt) {
+		return errors.New("proposal expired")
+	}
+	// Re-verify in case the signer set changed since approval
+	valid := 0
+	for signerID, signature := range proposal.Approvals {
+		if key, exists := msa.signers[signerID]; exists && ed25519.Verify(key, proposal.Digest, signature) {
+			valid++
+		}
+	}
+	if valid < msa.threshold {
+		return fmt.Errorf("proposal has %d of %d required approvals", valid, msa.threshold)
+	}
+	return nil
+}
+
+// Execute runs action once for an approved proposal whose operation and
+// payload match exactly. The proposal is consumed only if action succeeds.
+func (msa *MultiSigAuthorization) Execute(proposalID string, op MultiSigOperation, payload interface{}, action func() error) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	msa.mutex.Lock()
+	defer msa.mutex.Unlock()
+
+	proposal, exists := msa.proposals[proposalID]
+	if !exists {
+		return errors.New("proposal not found")
+	}
+	if proposal.Operation != op || !bytes.Equal(proposal.Payload, data) {
+		return errors.New("proposal does not authorize this operation")
+	}
+	if err := msa.approved(proposal); err != nil {
+		return err
+	}
+	if err := action(); err != nil {
+		return err
+	}
+	proposal.Executed = true
+	proposal.ExecutedAt = time.Now()
+	msa.record("executed", proposal, "")
+	log.Printf("Multisig proposal %s executed: %s", proposal.ID, proposal.Operation)
+	return nil
+}
+
+// AuthorizeUpgrade consumes an approved contract-upgrade proposal for exactly this upgrade
+func (msa *MultiSigAuthorization) AuthorizeUpgrade(proposalID string, upgrade ContractUpgradePayload) error {
+	return msa.Execute(proposalID, OpContractUpgrade, upgrade, func() error { return nil })
+}
+
+// record anchors a proposal event on the blockchain. Must be called with the
+// mutex held.
+func (msa *MultiSigAuthorization) record(event string, proposal *MultiSigProposal, actorID string) {
+	if msa.blockchain == nil {
+		return
+	}
+	data, err := json.Marshal(struct {
+		Type       string            `json:"type"`
+		Event      string            `json:"event"`
+		ProposalID string            `json:"proposal_id"`
+		Operation  MultiSigOperation `json:"operation"`
+		Payload    json.RawMessage   `json:"payload"`
+		ActorID    string            `json:"actor_id,omitempty"`
+		Approvals  int               `json:"approvals"`
+	}{"multisig", event, proposal.ID, proposal.Operation, proposal.Payload, actorID, len(proposal.Approvals)})
+	if err != nil {
+		log.Printf("Error marshaling multisig event: %v", err)
+		return
+	}
+	if err := msa.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding multisig event to blockchain: %v", err)
+	}
+}
+
+// copyProposal returns a snapshot of a proposal safe to hand to callers
+func copyProposal(proposal *MultiSigProposal) MultiSigProposal {
+	snapshot := *proposal
+	snapshot.Approvals = make(map[string][]byte, len(proposal.Approvals))
+	for signerID, signature := range proposal.Approvals {
+		snapshot.Approvals[signerID] = signature
+	}
+	return snapshot
+}
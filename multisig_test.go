@@ -0,0 +1,129 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"testing"
+	"time"
+)
+
+func newTestMultiSig(t *testing.T, threshold int, ttl time.Duration) (*MultiSigAuthorization, map[string]ed25519.PrivateKey) {
+	keys := make(map[string]ed25519.PrivateKey)
+	signers := make(map[string]ed25519.PublicKey)
+	for _, id := range []string{"alice", "bob", "carol"} {
+		pub, priv, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			t.Fatalf("GenerateKey failed: %v", err)
+		}
+		keys[id] = priv
+		signers[id] = pub
+	}
+	msa, err := NewMultiSigAuthorization(NewBlockchain(), threshold, signers, ttl)
+	if err != nil {
+		t.Fatalf("NewMultiSigAuthorization failed: %v", err)
+	}
+	return msa, keys
+}
+
+func TestMultiSigAuthorization_ThresholdAndExecution(t *testing.T) {
+	msa, keys := newTestMultiSig(t, 2, 0)
+	payload := MintPayload{ParticipantID: "p1", TokenID: "TOKEN1", Amount: 1e6}
+
+	if _, err := msa.Propose("mallory", OpLargeMint, payload); err == nil {
+		t.Errorf("Expected error proposing as non-signer")
+	}
+	proposal, err := msa.Propose("alice", OpLargeMint, payload)
+	if err != nil {
+		t.Fatalf("Propose failed: %v", err)
+	}
+
+	if err := msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["bob"], proposal.Digest)); err == nil {
+		t.Errorf("Expected error for signature by another key")
+	}
+	if err := msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["alice"], proposal.Digest)); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if err := msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["alice"], proposal.Digest)); err == nil {
+		t.Errorf("Expected error for duplicate approval")
+	}
+
+	executed := 0
+	action := func() error { executed++; return nil }
+	if err := msa.Execute(proposal.ID, OpLargeMint, payload, action); err == nil {
+		t.Errorf("Expected error executing below threshold")
+	}
+	if err := msa.Approve(proposal.ID, "bob", ed25519.Sign(keys["bob"], proposal.Digest)); err != nil {
+		t.Fatalf("Approve failed: %v", err)
+	}
+	if !msa.IsApproved(proposal.ID) {
+		t.Fatalf("Expected proposal to be approved")
+	}
+
+	// Approvals only cover the exact operation proposed
+	altered := payload
+	altered.Amount = 2e6
+	if err := msa.Execute(proposal.ID, OpLargeMint, altered, action); err == nil {
+		t.Errorf("Expected error executing a different payload")
+	}
+	if err := msa.Execute(proposal.ID, OpTreasuryWithdrawal, payload, action); err == nil {
+		t.Errorf("Expected error executing a different operation")
+	}
+	if err := msa.Execute(proposal.ID, OpLargeMint, payload, action); err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if err := msa.Execute(proposal.ID, OpLargeMint, payload, action); err == nil {
+		t.Errorf("Expected proposal to execute only once")
+	}
+	if executed != 1 {
+		t.Errorf("Expected action to run once, ran %d times", executed)
+	}
+}
+
+func TestMultiSigAuthorization_Expiry(t *testing.T) {
+	msa, keys := newTestMultiSig(t, 1, time.Millisecond)
+	proposal, err := msa.Propose("alice", OpContractUpgrade, ContractUpgradePayload{Contract: AuctionRulesContract, Version: "v2"})
+	if err != nil {
+		t.Fatalf("Propose failed: %v", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if err := msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["alice"], proposal.Digest)); err == nil {
+		t.Errorf("Expected error approving expired proposal")
+	}
+}
+
+func TestMultiSigAuthorization_MintRollingTotal(t *testing.T) {
+	msa, keys := newTestMultiSig(t, 2, 0)
+	msa.SetLargeMintAmount(1000)
+	minted := 0.0
+	mint := func(amount float64) func() error {
+		return func() error { minted += amount; return nil }
+	}
+
+	if err := msa.Mint("admin1", "", MintPayload{ParticipantID: "p1", Amount: 600}, mint(600)); err != nil {
+		t.Fatalf("Mint failed: %v", err)
+	}
+	// A second mint that takes the admin's total to the limit needs approval
+	payload := MintPayload{ParticipantID: "p1", Amount: 400}
+	if err := msa.Mint("admin1", "", payload, mint(400)); err == nil {
+		t.Errorf("Expected a mint splitting a large amount to need approval")
+	}
+	if err := msa.Mint("admin2", "", payload, mint(400)); err != nil {
+		t.Errorf("Expected another admin's total to be separate: %v", err)
+	}
+	proposal, _ := msa.Propose("alice", OpLargeMint, payload)
+	msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["alice"], proposal.Digest))
+	msa.Approve(proposal.ID, "bob", ed25519.Sign(keys["bob"], proposal.Digest))
+	if err := msa.Mint("admin1", proposal.ID, payload, mint(400)); err != nil {
+		t.Errorf("Expected an approved mint to run: %v", err)
+	}
+	if minted != 1400 {
+		t.Errorf("Expected 1400 minted, got %v", minted)
+	}
+
+	// Mints older than the window no longer count
+	msa.SetMintWindow(time.Millisecond)
+	time.Sleep(5 * time.Millisecond)
+	if err := msa.Mint("admin1", "", MintPayload{ParticipantID: "p1", Amount: 600}, mint(600)); err != nil {
+		t.Errorf("Expected the rolling total to reset after the window: %v", err)
+	}
+}
@@ -0,0 +1,462 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// VerificationStatus defines the KYC/KYB state of a participant
+type VerificationStatus string
+
+const (
+	VerificationUnverified VerificationStatus = "Unverified" // profile being completed
+	VerificationSubmitted  VerificationStatus = "Submitted"  // awaiting the verifier
+	VerificationInReview   VerificationStatus = "InReview"   // referred for manual review
+	VerificationVerified   VerificationStatus = "Verified"
+	VerificationRejected   VerificationStatus = "Rejected" // may be corrected and resubmitted
+	VerificationSuspended  VerificationStatus = "Suspended"
+)
+
+// verificationTransitions lists the allowed status changes
+var verificationTransitions = map[VerificationStatus][]VerificationStatus{
+	VerificationUnverified: {VerificationSubmitted},
+	VerificationSubmitted:  {VerificationVerified, VerificationRejected, VerificationInReview},
+	VerificationInReview:   {VerificationVerified, VerificationRejected},
+	VerificationRejected:   {VerificationSubmitted},
+	VerificationVerified:   {VerificationSuspended},
+	VerificationSuspended:  {VerificationVerified},
+}
+
+// LicenseType identifies an industry license or accreditation
+type LicenseType string
+
+const (
+	LicenseIATA          LicenseType = "IATA" // IATA cargo agent accreditation
+	LicenseFMC           LicenseType = "FMC"  // US Federal Maritime Commission OTI license
+	LicenseCustomsBroker LicenseType = "CustomsBroker"
+)
+
+// License is an industry license held by a participant
+type License struct {
+	Type      LicenseType
+	Number    string
+	Issuer    string
+	ExpiresAt time.Time
+}
+
+// DocumentKind identifies the purpose of an onboarding document
+type DocumentKind string
+
+const (
+	DocumentIncorporation DocumentKind = "CertificateOfIncorporation"
+	DocumentLicense       DocumentKind = "License"
+	DocumentProofOfAddr   DocumentKind = "ProofOfAddress"
+	DocumentIdentity      DocumentKind = "Identity"
+)
+
+// maxOnboardingDocumentSize limits uploaded document size to 10 MB
+const maxOnboardingDocumentSize = 10 << 20
+
+// OnboardingDocument describes an uploaded verification document
+type OnboardingDocument struct {
+	ID          string
+	Kind        DocumentKind
+	FileName    string
+	ContentType string
+	Size        int
+	SHA256      string
+	UploadedAt  time.Time
+}
+
+// ProfileDetails are the company details a participant submits
+type ProfileDetails struct {
+	LegalEntityName    string
+	RegistrationNumber string
+	Country            string // ISO 3166-1 alpha-2
+	Address            string
+	ContactEmail       string
+	Licenses           []License
+}
+
+// OnboardingProfile tracks a participant's onboarding and verification
+type OnboardingProfile struct {
+	ParticipantID   string
+	ParticipantType ParticipantType
+	ProfileDetails
+	Documents    []OnboardingDocument
+	Status       VerificationStatus
+	SubmittedAt  time.Time
+	ReviewedAt   time.Time
+	StatusReason string
+	VerifierRef  string
+}
+
+// VerificationDecision is the outcome reported by a verifier
+type VerificationDecision string
+
+const (
+	DecisionApproved     VerificationDecision = "Approved"
+	DecisionRejected     VerificationDecision = "Rejected"
+	DecisionManualReview VerificationDecision = "ManualReview"
+)
+
+// VerificationResult is a verifier's decision on a profile
+type VerificationResult struct {
+	Decision  VerificationDecision
+	Reason    string
+	Reference string // verifier's case reference
+}
+
+// ParticipantVerifier performs KYC/KYB checks on a submitted profile
+type ParticipantVerifier interface {
+	Verify(profile OnboardingProfile) (VerificationResult, error)
+}
+
+// requiredLicenses lists the licenses a participant type must hold, any one of which suffices
+var requiredLicenses = map[ParticipantType][]LicenseType{
+	FreightForwarder: {LicenseIATA, LicenseFMC},
+	CustomsBroker:    {LicenseCustomsBroker},
+}
+
+// StubVerifier is a local verifier that checks the profile is complete and
+// licenses are current, without consulting an external provider
+type StubVerifier struct{}
+
+// NewStubVerifier creates a new StubVerifier
+func NewStubVerifier() *StubVerifier {
+	return &StubVerifier{}
+}
+
+// Verify approves complete profiles and rejects those with missing details
+func (sv *StubVerifier) Verify(profile OnboardingProfile) (VerificationResult, error) {
+	reject := func(reason string) (VerificationResult, error) {
+		return VerificationResult{Decision: DecisionRejected, Reason: reason}, nil
+	}
+	if len(profile.Documents) == 0 {
+		return reject("no supporting documents uploaded")
+	}
+	now := time.Now()
+	valid := make(map[LicenseType]bool)
+	for _, l := range profile.Licenses {
+		if !l.ExpiresAt.IsZero() && l.ExpiresAt.Before(now) {
+			return reject(string(l.Type) + " license has expired")
+		}
+		valid[l.Type] = true
+	}
+	if required, ok := requiredLicenses[profile.ParticipantType]; ok {
+		held := false
+		for _, lt := range required {
+			held = held || valid[lt]
+		}
+		if !held {
+			return reject("missing required license for " + string(profile.ParticipantType))
+		}
+	}
+	return VerificationResult{
+		Decision:  DecisionApproved,
+		Reference: "stub-" + profile.ParticipantID,
+	}, nil
+}
+
+// OnboardingService manages participant profiles and verification
+type OnboardingService struct {
+	blockchain *Blockchain
+	verifier   ParticipantVerifier
+	compliance *ComplianceLog
+
+	profiles map[string]*OnboardingProfile // participantID -> profile
+	mutex    sync.RWMutex
+}
+
+// NewOnboardingService creates a new OnboardingService
+func NewOnboardingService(bc *Blockchain, verifier ParticipantVerifier) *OnboardingService {
+	return &OnboardingService{
+		blockchain: bc,
+		verifier:   verifier,
+		profiles:   make(map[string]*OnboardingProfile),
+	}
+}
+
+// StartOnboarding creates an unverified profile for a newly registered participant
+func (obs *OnboardingService) StartOnboarding(participant Participant) OnboardingProfile {
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	if profile, exists := obs.profiles[participant.ID]; exists {
+		return *profile
+	}
+	profile := &OnboardingProfile{
+		ParticipantID:   participant.ID,
+		ParticipantType: participant.Type,
+		Status:          VerificationUnverified,
+	}
+	obs.profiles[participant.ID] = profile
+	return *profile
+}
+
+// validateDetails checks the submitted company details are well formed
+func validateDetails(details ProfileDetails) error {
+	if strings.TrimSpace(details.LegalEntityName) == "" {
+		return errors.New("legal entity name is required")
+	}
+	if strings.TrimSpace(details.RegistrationNumber) == "" {
+		return errors.New("registration number is required")
+	}
+	if len(details.Country) != 2 || strings.ToUpper(details.Country) != details.Country {
+		return errors.New("country must be an ISO 3166-1 alpha-2 code")
+	}
+	if details.ContactEmail != "" && !strings.Contains(details.ContactEmail, "@") {
+		return errors.New("invalid contact email")
+	}
+	for _, l := range details.Licenses {
+		if l.Type == "" || strings.TrimSpace(l.Number) == "" {
+			return errors.New("license type and number are required")
+		}
+	}
+	return nil
+}
+
+// editableProfile returns a profile that may still be edited. Must be called
+// with the mutex held.
+func (obs *OnboardingService) editableProfile(participantID string) (*OnboardingProfile, error) {
+	profile, exists := obs.profiles[participantID]
+	if !exists {
+		return nil, errors.New("onboarding profile not found")
+	}
+	if profile.Status != VerificationUnverified && profile.Status != VerificationRejected {
+		return nil, errors.New("profile cannot be changed while " + string(profile.Status))
+	}
+	return profile, nil
+}
+
+// UpdateProfile sets the company details on an unsubmitted or rejected profile
+func (obs *OnboardingService) UpdateProfile(participantID string, details ProfileDetails) (OnboardingProfile, error) {
+	details.Country = strings.ToUpper(strings.TrimSpace(details.Country))
+	if err := validateDetails(details); err != nil {
+		return OnboardingProfile{}, err
+	}
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	profile, err := obs.editableProfile(participantID)
+	if err != nil {
+		return OnboardingProfile{}, err
+	}
+	profile.ProfileDetails = details
+	return *profile, nil
+}
+
+// UploadDocument attaches a verification document to a profile. Only the
+// document's metadata and content hash are kept.
+func (obs *OnboardingService) UploadDocument(participantID string, kind DocumentKind, fileName, contentType string, content []byte) (OnboardingDocument, error) {
+	if len(content) == 0 {
+		return OnboardingDocument{}, errors.New("document is empty")
+	}
+	if len(content) > maxOnboardingDocumentSize {
+		return OnboardingDocument{}, errors.New("document exceeds maximum size")
+	}
+	if kind == "" {
+		return OnboardingDocument{}, errors.New("document kind is required")
+	}
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	profile, err := obs.editableProfile(participantID)
+	if err != nil {
+		return OnboardingDocument{}, err
+	}
+	sum := sha256.Sum256(content)
+	doc := OnboardingDocument{
+		ID:          uuid.New().String(),
+		Kind:        kind,
+		FileName:    fileName,
+		ContentType: contentType,
+		Size:        len(content),
+		SHA256:      hex.EncodeToString(sum[:]),
+		UploadedAt:  time.Now(),
+	}
+	profile.Documents = append(profile.Documents, doc)
+	log.Printf("Onboarding document %s uploaded for %s", doc.ID, participantID)
+	return doc, nil
+}
+
+// checkTransition reports whether a profile may move to a status
+func checkTransition(profile *OnboardingProfile, status VerificationStatus) error {
+	for _, next := range verificationTransitions[profile.Status] {
+		if next == status {
+			return nil
+		}
+	}
+	return errors.New("cannot move verification from " + string(profile.Status) + " to " + string(status))
+}
+
+// transition moves a profile to a new status if allowed and records the
+// change on the blockchain. Must be called with the mutex held.
+func (obs *OnboardingService) transition(profile *OnboardingProfile, status VerificationStatus, reason string) error {
+	if err := checkTransition(profile, status); err != nil {
+		return err
+	}
+	profile.Status = status
+	profile.StatusReason = reason
+
+	data, err := json.Marshal(struct {
+		ParticipantID string
+		Status        VerificationStatus
+		Reason        string
+		Timestamp     time.Time
+	}{profile.ParticipantID, status, reason, time.Now()})
+	if err != nil {
+		return err
+	}
+	if obs.blockchain != nil {
+		if err := obs.blockchain.AddBlock(string(data)); err != nil {
+			log.Printf("Error recording verification status: %v", err)
+			return err
+		}
+	}
+	log.Printf("Participant %s verification status: %s", profile.ParticipantID, status)
+	return nil
+}
+
+// SubmitForVerification submits a completed profile to the verifier and
+// applies its decision
+func (obs *OnboardingService) SubmitForVerification(participantID string) (OnboardingProfile, error) {
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	profile, err := obs.editableProfile(participantID)
+	if err != nil {
+		return OnboardingProfile{}, err
+	}
+	if err := validateDetails(profile.ProfileDetails); err != nil {
+		return OnboardingProfile{}, err
+	}
+	if err := obs.transition(profile, VerificationSubmitted, ""); err != nil {
+		return OnboardingProfile{}, err
+	}
+	profile.SubmittedAt = time.Now()
+
+	result, err := obs.verifier.Verify(*profile)
+	if err != nil {
+		// Leave the profile submitted so it can be retried or reviewed manually
+		log.Printf("Verifier error for %s: %v", participantID, err)
+		return *profile, err
+	}
+	profile.VerifierRef = result.Reference
+	if err := obs.applyDecision(profile, result.Decision, result.Reason); err != nil {
+		return OnboardingProfile{}, err
+	}
+	return *profile, nil
+}
+
+// applyDecision moves a profile to the status for a verification decision.
+// Must be called with the mutex held.
+func (obs *OnboardingService) applyDecision(profile *OnboardingProfile, decision VerificationDecision, reason string) error {
+	// The compliance record is written before the profile changes so a
+	// participant is never verified without a KYC record
+	switch decision {
+	case DecisionApproved:
+		return obs.decide(profile, VerificationVerified, ComplianceKYCPassed, reason)
+	case DecisionRejected:
+		return obs.decide(profile, VerificationRejected, ComplianceKYCRejected, reason)
+	case DecisionManualReview:
+		return obs.transition(profile, VerificationInReview, reason)
+	}
+	return errors.New("unknown verification decision")
+}
+
+// decide records a final verification outcome in the compliance log, then
+// moves the profile to its status
+func (obs *OnboardingService) decide(profile *OnboardingProfile, status VerificationStatus, eventType ComplianceEventType, reason string) error {
+	if err := checkTransition(profile, status); err != nil {
+		return err
+	}
+	if err := obs.recordCompliance(profile, eventType, reason); err != nil {
+		return err
+	}
+	if err := obs.transition(profile, status, reason); err != nil {
+		return err
+	}
+	profile.ReviewedAt = time.Now()
+	return nil
+}
+
+// SetComplianceLog records verification outcomes in the compliance log
+func (obs *OnboardingService) SetComplianceLog(compliance *ComplianceLog) {
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+	obs.compliance = compliance
+}
+
+// recordCompliance logs a KYC/KYB outcome. Must be called with the mutex held.
+func (obs *OnboardingService) recordCompliance(profile *OnboardingProfile, eventType ComplianceEventType, reason string) error {
+	if obs.compliance == nil {
+		return nil
+	}
+	details := string(profile.ParticipantType) + " verification"
+	if reason != "" {
+		details += ": " + reason
+	}
+	_, err := obs.compliance.Record(eventType, profile.ParticipantID, "", details, "onboarding")
+	return err
+}
+
+// Review records a manual decision on a submitted or referred profile
+func (obs *OnboardingService) Review(participantID string, approve bool, reason string) (OnboardingProfile, error) {
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	profile, exists := obs.profiles[participantID]
+	if !exists {
+		return OnboardingProfile{}, errors.New("onboarding profile not found")
+	}
+	decision := DecisionRejected
+	if approve {
+		decision = DecisionApproved
+	}
+	if err := obs.applyDecision(profile, decision, reason); err != nil {
+		return OnboardingProfile{}, err
+	}
+	return *profile, nil
+}
+
+// Suspend revokes a verified participant's access
+func (obs *OnboardingService) Suspend(participantID, reason string) error {
+	obs.mutex.Lock()
+	defer obs.mutex.Unlock()
+
+	profile, exists := obs.profiles[participantID]
+	if !exists {
+		return errors.New("onboarding profile not found")
+	}
+	return obs.transition(profile, VerificationSuspended, reason)
+}
+
+// GetProfile returns a participant's onboarding profile
+func (obs *OnboardingService) GetProfile(participantID string) (OnboardingProfile, error) {
+	obs.mutex.RLock()
+	defer obs.mutex.RUnlock()
+
+	profile, exists := obs.profiles[participantID]
+	if !exists {
+		return OnboardingProfile{}, errors.New("onboarding profile not found")
+	}
+	return *profile, nil
+}
+
+// IsVerified checks whether a participant has passed verification
+func (obs *OnboardingService) IsVerified(participantID string) bool {
+	obs.mutex.RLock()
+	defer obs.mutex.RUnlock()
+
+	profile, exists := obs.profiles[participantID]
+	return exists && profile.Status == VerificationVerified
+}
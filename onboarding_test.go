@@ -0,0 +1,105 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func newOnboardingMarketplace() *Marketplace {
+	bc := NewBlockchain()
+	marketplace := NewMarketplace(bc)
+	marketplace.Onboarding = NewOnboardingService(bc, NewStubVerifier())
+	return marketplace
+}
+
+func completeOnboarding(t *testing.T, obs *OnboardingService, participantID string, licenses []License) OnboardingProfile {
+	_, err := obs.UpdateProfile(participantID, ProfileDetails{
+		LegalEntityName:    "Acme Logistics Ltd",
+		RegistrationNumber: "12345678",
+		Country:            "gb",
+		Licenses:           licenses,
+	})
+	if err != nil {
+		t.Fatalf("UpdateProfile failed: %v", err)
+	}
+	if _, err := obs.UploadDocument(participantID, DocumentIncorporation, "incorporation.pdf", "application/pdf", []byte("%PDF-1.4")); err != nil {
+		t.Fatalf("UploadDocument failed: %v", err)
+	}
+	profile, err := obs.SubmitForVerification(participantID)
+	if err != nil {
+		t.Fatalf("SubmitForVerification failed: %v", err)
+	}
+	return profile
+}
+
+func TestOnboardingService_VerificationWorkflow(t *testing.T) {
+	marketplace := newOnboardingMarketplace()
+	obs := marketplace.Onboarding
+	forwarder := marketplace.RegisterParticipant("Forwarder1", FreightForwarder)
+
+	if _, err := obs.UpdateProfile(forwarder.ID, ProfileDetails{LegalEntityName: "Acme", RegistrationNumber: "1", Country: "GBR"}); err == nil {
+		t.Errorf("Expected error for non ISO country code")
+	}
+	if _, err := obs.SubmitForVerification(forwarder.ID); err == nil {
+		t.Errorf("Expected error submitting an incomplete profile")
+	}
+
+	// Forwarders need an IATA or FMC license
+	profile := completeOnboarding(t, obs, forwarder.ID, nil)
+	if profile.Status != VerificationRejected || profile.Country != "GB" {
+		t.Fatalf("Expected rejection without license, got %s", profile.Status)
+	}
+
+	// A rejected profile can be corrected and resubmitted
+	profile = completeOnboarding(t, obs, forwarder.ID, []License{
+		{Type: LicenseFMC, Number: "023456NF", ExpiresAt: time.Now().AddDate(1, 0, 0)},
+	})
+	if profile.Status != VerificationVerified || !obs.IsVerified(forwarder.ID) {
+		t.Fatalf("Expected verified profile, got %s (%s)", profile.Status, profile.StatusReason)
+	}
+	if len(profile.Documents) != 2 || profile.Documents[0].SHA256 == "" {
+		t.Errorf("Expected both uploaded documents recorded with hashes, got %+v", profile.Documents)
+	}
+	if _, err := obs.UpdateProfile(forwarder.ID, ProfileDetails{LegalEntityName: "Other", RegistrationNumber: "2", Country: "US"}); err == nil {
+		t.Errorf("Expected verified profile to be locked")
+	}
+
+	if err := obs.Suspend(forwarder.ID, "license revoked"); err != nil {
+		t.Fatalf("Suspend failed: %v", err)
+	}
+	if obs.IsVerified(forwarder.ID) {
+		t.Errorf("Suspended participant should not be verified")
+	}
+}
+
+func TestMarketplace_UnverifiedParticipantsRestricted(t *testing.T) {
+	marketplace := newOnboardingMarketplace()
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+
+	validUntil := time.Now().Add(24 * time.Hour)
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", validUntil)
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, ""); err == nil {
+		t.Fatalf("Expected unverified carrier to be refused")
+	}
+
+	completeOnboarding(t, marketplace.Onboarding, carrier.ID, nil)
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed for verified carrier: %v", err)
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err == nil {
+		t.Fatalf("Expected unverified shipper to be refused")
+	}
+	if accepted, _ := marketplace.GetBid(quote.ID, bid.ID); accepted.IsAccepted {
+		t.Errorf("Refused booking should not accept the bid")
+	}
+
+	completeOnboarding(t, marketplace.Onboarding, shipper.ID, nil)
+	if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err != nil {
+		t.Errorf("ConfirmBooking failed for verified shipper: %v", err)
+	}
+}
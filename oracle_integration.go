@@ -1,63 +1,485 @@
 package main
 
 import (
+	"crypto/ed25519"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
 	"time"
 )
 
-// OracleIntegration provides methods to fetch real-world data from oracles
+// OracleFeed is a kind of real-world data the oracle layer aggregates
+type OracleFeed string
+
+const (
+	CustomsTariffFeed OracleFeed = "tariffs"   // keyed by country, values by HS heading
+	PortFeeFeed       OracleFeed = "port_fees" // keyed by port code
+	FuelPriceFeed     OracleFeed = "fuel"      // keyed by region
+	WeatherFeed       OracleFeed = "weather"   // keyed by location code
+	ExchangeRateFeed  OracleFeed = "fx"        // keyed by BASE/QUOTE currency pair
+)
+
+// ValueBounds is the range a feed value must fall in to be accepted
+type ValueBounds struct {
+	Min float64 `yaml:"min"`
+	Max float64 `yaml:"max"`
+}
+
+// FeedConfig sets how observations of a feed are accepted and aggregated
+type FeedConfig struct {
+	MinSources        int                    `yaml:"min_sources"`   // quorum of accepted sources
+	MaxDeviation      float64                `yaml:"max_deviation"` // fraction of the median a source may stray before it is rejected
+	Heartbeat         time.Duration          `yaml:"heartbeat"`     // an aggregate is reused until it is this old
+	StaleAfter        time.Duration          `yaml:"stale_after"`   // observations older than this are rejected
+	RequireSignatures bool                   `yaml:"require_signatures"`
+	Bounds            map[string]ValueBounds `yaml:"bounds"` // per value name
+}
+
+// defaultFeedConfigs are the feed settings used until configured otherwise
+var defaultFeedConfigs = map[OracleFeed]FeedConfig{
+	CustomsTariffFeed: {MinSources: 1, MaxDeviation: 0.05, Heartbeat: 24 * time.Hour, StaleAfter: 30 * 24 * time.Hour},
+	PortFeeFeed:       {MinSources: 1, MaxDeviation: 0.10, Heartbeat: 24 * time.Hour, StaleAfter: 30 * 24 * time.Hour},
+	FuelPriceFeed:     {MinSources: 1, MaxDeviation: 0.05, Heartbeat: time.Hour, StaleAfter: 72 * time.Hour},
+	WeatherFeed:       {MinSources: 1, MaxDeviation: 0.25, Heartbeat: 10 * time.Minute, StaleAfter: time.Hour},
+	ExchangeRateFeed:  {MinSources: 1, MaxDeviation: 0.02, Heartbeat: 5 * time.Minute, StaleAfter: 24 * time.Hour},
+}
+
+// validateFeedConfig checks a feed config is consistent
+func validateFeedConfig(config FeedConfig) error {
+	if config.MinSources < 1 {
+		return errors.New("a feed needs a quorum of at least one source")
+	}
+	if config.MaxDeviation < 0 || config.Heartbeat < 0 || config.StaleAfter < 0 {
+		return errors.New("deviation, heartbeat and staleness must not be negative")
+	}
+	if config.StaleAfter > 0 && config.Heartbeat > config.StaleAfter {
+		return errors.New("heartbeat must not exceed the staleness threshold")
+	}
+	for name, bounds := range config.Bounds {
+		if bounds.Min >= bounds.Max {
+			return errors.New("invalid bounds for " + name)
+		}
+	}
+	return nil
+}
+
+// OracleReading is the aggregate of a feed for a key across sources
+type OracleReading struct {
+	Feed         OracleFeed         `json:"feed"`
+	Key          string             `json:"key"`
+	Values       map[string]float64 `json:"values"`   // median of the accepted sources
+	Sources      []string           `json:"sources"`  // sources the values were aggregated from
+	Rejected     map[string]string  `json:"rejected"` // source -> reason it was left out
+	ObservedAt   time.Time          `json:"observed_at"`
+	AggregatedAt time.Time          `json:"aggregated_at"`
+}
+
+// CustomsTariff is the ad valorem duty a country levies by HS heading
+type CustomsTariff struct {
+	CountryCode string             `json:"country_code"`
+	Duties      map[string]float64 `json:"duties"` // HS heading -> duty percent, "*" for the general rate
+	Reading     OracleReading      `json:"reading"`
+}
+
+// DutyRate returns the duty percent on an HS code from its longest matching
+// heading, falling back to the general rate
+func (t CustomsTariff) DutyRate(hsCode string) (float64, bool) {
+	best := ""
+	for heading := range t.Duties {
+		if heading != "*" && strings.HasPrefix(hsCode, heading) && len(heading) > len(best) {
+			best = heading
+		}
+	}
+	if best == "" {
+		best = "*"
+	}
+	rate, ok := t.Duties[best]
+	return rate, ok
+}
+
+// PortFeeSchedule is the per-shipment fees a port levies, in DefaultCurrency
+type PortFeeSchedule struct {
+	PortCode         string        `json:"port_code"`
+	PortDues         float64       `json:"port_dues"`
+	TerminalHandling float64       `json:"terminal_handling"`
+	Security         float64       `json:"security"`
+	Total            float64       `json:"total"`
+	Reading          OracleReading `json:"reading"`
+}
+
+// portFeeKeys lists the fees a port fee schedule is read by
+var portFeeKeys = map[string]bool{"port_dues": true, "terminal_handling": true, "security": true, "total": true}
+
+// Fee returns a fee of the schedule by its feed value name
+func (s PortFeeSchedule) Fee(key string) float64 {
+	switch key {
+	case "port_dues":
+		return s.PortDues
+	case "terminal_handling":
+		return s.TerminalHandling
+	case "security":
+		return s.Security
+	case "total":
+		return s.Total
+	}
+	return 0
+}
+
+// FuelPriceIndex is a region's bunker or fuel price index
+type FuelPriceIndex struct {
+	Region  string        `json:"region"`
+	Index   float64       `json:"index"`
+	Reading OracleReading `json:"reading"`
+}
+
+// WeatherReport is the observed weather at a location
+type WeatherReport struct {
+	Location        string        `json:"location"`
+	TemperatureC    float64       `json:"temperature_c"`
+	WindKnots       float64       `json:"wind_knots"`
+	PrecipitationMM float64       `json:"precipitation_mm"`
+	Reading         OracleReading `json:"reading"`
+}
+
+// OracleIntegration aggregates real-world data from oracle providers
 type OracleIntegration struct {
-	// Add fields for API keys, endpoints, etc.
+	providers []OracleProvider
+	signers   map[string]ed25519.PublicKey // source -> key its observations are signed with
+	feeds     map[OracleFeed]FeedConfig
+	readings  map[string]OracleReading // feed/key -> last aggregate
+
+	// fxProvider supplies exchange rates for currency conversion
+	fxProvider FXRateProvider
+
+	mutex sync.RWMutex
 }
 
-// NewOracleIntegration creates a new OracleIntegration instance
-func NewOracleIntegration() *OracleIntegration {
-	return &OracleIntegration{}
+// NewOracleIntegration creates a new OracleIntegration aggregating the given
+// providers, or the stub feeds when none are given
+func NewOracleIntegration(providers ...OracleProvider) *OracleIntegration {
+	if len(providers) == 0 {
+		providers = []OracleProvider{NewStubOracleProvider()}
+	}
+	feeds := make(map[OracleFeed]FeedConfig, len(defaultFeedConfigs))
+	for feed, config := range defaultFeedConfigs {
+		feeds[feed] = config
+	}
+	return &OracleIntegration{
+		providers: providers,
+		signers:   make(map[string]ed25519.PublicKey),
+		feeds:     feeds,
+		readings:  make(map[string]OracleReading),
+	}
 }
 
-// FetchCustomsTariff fetches customs tariff updates from an external API
-func (oi *OracleIntegration) FetchCustomsTariff(countryCode string) (map[string]interface{}, error) {
-	// Placeholder: Implement API call to customs tariff data provider
-	fmt.Printf("Fetching customs tariff for country: %s\n", countryCode)
-	// Simulate data
-	data := map[string]interface{}{
-		"country": countryCode,
-		"tariffs": []string{"Tariff1", "Tariff2"},
-		"updated": time.Now(),
+// RegisterSigner sets the key a source's observations are verified against
+func (oi *OracleIntegration) RegisterSigner(source string, key ed25519.PublicKey) error {
+	if len(key) != ed25519.PublicKeySize {
+		return errors.New("invalid public key for oracle source " + source)
 	}
-	return data, nil
+	oi.mutex.Lock()
+	defer oi.mutex.Unlock()
+	oi.signers[source] = key
+	return nil
 }
 
-// FetchPortFeeSchedule fetches port or airport fee schedules
-func (oi *OracleIntegration) FetchPortFeeSchedule(portCode string) (map[string]interface{}, error) {
-	// Placeholder: Implement API call to port fee data provider
-	fmt.Printf("Fetching port fee schedule for port: %s\n", portCode)
-	data := map[string]interface{}{
-		"port":  portCode,
-		"fees":  []string{"Fee1", "Fee2"},
-		"valid": time.Now().AddDate(0, 1, 0),
+// SetFeedConfig replaces how a feed is accepted and aggregated
+func (oi *OracleIntegration) SetFeedConfig(feed OracleFeed, config FeedConfig) error {
+	if _, known := defaultFeedConfigs[feed]; !known {
+		return errors.New("unknown oracle feed " + string(feed))
+	}
+	if err := validateFeedConfig(config); err != nil {
+		return fmt.Errorf("feed %s: %v", feed, err)
+	}
+	oi.mutex.Lock()
+	defer oi.mutex.Unlock()
+	oi.feeds[feed] = config
+	for cacheKey := range oi.readings {
+		if strings.HasPrefix(cacheKey, string(feed)+"/") {
+			delete(oi.readings, cacheKey)
+		}
 	}
-	return data, nil
+	return nil
 }
 
-// FetchFuelPriceIndex fetches fuel price indices
-func (oi *OracleIntegration) FetchFuelPriceIndex(region string) (float64, error) {
-	// Placeholder: Implement API call to fuel price index provider
-	fmt.Printf("Fetching fuel price index for region: %s\n", region)
-	// Simulate price
-	price := 3.45
-	return price, nil
+// normalizeFeedKey upper-cases a feed key such as a port code or currency pair
+func normalizeFeedKey(key string) string {
+	return strings.ToUpper(strings.TrimSpace(key))
+}
+
+// Reading returns the aggregate of a feed for a key. An aggregate younger
+// than the feed's heartbeat is reused; otherwise every provider is asked again.
+func (oi *OracleIntegration) Reading(feed OracleFeed, key string) (OracleReading, error) {
+	key = normalizeFeedKey(key)
+	if key == "" {
+		return OracleReading{}, errors.New("oracle feed key is required")
+	}
+	cacheKey := string(feed) + "/" + key
+
+	oi.mutex.RLock()
+	config, known := oi.feeds[feed]
+	cached, hasCached := oi.readings[cacheKey]
+	providers := oi.providers
+	oi.mutex.RUnlock()
+	if !known {
+		return OracleReading{}, errors.New("unknown oracle feed " + string(feed))
+	}
+	now := time.Now()
+	// An aggregate is only reused while its oldest observation is still fresh
+	fresh := config.StaleAfter <= 0 || now.Sub(cached.ObservedAt) <= config.StaleAfter
+	if hasCached && now.Sub(cached.AggregatedAt) < config.Heartbeat && fresh {
+		return cached, nil
+	}
+
+	reading := OracleReading{Feed: feed, Key: key, Rejected: make(map[string]string), AggregatedAt: now}
+	accepted := []OracleObservation{}
+	// Each source counts once towards the quorum
+	seen := make(map[string]bool)
+	for _, provider := range providers {
+		observation, err := provider.Fetch(feed, key)
+		if err == errFeedNotServed {
+			continue
+		}
+		if err == nil {
+			err = oi.acceptObservation(config, provider.Name(), feed, key, observation, now)
+		}
+		if err == nil && seen[observation.Source] {
+			err = errors.New("duplicate source")
+		}
+		if err != nil {
+			reading.Rejected[provider.Name()] = err.Error()
+			continue
+		}
+		seen[observation.Source] = true
+		accepted = append(accepted, observation)
+	}
+
+	// Sources straying from the median are rejected before the final median
+	medians := medianValues(accepted)
+	kept := []OracleObservation{}
+	for _, observation := range accepted {
+		if name, deviates := deviatingValue(observation, medians, config.MaxDeviation); deviates {
+			reading.Rejected[observation.Source] = "outlier " + name
+			continue
+		}
+		kept = append(kept, observation)
+	}
+	for source, reason := range reading.Rejected {
+		log.Printf("Oracle %s/%s rejected source %s: %s", feed, key, source, reason)
+	}
+	if len(kept) < config.MinSources {
+		return OracleReading{}, fmt.Errorf("oracle feed %s/%s has %d of %d required sources", feed, key, len(kept), config.MinSources)
+	}
+
+	reading.Values = medianValues(kept)
+	for _, observation := range kept {
+		reading.Sources = append(reading.Sources, observation.Source)
+		if reading.ObservedAt.IsZero() || observation.ObservedAt.Before(reading.ObservedAt) {
+			reading.ObservedAt = observation.ObservedAt
+		}
+	}
+	sort.Strings(reading.Sources)
+
+	oi.mutex.Lock()
+	oi.readings[cacheKey] = reading
+	oi.mutex.Unlock()
+	return reading, nil
+}
+
+// acceptObservation checks an observation comes from the provider that
+// returned it for the feed and key asked, and is fresh, attested and in bounds
+func (oi *OracleIntegration) acceptObservation(config FeedConfig, providerName string, feed OracleFeed, key string, observation OracleObservation, now time.Time) error {
+	if observation.Source != providerName {
+		return errors.New("observation source " + observation.Source + " does not match provider " + providerName)
+	}
+	if observation.Feed != feed || normalizeFeedKey(observation.Key) != key {
+		return errors.New("observation is for a different feed or key")
+	}
+	if config.StaleAfter > 0 && now.Sub(observation.ObservedAt) > config.StaleAfter {
+		return errors.New("stale observation from " + observation.ObservedAt.Format(time.RFC3339))
+	}
+
+	oi.mutex.RLock()
+	signer, hasKey := oi.signers[observation.Source]
+	oi.mutex.RUnlock()
+	switch {
+	case hasKey && len(observation.Signature) > 0:
+		if !ed25519.Verify(signer, observation.Digest(), observation.Signature) {
+			return errors.New("invalid signature")
+		}
+	case config.RequireSignatures && !hasKey:
+		return errors.New("no signing key registered")
+	case config.RequireSignatures:
+		return errors.New("unsigned observation")
+	}
+
+	for name, value := range observation.Values {
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			return errors.New("invalid value " + name)
+		}
+		if bounds, ok := config.Bounds[name]; ok && (value < bounds.Min || value > bounds.Max) {
+			return errors.New("value " + name + " out of bounds")
+		}
+	}
+	return nil
+}
+
+// medianValues returns the median of each value across observations
+func medianValues(observations []OracleObservation) map[string]float64 {
+	samples := make(map[string][]float64)
+	for _, observation := range observations {
+		for name, value := range observation.Values {
+			samples[name] = append(samples[name], value)
+		}
+	}
+	medians := make(map[string]float64, len(samples))
+	for name, values := range samples {
+		medians[name] = medianOf(values)
+	}
+	return medians
+}
+
+// deviatingValue returns the first value of an observation straying from its
+// median by more than the allowed fraction
+func deviatingValue(observation OracleObservation, medians map[string]float64, maxDeviation float64) (string, bool) {
+	if maxDeviation <= 0 {
+		return "", false
+	}
+	names := make([]string, 0, len(observation.Values))
+	for name := range observation.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		median := medians[name]
+		if math.Abs(observation.Values[name]-median) > maxDeviation*math.Abs(median) {
+			return name, true
+		}
+	}
+	return "", false
+}
+
+// FetchCustomsTariff fetches the duties a country levies
+func (oi *OracleIntegration) FetchCustomsTariff(countryCode string) (CustomsTariff, error) {
+	reading, err := oi.Reading(CustomsTariffFeed, countryCode)
+	if err != nil {
+		return CustomsTariff{}, err
+	}
+	return CustomsTariff{CountryCode: reading.Key, Duties: reading.Values, Reading: reading}, nil
+}
+
+// FetchPortFeeSchedule fetches a port or airport fee schedule. The total is
+// the sum of the fees unless the sources publish one.
+func (oi *OracleIntegration) FetchPortFeeSchedule(portCode string) (PortFeeSchedule, error) {
+	reading, err := oi.Reading(PortFeeFeed, portCode)
+	if err != nil {
+		return PortFeeSchedule{}, err
+	}
+	schedule := PortFeeSchedule{
+		PortCode:         reading.Key,
+		PortDues:         reading.Values["port_dues"],
+		TerminalHandling: reading.Values["terminal_handling"],
+		Security:         reading.Values["security"],
+		Reading:          reading,
+	}
+	schedule.Total = schedule.PortDues + schedule.TerminalHandling + schedule.Security
+	if total, ok := reading.Values["total"]; ok {
+		schedule.Total = total
+	}
+	return schedule, nil
+}
+
+// FetchFuelPriceIndex fetches a region's fuel price index
+func (oi *OracleIntegration) FetchFuelPriceIndex(region string) (FuelPriceIndex, error) {
+	reading, err := oi.Reading(FuelPriceFeed, region)
+	if err != nil {
+		return FuelPriceIndex{}, err
+	}
+	index, ok := reading.Values["index"]
+	if !ok {
+		return FuelPriceIndex{}, errors.New("fuel feed for " + reading.Key + " has no index")
+	}
+	return FuelPriceIndex{Region: reading.Key, Index: index, Reading: reading}, nil
+}
+
+// FetchWeatherData fetches the observed weather at a location
+func (oi *OracleIntegration) FetchWeatherData(location string) (WeatherReport, error) {
+	reading, err := oi.Reading(WeatherFeed, location)
+	if err != nil {
+		return WeatherReport{}, err
+	}
+	return WeatherReport{
+		Location:        reading.Key,
+		TemperatureC:    reading.Values["temperature_c"],
+		WindKnots:       reading.Values["wind_knots"],
+		PrecipitationMM: reading.Values["precipitation_mm"],
+		Reading:         reading,
+	}, nil
+}
+
+// feedFXRateProvider serves exchange rates from the oracle's fx feed
+type feedFXRateProvider struct {
+	oracle *OracleIntegration
+}
+
+// FeedFXRates returns an FXRateProvider backed by the aggregated fx feed
+func (oi *OracleIntegration) FeedFXRates() FXRateProvider {
+	return feedFXRateProvider{oracle: oi}
+}
+
+// Rate implements FXRateProvider, inverting the reverse pair if only it is published
+func (p feedFXRateProvider) Rate(base, quote string) (float64, error) {
+	reading, err := p.oracle.Reading(ExchangeRateFeed, base+"/"+quote)
+	if err == nil && reading.Values["rate"] > 0 {
+		return reading.Values["rate"], nil
+	}
+	inverse, inverseErr := p.oracle.Reading(ExchangeRateFeed, quote+"/"+base)
+	if inverseErr == nil && inverse.Values["rate"] > 0 {
+		return 1 / inverse.Values["rate"], nil
+	}
+	if err == nil {
+		err = inverseErr
+	}
+	return 0, err
+}
+
+// SetFXRateProvider configures the source of foreign exchange rates
+func (oi *OracleIntegration) SetFXRateProvider(provider FXRateProvider) {
+	oi.mutex.Lock()
+	defer oi.mutex.Unlock()
+	oi.fxProvider = provider
+}
+
+// FetchExchangeRate returns how many units of the "to" currency one unit of "from" buys
+func (oi *OracleIntegration) FetchExchangeRate(from, to string) (float64, error) {
+	if strings.EqualFold(from, to) {
+		return 1, nil
+	}
+	oi.mutex.RLock()
+	provider := oi.fxProvider
+	oi.mutex.RUnlock()
+	if provider == nil {
+		return 0, errors.New("no FX rate provider configured")
+	}
+	rate, err := provider.Rate(from, to)
+	if err != nil {
+		return 0, err
+	}
+	if rate <= 0 {
+		return 0, errors.New("invalid exchange rate from " + from + " to " + to)
+	}
+	return rate, nil
 }
 
-// FetchWeatherData fetches weather data feeds for a location
-func (oi *OracleIntegration) FetchWeatherData(location string) (map[string]interface{}, error) {
-	// Placeholder: Implement API call to weather data provider
-	fmt.Printf("Fetching weather data for location: %s\n", location)
-	data := map[string]interface{}{
-		"location":  location,
-		"temp":      25.0,
-		"condition": "Sunny",
-		"timestamp": time.Now(),
+// ConvertAmount converts an amount between currencies at the current rate
+func (oi *OracleIntegration) ConvertAmount(amount float64, from, to string) (float64, error) {
+	rate, err := oi.FetchExchangeRate(from, to)
+	if err != nil {
+		return 0, err
 	}
-	return data, nil
+	return amount * rate, nil
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func newSignedProvider(t *testing.T, oracle *OracleIntegration, name string) *MemoryOracleProvider {
+	public, private, err := ed25519.GenerateKey(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := oracle.RegisterSigner(name, public); err != nil {
+		t.Fatalf("RegisterSigner failed: %v", err)
+	}
+	return NewMemoryOracleProvider(name, private)
+}
+
+func TestOracleIntegration_AggregatesSignedFreshSources(t *testing.T) {
+	placeholder := NewMemoryOracleProvider("placeholder", nil)
+	oracle := NewOracleIntegration(placeholder)
+	a := newSignedProvider(t, oracle, "platts")
+	b := newSignedProvider(t, oracle, "argus")
+	outlier := newSignedProvider(t, oracle, "outlier")
+	stale := newSignedProvider(t, oracle, "stale")
+	unsigned := NewMemoryOracleProvider("unsigned", nil)
+	forged := newSignedProvider(t, oracle, "forged")
+	oracle.providers = []OracleProvider{a, b, outlier, stale, unsigned, forged, placeholder}
+	if err := oracle.SetFeedConfig(FuelPriceFeed, FeedConfig{
+		MinSources:        2,
+		MaxDeviation:      0.05,
+		Heartbeat:         time.Hour,
+		StaleAfter:        24 * time.Hour,
+		RequireSignatures: true,
+		Bounds:            map[string]ValueBounds{"index": {Min: 0.5, Max: 20}},
+	}); err != nil {
+		t.Fatalf("SetFeedConfig failed: %v", err)
+	}
+
+	now := time.Now()
+	a.Publish(FuelPriceFeed, "sgsin", map[string]float64{"index": 3.40}, now)
+	b.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.50}, now)
+	outlier.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 5.00}, now)
+	stale.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.45}, now.Add(-48*time.Hour))
+	unsigned.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.45}, now)
+	signed := forged.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.45}, now)
+	signed.Values = map[string]float64{"index": 9.99}
+	forged.observations["fuel/SGSIN"] = signed
+
+	index, err := oracle.FetchFuelPriceIndex("SGSIN")
+	if err != nil {
+		t.Fatalf("FetchFuelPriceIndex failed: %v", err)
+	}
+	if index.Index != 3.45 || len(index.Reading.Sources) != 2 || index.Reading.Sources[0] != "argus" || index.Reading.Sources[1] != "platts" {
+		t.Errorf("Expected the median of the two agreeing sources, got %+v", index)
+	}
+	for _, source := range []string{"outlier", "stale", "unsigned", "forged"} {
+		if _, rejected := index.Reading.Rejected[source]; !rejected {
+			t.Errorf("Expected source %s to be rejected, got %+v", source, index.Reading.Rejected)
+		}
+	}
+	if _, listed := index.Reading.Rejected["placeholder"]; listed {
+		t.Errorf("Expected a provider not serving the feed to be skipped")
+	}
+
+	// Inside the heartbeat the aggregate is reused
+	a.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.60}, now)
+	if again, _ := oracle.FetchFuelPriceIndex("SGSIN"); again.Index != 3.45 {
+		t.Errorf("Expected the cached aggregate within the heartbeat, got %v", again.Index)
+	}
+
+	// Losing quorum fails the feed rather than serving a single source
+	if err := oracle.SetFeedConfig(FuelPriceFeed, FeedConfig{MinSources: 3, MaxDeviation: 0.05, StaleAfter: 24 * time.Hour, RequireSignatures: true}); err != nil {
+		t.Fatalf("SetFeedConfig failed: %v", err)
+	}
+	if _, err := oracle.FetchFuelPriceIndex("SGSIN"); err == nil {
+		t.Errorf("Expected the feed to fail below its quorum")
+	}
+	if err := oracle.SetFeedConfig(FuelPriceFeed, FeedConfig{MinSources: 1, Heartbeat: time.Hour, StaleAfter: time.Minute}); err == nil {
+		t.Errorf("Expected a heartbeat beyond the staleness threshold to be rejected")
+	}
+}
+
+func TestOracleIntegration_StaleAggregateRefetched(t *testing.T) {
+	provider := NewMemoryOracleProvider("platts", nil)
+	oracle := NewOracleIntegration(provider)
+	if err := oracle.SetFeedConfig(FuelPriceFeed, FeedConfig{MinSources: 1, MaxDeviation: 0.05, Heartbeat: time.Hour, StaleAfter: 24 * time.Hour}); err != nil {
+		t.Fatalf("SetFeedConfig failed: %v", err)
+	}
+	now := time.Now()
+	provider.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.40}, now.Add(-23*time.Hour))
+	if _, err := oracle.FetchFuelPriceIndex("SGSIN"); err != nil {
+		t.Fatalf("FetchFuelPriceIndex failed: %v", err)
+	}
+
+	// The cached aggregate's observation ages past the staleness threshold
+	// inside the heartbeat
+	cached := oracle.readings["fuel/SGSIN"]
+	cached.ObservedAt = now.Add(-25 * time.Hour)
+	oracle.readings["fuel/SGSIN"] = cached
+	provider.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.60}, now)
+	if index, err := oracle.FetchFuelPriceIndex("SGSIN"); err != nil || index.Index != 3.60 {
+		t.Errorf("Expected a stale aggregate to be refetched, got %+v (%v)", index, err)
+	}
+}
+
+func TestOracleIntegration_FileAndHTTPProviders(t *testing.T) {
+	observedAt := time.Now().Add(-time.Hour)
+	path := filepath.Join(t.TempDir(), "port_fees.json")
+	file, _ := json.Marshal(oracleFile{Observations: []OracleObservation{
+		{Feed: PortFeeFeed, Key: "NLRTM", Values: map[string]float64{"port_dues": 90}, ObservedAt: observedAt},
+		{Feed: PortFeeFeed, Key: "NLRTM", Values: map[string]float64{"port_dues": 100, "terminal_handling": 50}, ObservedAt: observedAt},
+	}})
+	if err := os.WriteFile(path, file, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	public, private, _ := ed25519.GenerateKey(nil)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/port_fees/NLRTM" {
+			http.NotFound(w, r)
+			return
+		}
+		json.NewEncoder(w).Encode(SignObservation(OracleObservation{
+			Source:     "port-authority",
+			Feed:       PortFeeFeed,
+			Key:        "NLRTM",
+			Values:     map[string]float64{"port_dues": 110, "terminal_handling": 50, "security": 12},
+			ObservedAt: observedAt,
+		}, private))
+	}))
+	defer server.Close()
+
+	oracle := NewOracleIntegration(NewFileOracleProvider("port-fee-file", path), NewHTTPOracleProvider("port-authority", server.URL, time.Second))
+	if err := oracle.RegisterSigner("port-authority", public); err != nil {
+		t.Fatalf("RegisterSigner failed: %v", err)
+	}
+	schedule, err := oracle.FetchPortFeeSchedule("nlrtm")
+	if err != nil {
+		t.Fatalf("FetchPortFeeSchedule failed: %v", err)
+	}
+	if schedule.PortDues != 105 || schedule.TerminalHandling != 50 || schedule.Security != 12 || schedule.Total != 167 {
+		t.Errorf("Unexpected aggregated schedule %+v", schedule)
+	}
+	if len(schedule.Reading.Sources) != 2 || !schedule.Reading.ObservedAt.Equal(observedAt) {
+		t.Errorf("Expected both sources in the reading, got %+v", schedule.Reading)
+	}
+	if _, err := oracle.FetchPortFeeSchedule("USNYC"); err == nil {
+		t.Errorf("Expected a port no source publishes to fail")
+	}
+
+	provider, err := NewOracleProvider(OracleProviderConfig{Name: "feed", Type: "ftp", URL: "ftp://example"})
+	if err == nil || provider != nil {
+		t.Errorf("Expected an unknown provider type to be rejected")
+	}
+}
+
+func TestOracleIntegration_FeedFXRatesInvertsPairs(t *testing.T) {
+	provider := NewMemoryOracleProvider("ecb", nil)
+	provider.Publish(ExchangeRateFeed, "EUR/USD", map[string]float64{"rate": 1.25}, time.Now())
+	oracle := NewOracleIntegration(provider)
+	oracle.SetFXRateProvider(oracle.FeedFXRates())
+
+	if rate, err := oracle.FetchExchangeRate("EUR", "USD"); err != nil || rate != 1.25 {
+		t.Errorf("Expected the published pair, got %v (%v)", rate, err)
+	}
+	if amount, err := oracle.ConvertAmount(100, "usd", "eur"); err != nil || amount != 80 {
+		t.Errorf("Expected the inverted pair, got %v (%v)", amount, err)
+	}
+	if _, err := oracle.FetchExchangeRate("USD", "GBP"); err == nil {
+		t.Errorf("Expected an unpublished pair to fail")
+	}
+}
+
+// replayProvider serves another provider's observations under its own name
+type replayProvider struct {
+	name   string
+	source OracleProvider
+}
+
+func (p replayProvider) Name() string { return p.name }
+
+func (p replayProvider) Fetch(feed OracleFeed, key string) (OracleObservation, error) {
+	return p.source.Fetch(feed, key)
+}
+
+func TestOracleIntegration_SourcesCountOnce(t *testing.T) {
+	oracle := NewOracleIntegration()
+	platts := newSignedProvider(t, oracle, "platts")
+	oracle.providers = []OracleProvider{platts, replayProvider{name: "argus", source: platts}, platts}
+	if err := oracle.SetFeedConfig(FuelPriceFeed, FeedConfig{MinSources: 2, MaxDeviation: 0.05, StaleAfter: 24 * time.Hour, RequireSignatures: true}); err != nil {
+		t.Fatalf("SetFeedConfig failed: %v", err)
+	}
+	platts.Publish(FuelPriceFeed, "SGSIN", map[string]float64{"index": 3.40}, time.Now())
+
+	if _, err := oracle.FetchFuelPriceIndex("SGSIN"); err == nil {
+		t.Errorf("Expected one source's observation replayed by other providers to miss a quorum of two")
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// errFeedNotServed is returned by providers that do not publish a feed or key
+var errFeedNotServed = errors.New("feed not served by provider")
+
+// OracleObservation is one source's reading of a feed for a key, such as the
+// fuel index of a region or the fee schedule of a port
+type OracleObservation struct {
+	Source     string             `json:"source"`
+	Feed       OracleFeed         `json:"feed"`
+	Key        string             `json:"key"`
+	Values     map[string]float64 `json:"values"`
+	ObservedAt time.Time          `json:"observed_at"`
+	Signature  []byte             `json:"signature,omitempty"` // ed25519 over Digest by the source's key
+}
+
+// Digest is the message a source signs to attest to an observation
+func (o OracleObservation) Digest() []byte {
+	names := make([]string, 0, len(o.Values))
+	for name := range o.Values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	h := sha256.New()
+	fmt.Fprintf(h, "oracle:%s\n%s\n%s\n%d", o.Source, o.Feed, o.Key, o.ObservedAt.UnixNano())
+	for _, name := range names {
+		fmt.Fprintf(h, "\n%s=%g", name, o.Values[name])
+	}
+	return h.Sum(nil)
+}
+
+// SignObservation attests to an observation with the source's private key
+func SignObservation(observation OracleObservation, key ed25519.PrivateKey) OracleObservation {
+	observation.Signature = ed25519.Sign(key, observation.Digest())
+	return observation
+}
+
+// OracleProvider is a source of oracle observations
+type OracleProvider interface {
+	// Name identifies the source; observations must carry it as their source
+	Name() string
+	// Fetch returns the source's latest observation of a feed for a key
+	Fetch(feed OracleFeed, key string) (OracleObservation, error)
+}
+
+// checkObservation fills in the source of an observation and checks it
+// answers the feed and key asked for
+func checkObservation(name string, feed OracleFeed, key string, observation OracleObservation) (OracleObservation, error) {
+	if observation.Source == "" {
+		observation.Source = name
+	}
+	if observation.Source != name {
+		return OracleObservation{}, errors.New("observation source " + observation.Source + " does not match provider " + name)
+	}
+	if observation.Feed != feed || !strings.EqualFold(observation.Key, key) {
+		return OracleObservation{}, errors.New("provider " + name + " answered a different feed or key")
+	}
+	if len(observation.Values) == 0 || observation.ObservedAt.IsZero() {
+		return OracleObservation{}, errors.New("provider " + name + " returned an empty observation")
+	}
+	return observation, nil
+}
+
+// MemoryOracleProvider serves observations published to it in process. It is
+// used for tests and for the stub feeds.
+type MemoryOracleProvider struct {
+	name         string
+	signer       ed25519.PrivateKey
+	observations map[string]OracleObservation // feed/key -> latest observation
+	defaults     map[OracleFeed]map[string]float64
+	mutex        sync.RWMutex
+}
+
+// NewMemoryOracleProvider creates a new MemoryOracleProvider. Observations are
+// signed when a signing key is given.
+func NewMemoryOracleProvider(name string, signer ed25519.PrivateKey) *MemoryOracleProvider {
+	return &MemoryOracleProvider{
+		name:         name,
+		signer:       signer,
+		observations: make(map[string]OracleObservation),
+		defaults:     make(map[OracleFeed]map[string]float64),
+	}
+}
+
+// NewStubOracleProvider creates a provider answering every key with fixed
+// indicative values, used when no oracle providers are configured
+func NewStubOracleProvider() *MemoryOracleProvider {
+	p := NewMemoryOracleProvider("stub", nil)
+	p.SetDefault(FuelPriceFeed, map[string]float64{"index": 3.45})
+	p.SetDefault(PortFeeFeed, map[string]float64{"port_dues": 125})
+	p.SetDefault(CustomsTariffFeed, map[string]float64{"*": 0})
+	p.SetDefault(WeatherFeed, map[string]float64{"temperature_c": 25, "wind_knots": 8, "precipitation_mm": 0})
+	return p
+}
+
+// Name implements OracleProvider
+func (p *MemoryOracleProvider) Name() string {
+	return p.name
+}
+
+// Publish records the provider's observation of a feed for a key
+func (p *MemoryOracleProvider) Publish(feed OracleFeed, key string, values map[string]float64, observedAt time.Time) OracleObservation {
+	observation := OracleObservation{
+		Source:     p.name,
+		Feed:       feed,
+		Key:        normalizeFeedKey(key),
+		Values:     values,
+		ObservedAt: observedAt,
+	}
+	if p.signer != nil {
+		observation = SignObservation(observation, p.signer)
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.observations[string(feed)+"/"+observation.Key] = observation
+	return observation
+}
+
+// SetDefault answers keys of a feed without a published observation with
+// fixed values observed at the time of the fetch
+func (p *MemoryOracleProvider) SetDefault(feed OracleFeed, values map[string]float64) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	p.defaults[feed] = values
+}
+
+// Fetch implements OracleProvider
+func (p *MemoryOracleProvider) Fetch(feed OracleFeed, key string) (OracleObservation, error) {
+	key = normalizeFeedKey(key)
+	p.mutex.RLock()
+	observation, exists := p.observations[string(feed)+"/"+key]
+	values, hasDefault := p.defaults[feed]
+	p.mutex.RUnlock()
+
+	if exists {
+		return observation, nil
+	}
+	if !hasDefault {
+		return OracleObservation{}, errFeedNotServed
+	}
+	observation = OracleObservation{Source: p.name, Feed: feed, Key: key, Values: values, ObservedAt: time.Now()}
+	if p.signer != nil {
+		observation = SignObservation(observation, p.signer)
+	}
+	return observation, nil
+}
+
+// FileOracleProvider serves observations from a JSON file, re-read on every
+// fetch so an external publisher can update it in place
+type FileOracleProvider struct {
+	name string
+	path string
+}
+
+// oracleFile is the {"observations": [...]} layout of an oracle file
+type oracleFile struct {
+	Observations []OracleObservation `json:"observations"`
+}
+
+// NewFileOracleProvider creates a new FileOracleProvider reading path
+func NewFileOracleProvider(name, path string) *FileOracleProvider {
+	return &FileOracleProvider{name: name, path: path}
+}
+
+// Name implements OracleProvider
+func (p *FileOracleProvider) Name() string {
+	return p.name
+}
+
+// Fetch implements OracleProvider
+func (p *FileOracleProvider) Fetch(feed OracleFeed, key string) (OracleObservation, error) {
+	data, err := os.ReadFile(p.path)
+	if err != nil {
+		return OracleObservation{}, err
+	}
+	var file oracleFile
+	if err := json.Unmarshal(data, &file); err != nil {
+		return OracleObservation{}, fmt.Errorf("invalid oracle file %s: %v", p.path, err)
+	}
+	// The last observation in the file for a key is the latest
+	for i := len(file.Observations) - 1; i >= 0; i-- {
+		observation := file.Observations[i]
+		if observation.Feed == feed && strings.EqualFold(observation.Key, key) {
+			return checkObservation(p.name, feed, key, observation)
+		}
+	}
+	return OracleObservation{}, errFeedNotServed
+}
+
+// HTTPOracleProvider fetches observations as JSON from {baseURL}/{feed}/{key}
+type HTTPOracleProvider struct {
+	name    string
+	baseURL string
+	client  *http.Client
+}
+
+// NewHTTPOracleProvider creates a new HTTPOracleProvider
+func NewHTTPOracleProvider(name, baseURL string, timeout time.Duration) *HTTPOracleProvider {
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+	return &HTTPOracleProvider{
+		name:    name,
+		baseURL: strings.TrimRight(baseURL, "/"),
+		client:  &http.Client{Timeout: timeout},
+	}
+}
+
+// Name implements OracleProvider
+func (p *HTTPOracleProvider) Name() string {
+	return p.name
+}
+
+// Fetch implements OracleProvider
+func (p *HTTPOracleProvider) Fetch(feed OracleFeed, key string) (OracleObservation, error) {
+	resp, err := p.client.Get(p.baseURL + "/" + url.PathEscape(string(feed)) + "/" + url.PathEscape(key))
+	if err != nil {
+		return OracleObservation{}, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return OracleObservation{}, errFeedNotServed
+	}
+	if resp.StatusCode != http.StatusOK {
+		return OracleObservation{}, fmt.Errorf("oracle %s returned %s", p.name, resp.Status)
+	}
+	var observation OracleObservation
+	if err := json.NewDecoder(resp.Body).Decode(&observation); err != nil {
+		return OracleObservation{}, fmt.Errorf("invalid observation from oracle %s: %v", p.name, err)
+	}
+	return checkObservation(p.name, feed, key, observation)
+}
+
+// OracleProviderConfig configures an oracle source in the service config
+type OracleProviderConfig struct {
+	Name      string        `yaml:"name"`
+	Type      string        `yaml:"type"` // http or file
+	URL       string        `yaml:"url"`
+	Path      string        `yaml:"path"`
+	Timeout   time.Duration `yaml:"timeout"`
+	PublicKey string        `yaml:"public_key"` // hex ed25519 key the source signs with
+}
+
+// NewOracleProvider creates the provider an OracleProviderConfig describes
+func NewOracleProvider(config OracleProviderConfig) (OracleProvider, error) {
+	if config.Name == "" {
+		return nil, errors.New("oracle provider name is required")
+	}
+	switch config.Type {
+	case "http":
+		if config.URL == "" {
+			return nil, errors.New("oracle provider " + config.Name + " needs a url")
+		}
+		return NewHTTPOracleProvider(config.Name, config.URL, config.Timeout), nil
+	case "file":
+		if config.Path == "" {
+			return nil, errors.New("oracle provider " + config.Name + " needs a path")
+		}
+		return NewFileOracleProvider(config.Name, config.Path), nil
+	default:
+		return nil, errors.New("unknown oracle provider type " + config.Type)
+	}
+}
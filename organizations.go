@@ -0,0 +1,437 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// OrgRole defines a member's role within an organization
+type OrgRole string
+
+const (
+	OrgAdmin   OrgRole = "admin"   // manages members and the account
+	OrgBidder  OrgRole = "bidder"  // places bids and confirms bookings
+	OrgFinance OrgRole = "finance" // pays invoices, subscriptions and escrow
+	OrgViewer  OrgRole = "viewer"  // read-only access
+)
+
+// Permission is an action an organization member may be allowed to take
+type Permission string
+
+const (
+	PermView          Permission = "view"
+	PermBid           Permission = "bid"
+	PermBook          Permission = "book"
+	PermPay           Permission = "pay"
+	PermManageAccount Permission = "manage_account" // onboarding, memberships and governance
+	PermManageMembers Permission = "manage_members"
+)
+
+// rolePermissions maps organization roles to the permissions they grant
+var rolePermissions = map[OrgRole][]Permission{
+	OrgAdmin:   {PermView, PermBid, PermBook, PermPay, PermManageAccount, PermManageMembers},
+	OrgBidder:  {PermView, PermBid, PermBook},
+	OrgFinance: {PermView, PermPay},
+	OrgViewer:  {PermView},
+}
+
+// invitationTTL is how long an invitation can be accepted
+const invitationTTL = 7 * 24 * time.Hour
+
+// Organization owns a marketplace Participant identity on behalf of its members
+type Organization struct {
+	ID            string
+	Name          string
+	ParticipantID string
+	CreatedAt     time.Time
+}
+
+// OrgMember is a user's membership of an organization
+type OrgMember struct {
+	UserID    string
+	OrgID     string
+	Roles     []OrgRole
+	InvitedBy string
+	JoinedAt  time.Time
+}
+
+// Invitation invites an email address to join an organization
+type Invitation struct {
+	Token      string
+	OrgID      string
+	Email      string
+	Roles      []OrgRole
+	InvitedBy  string
+	ExpiresAt  time.Time
+	AcceptedBy string
+}
+
+// AuditEntry attributes an action taken for an organization to a member
+type AuditEntry struct {
+	Timestamp time.Time
+	OrgID     string
+	UserID    string
+	Action    string
+	Details   string
+}
+
+// OrganizationService manages organizations, their members and invitations
+type OrganizationService struct {
+	blockchain *Blockchain
+
+	organizations map[string]Organization
+	byParticipant map[string]string                // participantID -> orgID
+	members       map[string]map[string]*OrgMember // orgID -> userID -> member
+	userOrg       map[string]string                // userID -> orgID
+	invitations   map[string]*Invitation           // token -> invitation
+	auditLog      map[string][]AuditEntry          // orgID -> entries
+	mutex         sync.RWMutex
+}
+
+// NewOrganizationService creates a new OrganizationService
+func NewOrganizationService(bc *Blockchain) *OrganizationService {
+	return &OrganizationService{
+		blockchain:    bc,
+		organizations: make(map[string]Organization),
+		byParticipant: make(map[string]string),
+		members:       make(map[string]map[string]*OrgMember),
+		userOrg:       make(map[string]string),
+		invitations:   make(map[string]*Invitation),
+		auditLog:      make(map[string][]AuditEntry),
+	}
+}
+
+// validateRoles checks roles are known and not empty
+func validateRoles(roles []OrgRole) error {
+	if len(roles) == 0 {
+		return errors.New("at least one role is required")
+	}
+	for _, role := range roles {
+		if _, ok := rolePermissions[role]; !ok {
+			return errors.New("unknown role: " + string(role))
+		}
+	}
+	return nil
+}
+
+// CreateOrganization creates an organization owning a participant, with the
+// creating user as its first admin
+func (orgs *OrganizationService) CreateOrganization(name, participantID, ownerUserID string) (Organization, error) {
+	if name == "" || participantID == "" || ownerUserID == "" {
+		return Organization{}, errors.New("name, participant and owner are required")
+	}
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if _, exists := orgs.byParticipant[participantID]; exists {
+		return Organization{}, errors.New("participant already owned by an organization")
+	}
+	if _, exists := orgs.userOrg[ownerUserID]; exists {
+		return Organization{}, errors.New("user already belongs to an organization")
+	}
+	org := Organization{
+		ID:            uuid.New().String(),
+		Name:          name,
+		ParticipantID: participantID,
+		CreatedAt:     time.Now(),
+	}
+	orgs.organizations[org.ID] = org
+	orgs.byParticipant[participantID] = org.ID
+	orgs.members[org.ID] = make(map[string]*OrgMember)
+	orgs.addMember(org.ID, ownerUserID, []OrgRole{OrgAdmin}, "")
+	orgs.record(org.ID, ownerUserID, "organization.created", name)
+	log.Printf("Organization created: %s (%s)", name, org.ID)
+	return org, nil
+}
+
+// addMember must be called with the mutex held
+func (orgs *OrganizationService) addMember(orgID, userID string, roles []OrgRole, invitedBy string) *OrgMember {
+	member := &OrgMember{
+		UserID:    userID,
+		OrgID:     orgID,
+		Roles:     append([]OrgRole(nil), roles...),
+		InvitedBy: invitedBy,
+		JoinedAt:  time.Now(),
+	}
+	orgs.members[orgID][userID] = member
+	orgs.userOrg[userID] = orgID
+	return member
+}
+
+// GetOrganization returns an organization
+func (orgs *OrganizationService) GetOrganization(orgID string) (Organization, error) {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+
+	org, exists := orgs.organizations[orgID]
+	if !exists {
+		return Organization{}, errors.New("organization not found")
+	}
+	return org, nil
+}
+
+// OrganizationForUser returns the organization a user belongs to
+func (orgs *OrganizationService) OrganizationForUser(userID string) (Organization, error) {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+
+	orgID, exists := orgs.userOrg[userID]
+	if !exists {
+		return Organization{}, errors.New("user does not belong to an organization")
+	}
+	return orgs.organizations[orgID], nil
+}
+
+// Invite creates an invitation for an email address to join an organization.
+// The inviter must be allowed to manage members.
+func (orgs *OrganizationService) Invite(orgID, inviterID, email string, roles []OrgRole) (Invitation, error) {
+	email = normalizeEmail(email)
+	if email == "" {
+		return Invitation{}, errors.New("email is required")
+	}
+	if err := validateRoles(roles); err != nil {
+		return Invitation{}, err
+	}
+
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return Invitation{}, err
+	}
+	invitation := &Invitation{
+		Token:     hex.EncodeToString(buf),
+		OrgID:     orgID,
+		Email:     email,
+		Roles:     append([]OrgRole(nil), roles...),
+		InvitedBy: inviterID,
+		ExpiresAt: time.Now().Add(invitationTTL),
+	}
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if err := orgs.hasPermission(orgID, inviterID, PermManageMembers); err != nil {
+		return Invitation{}, err
+	}
+	orgs.invitations[invitation.Token] = invitation
+	orgs.record(orgID, inviterID, "member.invited", email)
+	return *invitation, nil
+}
+
+// CheckInvitation checks an invitation can be accepted by an email address
+func (orgs *OrganizationService) CheckInvitation(token, email string) error {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+
+	_, err := orgs.pendingInvitation(token, email)
+	return err
+}
+
+// pendingInvitation returns an unaccepted, unexpired invitation issued to
+// email. Must be called with the mutex held.
+func (orgs *OrganizationService) pendingInvitation(token, email string) (*Invitation, error) {
+	invitation, exists := orgs.invitations[token]
+	if !exists || invitation.AcceptedBy != "" {
+		return nil, errors.New("invitation not found")
+	}
+	if time.Now().After(invitation.ExpiresAt) {
+		return nil, errors.New("invitation expired")
+	}
+	if normalizeEmail(email) != invitation.Email {
+		return nil, errors.New("invitation was issued to a different email")
+	}
+	return invitation, nil
+}
+
+// AcceptInvitation adds a user to the inviting organization. The user's
+// email must match the invitation.
+func (orgs *OrganizationService) AcceptInvitation(token, userID, email string) (OrgMember, error) {
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	invitation, err := orgs.pendingInvitation(token, email)
+	if err != nil {
+		return OrgMember{}, err
+	}
+	if _, exists := orgs.userOrg[userID]; exists {
+		return OrgMember{}, errors.New("user already belongs to an organization")
+	}
+	invitation.AcceptedBy = userID
+	member := orgs.addMember(invitation.OrgID, userID, invitation.Roles, invitation.InvitedBy)
+	orgs.record(invitation.OrgID, userID, "member.joined", email)
+	return *member, nil
+}
+
+// SetMemberRoles replaces a member's roles. An organization always keeps at
+// least one admin.
+func (orgs *OrganizationService) SetMemberRoles(orgID, actorID, userID string, roles []OrgRole) (OrgMember, error) {
+	if err := validateRoles(roles); err != nil {
+		return OrgMember{}, err
+	}
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if err := orgs.hasPermission(orgID, actorID, PermManageMembers); err != nil {
+		return OrgMember{}, err
+	}
+	member, exists := orgs.members[orgID][userID]
+	if !exists {
+		return OrgMember{}, errors.New("member not found")
+	}
+	if hasRole(member.Roles, OrgAdmin) && !hasRole(roles, OrgAdmin) && orgs.adminCount(orgID) == 1 {
+		return OrgMember{}, errors.New("organization must keep at least one admin")
+	}
+	member.Roles = append([]OrgRole(nil), roles...)
+	orgs.record(orgID, actorID, "member.roles_changed", userID)
+	return *member, nil
+}
+
+// RemoveMember removes a user from an organization. Callers must also unlink
+// the user's account from the organization's participant.
+func (orgs *OrganizationService) RemoveMember(orgID, actorID, userID string) error {
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if err := orgs.hasPermission(orgID, actorID, PermManageMembers); err != nil {
+		return err
+	}
+	member, exists := orgs.members[orgID][userID]
+	if !exists {
+		return errors.New("member not found")
+	}
+	if hasRole(member.Roles, OrgAdmin) && orgs.adminCount(orgID) == 1 {
+		return errors.New("organization must keep at least one admin")
+	}
+	delete(orgs.members[orgID], userID)
+	delete(orgs.userOrg, userID)
+	orgs.record(orgID, actorID, "member.removed", userID)
+	return nil
+}
+
+// adminCount must be called with the mutex held
+func (orgs *OrganizationService) adminCount(orgID string) int {
+	count := 0
+	for _, m := range orgs.members[orgID] {
+		if hasRole(m.Roles, OrgAdmin) {
+			count++
+		}
+	}
+	return count
+}
+
+// hasRole reports whether roles contains role
+func hasRole(roles []OrgRole, role OrgRole) bool {
+	for _, r := range roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// Members lists an organization's members
+func (orgs *OrganizationService) Members(orgID string) []OrgMember {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+
+	members := []OrgMember{}
+	for _, m := range orgs.members[orgID] {
+		members = append(members, *m)
+	}
+	return members
+}
+
+// checkPermission checks a user's roles in an organization grant a permission
+func (orgs *OrganizationService) checkPermission(orgID, userID string, perm Permission) error {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+	return orgs.hasPermission(orgID, userID, perm)
+}
+
+// hasPermission must be called with the mutex held
+func (orgs *OrganizationService) hasPermission(orgID, userID string, perm Permission) error {
+	member, exists := orgs.members[orgID][userID]
+	if !exists {
+		return errors.New("user is not a member of the organization")
+	}
+	for _, role := range member.Roles {
+		for _, p := range rolePermissions[role] {
+			if p == perm {
+				return nil
+			}
+		}
+	}
+	return errors.New("missing permission: " + string(perm))
+}
+
+// HasMemberRole reports whether a user holds role in the organization that
+// owns participantID
+func (orgs *OrganizationService) HasMemberRole(userID, participantID string, role OrgRole) bool {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+
+	orgID, exists := orgs.userOrg[userID]
+	if !exists || orgs.organizations[orgID].ParticipantID != participantID {
+		return false
+	}
+	return hasRole(orgs.members[orgID][userID].Roles, role)
+}
+
+// Authorize checks a user may take an action for the participant their
+// organization owns and returns that participant's ID
+func (orgs *OrganizationService) Authorize(userID string, perm Permission) (string, error) {
+	org, err := orgs.OrganizationForUser(userID)
+	if err != nil {
+		return "", err
+	}
+	if err := orgs.checkPermission(org.ID, userID, perm); err != nil {
+		return "", err
+	}
+	return org.ParticipantID, nil
+}
+
+// RecordAction attributes an action taken for an organization to a member
+func (orgs *OrganizationService) RecordAction(userID, action, details string) {
+	orgs.mutex.Lock()
+	defer orgs.mutex.Unlock()
+
+	if orgID, exists := orgs.userOrg[userID]; exists {
+		orgs.record(orgID, userID, action, details)
+	}
+}
+
+// record appends an audit entry and anchors it on the blockchain. Must be
+// called with the mutex held.
+func (orgs *OrganizationService) record(orgID, userID, action, details string) {
+	entry := AuditEntry{
+		Timestamp: time.Now(),
+		OrgID:     orgID,
+		UserID:    userID,
+		Action:    action,
+		Details:   details,
+	}
+	orgs.auditLog[orgID] = append(orgs.auditLog[orgID], entry)
+	if orgs.blockchain == nil {
+		return
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		log.Printf("Error marshaling audit entry: %v", err)
+		return
+	}
+	if err := orgs.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error adding audit entry to blockchain: %v", err)
+	}
+}
+
+// AuditLog returns an organization's audit entries, oldest first
+func (orgs *OrganizationService) AuditLog(orgID string) []AuditEntry {
+	orgs.mutex.RLock()
+	defer orgs.mutex.RUnlock()
+	return append([]AuditEntry(nil), orgs.auditLog[orgID]...)
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestOrganizationService_InvitationsAndRoles(t *testing.T) {
+	orgs := NewOrganizationService(NewBlockchain())
+	org, err := orgs.CreateOrganization("Acme Forwarding", "participant1", "owner")
+	if err != nil {
+		t.Fatalf("CreateOrganization failed: %v", err)
+	}
+	if _, err := orgs.CreateOrganization("Other", "participant1", "someone"); err == nil {
+		t.Errorf("Expected error creating a second organization for the same participant")
+	}
+
+	invitation, err := orgs.Invite(org.ID, "owner", "Sales@Acme.com", []OrgRole{OrgBidder, OrgFinance})
+	if err != nil {
+		t.Fatalf("Invite failed: %v", err)
+	}
+	if _, err := orgs.AcceptInvitation(invitation.Token, "sales", "other@acme.com"); err == nil {
+		t.Errorf("Expected error accepting invitation with another email")
+	}
+	if _, err := orgs.AcceptInvitation(invitation.Token, "sales", "sales@acme.com"); err != nil {
+		t.Fatalf("AcceptInvitation failed: %v", err)
+	}
+	if _, err := orgs.AcceptInvitation(invitation.Token, "intruder", "sales@acme.com"); err == nil {
+		t.Errorf("Expected invitation to be single use")
+	}
+
+	// Members act for the organization's participant within their roles
+	participantID, err := orgs.Authorize("sales", PermBid)
+	if err != nil || participantID != "participant1" {
+		t.Errorf("Expected bidder to act for participant1, got %q err %v", participantID, err)
+	}
+	if _, err := orgs.Authorize("sales", PermManageMembers); err == nil {
+		t.Errorf("Expected bidder to be refused member management")
+	}
+	if _, err := orgs.Invite(org.ID, "sales", "x@acme.com", []OrgRole{OrgViewer}); err == nil {
+		t.Errorf("Expected non-admin invite to be refused")
+	}
+
+	if _, err := orgs.SetMemberRoles(org.ID, "owner", "sales", []OrgRole{OrgViewer}); err != nil {
+		t.Fatalf("SetMemberRoles failed: %v", err)
+	}
+	if _, err := orgs.Authorize("sales", PermBid); err == nil {
+		t.Errorf("Expected viewer to be refused bidding")
+	}
+	if _, err := orgs.SetMemberRoles(org.ID, "owner", "owner", []OrgRole{OrgViewer}); err == nil {
+		t.Errorf("Expected error removing the last admin")
+	}
+
+	orgs.RecordAction("sales", "bid.placed", "bid1")
+	audit := orgs.AuditLog(org.ID)
+	last := audit[len(audit)-1]
+	if last.UserID != "sales" || last.Action != "bid.placed" {
+		t.Errorf("Expected bid attributed to sales user, got %+v", last)
+	}
+}
+
+func TestOrganizationService_HandlersUseMemberPermissions(t *testing.T) {
+	auth, _ := newTestAuthService(t)
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Organizations = NewOrganizationService(nil)
+	router := SetupRouter(marketplace, nil, auth)
+
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	org, _ := marketplace.Organizations.CreateOrganization("Carrier1", carrier.ID, "owner")
+	invitation, _ := marketplace.Organizations.Invite(org.ID, "owner", "viewer@carrier.com", []OrgRole{OrgViewer})
+	marketplace.Organizations.AcceptInvitation(invitation.Token, "viewer", "viewer@carrier.com")
+
+	token := func(userID string) string {
+		pair, err := auth.issueTokens(&UserAccount{ID: userID, ParticipantID: carrier.ID})
+		if err != nil {
+			t.Fatalf("issueTokens failed: %v", err)
+		}
+		return pair.AccessToken
+	}
+	bid := func(userID string) int {
+		req := httptest.NewRequest("POST", "/bids", strings.NewReader(`{"quote_id":"q1","bid_amount":100}`))
+		req.Header.Set("Authorization", "Bearer "+token(userID))
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := bid("viewer"); code != http.StatusForbidden {
+		t.Errorf("Expected viewer bid to be forbidden, got %d", code)
+	}
+	// The owner is allowed through to the marketplace, which rejects the unknown quote
+	if code := bid("owner"); code != http.StatusBadRequest {
+		t.Errorf("Expected owner bid to reach the marketplace, got %d", code)
+	}
+}
+
+func TestOrganizationService_PlatformAdminAndMemberRemoval(t *testing.T) {
+	auth, sender := newTestAuthService(t)
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Organizations = NewOrganizationService(nil)
+	router := SetupRouter(marketplace, nil, auth)
+
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	org, _ := marketplace.Organizations.CreateOrganization("Carrier1", carrier.ID, "owner")
+	invitation, _ := marketplace.Organizations.Invite(org.ID, "owner", "bidder@carrier.com", []OrgRole{OrgBidder})
+	marketplace.AccessControl.AssignRole(carrier.ID, AdminRole)
+
+	// A bad invitation is refused before any account is created
+	register := func(token string) int {
+		body := `{"email":"bidder@carrier.com","password":"correct horse","invitation_token":"` + token + `"}`
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, httptest.NewRequest("POST", "/auth/register", strings.NewReader(body)))
+		return rr.Code
+	}
+	if code := register("bogus"); code != http.StatusBadRequest {
+		t.Errorf("Expected 400 for an unknown invitation, got %d", code)
+	}
+	if code := register(invitation.Token); code != http.StatusOK {
+		t.Fatalf("Expected invited registration to succeed, got %d", code)
+	}
+	auth.VerifyEmail("bidder@carrier.com", sender.codes["bidder@carrier.com"])
+	tokens, err := auth.Login("bidder@carrier.com", "correct horse")
+	if err != nil {
+		t.Fatalf("Login failed: %v", err)
+	}
+	bidder, _ := auth.Authenticate(tokens.AccessToken)
+
+	// The participant's Admin role only extends to the organization's admins
+	owner := Principal{UserID: "owner", ParticipantID: carrier.ID}
+	if !isPlatformAdmin(marketplace, owner) {
+		t.Errorf("Expected the organization admin to hold the platform Admin role")
+	}
+	if isPlatformAdmin(marketplace, bidder) {
+		t.Errorf("Expected a bidder not to hold the platform Admin role")
+	}
+	for _, role := range MarketplaceRoles(marketplace)(bidder) {
+		if role == string(AdminRole) {
+			t.Errorf("Expected bidder roles without Admin, got %v", MarketplaceRoles(marketplace)(bidder))
+		}
+	}
+
+	ownerTokens, _ := auth.issueTokens(&UserAccount{ID: "owner", ParticipantID: carrier.ID})
+	req := httptest.NewRequest("DELETE", "/organizations/"+org.ID+"/members/"+bidder.UserID, nil)
+	req.Header.Set("Authorization", "Bearer "+ownerTokens.AccessToken)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	if rr.Code != http.StatusOK {
+		t.Fatalf("Expected member removal to succeed, got %d: %s", rr.Code, rr.Body.String())
+	}
+	if account, _ := auth.GetAccount(bidder.UserID); account.ParticipantID != "" {
+		t.Errorf("Expected removed member to be unlinked, got %s", account.ParticipantID)
+	}
+	if _, err := auth.Refresh(tokens.RefreshToken); err == nil {
+		t.Errorf("Expected removed member's refresh token to be revoked")
+	}
+}
@@ -0,0 +1,521 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+	"gopkg.in/yaml.v2"
+)
+
+// anyRole in a rule's roles matches every authenticated subject
+const anyRole = "*"
+
+// PolicySet is a permission matrix loaded from a policy file
+type PolicySet struct {
+	Version string       `yaml:"version"`
+	Default string       `yaml:"default"` // "allow" or "deny" when no rule matches
+	Rules   []PolicyRule `yaml:"rules"`
+}
+
+// PolicyRule grants an action on a route to subjects holding any of its roles
+type PolicyRule struct {
+	Route   string                `yaml:"route"`   // mux path template; a trailing * matches a prefix
+	Methods []string              `yaml:"methods"` // empty matches every method
+	Action  string                `yaml:"action"`
+	Public  bool                  `yaml:"public"` // allowed without authentication
+	Roles   []string              `yaml:"roles"`
+	Owner   *OwnershipRequirement `yaml:"owner"`
+}
+
+// OwnershipRequirement restricts a rule to the subject owning a resource
+type OwnershipRequirement struct {
+	Rule        string   `yaml:"rule"`         // registered ownership rule name
+	Param       string   `yaml:"param"`        // path variable or JSON body field holding the resource ID
+	BypassRoles []string `yaml:"bypass_roles"` // roles exempt from the ownership check
+}
+
+// PolicySubject is the caller a policy decision is made for
+type PolicySubject struct {
+	Authenticated bool     `yaml:"authenticated"`
+	UserID        string   `yaml:"user_id"`
+	ParticipantID string   `yaml:"participant_id"`
+	Roles         []string `yaml:"roles"`
+}
+
+// PolicyRequest describes an attempted action
+type PolicyRequest struct {
+	Route    string
+	Method   string
+	Subject  PolicySubject
+	Resource map[string]string // request parameters, keyed by path variable or body field
+}
+
+// PolicyDecision is the outcome of evaluating a PolicyRequest
+type PolicyDecision struct {
+	Allowed bool
+	Action  string
+	Reason  string
+}
+
+// OwnershipRule reports whether a subject owns the identified resource
+type OwnershipRule func(subject PolicySubject, resourceID string) (bool, error)
+
+// PolicyEngine evaluates requests against a hot-reloadable PolicySet
+type PolicyEngine struct {
+	path     string
+	policy   PolicySet
+	modTime  time.Time
+	owners   map[string]OwnershipRule
+	stopChan chan struct{}
+	mutex    sync.RWMutex
+}
+
+// NewPolicyEngine creates a PolicyEngine from an in-memory PolicySet
+func NewPolicyEngine(policy PolicySet) (*PolicyEngine, error) {
+	if err := validatePolicySet(policy); err != nil {
+		return nil, err
+	}
+	return &PolicyEngine{
+		policy: policy,
+		owners: make(map[string]OwnershipRule),
+	}, nil
+}
+
+// LoadPolicyEngine creates a PolicyEngine from a YAML policy file
+func LoadPolicyEngine(path string) (*PolicyEngine, error) {
+	policy, modTime, err := readPolicyFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pe, err := NewPolicyEngine(policy)
+	if err != nil {
+		return nil, err
+	}
+	pe.path = path
+	pe.modTime = modTime
+	return pe, nil
+}
+
+// readPolicyFile parses a policy file and returns it with its modification time
+func readPolicyFile(path string) (PolicySet, time.Time, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return PolicySet{}, time.Time{}, err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PolicySet{}, time.Time{}, err
+	}
+	var policy PolicySet
+	if err := yaml.UnmarshalStrict(data, &policy); err != nil {
+		return PolicySet{}, time.Time{}, fmt.Errorf("invalid policy file %s: %v", path, err)
+	}
+	return policy, info.ModTime(), nil
+}
+
+// validatePolicySet checks a policy set is complete
+func validatePolicySet(policy PolicySet) error {
+	if policy.Default != "allow" && policy.Default != "deny" {
+		return errors.New("policy default must be allow or deny")
+	}
+	for i, rule := range policy.Rules {
+		if rule.Route == "" {
+			return fmt.Errorf("rule %d: route is required", i)
+		}
+		if !rule.Public && len(rule.Roles) == 0 {
+			return fmt.Errorf("rule %d (%s): roles are required unless public", i, rule.Route)
+		}
+		if rule.Owner != nil && (rule.Owner.Rule == "" || rule.Owner.Param == "") {
+			return fmt.Errorf("rule %d (%s): ownership needs a rule and param", i, rule.Route)
+		}
+	}
+	return nil
+}
+
+// RegisterOwnershipRule registers a named ownership rule policies can reference
+func (pe *PolicyEngine) RegisterOwnershipRule(name string, rule OwnershipRule) {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	pe.owners[name] = rule
+}
+
+// Reload re-reads the policy file if it has changed. An invalid file is
+// rejected and the current policy stays in force.
+func (pe *PolicyEngine) Reload() (bool, error) {
+	if pe.path == "" {
+		return false, errors.New("policy engine not loaded from a file")
+	}
+	info, err := os.Stat(pe.path)
+	if err != nil {
+		return false, err
+	}
+	pe.mutex.RLock()
+	unchanged := info.ModTime().Equal(pe.modTime)
+	pe.mutex.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	policy, modTime, err := readPolicyFile(pe.path)
+	if err == nil {
+		err = validatePolicySet(policy)
+	}
+	if err != nil {
+		return false, err
+	}
+	pe.mutex.Lock()
+	pe.policy = policy
+	pe.modTime = modTime
+	pe.mutex.Unlock()
+	log.Printf("Policy reloaded from %s (version %s)", pe.path, policy.Version)
+	return true, nil
+}
+
+// WatchFile polls the policy file and hot-reloads it when it changes
+func (pe *PolicyEngine) WatchFile(interval time.Duration) {
+	pe.mutex.Lock()
+	if pe.stopChan != nil {
+		pe.mutex.Unlock()
+		return
+	}
+	pe.stopChan = make(chan struct{})
+	stop := pe.stopChan
+	pe.mutex.Unlock()
+
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				if _, err := pe.Reload(); err != nil {
+					log.Printf("Policy reload failed, keeping current policy: %v", err)
+				}
+			case <-stop:
+				return
+			}
+		}
+	}()
+}
+
+// StopWatching stops hot-reloading the policy file
+func (pe *PolicyEngine) StopWatching() {
+	pe.mutex.Lock()
+	defer pe.mutex.Unlock()
+	if pe.stopChan != nil {
+		close(pe.stopChan)
+		pe.stopChan = nil
+	}
+}
+
+// Policy returns the policy set currently in force
+func (pe *PolicyEngine) Policy() PolicySet {
+	pe.mutex.RLock()
+	defer pe.mutex.RUnlock()
+	return pe.policy
+}
+
+// matches reports whether a rule applies to a route and method
+func (rule PolicyRule) matches(route, method string) bool {
+	if strings.HasSuffix(rule.Route, "*") {
+		if !strings.HasPrefix(route, strings.TrimSuffix(rule.Route, "*")) {
+			return false
+		}
+	} else if rule.Route != route {
+		return false
+	}
+	if len(rule.Methods) == 0 {
+		return true
+	}
+	for _, m := range rule.Methods {
+		if strings.EqualFold(m, method) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAnyRole reports whether a subject holds any of the given roles
+func (subject PolicySubject) hasAnyRole(roles []string) bool {
+	for _, want := range roles {
+		if want == anyRole {
+			return true
+		}
+		for _, held := range subject.Roles {
+			if held == want {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Evaluate decides a request against the first matching rule
+func (pe *PolicyEngine) Evaluate(req PolicyRequest) PolicyDecision {
+	pe.mutex.RLock()
+	defer pe.mutex.RUnlock()
+
+	for _, rule := range pe.policy.Rules {
+		if !rule.matches(req.Route, req.Method) {
+			continue
+		}
+		decision := PolicyDecision{Action: rule.Action}
+		if rule.Public {
+			decision.Allowed = true
+			return decision
+		}
+		if !req.Subject.Authenticated {
+			decision.Reason = "authentication required"
+			return decision
+		}
+		if !req.Subject.hasAnyRole(rule.Roles) {
+			decision.Reason = "role not permitted to " + rule.Action
+			return decision
+		}
+		if rule.Owner != nil && !req.Subject.hasAnyRole(rule.Owner.BypassRoles) {
+			owned, reason := pe.checkOwnership(rule.Owner, req)
+			if !owned {
+				decision.Reason = reason
+				return decision
+			}
+		}
+		decision.Allowed = true
+		return decision
+	}
+	if pe.policy.Default == "allow" {
+		return PolicyDecision{Allowed: true}
+	}
+	return PolicyDecision{Reason: "no policy rule for route"}
+}
+
+// checkOwnership must be called with the mutex held
+func (pe *PolicyEngine) checkOwnership(owner *OwnershipRequirement, req PolicyRequest) (bool, string) {
+	rule, exists := pe.owners[owner.Rule]
+	if !exists {
+		return false, "unknown ownership rule " + owner.Rule
+	}
+	resourceID := req.Resource[owner.Param]
+	if resourceID == "" {
+		return false, "missing " + owner.Param
+	}
+	owned, err := rule(req.Subject, resourceID)
+	if err != nil {
+		return false, err.Error()
+	}
+	if !owned {
+		return false, "subject does not own " + owner.Param
+	}
+	return true, ""
+}
+
+// Middleware enforces the policy on routed requests. roles resolves the
+// authenticated principal's roles. It must run after the auth middleware.
+func (pe *PolicyEngine) Middleware(roles func(Principal) []string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route := r.URL.Path
+			if current := mux.CurrentRoute(r); current != nil {
+				if tpl, err := current.GetPathTemplate(); err == nil {
+					route = tpl
+				}
+			}
+			req := PolicyRequest{
+				Route:    route,
+				Method:   r.Method,
+				Resource: requestResource(r),
+			}
+			if principal, ok := PrincipalFromContext(r.Context()); ok {
+				req.Subject = PolicySubject{
+					Authenticated: true,
+					UserID:        principal.UserID,
+					ParticipantID: principal.ParticipantID,
+					Roles:         roles(principal),
+				}
+			}
+			decision := pe.Evaluate(req)
+			if !decision.Allowed {
+				http.Error(w, "Forbidden: "+decision.Reason, http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requestResource collects path variables and top-level JSON body string
+// fields for ownership checks, leaving the body readable by the handler
+func requestResource(r *http.Request) map[string]string {
+	resource := make(map[string]string)
+	contentType := r.Header.Get("Content-Type")
+	if r.Body != nil && (contentType == "" || strings.HasPrefix(contentType, "application/json")) {
+		data, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+		r.Body = io.NopCloser(bytes.NewReader(data))
+		var fields map[string]interface{}
+		if err == nil && json.Unmarshal(data, &fields) == nil {
+			for k, v := range fields {
+				if s, ok := v.(string); ok {
+					resource[k] = s
+				}
+			}
+		}
+	}
+	for k, v := range mux.Vars(r) {
+		resource[k] = v
+	}
+	return resource
+}
+
+// MarketplaceRoles resolves a principal's roles from its organization
+// membership and platform AccessControl roles. The platform Admin role only
+// applies to the organization's admins.
+func MarketplaceRoles(marketplace *Marketplace) func(Principal) []string {
+	return func(principal Principal) []string {
+		roles := []string{}
+		if marketplace.Organizations != nil {
+			if org, err := marketplace.Organizations.OrganizationForUser(principal.UserID); err == nil {
+				for _, m := range marketplace.Organizations.Members(org.ID) {
+					if m.UserID == principal.UserID {
+						for _, role := range m.Roles {
+							roles = append(roles, string(role))
+						}
+					}
+				}
+			}
+		}
+		if marketplace.AccessControl != nil {
+			for _, role := range marketplace.AccessControl.Roles(principal.ParticipantID) {
+				if role == AdminRole && !isPlatformAdmin(marketplace, principal) {
+					continue
+				}
+				roles = append(roles, string(role))
+			}
+		}
+		return roles
+	}
+}
+
+// RegisterMarketplaceOwnershipRules registers the ownership rules for
+// marketplace resources
+func RegisterMarketplaceOwnershipRules(pe *PolicyEngine, marketplace *Marketplace) {
+	// quote_owner: the shipper that claimed the quote
+	pe.RegisterOwnershipRule("quote_owner", func(subject PolicySubject, quoteID string) (bool, error) {
+		quote, err := marketplace.GetQuote(quoteID)
+		if err != nil {
+			return false, err
+		}
+		return quote.ShipperID != "" && quote.ShipperID == subject.ParticipantID, nil
+	})
+	// participant_self: the participant named by the resource itself
+	pe.RegisterOwnershipRule("participant_self", func(subject PolicySubject, participantID string) (bool, error) {
+		return subject.ParticipantID != "" && subject.ParticipantID == participantID, nil
+	})
+	// booking_party: the shipper or carrier on the booking
+	pe.RegisterOwnershipRule("booking_party", func(subject PolicySubject, bookingID string) (bool, error) {
+		booking, err := marketplace.GetBooking(bookingID)
+		if err != nil {
+			return false, err
+		}
+		return subject.ParticipantID == booking.ShipperID || subject.ParticipantID == booking.CarrierID, nil
+	})
+	// contract_party: the shipper or carrier on a rate contract
+	pe.RegisterOwnershipRule("contract_party", func(subject PolicySubject, contractID string) (bool, error) {
+		if marketplace.Contracts == nil {
+			return false, errors.New("rate contracts not configured")
+		}
+		contract, err := marketplace.Contracts.Get(contractID)
+		if err != nil {
+			return false, err
+		}
+		return subject.ParticipantID == contract.ShipperID || subject.ParticipantID == contract.CarrierID, nil
+	})
+	// invoice_party: the buyer or seller on the invoice
+	pe.RegisterOwnershipRule("invoice_party", func(subject PolicySubject, invoiceID string) (bool, error) {
+		if marketplace.InvoiceService == nil {
+			return false, errors.New("invoicing not configured")
+		}
+		invoice, err := marketplace.InvoiceService.GetInvoice(invoiceID)
+		if err != nil {
+			return false, err
+		}
+		return subject.ParticipantID == invoice.BuyerID || subject.ParticipantID == invoice.SellerID, nil
+	})
+}
+
+// PolicyCase is an allow/deny expectation for the policy test harness
+type PolicyCase struct {
+	Name     string            `yaml:"name"`
+	Route    string            `yaml:"route"`
+	Method   string            `yaml:"method"`
+	Subject  PolicySubject     `yaml:"subject"`
+	Resource map[string]string `yaml:"resource"`
+	Expect   string            `yaml:"expect"` // "allow" or "deny"
+}
+
+// PolicyCaseFile holds harness cases and the resource ownership fixtures
+// they rely on
+type PolicyCaseFile struct {
+	// Owners maps an ownership rule to resource ID -> owning participant IDs
+	Owners map[string]map[string][]string `yaml:"owners"`
+	Cases  []PolicyCase                   `yaml:"cases"`
+}
+
+// LoadPolicyCases reads a policy harness case file
+func LoadPolicyCases(path string) (PolicyCaseFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return PolicyCaseFile{}, err
+	}
+	var cases PolicyCaseFile
+	if err := yaml.UnmarshalStrict(data, &cases); err != nil {
+		return PolicyCaseFile{}, fmt.Errorf("invalid policy cases %s: %v", path, err)
+	}
+	return cases, nil
+}
+
+// RunPolicyCases evaluates harness cases against a policy set, using the
+// case file's ownership fixtures, and returns a description of each failure
+func RunPolicyCases(policy PolicySet, cases PolicyCaseFile) ([]string, error) {
+	pe, err := NewPolicyEngine(policy)
+	if err != nil {
+		return nil, err
+	}
+	for name, resources := range cases.Owners {
+		resources := resources
+		pe.RegisterOwnershipRule(name, func(subject PolicySubject, resourceID string) (bool, error) {
+			for _, owner := range resources[resourceID] {
+				if owner == subject.ParticipantID {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+	}
+
+	failures := []string{}
+	for _, c := range cases.Cases {
+		if c.Expect != "allow" && c.Expect != "deny" {
+			failures = append(failures, c.Name+": expect must be allow or deny")
+			continue
+		}
+		decision := pe.Evaluate(PolicyRequest{
+			Route:    c.Route,
+			Method:   c.Method,
+			Subject:  c.Subject,
+			Resource: c.Resource,
+		})
+		if decision.Allowed != (c.Expect == "allow") {
+			failures = append(failures, fmt.Sprintf("%s: expected %s, got allowed=%t (%s)", c.Name, c.Expect, decision.Allowed, decision.Reason))
+		}
+	}
+	return failures, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPolicyHarness(t *testing.T) {
+	engine, err := LoadPolicyEngine("pkg/security/policies.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicyEngine failed: %v", err)
+	}
+	cases, err := LoadPolicyCases("pkg/security/policy_cases.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicyCases failed: %v", err)
+	}
+	failures, err := RunPolicyCases(engine.Policy(), cases)
+	if err != nil {
+		t.Fatalf("RunPolicyCases failed: %v", err)
+	}
+	for _, failure := range failures {
+		t.Error(failure)
+	}
+}
+
+func TestPolicyEngine_Reload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policies.yaml")
+	write := func(content string, modTime time.Time) {
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatalf("WriteFile failed: %v", err)
+		}
+		os.Chtimes(path, modTime, modTime)
+	}
+	subject := PolicySubject{Authenticated: true, ParticipantID: "p1", Roles: []string{"viewer"}}
+	request := PolicyRequest{Route: "/bids", Method: "POST", Subject: subject}
+
+	start := time.Now().Add(-time.Hour)
+	write("version: \"1\"\ndefault: deny\nrules:\n  - {route: /bids, action: bid.place, roles: [bidder]}\n", start)
+	engine, err := LoadPolicyEngine(path)
+	if err != nil {
+		t.Fatalf("LoadPolicyEngine failed: %v", err)
+	}
+	if engine.Evaluate(request).Allowed {
+		t.Fatalf("Expected viewer to be denied bidding")
+	}
+
+	write("version: \"2\"\ndefault: deny\nrules:\n  - {route: /bids, action: bid.place, roles: [bidder, viewer]}\n", start.Add(time.Minute))
+	if reloaded, err := engine.Reload(); err != nil || !reloaded {
+		t.Fatalf("Expected reload, got %t err %v", reloaded, err)
+	}
+	if !engine.Evaluate(request).Allowed {
+		t.Errorf("Expected viewer to be allowed after reload")
+	}
+
+	// An invalid file is rejected and the previous policy stays in force
+	write("version: \"3\"\ndefault: maybe\nrules: []\n", start.Add(2*time.Minute))
+	if _, err := engine.Reload(); err == nil {
+		t.Errorf("Expected error reloading invalid policy")
+	}
+	if engine.Policy().Version != "2" || !engine.Evaluate(request).Allowed {
+		t.Errorf("Expected version 2 to remain active, got %s", engine.Policy().Version)
+	}
+}
+
+func TestPolicyEngine_MiddlewareEnforcesQuoteOwnership(t *testing.T) {
+	auth, _ := newTestAuthService(t)
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Organizations = NewOrganizationService(nil)
+	router := SetupRouter(marketplace, nil, auth)
+
+	engine, err := LoadPolicyEngine("pkg/security/policies.yaml")
+	if err != nil {
+		t.Fatalf("LoadPolicyEngine failed: %v", err)
+	}
+	RegisterMarketplaceOwnershipRules(engine, marketplace)
+	router.Use(engine.Middleware(MarketplaceRoles(marketplace)))
+
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	other := marketplace.RegisterParticipant("Shipper2", Shipper)
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	marketplace.Organizations.CreateOrganization("Shipper1", shipper.ID, "owner")
+	marketplace.Organizations.CreateOrganization("Shipper2", other.ID, "intruder")
+
+	quote, err := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("CreateFreightQuote failed: %v", err)
+	}
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+
+	book := func(userID, participantID string) int {
+		pair, err := auth.issueTokens(&UserAccount{ID: userID, ParticipantID: participantID})
+		if err != nil {
+			t.Fatalf("issueTokens failed: %v", err)
+		}
+		body := `{"quote_id":"` + quote.ID + `","bid_id":"` + bid.ID + `"}`
+		req := httptest.NewRequest("POST", "/bookings", strings.NewReader(body))
+		req.Header.Set("Authorization", "Bearer "+pair.AccessToken)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	if code := book("intruder", other.ID); code != http.StatusForbidden {
+		t.Errorf("Expected another shipper to be forbidden, got %d", code)
+	}
+	if code := book("owner", shipper.ID); code != http.StatusOK {
+		t.Errorf("Expected quote owner to confirm booking, got %d", code)
+	}
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Weights of the recommendation score components; they sum to one
+const (
+	onTimeWeight   = 0.4
+	priceWeight    = 0.3
+	disputeWeight  = 0.2
+	capacityWeight = 0.1
+)
+
+// CapacityStatus is whether a carrier's published capacity fits a quote
+type CapacityStatus string
+
+const (
+	CapacityFits        CapacityStatus = "fits"
+	CapacityShort       CapacityStatus = "insufficient"
+	CapacityUnpublished CapacityStatus = "unpublished"
+)
+
+// CarrierTrackRecord is the history a carrier is recommended on
+type CarrierTrackRecord struct {
+	CarrierID        string         `json:"carrier_id"`
+	Name             string         `json:"name"`
+	ArrivedLegs      int            `json:"arrived_legs"` // legs arrived against a planned arrival
+	OnTimeLegs       int            `json:"on_time_legs"`
+	Bookings         int            `json:"bookings"`
+	DisputedBookings int            `json:"disputed_bookings"`
+	PriceRatios      []float64      `json:"price_ratios,omitempty"` // lane bids relative to the median competing bid
+	Capacity         CapacityStatus `json:"capacity"`
+}
+
+// CarrierRecommendation is a carrier's score for a quote with its components,
+// each from 0 to 1
+type CarrierRecommendation struct {
+	CarrierID string             `json:"carrier_id"`
+	Name      string             `json:"name"`
+	Score     float64            `json:"score"`
+	OnTime    float64            `json:"on_time"`
+	Price     float64            `json:"price"`
+	Disputes  float64            `json:"disputes"`
+	Capacity  float64            `json:"capacity"`
+	Record    CarrierTrackRecord `json:"record"`
+}
+
+// ScoreCarrier scores a carrier's track record. Rates are smoothed towards
+// one half so a carrier without history is neither favoured nor penalized.
+func ScoreCarrier(record CarrierTrackRecord) CarrierRecommendation {
+	rec := CarrierRecommendation{
+		CarrierID: record.CarrierID,
+		Name:      record.Name,
+		OnTime:    float64(record.OnTimeLegs+1) / float64(record.ArrivedLegs+2),
+		Price:     0.5,
+		Disputes:  float64(record.Bookings-record.DisputedBookings+1) / float64(record.Bookings+2),
+		Record:    record,
+	}
+	// A bid at the lane median scores one half, half the median or less scores one
+	if len(record.PriceRatios) > 0 {
+		sum := 0.0
+		for _, ratio := range record.PriceRatios {
+			sum += ratio
+		}
+		rec.Price = math.Max(0, math.Min(1, 1.5-sum/float64(len(record.PriceRatios))))
+	}
+	switch record.Capacity {
+	case CapacityFits:
+		rec.Capacity = 1
+	case CapacityShort:
+		rec.Capacity = 0
+	default:
+		rec.Capacity = 0.5
+	}
+
+	rec.OnTime = roundMeasure(rec.OnTime)
+	rec.Price = roundMeasure(rec.Price)
+	rec.Disputes = roundMeasure(rec.Disputes)
+	rec.Score = roundMeasure(onTimeWeight*rec.OnTime + priceWeight*rec.Price + disputeWeight*rec.Disputes + capacityWeight*rec.Capacity)
+	return rec
+}
+
+// RankCarriers scores track records and orders them best first, breaking ties
+// by carrier ID
+func RankCarriers(records []CarrierTrackRecord) []CarrierRecommendation {
+	recs := make([]CarrierRecommendation, 0, len(records))
+	for _, record := range records {
+		recs = append(recs, ScoreCarrier(record))
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if recs[i].Score != recs[j].Score {
+			return recs[i].Score > recs[j].Score
+		}
+		return recs[i].CarrierID < recs[j].CarrierID
+	})
+	return recs
+}
+
+// RecommendCarriers ranks the carriers eligible to bid on a quote by on-time
+// performance, price on the quote's lanes, dispute rate and capacity
+func (m *Marketplace) RecommendCarriers(quoteID string, limit int) ([]CarrierRecommendation, error) {
+	m.mutex.RLock()
+	defer m.mutex.RUnlock()
+
+	quote, exists := m.quotes[quoteID]
+	if !exists {
+		return nil, errors.New("quote not found")
+	}
+
+	records := make(map[string]*CarrierTrackRecord)
+	for _, p := range m.participants {
+		if p.Type == Carrier && canServeQuote(p, quote) {
+			records[p.ID] = &CarrierTrackRecord{CarrierID: p.ID, Name: p.Name, Capacity: CapacityUnpublished}
+		}
+	}
+
+	arrived, onTime := m.onTimeArrivals()
+	for carrierID, record := range records {
+		record.ArrivedLegs, record.OnTimeLegs = arrived[carrierID], onTime[carrierID]
+	}
+
+	// Dispute rate over the carrier's bookings
+	disputed := make(map[string]bool)
+	if m.Disputes != nil {
+		for _, dispute := range m.Disputes.Disputes() {
+			disputed[dispute.BookingID] = true
+		}
+	}
+	for _, booking := range m.bookings {
+		if record, ok := records[booking.CarrierID]; ok {
+			record.Bookings++
+			if disputed[booking.ID] {
+				record.DisputedBookings++
+			}
+		}
+	}
+
+	// Price competitiveness of bids on the same lanes as the quote
+	lanes := make(map[string]bool)
+	for _, segment := range quoteSegments(quote) {
+		lanes[segmentKey(segment)] = true
+	}
+	for otherID, bids := range m.bids {
+		other := m.quotes[otherID]
+		segments := quoteSegments(other)
+		for _, group := range competingBidGroups(bids) {
+			sequence := group[0].LegSequence
+			segment := segments[0]
+			if sequence > 0 && len(other.Legs) > 1 && sequence <= len(other.Legs) {
+				segment = other.Legs[sequence-1]
+			}
+			if len(group) < 2 || !lanes[segmentKey(segment)] {
+				continue
+			}
+			amounts := make([]float64, len(group))
+			for i, b := range group {
+				amounts[i] = b.BidAmount
+			}
+			median := medianOf(amounts)
+			for _, b := range group {
+				if record, ok := records[b.CarrierID]; ok {
+					record.PriceRatios = append(record.PriceRatios, roundMeasure(b.BidAmount/median))
+				}
+			}
+		}
+	}
+
+	list := make([]CarrierTrackRecord, 0, len(records))
+	for _, record := range records {
+		sort.Float64s(record.PriceRatios)
+		if m.Lanes != nil {
+			if published, fits := m.Lanes.CapacityFor(record.CarrierID, quote); fits {
+				record.Capacity = CapacityFits
+			} else if published {
+				record.Capacity = CapacityShort
+			}
+		}
+		list = append(list, *record)
+	}
+	recs := RankCarriers(list)
+	if limit > 0 && len(recs) > limit {
+		recs = recs[:limit]
+	}
+	return recs, nil
+}
+
+// onTimeArrivals counts, per carrier, the legs arrived against a planned
+// arrival and those that arrived on time. Must be called with the mutex held.
+func (m *Marketplace) onTimeArrivals() (arrived, onTime map[string]int) {
+	arrived, onTime = make(map[string]int), make(map[string]int)
+	for _, events := range m.tracking {
+		for _, event := range events {
+			if event.Status != LegArrived {
+				continue
+			}
+			legs := m.quotes[event.QuoteID].Legs
+			if event.LegSequence < 1 || event.LegSequence > len(legs) || legs[event.LegSequence-1].PlannedArrival.IsZero() {
+				continue
+			}
+			arrived[event.CarrierID]++
+			if !event.Time.After(legs[event.LegSequence-1].PlannedArrival) {
+				onTime[event.CarrierID]++
+			}
+		}
+	}
+	return arrived, onTime
+}
+
+// canServeQuote reports whether a carrier may bid on every leg of a quote
+func canServeQuote(carrier Participant, quote FreightQuote) bool {
+	if quote.Cargo.ColdChain != nil && !carrier.HasCapability(CapabilityReefer) {
+		return false
+	}
+	if len(carrier.ServiceItems) == 0 {
+		return true
+	}
+	for _, leg := range quote.Legs {
+		if !carrier.Serves(leg.ServiceItem) {
+			return false
+		}
+	}
+	return true
+}
+
+// segmentKey identifies a lane by origin, destination and mode
+func segmentKey(segment RouteLeg) string {
+	return segment.OriginCode + ">" + segment.DestinationCode + "/" + string(segment.Mode)
+}
+
+// competingBidGroups splits a quote's bids into those competing with each
+// other: bids on the same leg in the same currency
+func competingBidGroups(bids []FreightBid) [][]FreightBid {
+	index := make(map[string]int)
+	groups := [][]FreightBid{}
+	for _, b := range bids {
+		key := fmt.Sprintf("%d/%s", b.LegSequence, b.Currency)
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], b)
+	}
+	return groups
+}
+
+// medianOf returns the median of values
+func medianOf(values []float64) float64 {
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	mid := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[mid-1] + sorted[mid]) / 2
+	}
+	return sorted[mid]
+}
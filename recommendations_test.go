@@ -0,0 +1,111 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestRankCarriers_ScoresTrackRecords(t *testing.T) {
+	recs := RankCarriers([]CarrierTrackRecord{
+		{CarrierID: "newcomer-b"},
+		{CarrierID: "budget", ArrivedLegs: 4, OnTimeLegs: 1, Bookings: 4, DisputedBookings: 2, PriceRatios: []float64{0.5}, Capacity: CapacityShort},
+		{CarrierID: "newcomer-a"},
+		{CarrierID: "reliable", ArrivedLegs: 8, OnTimeLegs: 8, Bookings: 8, PriceRatios: []float64{0.9, 1.0}, Capacity: CapacityFits},
+	})
+
+	want := []struct {
+		carrierID string
+		score     float64
+	}{
+		{"reliable", 0.805},
+		{"budget", 0.533},
+		{"newcomer-a", 0.5},
+		{"newcomer-b", 0.5},
+	}
+	if len(recs) != len(want) {
+		t.Fatalf("Expected %d recommendations, got %d", len(want), len(recs))
+	}
+	for i, w := range want {
+		if recs[i].CarrierID != w.carrierID || recs[i].Score != w.score {
+			t.Errorf("Rank %d: got %s scoring %v, want %s scoring %v", i+1, recs[i].CarrierID, recs[i].Score, w.carrierID, w.score)
+		}
+	}
+	if recs[1].OnTime != 0.333 || recs[1].Price != 1 || recs[1].Disputes != 0.5 || recs[1].Capacity != 0 {
+		t.Errorf("Unexpected budget carrier components %+v", recs[1])
+	}
+}
+
+func TestMarketplace_RecommendCarriersFromHistory(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Disputes = NewDisputeService()
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	punctual := marketplace.RegisterParticipant("Punctual Trucking", Carrier)
+	late := marketplace.RegisterParticipant("Late Trucking", Carrier)
+	airline := marketplace.RegisterParticipant("Air Cargo", Carrier)
+	if _, err := marketplace.SubscribeCatalogItems(airline.ID, []SubCategoryItem{ImportAirLooseLiveCargo}); err != nil {
+		t.Fatalf("SubscribeCatalogItems failed: %v", err)
+	}
+
+	departure := time.Now().Add(-72 * time.Hour)
+	newQuote := func() FreightQuote {
+		quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Pallet, []RouteLeg{
+			{Mode: Road, OriginCode: "NLRTM", DestinationCode: "PLWAW", PlannedDeparture: departure, PlannedArrival: departure.Add(24 * time.Hour)},
+		}, 1000.0, "EUR", time.Now().Add(24*time.Hour), CargoDetails{})
+		if err != nil {
+			t.Fatalf("CreateMultimodalQuote failed: %v", err)
+		}
+		return quote
+	}
+	deliver := func(quote FreightQuote, bid FreightBid, arrival time.Time) Booking {
+		booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+		if err != nil {
+			t.Fatalf("ConfirmBooking failed: %v", err)
+		}
+		if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegDeparted, "", departure); err != nil {
+			t.Fatalf("RecordLegEvent failed: %v", err)
+		}
+		if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegArrived, "", arrival); err != nil {
+			t.Fatalf("RecordLegEvent failed: %v", err)
+		}
+		return booking
+	}
+
+	// The punctual carrier underbids and arrives early
+	first := newQuote()
+	cheap, err := marketplace.PlaceBid(first.ID, punctual.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	if _, err := marketplace.PlaceBid(first.ID, late.ID, 1100.0, ""); err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	deliver(first, cheap, departure.Add(23*time.Hour))
+
+	// The late carrier arrives a day late and is disputed
+	second := newQuote()
+	bid, err := marketplace.PlaceBid(second.ID, late.ID, 1000.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking := deliver(second, bid, departure.Add(48*time.Hour))
+	if _, err := marketplace.Disputes.RaiseDispute(booking.ID, shipper.ID, "delivered a day late"); err != nil {
+		t.Fatalf("RaiseDispute failed: %v", err)
+	}
+
+	if _, err := marketplace.RecommendCarriers("missing", 0); err == nil {
+		t.Errorf("Expected an unknown quote to be rejected")
+	}
+	recs, err := marketplace.RecommendCarriers(newQuote().ID, 0)
+	if err != nil {
+		t.Fatalf("RecommendCarriers failed: %v", err)
+	}
+	if len(recs) != 2 {
+		t.Fatalf("Expected the air-only carrier to be left out, got %+v", recs)
+	}
+	if recs[0].CarrierID != punctual.ID || recs[0].Score != 0.63 || recs[0].Record.OnTimeLegs != 1 || recs[0].Record.PriceRatios[0] != 0.9 {
+		t.Errorf("Expected the punctual carrier first, got %+v", recs[0])
+	}
+	if recs[1].CarrierID != late.ID || recs[1].Score != 0.37 || recs[1].Record.DisputedBookings != 1 {
+		t.Errorf("Expected the late carrier second, got %+v", recs[1])
+	}
+}
@@ -0,0 +1,433 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RatingStatus is the moderation state of a rating's review comment
+type RatingStatus string
+
+const (
+	RatingPublished RatingStatus = "published"
+	RatingReported  RatingStatus = "reported" // awaiting moderation
+	RatingRemoved   RatingStatus = "removed"  // comment withheld; the score still counts
+)
+
+const (
+	minRatingScore   = 1
+	maxRatingScore   = 5
+	maxCommentLength = 2000
+)
+
+// Rating is one booking party's rating of the other after delivery. Its hash
+// covers the score and a hash of the comment, so moderation can withhold the
+// comment without breaking the anchored record.
+type Rating struct {
+	ID             string       `json:"id"`
+	BookingID      string       `json:"booking_id"`
+	RaterID        string       `json:"rater_id"`
+	RateeID        string       `json:"ratee_id"`
+	Score          int          `json:"score"`  // 1 to 5 stars
+	Weight         float64      `json:"weight"` // shipment value the score is weighted by
+	Comment        string       `json:"comment,omitempty"`
+	CommentHash    string       `json:"comment_hash,omitempty"`
+	Status         RatingStatus `json:"status"`
+	ReportReason   string       `json:"report_reason,omitempty"`
+	ModerationNote string       `json:"moderation_note,omitempty"`
+	CreatedAt      time.Time    `json:"created_at"`
+	Hash           string       `json:"hash"`
+}
+
+// ReputationScore is a participant's reputation as published on chain.
+// Score runs from 0 to 1 and blends value-weighted ratings with on-time
+// delivery and disputes lost.
+type ReputationScore struct {
+	ParticipantID string    `json:"participant_id"`
+	Score         float64   `json:"score"`
+	AverageRating float64   `json:"average_rating"` // value-weighted stars, 0 when unrated
+	Ratings       int       `json:"ratings"`
+	RatedValue    float64   `json:"rated_value"`
+	ArrivedLegs   int       `json:"arrived_legs"`
+	OnTimeLegs    int       `json:"on_time_legs"`
+	Bookings      int       `json:"bookings"`
+	DisputesLost  int       `json:"disputes_lost"`
+	PublishedAt   time.Time `json:"published_at"`
+	Hash          string    `json:"hash"`
+}
+
+// AwardRule selects the bid a quote is awarded to automatically: the
+// cheapest bid from a carrier meeting the reputation thresholds
+type AwardRule struct {
+	LegSequence   int     `json:"leg_sequence,omitempty"` // 0 awards the whole route
+	MinReputation float64 `json:"min_reputation"`
+	MinRatings    int     `json:"min_ratings"`
+	MaxAmount     float64 `json:"max_amount,omitempty"` // in the quote's currency; 0 is unlimited
+}
+
+// ReputationService keeps ratings and the reputation scores published on chain
+type ReputationService struct {
+	blockchain *Blockchain
+	ratings    map[string]Rating          // ratingID -> rating
+	received   map[string][]string        // rateeID -> rating IDs, oldest first
+	published  map[string]ReputationScore // participantID -> latest published score
+	mutex      sync.RWMutex
+}
+
+// NewReputationService creates a new ReputationService instance
+func NewReputationService(bc *Blockchain) *ReputationService {
+	return &ReputationService{
+		blockchain: bc,
+		ratings:    make(map[string]Rating),
+		received:   make(map[string][]string),
+		published:  make(map[string]ReputationScore),
+	}
+}
+
+// hashRating hashes the fields of a rating that may never change
+func hashRating(rating Rating) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n%s\n%d\n%.2f\n%s\n%d",
+		rating.ID, rating.BookingID, rating.RaterID, rating.RateeID,
+		rating.Score, rating.Weight, rating.CommentHash, rating.CreatedAt.UnixNano())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashReputation hashes a published reputation score
+func hashReputation(score ReputationScore) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%.3f\n%.2f\n%d\n%.2f\n%d\n%d\n%d\n%d\n%d",
+		score.ParticipantID, score.Score, score.AverageRating, score.Ratings, score.RatedValue,
+		score.ArrivedLegs, score.OnTimeLegs, score.Bookings, score.DisputesLost, score.PublishedAt.UnixNano())
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// hashComment hashes a review comment; an empty comment has no hash
+func hashComment(comment string) string {
+	if comment == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(comment))
+	return hex.EncodeToString(sum[:])
+}
+
+// anchor adds a record to the chain
+func (rs *ReputationService) anchor(record interface{}) error {
+	if rs.blockchain == nil {
+		return nil
+	}
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	if err := rs.blockchain.AddBlock(string(data)); err != nil {
+		log.Printf("Error anchoring reputation record: %v", err)
+		return err
+	}
+	return nil
+}
+
+// addRating anchors and stores a rating. A party rates each booking once.
+func (rs *ReputationService) addRating(rating Rating) (Rating, error) {
+	if rating.Score < minRatingScore || rating.Score > maxRatingScore {
+		return Rating{}, fmt.Errorf("score must be between %d and %d", minRatingScore, maxRatingScore)
+	}
+	rating.Comment = strings.TrimSpace(rating.Comment)
+	if len(rating.Comment) > maxCommentLength {
+		return Rating{}, fmt.Errorf("comment exceeds %d characters", maxCommentLength)
+	}
+
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	for _, id := range rs.received[rating.RateeID] {
+		if existing := rs.ratings[id]; existing.BookingID == rating.BookingID && existing.RaterID == rating.RaterID {
+			return Rating{}, errors.New("booking already rated")
+		}
+	}
+	rating.ID = uuid.New().String()
+	rating.CommentHash = hashComment(rating.Comment)
+	rating.Status = RatingPublished
+	rating.CreatedAt = time.Now().UTC()
+	rating.Hash = hashRating(rating)
+
+	if err := rs.anchor(struct {
+		Type     string `json:"type"`
+		RatingID string `json:"rating_id"`
+		RateeID  string `json:"ratee_id"`
+		Hash     string `json:"hash"`
+	}{"rating-anchor", rating.ID, rating.RateeID, rating.Hash}); err != nil {
+		return Rating{}, err
+	}
+	rs.ratings[rating.ID] = rating
+	rs.received[rating.RateeID] = append(rs.received[rating.RateeID], rating.ID)
+	return rating, nil
+}
+
+// Received returns the ratings a participant received, newest first, with
+// removed comments withheld
+func (rs *ReputationService) Received(participantID string) []Rating {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	ids := rs.received[participantID]
+	ratings := make([]Rating, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		ratings = append(ratings, rs.ratings[ids[i]])
+	}
+	return ratings
+}
+
+// Report flags a rating's comment for moderation
+func (rs *ReputationService) Report(ratingID, reason string) (Rating, error) {
+	if strings.TrimSpace(reason) == "" {
+		return Rating{}, errors.New("a reason is required")
+	}
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rating, exists := rs.ratings[ratingID]
+	if !exists {
+		return Rating{}, errors.New("rating not found")
+	}
+	if rating.Status != RatingPublished {
+		return Rating{}, errors.New("rating already reported or moderated")
+	}
+	rating.Status = RatingReported
+	rating.ReportReason = reason
+	rs.ratings[ratingID] = rating
+	return rating, nil
+}
+
+// Moderate decides a reported rating, either removing its comment or
+// republishing it. The decision is anchored on chain; the score is unaffected.
+func (rs *ReputationService) Moderate(ratingID string, remove bool, note string) (Rating, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	rating, exists := rs.ratings[ratingID]
+	if !exists {
+		return Rating{}, errors.New("rating not found")
+	}
+	if rating.Status != RatingReported {
+		return Rating{}, errors.New("rating has not been reported")
+	}
+	rating.Status = RatingPublished
+	if remove {
+		rating.Status = RatingRemoved
+		rating.Comment = ""
+	}
+	rating.ModerationNote = note
+
+	if err := rs.anchor(struct {
+		Type     string       `json:"type"`
+		RatingID string       `json:"rating_id"`
+		Status   RatingStatus `json:"status"`
+	}{"rating-moderation", rating.ID, rating.Status}); err != nil {
+		return Rating{}, err
+	}
+	rs.ratings[ratingID] = rating
+	return rating, nil
+}
+
+// Verify recomputes every rating and published score hash, reporting the
+// first record that was edited
+func (rs *ReputationService) Verify() error {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+
+	for _, rating := range rs.ratings {
+		if hashRating(rating) != rating.Hash || (rating.Comment != "" && hashComment(rating.Comment) != rating.CommentHash) {
+			return fmt.Errorf("rating %s fails hash verification", rating.ID)
+		}
+	}
+	for _, score := range rs.published {
+		if hashReputation(score) != score.Hash {
+			return fmt.Errorf("reputation of %s fails hash verification", score.ParticipantID)
+		}
+	}
+	return nil
+}
+
+// publish anchors a reputation score and makes it the participant's current one
+func (rs *ReputationService) publish(score ReputationScore) (ReputationScore, error) {
+	rs.mutex.Lock()
+	defer rs.mutex.Unlock()
+
+	score.PublishedAt = time.Now().UTC()
+	score.Hash = hashReputation(score)
+	if err := rs.anchor(struct {
+		Type          string  `json:"type"`
+		ParticipantID string  `json:"participant_id"`
+		Score         float64 `json:"score"`
+		Hash          string  `json:"hash"`
+	}{"reputation-anchor", score.ParticipantID, score.Score, score.Hash}); err != nil {
+		return ReputationScore{}, err
+	}
+	rs.published[score.ParticipantID] = score
+	return score, nil
+}
+
+// Published returns a participant's latest published reputation
+func (rs *ReputationService) Published(participantID string) (ReputationScore, bool) {
+	rs.mutex.RLock()
+	defer rs.mutex.RUnlock()
+	score, ok := rs.published[participantID]
+	return score, ok
+}
+
+// RateCounterparty records a booking party's rating of the other party once
+// the booking is delivered, weighted by the booked amount, and republishes
+// the rated party's reputation
+func (m *Marketplace) RateCounterparty(bookingID, raterID string, score int, comment string) (Rating, error) {
+	if m.Reputation == nil {
+		return Rating{}, errors.New("reputation not configured")
+	}
+
+	m.mutex.RLock()
+	booking, exists := m.bookings[bookingID]
+	weight, currency := 0.0, DefaultCurrency
+	for _, b := range m.bids[booking.QuoteID] {
+		if b.ID == booking.BidID {
+			weight, currency = b.BidAmount, b.Currency
+		}
+	}
+	m.mutex.RUnlock()
+
+	if !exists {
+		return Rating{}, errors.New("booking not found")
+	}
+	if booking.Status != "Delivered" {
+		return Rating{}, errors.New("booking has not been delivered")
+	}
+	// Ratings are weighted by booking value in the default currency
+	if currency != "" && currency != DefaultCurrency {
+		if m.Oracle == nil {
+			return Rating{}, errors.New("oracle required to weight ratings of bookings in " + currency)
+		}
+		converted, err := m.Oracle.ConvertAmount(weight, currency, DefaultCurrency)
+		if err != nil {
+			return Rating{}, err
+		}
+		weight = converted
+	}
+	rating := Rating{BookingID: bookingID, RaterID: raterID, Score: score, Weight: math.Max(weight, 1), Comment: comment}
+	switch raterID {
+	case booking.ShipperID:
+		rating.RateeID = booking.CarrierID
+	case booking.CarrierID:
+		rating.RateeID = booking.ShipperID
+	default:
+		return Rating{}, errors.New("only the booking's shipper and carrier may rate it")
+	}
+
+	rating, err := m.Reputation.addRating(rating)
+	if err != nil {
+		return Rating{}, err
+	}
+	// The rating is stored; a failed publication is retried with the next one
+	if _, err := m.PublishReputation(rating.RateeID); err != nil {
+		log.Printf("Error publishing reputation of %s: %v", rating.RateeID, err)
+	}
+	log.Printf("Booking %s rated %d by %s", bookingID, score, raterID)
+	return rating, nil
+}
+
+// PublishReputation recomputes a participant's reputation from ratings,
+// on-time delivery and disputes lost, and anchors it on chain
+func (m *Marketplace) PublishReputation(participantID string) (ReputationScore, error) {
+	if m.Reputation == nil {
+		return ReputationScore{}, errors.New("reputation not configured")
+	}
+	participant, err := m.GetParticipant(participantID)
+	if err != nil {
+		return ReputationScore{}, err
+	}
+
+	score := ReputationScore{ParticipantID: participantID}
+	ratingScore := 0.5
+	weighted := 0.0
+	for _, rating := range m.Reputation.Received(participantID) {
+		score.Ratings++
+		score.RatedValue += rating.Weight
+		weighted += float64(rating.Score) * rating.Weight
+	}
+	if score.RatedValue > 0 {
+		score.AverageRating = math.Round(weighted/score.RatedValue*100) / 100
+		ratingScore = (weighted/score.RatedValue - minRatingScore) / (maxRatingScore - minRatingScore)
+	}
+	score.RatedValue = roundAmount(score.RatedValue)
+
+	lost := make(map[string]int)
+	if m.Disputes != nil {
+		for _, dispute := range m.Disputes.Disputes() {
+			if dispute.LiableID != "" {
+				lost[dispute.BookingID+"/"+dispute.LiableID]++
+			}
+		}
+	}
+	m.mutex.RLock()
+	for _, booking := range m.bookings {
+		if booking.ShipperID == participantID || booking.CarrierID == participantID {
+			score.Bookings++
+			score.DisputesLost += lost[booking.ID+"/"+participantID]
+		}
+	}
+	arrived, onTime := m.onTimeArrivals()
+	m.mutex.RUnlock()
+	score.ArrivedLegs, score.OnTimeLegs = arrived[participantID], onTime[participantID]
+
+	// Rates are smoothed towards one half like carrier recommendations; only
+	// carriers are measured on delivery
+	disputeScore := math.Max(0, float64(score.Bookings-score.DisputesLost+1)/float64(score.Bookings+2))
+	if participant.Type == Carrier {
+		onTimeScore := float64(score.OnTimeLegs+1) / float64(score.ArrivedLegs+2)
+		score.Score = 0.5*ratingScore + 0.3*onTimeScore + 0.2*disputeScore
+	} else {
+		score.Score = 0.75*ratingScore + 0.25*disputeScore
+	}
+	score.Score = roundMeasure(score.Score)
+	return m.Reputation.publish(score)
+}
+
+// AutoAward books the cheapest bid on a quote from a carrier whose published
+// reputation meets the rule
+func (m *Marketplace) AutoAward(quoteID, shipperID string, rule AwardRule) (Booking, error) {
+	if m.Reputation == nil {
+		return Booking{}, errors.New("reputation not configured")
+	}
+	bids, err := m.NormalizedBids(quoteID)
+	if err != nil {
+		return Booking{}, err
+	}
+	sort.SliceStable(bids, func(i, j int) bool {
+		if bids[i].Amount != bids[j].Amount {
+			return bids[i].Amount < bids[j].Amount
+		}
+		return bids[i].Bid.BidTime.Before(bids[j].Bid.BidTime)
+	})
+	for _, b := range bids {
+		if b.Bid.LegSequence != rule.LegSequence || b.Bid.IsAccepted {
+			continue
+		}
+		if rule.MaxAmount > 0 && b.Amount > rule.MaxAmount {
+			break
+		}
+		if b.Reputation == nil || b.Reputation.Score < rule.MinReputation || b.Reputation.Ratings < rule.MinRatings {
+			continue
+		}
+		return m.ConfirmBooking(quoteID, b.Bid.ID, shipperID)
+	}
+	return Booking{}, errors.New("no bid meets the award rule")
+}
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReputationService_ModerationKeepsRecordsVerifiable(t *testing.T) {
+	rs := NewReputationService(nil)
+	if _, err := rs.addRating(Rating{BookingID: "booking-1", RaterID: "shipper-1", RateeID: "carrier-1", Score: 6}); err == nil {
+		t.Errorf("Expected an out-of-range score to be rejected")
+	}
+	rating, err := rs.addRating(Rating{BookingID: "booking-1", RaterID: "shipper-1", RateeID: "carrier-1", Score: 1, Weight: 1000, Comment: "  abusive remark  "})
+	if err != nil {
+		t.Fatalf("addRating failed: %v", err)
+	}
+	if rating.Comment != "abusive remark" || rating.CommentHash == "" || rating.Hash == "" {
+		t.Errorf("Unexpected rating %+v", rating)
+	}
+	if _, err := rs.addRating(Rating{BookingID: "booking-1", RaterID: "shipper-1", RateeID: "carrier-1", Score: 5}); err == nil {
+		t.Errorf("Expected a second rating of the same booking to be rejected")
+	}
+
+	if _, err := rs.Moderate(rating.ID, true, ""); err == nil {
+		t.Errorf("Expected moderation of an unreported rating to be rejected")
+	}
+	if _, err := rs.Report(rating.ID, "insulting"); err != nil {
+		t.Fatalf("Report failed: %v", err)
+	}
+	moderated, err := rs.Moderate(rating.ID, true, "removed for abuse")
+	if err != nil {
+		t.Fatalf("Moderate failed: %v", err)
+	}
+	if moderated.Status != RatingRemoved || moderated.Comment != "" || moderated.Score != 1 {
+		t.Errorf("Expected the comment withheld and the score kept, got %+v", moderated)
+	}
+	if err := rs.Verify(); err != nil {
+		t.Errorf("Expected moderated ratings to verify: %v", err)
+	}
+
+	// Quietly raising the score breaks the hash
+	edited := rs.ratings[rating.ID]
+	edited.Score = 5
+	rs.ratings[rating.ID] = edited
+	if err := rs.Verify(); err == nil {
+		t.Errorf("Expected an edited rating to fail verification")
+	}
+}
+
+func TestMarketplace_ReputationDrivesBidsAndAutoAward(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Disputes = NewDisputeService()
+	marketplace.Reputation = NewReputationService(marketplace.blockchain)
+	fx := NewMemoryOracleProvider("ecb", nil)
+	fx.Publish(ExchangeRateFeed, "EUR/USD", map[string]float64{"rate": 1.2}, time.Now())
+	marketplace.Oracle = NewOracleIntegration(fx)
+	marketplace.Oracle.SetFXRateProvider(marketplace.Oracle.FeedFXRates())
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	reliable := marketplace.RegisterParticipant("Reliable Trucking", Carrier)
+	unreliable := marketplace.RegisterParticipant("Unreliable Trucking", Carrier)
+
+	departure := time.Now().Add(-72 * time.Hour)
+	newQuote := func() FreightQuote {
+		quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Pallet, []RouteLeg{
+			{Mode: Road, OriginCode: "NLRTM", DestinationCode: "PLWAW", PlannedDeparture: departure, PlannedArrival: departure.Add(24 * time.Hour)},
+		}, 1000.0, "EUR", time.Now().Add(24*time.Hour), CargoDetails{})
+		if err != nil {
+			t.Fatalf("CreateMultimodalQuote failed: %v", err)
+		}
+		return quote
+	}
+	book := func(carrierID string, amount float64) Booking {
+		quote := newQuote()
+		bid, err := marketplace.PlaceBid(quote.ID, carrierID, amount, "")
+		if err != nil {
+			t.Fatalf("PlaceBid failed: %v", err)
+		}
+		booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+		if err != nil {
+			t.Fatalf("ConfirmBooking failed: %v", err)
+		}
+		return booking
+	}
+	deliver := func(booking Booking, arrival time.Time) {
+		if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegDeparted, "", departure); err != nil {
+			t.Fatalf("RecordLegEvent failed: %v", err)
+		}
+		if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegArrived, "", arrival); err != nil {
+			t.Fatalf("RecordLegEvent failed: %v", err)
+		}
+	}
+
+	onTime := book(reliable.ID, 1000.0)
+	if _, err := marketplace.RateCounterparty(onTime.ID, shipper.ID, 5, "on time"); err == nil {
+		t.Errorf("Expected rating before delivery to be rejected")
+	}
+	deliver(onTime, departure.Add(20*time.Hour))
+	if _, err := marketplace.RateCounterparty(onTime.ID, unreliable.ID, 1, ""); err == nil {
+		t.Errorf("Expected a carrier outside the booking not to rate it")
+	}
+	if _, err := marketplace.RateCounterparty(onTime.ID, shipper.ID, 5, "on time"); err != nil {
+		t.Fatalf("RateCounterparty failed: %v", err)
+	}
+	if _, err := marketplace.RateCounterparty(onTime.ID, reliable.ID, 4, "paid promptly"); err != nil {
+		t.Fatalf("RateCounterparty failed: %v", err)
+	}
+
+	late := book(unreliable.ID, 500.0)
+	deliver(late, departure.Add(48*time.Hour))
+	dispute, err := marketplace.Disputes.RaiseDispute(late.ID, shipper.ID, "delivered a day late")
+	if err != nil {
+		t.Fatalf("RaiseDispute failed: %v", err)
+	}
+	if err := marketplace.Disputes.ResolveDispute(dispute.ID, "carrier at fault"); err != nil {
+		t.Fatalf("ResolveDispute failed: %v", err)
+	}
+	if err := marketplace.Disputes.AssignLiability(dispute.ID, unreliable.ID); err != nil {
+		t.Fatalf("AssignLiability failed: %v", err)
+	}
+	if _, err := marketplace.RateCounterparty(late.ID, shipper.ID, 2, "late"); err != nil {
+		t.Fatalf("RateCounterparty failed: %v", err)
+	}
+
+	for participantID, want := range map[string]float64{reliable.ID: 0.833, unreliable.ID: 0.292, shipper.ID: 0.729} {
+		if score, ok := marketplace.Reputation.Published(participantID); !ok || score.Score != want {
+			t.Errorf("Expected %s published at %v, got %+v", participantID, want, score)
+		}
+	}
+	if score, _ := marketplace.Reputation.Published(unreliable.ID); score.DisputesLost != 1 || score.AverageRating != 2 || score.RatedValue != 600 { // EUR 500 in USD
+		t.Errorf("Unexpected unreliable carrier reputation %+v", score)
+	}
+	if err := marketplace.Reputation.Verify(); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	quote := newQuote()
+	if _, err := marketplace.PlaceBid(quote.ID, unreliable.ID, 700.0, ""); err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	preferred, err := marketplace.PlaceBid(quote.ID, reliable.ID, 800.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	bids, err := marketplace.NormalizedBids(quote.ID)
+	if err != nil {
+		t.Fatalf("NormalizedBids failed: %v", err)
+	}
+	for _, b := range bids {
+		if b.Reputation == nil || b.Reputation.ParticipantID != b.Bid.CarrierID {
+			t.Errorf("Expected the carrier's reputation on bid %+v", b)
+		}
+	}
+
+	rule := AwardRule{MinReputation: 0.5, MinRatings: 1, MaxAmount: 750}
+	if _, err := marketplace.AutoAward(quote.ID, shipper.ID, rule); err == nil {
+		t.Errorf("Expected no reputable bid under the maximum amount")
+	}
+	rule.MaxAmount = 0
+	booking, err := marketplace.AutoAward(quote.ID, shipper.ID, rule)
+	if err != nil {
+		t.Fatalf("AutoAward failed: %v", err)
+	}
+	if booking.BidID != preferred.ID || booking.CarrierID != reliable.ID {
+		t.Errorf("Expected the reputable carrier's bid to be awarded, got %+v", booking)
+	}
+}
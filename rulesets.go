@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Names of the upgradeable marketplace rule set contracts
+const (
+	ValidationRulesContract = "validation-rules"
+	FeeRulesContract        = "fee-rules"
+	AuctionRulesContract    = "auction-rules"
+)
+
+// RuleSet is a versioned implementation of marketplace business logic
+type RuleSet interface {
+	Version() string
+}
+
+// ValidationRules decides whether a freight quote may be published
+type ValidationRules interface {
+	RuleSet
+	ValidateQuote(quote FreightQuote, now time.Time) error
+}
+
+// FeeRules calculates platform fees
+type FeeRules interface {
+	RuleSet
+	// BidFee returns the fee for a bid given the base fee and a discount percentage
+	BidFee(baseFee, discountPercent float64) float64
+}
+
+// AuctionRules decides whether a bid may be placed on a quote given the
+// bids already placed. Bids in other currencies are compared in the quote's
+// currency at the rates given, which may be nil when no oracle is configured.
+type AuctionRules interface {
+	RuleSet
+	ValidateBid(quote FreightQuote, bids []FreightBid, bid FreightBid, rates ExchangeRates, now time.Time) error
+}
+
+// ExchangeRates converts between currencies for rule sets that compare bids
+type ExchangeRates interface {
+	// FetchExchangeRate returns how many units of the "to" currency one unit of "from" buys
+	FetchExchangeRate(from, to string) (float64, error)
+}
+
+// quoteAmount returns a bid's amount in the quote's currency
+func quoteAmount(quote FreightQuote, bid FreightBid, rates ExchangeRates) (float64, error) {
+	if bid.Currency == "" || strings.EqualFold(bid.Currency, quote.Currency) {
+		return bid.BidAmount, nil
+	}
+	if rates == nil {
+		return 0, errors.New("oracle required to compare bids in different currencies")
+	}
+	rate, err := rates.FetchExchangeRate(bid.Currency, quote.Currency)
+	if err != nil {
+		return 0, err
+	}
+	return bid.BidAmount * rate, nil
+}
+
+// ValidationRulesV1 requires a positive rate and a future expiry
+type ValidationRulesV1 struct{}
+
+// Version implements RuleSet
+func (ValidationRulesV1) Version() string { return "v1" }
+
+// ValidateQuote implements ValidationRules
+func (ValidationRulesV1) ValidateQuote(quote FreightQuote, now time.Time) error {
+	if quote.Rate <= 0 {
+		return errors.New("rate must be positive")
+	}
+	if quote.ValidUntil.Before(now) {
+		return errors.New("validUntil must be in the future")
+	}
+	return nil
+}
+
+// FeeRulesV1 applies the discount percentage to the base fee
+type FeeRulesV1 struct{}
+
+// Version implements RuleSet
+func (FeeRulesV1) Version() string { return "v1" }
+
+// BidFee implements FeeRules
+func (FeeRulesV1) BidFee(baseFee, discountPercent float64) float64 {
+	return baseFee * (1 - discountPercent/100)
+}
+
+// AuctionRulesV1 accepts any positive bid
+type AuctionRulesV1 struct{}
+
+// Version implements RuleSet
+func (AuctionRulesV1) Version() string { return "v1" }
+
+// ValidateBid implements AuctionRules
+func (AuctionRulesV1) ValidateBid(quote FreightQuote, bids []FreightBid, bid FreightBid, rates ExchangeRates, now time.Time) error {
+	if bid.BidAmount <= 0 {
+		return errors.New("bid amount must be positive")
+	}
+	return nil
+}
+
+// maxQuoteValidity is how long a quote may stay open under ValidationRulesV2
+const maxQuoteValidity = 90 * 24 * time.Hour
+
+// ValidationRulesV2 adds to v1 that a quote moves between two places and
+// stays open at most 90 days
+type ValidationRulesV2 struct{}
+
+// Version implements RuleSet
+func (ValidationRulesV2) Version() string { return "v2" }
+
+// ValidateQuote implements ValidationRules
+func (ValidationRulesV2) ValidateQuote(quote FreightQuote, now time.Time) error {
+	if err := (ValidationRulesV1{}).ValidateQuote(quote, now); err != nil {
+		return err
+	}
+	if quote.OriginCode != "" && strings.EqualFold(quote.OriginCode, quote.DestinationCode) {
+		return errors.New("origin and destination must differ")
+	}
+	if quote.ValidUntil.After(now.Add(maxQuoteValidity)) {
+		return errors.New("validUntil must be within 90 days")
+	}
+	return nil
+}
+
+// maxFeeDiscount caps the fee discount in percent under FeeRulesV2
+const maxFeeDiscount = 50
+
+// FeeRulesV2 caps the discount at 50% so every bid pays at least half the
+// base fee
+type FeeRulesV2 struct{}
+
+// Version implements RuleSet
+func (FeeRulesV2) Version() string { return "v2" }
+
+// BidFee implements FeeRules
+func (FeeRulesV2) BidFee(baseFee, discountPercent float64) float64 {
+	if discountPercent > maxFeeDiscount {
+		discountPercent = maxFeeDiscount
+	}
+	return FeeRulesV1{}.BidFee(baseFee, discountPercent)
+}
+
+// AuctionRulesV2 runs a descending auction: a bid must undercut the lowest
+// bid placed so far, compared in the quote's currency
+type AuctionRulesV2 struct{}
+
+// Version implements RuleSet
+func (AuctionRulesV2) Version() string { return "v2" }
+
+// ValidateBid implements AuctionRules
+func (AuctionRulesV2) ValidateBid(quote FreightQuote, bids []FreightBid, bid FreightBid, rates ExchangeRates, now time.Time) error {
+	if err := (AuctionRulesV1{}).ValidateBid(quote, bids, bid, rates, now); err != nil {
+		return err
+	}
+	amount, err := quoteAmount(quote, bid, rates)
+	if err != nil {
+		return err
+	}
+	for _, placed := range bids {
+		placedAmount, err := quoteAmount(quote, placed, rates)
+		if err != nil {
+			return err
+		}
+		if amount >= placedAmount {
+			return errors.New("bid must undercut the lowest bid")
+		}
+	}
+	return nil
+}
+
+// MarketplaceRules holds the upgradeable rule set contracts the marketplace
+// dispatches validation, fee and auction decisions through
+type MarketplaceRules struct {
+	validation *ProxyContract
+	fees       *ProxyContract
+	auction    *ProxyContract
+}
+
+// NewMarketplaceRules creates rule set contracts running the v1 rules, with
+// the v2 rules registered for upgrade and the given upgrade timelock
+func NewMarketplaceRules(timelock time.Duration) *MarketplaceRules {
+	mr := &MarketplaceRules{
+		validation: NewProxyContract(ValidationRulesContract, "v1", ValidationRulesV1{}, timelock),
+		fees:       NewProxyContract(FeeRulesContract, "v1", FeeRulesV1{}, timelock),
+		auction:    NewProxyContract(AuctionRulesContract, "v1", AuctionRulesV1{}, timelock),
+	}
+	mr.RegisterValidationRules(ValidationRulesV2{})
+	mr.RegisterFeeRules(FeeRulesV2{})
+	mr.RegisterAuctionRules(AuctionRulesV2{})
+	return mr
+}
+
+// SetClock replaces the clock upgrade timelocks are measured against
+func (mr *MarketplaceRules) SetClock(now func() time.Time) {
+	for _, contract := range mr.Contracts() {
+		contract.SetClock(now)
+	}
+}
+
+// Contract returns a rule set contract by name
+func (mr *MarketplaceRules) Contract(name string) (*ProxyContract, error) {
+	for _, contract := range mr.Contracts() {
+		if contract.Name() == name {
+			return contract, nil
+		}
+	}
+	return nil, errors.New("contract not found")
+}
+
+// Contracts lists the rule set contracts by name
+func (mr *MarketplaceRules) Contracts() []*ProxyContract {
+	return []*ProxyContract{mr.auction, mr.fees, mr.validation}
+}
+
+// RegisterValidationRules makes a validation rule set version available for upgrade
+func (mr *MarketplaceRules) RegisterValidationRules(rules ValidationRules) error {
+	return mr.validation.RegisterImplementation(rules.Version(), rules)
+}
+
+// RegisterFeeRules makes a fee rule set version available for upgrade
+func (mr *MarketplaceRules) RegisterFeeRules(rules FeeRules) error {
+	return mr.fees.RegisterImplementation(rules.Version(), rules)
+}
+
+// RegisterAuctionRules makes an auction rule set version available for upgrade
+func (mr *MarketplaceRules) RegisterAuctionRules(rules AuctionRules) error {
+	return mr.auction.RegisterImplementation(rules.Version(), rules)
+}
+
+// Validation returns the active validation rules
+func (mr *MarketplaceRules) Validation() ValidationRules {
+	return mr.validation.Implementation().(ValidationRules)
+}
+
+// Fees returns the active fee rules
+func (mr *MarketplaceRules) Fees() FeeRules {
+	return mr.fees.Implementation().(FeeRules)
+}
+
+// Auction returns the active auction rules
+func (mr *MarketplaceRules) Auction() AuctionRules {
+	return mr.auction.Implementation().(AuctionRules)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/ed25519"
+	"testing"
+	"time"
+)
+
+func TestMarketplaceRules_MultiSigUpgradeWithTimelock(t *testing.T) {
+	msa, keys := newTestMultiSig(t, 2, 0)
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Rules = NewMarketplaceRules(time.Hour)
+	now := time.Now()
+	marketplace.Rules.SetClock(func() time.Time { return now })
+	contract, _ := marketplace.Rules.Contract(AuctionRulesContract)
+
+	proposal, err := msa.Propose("alice", OpContractUpgrade, ContractUpgradePayload{Contract: AuctionRulesContract, Version: "v2"})
+	if err != nil {
+		t.Fatalf("Propose failed: %v", err)
+	}
+	msa.Approve(proposal.ID, "alice", ed25519.Sign(keys["alice"], proposal.Digest))
+	if _, err := contract.ScheduleUpgrade(proposal.ID, "v2", msa); err == nil {
+		t.Errorf("Expected upgrade to be refused below threshold")
+	}
+	msa.Approve(proposal.ID, "bob", ed25519.Sign(keys["bob"], proposal.Digest))
+	if _, err := contract.ScheduleUpgrade(proposal.ID, "v1", msa); err == nil {
+		t.Errorf("Expected upgrade to an unapproved version to be refused")
+	}
+	pending, err := contract.ScheduleUpgrade(proposal.ID, "v2", msa)
+	if err != nil {
+		t.Fatalf("ScheduleUpgrade failed: %v", err)
+	}
+	// v1 stays active until the timelock expires
+	if _, err := contract.ApplyUpgrade(); err == nil {
+		t.Errorf("Expected error applying upgrade before timelock")
+	}
+
+	shipper := marketplace.RegisterParticipant("Shipper1", Shipper)
+	quote, _ := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	carrier := marketplace.RegisterParticipant("Carrier1", Carrier)
+	marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 950.0, ""); err != nil {
+		t.Errorf("Expected v1 rules to accept a higher bid: %v", err)
+	}
+
+	now = pending.ETA
+	if _, err := contract.ApplyUpgrade(); err != nil {
+		t.Fatalf("ApplyUpgrade failed: %v", err)
+	}
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 950.0, ""); err == nil {
+		t.Errorf("Expected v2 rules to reject a bid above the lowest")
+	}
+	if _, err := marketplace.PlaceBid(quote.ID, carrier.ID, 850.0, ""); err != nil {
+		t.Errorf("Expected v2 rules to accept an undercutting bid: %v", err)
+	}
+
+	history := contract.History()
+	if len(history) != 2 || history[1].Version != "v2" || history[1].ProposalID != proposal.ID {
+		t.Errorf("Unexpected version history: %+v", history)
+	}
+}
+
+func TestMarketplaceRules_GovernanceUpgrade(t *testing.T) {
+	governance := NewGovernance(NewBlockchain(), nil, nil)
+	rules := NewMarketplaceRules(0)
+	contract, _ := rules.Contract(AuctionRulesContract)
+
+	upgrade := ContractUpgradePayload{Contract: AuctionRulesContract, Version: "v2"}
+	proposal, err := governance.ProposeUpgrade("p1", upgrade)
+	if err != nil {
+		t.Fatalf("ProposeUpgrade failed: %v", err)
+	}
+	if _, err := contract.ScheduleUpgrade(proposal.ID, "v2", governance); err == nil {
+		t.Errorf("Expected pending proposal to be refused")
+	}
+	for _, voter := range []string{"p1", "p2", "p3"} {
+		if err := governance.VoteProposal(proposal.ID, voter, true); err != nil {
+			t.Fatalf("VoteProposal failed: %v", err)
+		}
+	}
+	if _, err := contract.ScheduleUpgrade(proposal.ID, "v2", governance); err != nil {
+		t.Fatalf("ScheduleUpgrade failed: %v", err)
+	}
+	if _, err := contract.ApplyUpgrade(); err != nil {
+		t.Fatalf("ApplyUpgrade failed: %v", err)
+	}
+	if rules.Auction().Version() != "v2" {
+		t.Errorf("Expected auction rules v2, got %s", rules.Auction().Version())
+	}
+	if err := governance.AuthorizeUpgrade(proposal.ID, upgrade); err == nil {
+		t.Errorf("Expected proposal to authorize only one upgrade")
+	}
+}
+
+func TestMarketplaceRules_CancelUpgrade(t *testing.T) {
+	rules := NewMarketplaceRules(time.Hour)
+	now := time.Now()
+	rules.SetClock(func() time.Time { return now })
+	contract, _ := rules.Contract(FeeRulesContract)
+	governance := NewGovernance(NewBlockchain(), nil, nil)
+	proposal, _ := governance.ProposeUpgrade("p1", ContractUpgradePayload{Contract: FeeRulesContract, Version: "v2"})
+	for _, voter := range []string{"p1", "p2", "p3"} {
+		governance.VoteProposal(proposal.ID, voter, true)
+	}
+	if _, err := contract.ScheduleUpgrade(proposal.ID, "v2", governance); err != nil {
+		t.Fatalf("ScheduleUpgrade failed: %v", err)
+	}
+
+	cancelled, err := contract.CancelUpgrade()
+	if err != nil || cancelled.Version != "v2" {
+		t.Fatalf("CancelUpgrade failed: %+v (%v)", cancelled, err)
+	}
+	now = now.Add(2 * time.Hour)
+	if _, err := contract.ApplyUpgrade(); err == nil {
+		t.Errorf("Expected a cancelled upgrade not to apply")
+	}
+	if rules.Fees().Version() != "v1" {
+		t.Errorf("Expected fee rules to stay on v1, got %s", rules.Fees().Version())
+	}
+	if _, err := contract.CancelUpgrade(); err == nil {
+		t.Errorf("Expected nothing left to cancel")
+	}
+}
+
+func TestRuleSetsV2(t *testing.T) {
+	now := time.Now()
+	quote := FreightQuote{Rate: 100, OriginCode: "NLRTM", DestinationCode: "nlrtm", ValidUntil: now.Add(time.Hour)}
+	if err := (ValidationRulesV2{}).ValidateQuote(quote, now); err == nil {
+		t.Errorf("Expected a quote to the same place to be rejected")
+	}
+	quote.DestinationCode = "CNSHA"
+	quote.ValidUntil = now.Add(120 * 24 * time.Hour)
+	if err := (ValidationRulesV2{}).ValidateQuote(quote, now); err == nil {
+		t.Errorf("Expected a quote open beyond 90 days to be rejected")
+	}
+	quote.ValidUntil = now.Add(30 * 24 * time.Hour)
+	if err := (ValidationRulesV2{}).ValidateQuote(quote, now); err != nil {
+		t.Errorf("Expected a valid quote to pass: %v", err)
+	}
+	if fee := (FeeRulesV2{}).BidFee(10, 80); fee != 5 {
+		t.Errorf("Expected the discount capped at 50%%, got %v", fee)
+	}
+
+	// 450 EUR is 900 USD, so an 850 USD bid undercuts it and a 950 USD bid does not
+	rates := NewOracleIntegration()
+	rates.SetFXRateProvider(NewStaticFXRateProvider("USD", map[string]float64{"EUR": 0.5}))
+	quote.Currency = "USD"
+	placed := []FreightBid{{BidAmount: 450, Currency: "EUR"}}
+	if err := (AuctionRulesV2{}).ValidateBid(quote, placed, FreightBid{BidAmount: 950, Currency: "USD"}, rates, now); err == nil {
+		t.Errorf("Expected a bid above the converted lowest bid to be rejected")
+	}
+	if err := (AuctionRulesV2{}).ValidateBid(quote, placed, FreightBid{BidAmount: 850, Currency: "USD"}, rates, now); err != nil {
+		t.Errorf("Expected a bid under the converted lowest bid to pass: %v", err)
+	}
+	if err := (AuctionRulesV2{}).ValidateBid(quote, placed, FreightBid{BidAmount: 850, Currency: "USD"}, nil, now); err == nil {
+		t.Errorf("Expected bids in other currencies to need exchange rates")
+	}
+}
@@ -0,0 +1,630 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/google/uuid"
+)
+
+// Names of the restricted-party lists the loaders produce
+const (
+	ListOFACSDN        = "OFAC-SDN"
+	ListEUConsolidated = "EU-CONSOLIDATED"
+)
+
+// Default name match scores at which a screening is flagged for review or
+// treated as a likely match
+const (
+	defaultFlagThreshold  = 0.88
+	defaultBlockThreshold = 0.97
+)
+
+// RestrictedParty is an entry on a sanctions or denied-party list
+type RestrictedParty struct {
+	List      string
+	EntryID   string
+	Names     []string // primary name first, then aliases
+	Countries []string // ISO 3166-1 alpha-2 where known, otherwise upper case names
+	Programs  []string
+}
+
+// ScreeningDecision is the outcome of screening a party
+type ScreeningDecision string
+
+const (
+	ScreeningClear   ScreeningDecision = "Clear"
+	ScreeningFlagged ScreeningDecision = "Flagged" // possible match held for review
+	ScreeningBlocked ScreeningDecision = "Blocked" // likely or confirmed match
+)
+
+// ScreeningReviewStatus tracks manual review of a flagged or blocked screening
+type ScreeningReviewStatus string
+
+const (
+	ReviewNotRequired ScreeningReviewStatus = ""
+	ReviewPending     ScreeningReviewStatus = "Pending"
+	ReviewCleared     ScreeningReviewStatus = "Cleared"   // false positive
+	ReviewConfirmed   ScreeningReviewStatus = "Confirmed" // true match
+)
+
+// ScreeningHit is a list entry that matched a screened party
+type ScreeningHit struct {
+	List        string   `json:"list"`
+	EntryID     string   `json:"entry_id"`
+	MatchedName string   `json:"matched_name"`
+	Score       float64  `json:"score"`
+	Countries   []string `json:"countries,omitempty"`
+}
+
+// ScreeningResult records one screening of a participant
+type ScreeningResult struct {
+	ID            string                `json:"id"`
+	ParticipantID string                `json:"participant_id"`
+	BookingRef    string                `json:"booking_ref,omitempty"` // quote the booking was for
+	Name          string                `json:"name"`
+	Country       string                `json:"country,omitempty"`
+	Hits          []ScreeningHit        `json:"hits"`
+	Decision      ScreeningDecision     `json:"decision"`
+	Review        ScreeningReviewStatus `json:"review,omitempty"`
+	ReviewedBy    string                `json:"reviewed_by,omitempty"`
+	ReviewNote    string                `json:"review_note,omitempty"`
+	ScreenedAt    time.Time             `json:"screened_at"`
+}
+
+// ScreeningService screens participants against restricted-party lists and
+// queues possible matches for review
+type ScreeningService struct {
+	compliance     *ComplianceLog
+	flagThreshold  float64
+	blockThreshold float64
+
+	lists          map[string][]RestrictedParty // list name -> entries
+	results        map[string]*ScreeningResult
+	falsePositives map[string]bool // participantID|list|entryID cleared by review
+	confirmed      map[string]bool // participantIDs confirmed as listed
+	mutex          sync.RWMutex
+}
+
+// NewScreeningService creates a ScreeningService. Zero thresholds use the
+// defaults; results are recorded in compliance when it is not nil.
+func NewScreeningService(compliance *ComplianceLog, flagThreshold, blockThreshold float64) *ScreeningService {
+	if flagThreshold <= 0 {
+		flagThreshold = defaultFlagThreshold
+	}
+	if blockThreshold <= 0 {
+		blockThreshold = defaultBlockThreshold
+	}
+	return &ScreeningService{
+		compliance:     compliance,
+		flagThreshold:  flagThreshold,
+		blockThreshold: blockThreshold,
+		lists:          make(map[string][]RestrictedParty),
+		results:        make(map[string]*ScreeningResult),
+		falsePositives: make(map[string]bool),
+		confirmed:      make(map[string]bool),
+	}
+}
+
+// LoadList replaces the entries of a restricted-party list
+func (ss *ScreeningService) LoadList(name string, parties []RestrictedParty) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.lists[name] = parties
+	log.Printf("Loaded %d entries for restricted-party list %s", len(parties), name)
+}
+
+// Screen checks a participant's name and country against every loaded list.
+// Hits cleared as false positives for the participant are ignored.
+func (ss *ScreeningService) Screen(participantID, name, country, bookingRef string) (ScreeningResult, error) {
+	if strings.TrimSpace(name) == "" {
+		return ScreeningResult{}, errors.New("name is required for screening")
+	}
+	country = normalizeCountry(country)
+
+	// Lists are scanned under the read lock so screenings run concurrently
+	ss.mutex.RLock()
+	hits := ss.scan(participantID, name, country)
+	ss.mutex.RUnlock()
+
+	ss.mutex.Lock()
+	result := &ScreeningResult{
+		ID:            uuid.New().String(),
+		ParticipantID: participantID,
+		BookingRef:    bookingRef,
+		Name:          name,
+		Country:       country,
+		Hits:          []ScreeningHit{},
+		Decision:      ScreeningClear,
+		ScreenedAt:    time.Now(),
+	}
+	// Hits may have been cleared by a review since the scan
+	best := 0.0
+	for _, hit := range hits {
+		if ss.falsePositives[falsePositiveKey(participantID, hit.List, hit.EntryID)] {
+			continue
+		}
+		result.Hits = append(result.Hits, hit)
+		if hit.Score > best {
+			best = hit.Score
+		}
+	}
+	switch {
+	case ss.confirmed[participantID] || best >= ss.blockThreshold:
+		result.Decision = ScreeningBlocked
+	case len(result.Hits) > 0:
+		result.Decision = ScreeningFlagged
+	}
+	if result.Decision != ScreeningClear && !ss.confirmed[participantID] {
+		result.Review = ReviewPending
+		// A retried booking reuses the open review covering the same entries,
+		// which takes this screening's hits and decision
+		if open := ss.openReview(participantID, result.Hits); open != nil {
+			open.Hits = result.Hits
+			open.Decision = result.Decision
+			result = open
+		}
+	}
+	ss.results[result.ID] = result
+	snapshot := *result
+	ss.mutex.Unlock()
+
+	if err := ss.record(snapshot, ""); err != nil {
+		return ScreeningResult{}, err
+	}
+	return snapshot, nil
+}
+
+// scan returns the hits for a name and country across every loaded list,
+// strongest first, skipping hits cleared for the participant. Must be called
+// with the mutex held for reading.
+func (ss *ScreeningService) scan(participantID, name, country string) []ScreeningHit {
+	hits := []ScreeningHit{}
+	for listName, parties := range ss.lists {
+		for _, party := range parties {
+			if ss.falsePositives[falsePositiveKey(participantID, listName, party.EntryID)] {
+				continue
+			}
+			if hit, ok := ss.match(name, country, party); ok {
+				hits = append(hits, hit)
+			}
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool { return hits[i].Score > hits[j].Score })
+	return hits
+}
+
+// openReview returns a pending review of a participant that covers every hit,
+// or nil. Must be called with the mutex held.
+func (ss *ScreeningService) openReview(participantID string, hits []ScreeningHit) *ScreeningResult {
+	for _, result := range ss.results {
+		if result.ParticipantID != participantID || result.Review != ReviewPending {
+			continue
+		}
+		covered := true
+		for _, hit := range hits {
+			found := false
+			for _, open := range result.Hits {
+				found = found || (open.List == hit.List && open.EntryID == hit.EntryID)
+			}
+			covered = covered && found
+		}
+		if covered {
+			return result
+		}
+	}
+	return nil
+}
+
+// match scores a name against a list entry. Must be called with the mutex
+// held for reading.
+func (ss *ScreeningService) match(name, country string, party RestrictedParty) (ScreeningHit, bool) {
+	hit := ScreeningHit{List: party.List, EntryID: party.EntryID, Countries: party.Countries}
+	for _, candidate := range party.Names {
+		if score := nameMatchScore(name, candidate); score > hit.Score {
+			hit.Score = score
+			hit.MatchedName = candidate
+		}
+	}
+	// A known country that differs lowers confidence; a match raises it.
+	// Countries are only compared as different once both sides are ISO codes.
+	if country != "" && len(party.Countries) > 0 {
+		sameCountry := false
+		resolved := isCountryCode(country)
+		for _, c := range party.Countries {
+			sameCountry = sameCountry || c == country
+			resolved = resolved && isCountryCode(c)
+		}
+		if sameCountry {
+			hit.Score = minFloat(1, hit.Score+0.03)
+		} else if resolved {
+			hit.Score -= 0.05
+		}
+	}
+	return hit, hit.Score >= ss.flagThreshold
+}
+
+// PendingReviews lists screenings awaiting review, oldest first
+func (ss *ScreeningService) PendingReviews() []ScreeningResult {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	pending := []ScreeningResult{}
+	for _, result := range ss.results {
+		if result.Review == ReviewPending {
+			pending = append(pending, *result)
+		}
+	}
+	sort.Slice(pending, func(i, j int) bool { return pending[i].ScreenedAt.Before(pending[j].ScreenedAt) })
+	return pending
+}
+
+// GetResult retrieves a screening result
+func (ss *ScreeningService) GetResult(resultID string) (ScreeningResult, error) {
+	ss.mutex.RLock()
+	defer ss.mutex.RUnlock()
+	result, exists := ss.results[resultID]
+	if !exists {
+		return ScreeningResult{}, errors.New("screening result not found")
+	}
+	return *result, nil
+}
+
+// Review resolves a pending screening. A false positive clears its hits for
+// the participant in future screenings; otherwise the participant stays blocked.
+func (ss *ScreeningService) Review(resultID, reviewerID string, falsePositive bool, note string) (ScreeningResult, error) {
+	ss.mutex.Lock()
+	result, exists := ss.results[resultID]
+	if !exists {
+		ss.mutex.Unlock()
+		return ScreeningResult{}, errors.New("screening result not found")
+	}
+	if result.Review != ReviewPending {
+		ss.mutex.Unlock()
+		return ScreeningResult{}, errors.New("screening is not pending review")
+	}
+	result.ReviewedBy = reviewerID
+	result.ReviewNote = note
+	if falsePositive {
+		result.Review = ReviewCleared
+		result.Decision = ScreeningClear
+		for _, hit := range result.Hits {
+			ss.falsePositives[falsePositiveKey(result.ParticipantID, hit.List, hit.EntryID)] = true
+		}
+	} else {
+		result.Review = ReviewConfirmed
+		result.Decision = ScreeningBlocked
+		ss.confirmed[result.ParticipantID] = true
+	}
+	snapshot := *result
+	ss.mutex.Unlock()
+
+	if err := ss.record(snapshot, reviewerID); err != nil {
+		return ScreeningResult{}, err
+	}
+	return snapshot, nil
+}
+
+// record writes a screening outcome to the compliance log
+func (ss *ScreeningService) record(result ScreeningResult, reviewerID string) error {
+	if ss.compliance == nil {
+		return nil
+	}
+	details := fmt.Sprintf("%s screened: %s, %d hits", result.Name, result.Decision, len(result.Hits))
+	if len(result.Hits) > 0 {
+		top := result.Hits[0]
+		details += fmt.Sprintf(", best %s %s %q (%.2f)", top.List, top.EntryID, top.MatchedName, top.Score)
+	}
+	if result.BookingRef != "" {
+		details += ", for booking on quote " + result.BookingRef
+	}
+	recordedBy := "screening"
+	if reviewerID != "" {
+		details += fmt.Sprintf(", review %s: %s", result.Review, result.ReviewNote)
+		recordedBy = reviewerID
+	}
+	_, err := ss.compliance.Record(ComplianceSanctionsScreened, result.ParticipantID, "", details, recordedBy)
+	return err
+}
+
+// falsePositiveKey identifies a cleared hit for one participant
+func falsePositiveKey(participantID, list, entryID string) string {
+	return participantID + "|" + list + "|" + entryID
+}
+
+// legalSuffixes are dropped before names are compared
+var legalSuffixes = map[string]bool{
+	"LTD": true, "LIMITED": true, "LLC": true, "INC": true, "CORP": true, "CORPORATION": true,
+	"CO": true, "COMPANY": true, "GMBH": true, "SA": true, "SAS": true, "SRL": true, "BV": true,
+	"NV": true, "AG": true, "PLC": true, "JSC": true, "OOO": true, "PJSC": true, "LLP": true,
+	"THE": true, "AND": true, "OF": true,
+}
+
+// nameTokens upper-cases a name, strips punctuation and legal suffixes and
+// returns its words
+func nameTokens(name string) []string {
+	fields := strings.FieldsFunc(strings.ToUpper(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+	tokens := []string{}
+	for _, f := range fields {
+		if !legalSuffixes[f] {
+			tokens = append(tokens, f)
+		}
+	}
+	return tokens
+}
+
+// nameMatchScore compares two names in [0,1], ignoring word order,
+// punctuation, case and legal suffixes
+func nameMatchScore(a, b string) float64 {
+	ta, tb := nameTokens(a), nameTokens(b)
+	if len(ta) == 0 || len(tb) == 0 {
+		return 0
+	}
+	score := jaroWinkler(strings.Join(ta, " "), strings.Join(tb, " "))
+	sort.Strings(ta)
+	sort.Strings(tb)
+	if sorted := jaroWinkler(strings.Join(ta, " "), strings.Join(tb, " ")); sorted > score {
+		score = sorted
+	}
+	return score
+}
+
+// jaroWinkler returns the Jaro-Winkler similarity of two strings
+func jaroWinkler(a, b string) float64 {
+	ra, rb := []rune(a), []rune(b)
+	if len(ra) == 0 || len(rb) == 0 {
+		return 0
+	}
+	window := len(ra)
+	if len(rb) > window {
+		window = len(rb)
+	}
+	window = window/2 - 1
+	if window < 0 {
+		window = 0
+	}
+	matchedA := make([]bool, len(ra))
+	matchedB := make([]bool, len(rb))
+	matches := 0
+	for i := range ra {
+		lo, hi := i-window, i+window+1
+		if lo < 0 {
+			lo = 0
+		}
+		if hi > len(rb) {
+			hi = len(rb)
+		}
+		for j := lo; j < hi; j++ {
+			if !matchedB[j] && ra[i] == rb[j] {
+				matchedA[i], matchedB[j] = true, true
+				matches++
+				break
+			}
+		}
+	}
+	if matches == 0 {
+		return 0
+	}
+	transpositions := 0
+	j := 0
+	for i := range ra {
+		if !matchedA[i] {
+			continue
+		}
+		for !matchedB[j] {
+			j++
+		}
+		if ra[i] != rb[j] {
+			transpositions++
+		}
+		j++
+	}
+	m := float64(matches)
+	jaro := (m/float64(len(ra)) + m/float64(len(rb)) + (m-float64(transpositions)/2)/m) / 3
+
+	prefix := 0
+	for prefix < 4 && prefix < len(ra) && prefix < len(rb) && ra[prefix] == rb[prefix] {
+		prefix++
+	}
+	return jaro + float64(prefix)*0.1*(1-jaro)
+}
+
+// countryCodes maps country names used by list publishers to ISO 3166-1
+// alpha-2 codes
+var countryCodes = map[string]string{
+	"AFGHANISTAN": "AF", "BELARUS": "BY", "BURMA": "MM", "MYANMAR": "MM", "CHINA": "CN",
+	"CUBA": "CU", "HONG KONG": "HK", "INDIA": "IN", "IRAN": "IR", "IRAQ": "IQ",
+	"KOREA, NORTH": "KP", "NORTH KOREA": "KP", "LEBANON": "LB", "LIBYA": "LY", "MALI": "ML",
+	"NICARAGUA": "NI", "PAKISTAN": "PK", "RUSSIA": "RU", "SOMALIA": "SO", "SOUTH SUDAN": "SS",
+	"SUDAN": "SD", "SYRIA": "SY", "TURKEY": "TR", "UKRAINE": "UA", "UNITED ARAB EMIRATES": "AE",
+	"VENEZUELA": "VE", "YEMEN": "YE", "ZIMBABWE": "ZW", "GERMANY": "DE", "FRANCE": "FR",
+	"UNITED KINGDOM": "GB", "UNITED STATES": "US", "NETHERLANDS": "NL", "SINGAPORE": "SG",
+	"PANAMA": "PA", "CYPRUS": "CY", "MALAYSIA": "MY",
+}
+
+// normalizeCountry returns an ISO alpha-2 code where one is known,
+// otherwise the upper case name
+func normalizeCountry(country string) string {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	if code, ok := countryCodes[country]; ok {
+		return code
+	}
+	return country
+}
+
+// ofacField converts the OFAC "-0-" null marker to an empty string
+func ofacField(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "-0-" {
+		return ""
+	}
+	return value
+}
+
+// readCSVRecords reads every record of a CSV file
+func readCSVRecords(path string, comma rune) ([][]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	records, err := parseCSV(f, comma)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return records, nil
+}
+
+// LoadOFACSDN loads the OFAC SDN list from a directory holding the published
+// legacy CSV files: sdn.csv (required), add.csv and alt.csv (optional)
+func LoadOFACSDN(dir string) ([]RestrictedParty, error) {
+	sdn, err := readCSVRecords(filepath.Join(dir, "sdn.csv"), ',')
+	if err != nil {
+		return nil, err
+	}
+	parties := []RestrictedParty{}
+	byID := make(map[string]int)
+	sdnTypes := make(map[string]string) // entry -> SDN type, for aliases
+	for _, row := range sdn {
+		if len(row) < 4 || ofacField(row[0]) == "" || ofacField(row[1]) == "" {
+			continue
+		}
+		party := RestrictedParty{List: ListOFACSDN, EntryID: ofacField(row[0])}
+		party.Names = ofacNames(ofacField(row[1]), ofacField(row[2]))
+		if program := ofacField(row[3]); program != "" {
+			party.Programs = strings.Split(program, "] [")
+		}
+		byID[party.EntryID] = len(parties)
+		sdnTypes[party.EntryID] = ofacField(row[2])
+		parties = append(parties, party)
+	}
+
+	// add.csv: ent_num, add_num, address, city/state/postal, country, remarks
+	if rows, err := readCSVRecords(filepath.Join(dir, "add.csv"), ','); err == nil {
+		for _, row := range rows {
+			if len(row) < 5 {
+				continue
+			}
+			if i, ok := byID[ofacField(row[0])]; ok {
+				if country := ofacField(row[4]); country != "" {
+					parties[i].Countries = appendUnique(parties[i].Countries, normalizeCountry(country))
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	// alt.csv: ent_num, alt_num, alt_type, alt_name, remarks
+	if rows, err := readCSVRecords(filepath.Join(dir, "alt.csv"), ','); err == nil {
+		for _, row := range rows {
+			if len(row) < 4 {
+				continue
+			}
+			if i, ok := byID[ofacField(row[0])]; ok {
+				if alias := ofacField(row[3]); alias != "" {
+					parties[i].Names = append(parties[i].Names, ofacNames(alias, sdnTypes[parties[i].EntryID])...)
+				}
+			}
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, err
+	}
+	return parties, nil
+}
+
+// ofacNames returns an OFAC name, adding "First LAST" for individuals
+// published as "LAST, First"
+func ofacNames(name, sdnType string) []string {
+	names := []string{name}
+	if strings.EqualFold(sdnType, "individual") {
+		if parts := strings.SplitN(name, ", ", 2); len(parts) == 2 {
+			names = append(names, parts[1]+" "+parts[0])
+		}
+	}
+	return names
+}
+
+// LoadEUConsolidated loads the EU consolidated financial sanctions list from
+// its published semicolon separated CSV file. Rows are grouped by entity.
+func LoadEUConsolidated(path string) ([]RestrictedParty, error) {
+	rows, err := readCSVRecords(path, ';')
+	if err != nil {
+		return nil, err
+	}
+	if len(rows) == 0 {
+		return nil, errors.New("empty EU consolidated list")
+	}
+	column := make(map[string]int)
+	for i, name := range rows[0] {
+		column[strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))] = i
+	}
+	field := func(row []string, names ...string) string {
+		for _, name := range names {
+			if i, ok := column[strings.ToLower(name)]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+		}
+		return ""
+	}
+	if _, ok := column["entity_logicalid"]; !ok {
+		return nil, errors.New("EU consolidated list is missing Entity_LogicalId column")
+	}
+	if _, ok := column["namealias_wholename"]; !ok {
+		return nil, errors.New("EU consolidated list is missing NameAlias_WholeName column")
+	}
+
+	parties := []RestrictedParty{}
+	byID := make(map[string]int)
+	for _, row := range rows[1:] {
+		id := field(row, "Entity_LogicalId")
+		if id == "" {
+			continue
+		}
+		i, ok := byID[id]
+		if !ok {
+			i = len(parties)
+			byID[id] = i
+			parties = append(parties, RestrictedParty{List: ListEUConsolidated, EntryID: id})
+		}
+		if name := field(row, "NameAlias_WholeName"); name != "" {
+			parties[i].Names = appendUnique(parties[i].Names, name)
+		}
+		for _, country := range []string{field(row, "Address_CountryIso2Code"), field(row, "Citizenship_CountryIso2Code")} {
+			if country != "" && country != "00" {
+				parties[i].Countries = appendUnique(parties[i].Countries, normalizeCountry(country))
+			}
+		}
+		if programme := field(row, "Entity_Regulation_Programme"); programme != "" {
+			parties[i].Programs = appendUnique(parties[i].Programs, programme)
+		}
+	}
+	return parties, nil
+}
+
+// appendUnique appends value unless already present
+func appendUnique(values []string, value string) []string {
+	for _, v := range values {
+		if v == value {
+			return values
+		}
+	}
+	return append(values, value)
+}
+
+// minFloat returns the smaller of two values
+func minFloat(a, b float64) float64 {
+	if a < b {
+		return a
+	}
+	return b
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeScreeningFile(t *testing.T, dir, name, content string) string {
+	path := filepath.Join(dir, name)
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("WriteFile failed: %v", err)
+	}
+	return path
+}
+
+func TestScreeningLoaders(t *testing.T) {
+	dir := t.TempDir()
+	writeScreeningFile(t, dir, "sdn.csv", strings.Join([]string{
+		`36,"AEROCARIBBEAN AIRLINES",-0- ,"CUBA",-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- `,
+		`2674,"ABDUL, Hamid","individual","SDGT",-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- ,-0- `,
+	}, "\n"))
+	writeScreeningFile(t, dir, "add.csv", `36,25,-0- ,"Havana","Cuba",-0- `)
+	writeScreeningFile(t, dir, "alt.csv", strings.Join([]string{
+		`36,12,"aka","AERO-CARIBBEAN",-0- `,
+		`36,13,"aka","CARIBBEAN, AERO",-0- `,
+		`2674,14,"aka","ABDEL, Hamid",-0- `,
+	}, "\n"))
+
+	sdn, err := LoadOFACSDN(dir)
+	if err != nil {
+		t.Fatalf("LoadOFACSDN failed: %v", err)
+	}
+	if len(sdn) != 2 || sdn[0].EntryID != "36" || len(sdn[0].Names) != 3 || sdn[0].Countries[0] != "CU" {
+		t.Errorf("Unexpected SDN entries: %+v", sdn)
+	}
+	if names := sdn[1].Names; len(names) != 4 || names[1] != "Hamid ABDUL" || names[3] != "Hamid ABDEL" {
+		t.Errorf("Expected reordered individual names and aliases, got %v", names)
+	}
+
+	eu := writeScreeningFile(t, dir, "eu.csv", strings.Join([]string{
+		"\ufeffFileGenerationDate;Entity_LogicalId;Entity_Regulation_Programme;NameAlias_WholeName;Address_CountryIso2Code;Citizenship_CountryIso2Code",
+		"28/10/2022;13;SYR;Syrian Shipping Lines;SY;",
+		"28/10/2022;13;SYR;SSL;;",
+		"28/10/2022;14;RUS;Ivan Petrov;;RU",
+	}, "\n"))
+	parties, err := LoadEUConsolidated(eu)
+	if err != nil {
+		t.Fatalf("LoadEUConsolidated failed: %v", err)
+	}
+	if len(parties) != 2 || len(parties[0].Names) != 2 || parties[0].Countries[0] != "SY" || parties[1].Countries[0] != "RU" {
+		t.Errorf("Unexpected EU entries: %+v", parties)
+	}
+
+	bad := writeScreeningFile(t, dir, "bad.csv", "Id;Name\n1;Someone\n")
+	if _, err := LoadEUConsolidated(bad); err == nil {
+		t.Errorf("Expected error for a file without EU columns")
+	}
+}
+
+func TestNameMatchScore(t *testing.T) {
+	if score := nameMatchScore("Acme Trading Co., Ltd.", "ACME TRADING COMPANY LIMITED"); score < 0.99 {
+		t.Errorf("Expected legal suffixes and punctuation to be ignored, got %.2f", score)
+	}
+	if score := nameMatchScore("Petrov Ivan", "Ivan Petrov"); score < 0.99 {
+		t.Errorf("Expected word order to be ignored, got %.2f", score)
+	}
+	if score := nameMatchScore("Syrian Shiping Line", "Syrian Shipping Lines"); score < 0.9 || score >= 1 {
+		t.Errorf("Expected a close but inexact match, got %.2f", score)
+	}
+	if score := nameMatchScore("Blue Ocean Freight", "Ivan Petrov"); score > 0.7 {
+		t.Errorf("Expected unrelated names to score low, got %.2f", score)
+	}
+}
+
+func TestScreening_CountryPenaltyNeedsResolvedCountries(t *testing.T) {
+	ss := NewScreeningService(nil, 0, 0)
+	party := RestrictedParty{List: ListEUConsolidated, EntryID: "13", Names: []string{"Syrian Shipping Lines"}, Countries: []string{"SY"}}
+
+	unresolved, _ := ss.match("Syrian Shipping Lines", normalizeCountry("Atlantis"), party)
+	resolved, _ := ss.match("Syrian Shipping Lines", normalizeCountry("Germany"), party)
+	if unresolved.Score != 1 {
+		t.Errorf("Expected no penalty for an unresolved country, got %.2f", unresolved.Score)
+	}
+	if resolved.Score >= 1 {
+		t.Errorf("Expected a penalty for a different ISO country, got %.2f", resolved.Score)
+	}
+}
+
+func TestScreening_BookingRetriesReuseOpenReview(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Screening = NewScreeningService(nil, 0, 0)
+	marketplace.Screening.LoadList(ListEUConsolidated, []RestrictedParty{
+		{List: ListEUConsolidated, EntryID: "20", Names: []string{"Blue Ocean Freight Services"}, Countries: []string{"IR"}},
+	})
+	shipper := marketplace.RegisterParticipant("Good Shipper", Shipper)
+	similar := marketplace.RegisterParticipant("Blue Ocean Freight Solutions", Carrier)
+	quote, _ := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	bid, _ := marketplace.PlaceBid(quote.ID, similar.ID, 950.0, "")
+
+	for i := 0; i < 3; i++ {
+		if _, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID); err == nil {
+			t.Fatalf("Expected booking to be held")
+		}
+	}
+	if pending := marketplace.Screening.PendingReviews(); len(pending) != 1 {
+		t.Errorf("Expected one pending review across retries, got %d", len(pending))
+	}
+}
+
+func TestScreening_ReusedReviewTakesNewDecision(t *testing.T) {
+	ss := NewScreeningService(nil, 0, 0)
+	ss.LoadList(ListEUConsolidated, []RestrictedParty{
+		{List: ListEUConsolidated, EntryID: "20", Names: []string{"Blue Ocean Freight Services"}},
+	})
+	flagged, err := ss.Screen("p1", "Blue Ocean Freight Solutions", "", "")
+	if err != nil || flagged.Decision != ScreeningFlagged {
+		t.Fatalf("Expected a flagged screening, got %+v (%v)", flagged, err)
+	}
+
+	// The entry is amended to the participant's exact name
+	ss.LoadList(ListEUConsolidated, []RestrictedParty{
+		{List: ListEUConsolidated, EntryID: "20", Names: []string{"Blue Ocean Freight Solutions"}},
+	})
+	again, err := ss.Screen("p1", "Blue Ocean Freight Solutions", "", "")
+	if err != nil {
+		t.Fatalf("Screen failed: %v", err)
+	}
+	if again.ID != flagged.ID || again.Decision != ScreeningBlocked {
+		t.Errorf("Expected the open review to be reused and blocked, got %+v", again)
+	}
+	if stored, _ := ss.GetResult(flagged.ID); stored.Decision != ScreeningBlocked || stored.Hits[0].Score != 1 {
+		t.Errorf("Expected the stored review re-evaluated, got %+v", stored)
+	}
+}
+
+func TestScreening_BlocksBookingsAndReviewsFalsePositives(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Compliance = NewComplianceLog(nil)
+	marketplace.Screening = NewScreeningService(marketplace.Compliance, 0, 0)
+	marketplace.Screening.LoadList(ListEUConsolidated, []RestrictedParty{
+		{List: ListEUConsolidated, EntryID: "13", Names: []string{"Syrian Shipping Lines"}, Countries: []string{"SY"}},
+		{List: ListEUConsolidated, EntryID: "20", Names: []string{"Blue Ocean Freight Services"}, Countries: []string{"IR"}},
+	})
+
+	shipper := marketplace.RegisterParticipant("Good Shipper", Shipper)
+	listed := marketplace.RegisterParticipant("Syrian Shipping Lines", Carrier)
+	similar := marketplace.RegisterParticipant("Blue Ocean Freight Solutions", Carrier)
+
+	quote, _ := marketplace.CreateFreightQuote(shipper.ID, Import, GeneralCargo, Container, "USNYC", "GBLON", Sea, 1000.0, "USD", time.Now().Add(24*time.Hour))
+	listedBid, _ := marketplace.PlaceBid(quote.ID, listed.ID, 900.0, "")
+	similarBid, _ := marketplace.PlaceBid(quote.ID, similar.ID, 950.0, "")
+
+	if _, err := marketplace.ConfirmBooking(quote.ID, listedBid.ID, shipper.ID); err == nil || !strings.Contains(err.Error(), "blocked") {
+		t.Errorf("Expected booking with a listed carrier to be blocked, got %v", err)
+	}
+	if bid, _ := marketplace.GetBid(quote.ID, listedBid.ID); bid.IsAccepted {
+		t.Errorf("Expected blocked bid not to be accepted")
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, similarBid.ID, shipper.ID); err == nil || !strings.Contains(err.Error(), "held") {
+		t.Errorf("Expected booking with a possible match to be held, got %v", err)
+	}
+
+	// Clearing the possible match as a false positive releases the booking
+	var flagged ScreeningResult
+	for _, result := range marketplace.Screening.PendingReviews() {
+		if result.ParticipantID == similar.ID {
+			flagged = result
+		}
+	}
+	if flagged.ID == "" || flagged.Decision != ScreeningFlagged {
+		t.Fatalf("Expected flagged screening in the review queue, got %+v", marketplace.Screening.PendingReviews())
+	}
+	if _, err := marketplace.Screening.Review(flagged.ID, "compliance-officer", true, "different company, verified registry"); err != nil {
+		t.Fatalf("Review failed: %v", err)
+	}
+	if _, err := marketplace.ConfirmBooking(quote.ID, similarBid.ID, shipper.ID); err != nil {
+		t.Errorf("Expected booking after false positive review, got %v", err)
+	}
+
+	// Every screening is kept as compliance history
+	records := marketplace.Compliance.Query(ComplianceFilter{ParticipantID: similar.ID, Types: []ComplianceEventType{ComplianceSanctionsScreened}})
+	if len(records) != 3 {
+		t.Errorf("Expected screening, review and rescreening records, got %d", len(records))
+	}
+}
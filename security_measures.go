@@ -2,7 +2,7 @@ package main
 
 import (
 	"errors"
-	"fmt"
+	"log"
 	"sync"
 	"time"
 )
@@ -18,65 +18,60 @@ const (
 	ForwarderRole Role = "Forwarder"
 )
 
-// AccessControl manages role-based permissions
+// AccessControl manages role-based permissions. A user may hold several roles.
 type AccessControl struct {
-	userRoles map[string]Role
+	userRoles map[string]map[Role]bool
 	mutex     sync.Mutex
 }
 
 // NewAccessControl creates a new AccessControl instance
 func NewAccessControl() *AccessControl {
 	return &AccessControl{
-		userRoles: make(map[string]Role),
+		userRoles: make(map[string]map[Role]bool),
 	}
 }
 
-// AssignRole assigns a role to a user
+// AssignRole grants a role to a user in addition to any roles already held
 func (ac *AccessControl) AssignRole(userID string, role Role) {
 	ac.mutex.Lock()
 	defer ac.mutex.Unlock()
-	ac.userRoles[userID] = role
+	if ac.userRoles[userID] == nil {
+		ac.userRoles[userID] = make(map[Role]bool)
+	}
+	ac.userRoles[userID][role] = true
 }
 
-// CheckRole checks if a user has a specific role
-func (ac *AccessControl) CheckRole(userID string, role Role) bool {
+// RevokeRole removes a role from a user
+func (ac *AccessControl) RevokeRole(userID string, role Role) {
 	ac.mutex.Lock()
 	defer ac.mutex.Unlock()
-	return ac.userRoles[userID] == role
+	delete(ac.userRoles[userID], role)
 }
 
-// MultiSigAuthorization simulates multi-signature authorization
-type MultiSigAuthorization struct {
-	requiredSigs int
-	signers     map[string]bool
-	mutex       sync.Mutex
+// CheckRole checks if a user has a specific role
+func (ac *AccessControl) CheckRole(userID string, role Role) bool {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	return ac.userRoles[userID][role]
 }
 
-// NewMultiSigAuthorization creates a new MultiSigAuthorization instance
-func NewMultiSigAuthorization(required int) *MultiSigAuthorization {
-	return &MultiSigAuthorization{
-		requiredSigs: required,
-		signers:     make(map[string]bool),
+// Roles lists the roles held by a user
+func (ac *AccessControl) Roles(userID string) []Role {
+	ac.mutex.Lock()
+	defer ac.mutex.Unlock()
+	roles := []Role{}
+	for role := range ac.userRoles[userID] {
+		roles = append(roles, role)
 	}
+	return roles
 }
 
-// Sign adds a signature from a user
-func (msa *MultiSigAuthorization) Sign(userID string) {
-	msa.mutex.Lock()
-	defer msa.mutex.Unlock()
-	msa.signers[userID] = true
-}
-
-// IsAuthorized checks if required signatures are met
-func (msa *MultiSigAuthorization) IsAuthorized() bool {
-	msa.mutex.Lock()
-	defer msa.mutex.Unlock()
-	return len(msa.signers) >= msa.requiredSigs
-}
-
-// Escrow represents an escrow with time-locked release
+// Escrow holds a payer's tokens on a ledger until a time-locked release to
+// the payee
 type Escrow struct {
-	amount   float64
+	ledger   *TokenLedger
+	tokenID  string
+	amount   float64 // tokens still held
 	payer    string
 	payee    string
 	lockTime time.Time
@@ -84,15 +79,97 @@ type Escrow struct {
 	mutex    sync.Mutex
 }
 
-// NewEscrow creates a new Escrow instance
-func NewEscrow(amount float64, payer, payee string, lockDuration time.Duration) *Escrow {
+// NewEscrow locks amount of the payer's tokens in escrow on the ledger
+func NewEscrow(ledger *TokenLedger, tokenID string, amount float64, payer, payee string, lockDuration time.Duration) (*Escrow, error) {
+	if ledger == nil {
+		return nil, errors.New("token ledger required for escrow")
+	}
+	if err := ledger.LockTokensInEscrow(payer, tokenID, amount); err != nil {
+		return nil, err
+	}
 	return &Escrow{
+		ledger:   ledger,
+		tokenID:  tokenID,
 		amount:   amount,
 		payer:    payer,
 		payee:    payee,
 		lockTime: time.Now().Add(lockDuration),
 		released: false,
+	}, nil
+}
+
+// Held returns the tokens still held in escrow
+func (e *Escrow) Held() float64 {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.amount
+}
+
+// Released reports whether the escrow has been released or refunded
+func (e *Escrow) Released() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.released
+}
+
+// Add locks more of the payer's tokens in the escrow
+func (e *Escrow) Add(amount float64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.released {
+		return errors.New("funds already released")
+	}
+	if err := e.ledger.LockTokensInEscrow(e.payer, e.tokenID, amount); err != nil {
+		return err
 	}
+	e.amount += amount
+	return nil
+}
+
+// Pay settles part of the escrow to the payee ahead of its release, as the
+// payer settles the payment it secures
+func (e *Escrow) Pay(amount float64) error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.released {
+		return errors.New("funds already released")
+	}
+	if amount > e.amount {
+		return errors.New("amount exceeds escrowed funds")
+	}
+	if err := e.ledger.SettleEscrowTokens(e.payer, e.payee, e.tokenID, amount); err != nil {
+		return err
+	}
+	e.amount -= amount
+	return nil
+}
+
+// Refund returns the funds still held to the payer
+func (e *Escrow) Refund() error {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	if e.released {
+		return errors.New("funds already released")
+	}
+	if e.amount > 0 {
+		if err := e.ledger.RefundEscrowTokens(e.payer, e.tokenID, e.amount); err != nil {
+			return err
+		}
+	}
+	e.released = true
+	log.Printf("Refunded %.2f %s escrowed by %s", e.amount, e.tokenID, e.payer)
+	e.amount = 0
+	return nil
+}
+
+// ReleaseAt returns when the escrowed funds may be released
+func (e *Escrow) ReleaseAt() time.Time {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.lockTime
 }
 
 // Release releases funds if lock time passed
@@ -106,65 +183,186 @@ func (e *Escrow) Release() error {
 	if time.Now().Before(e.lockTime) {
 		return errors.New("lock time not reached")
 	}
+	if e.amount > 0 {
+		if err := e.ledger.SettleEscrowTokens(e.payer, e.payee, e.tokenID, e.amount); err != nil {
+			return err
+		}
+	}
 	e.released = true
-	fmt.Printf("Released %.2f from %s to %s\n", e.amount, e.payer, e.payee)
+	log.Printf("Released %.2f %s from %s to %s", e.amount, e.tokenID, e.payer, e.payee)
+	e.amount = 0
 	return nil
 }
 
-// ProxyContract simulates upgradeable contract via proxy pattern
+// ProxyContract dispatches to the active version of an upgradeable
+// implementation. Upgrades are authorized by multisig or governance, take
+// effect after a timelock and are recorded in the version history.
 type ProxyContract struct {
-	implementation interface{}
-	mutex          sync.Mutex
+	name            string
+	implementation  interface{}
+	version         string
+	implementations map[string]interface{}
+	timelock        time.Duration
+	pending         *PendingUpgrade
+	history         []ContractVersion
+	now             func() time.Time
+	mutex           sync.Mutex
+}
 
-	// Compliance tracking data
-	complianceRecords map[string]ComplianceRecord
+// ContractVersion records when a contract version became active
+type ContractVersion struct {
+	Version     string    `json:"version"`
+	ProposalID  string    `json:"proposal_id,omitempty"`
+	ActivatedAt time.Time `json:"activated_at"`
 }
 
-// ComplianceRecord represents a compliance event or status
-type ComplianceRecord struct {
-	ParticipantID string
-	Event        string
-	Timestamp    time.Time
-	Details      string
+// PendingUpgrade is an authorized upgrade waiting out its timelock
+type PendingUpgrade struct {
+	Version     string    `json:"version"`
+	ProposalID  string    `json:"proposal_id"`
+	ScheduledAt time.Time `json:"scheduled_at"`
+	ETA         time.Time `json:"eta"`
 }
 
-// NewProxyContract creates a new ProxyContract instance
-func NewProxyContract(impl interface{}) *ProxyContract {
+// UpgradeAuthorizer approves contract upgrades, consuming the proposal that
+// authorized them. MultiSigAuthorization and Governance implement it.
+type UpgradeAuthorizer interface {
+	AuthorizeUpgrade(proposalID string, upgrade ContractUpgradePayload) error
+}
+
+// NewProxyContract creates a ProxyContract with impl active as version
+func NewProxyContract(name, version string, impl interface{}, timelock time.Duration) *ProxyContract {
 	return &ProxyContract{
-		implementation:    impl,
-		complianceRecords: make(map[string]ComplianceRecord),
+		name:            name,
+		implementation:  impl,
+		version:         version,
+		implementations: map[string]interface{}{version: impl},
+		timelock:        timelock,
+		history:         []ContractVersion{{Version: version, ActivatedAt: time.Now()}},
+		now:             time.Now,
 	}
 }
 
-// Upgrade upgrades the implementation with authorization
-func (p *ProxyContract) Upgrade(newImpl interface{}, msa *MultiSigAuthorization) error {
+// SetClock replaces the clock timelocks are measured against
+func (p *ProxyContract) SetClock(now func() time.Time) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
+	p.now = now
+}
 
-	if !msa.IsAuthorized() {
-		return errors.New("not authorized to upgrade")
+// Name returns the contract name upgrade proposals refer to
+func (p *ProxyContract) Name() string {
+	return p.name
+}
+
+// RegisterImplementation makes an implementation version available for upgrade
+func (p *ProxyContract) RegisterImplementation(version string, impl interface{}) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if version == "" || impl == nil {
+		return errors.New("version and implementation are required")
+	}
+	if _, exists := p.implementations[version]; exists {
+		return errors.New("version already registered")
 	}
-	p.implementation = newImpl
-	fmt.Println("Contract upgraded successfully")
+	p.implementations[version] = impl
 	return nil
 }
 
-// AddComplianceRecord adds a compliance record for a participant
-func (p *ProxyContract) AddComplianceRecord(participantID, event, details string) {
+// ScheduleUpgrade queues an upgrade to a registered version once authorizer
+// accepts the proposal. The upgrade can be applied after the timelock.
+func (p *ProxyContract) ScheduleUpgrade(proposalID, version string, authorizer UpgradeAuthorizer) (PendingUpgrade, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if authorizer == nil {
+		return PendingUpgrade{}, errors.New("not authorized to upgrade")
+	}
+	if _, exists := p.implementations[version]; !exists {
+		return PendingUpgrade{}, errors.New("version not registered")
+	}
+	if version == p.version {
+		return PendingUpgrade{}, errors.New("version already active")
+	}
+	if p.pending != nil {
+		return PendingUpgrade{}, errors.New("an upgrade is already pending")
+	}
+	upgrade := ContractUpgradePayload{Contract: p.name, Version: version}
+	if err := authorizer.AuthorizeUpgrade(proposalID, upgrade); err != nil {
+		return PendingUpgrade{}, err
+	}
+	now := p.now()
+	p.pending = &PendingUpgrade{
+		Version:     version,
+		ProposalID:  proposalID,
+		ScheduledAt: now,
+		ETA:         now.Add(p.timelock),
+	}
+	log.Printf("Contract %s upgrade to %s scheduled for %s", p.name, version, p.pending.ETA.Format(time.RFC3339))
+	return *p.pending, nil
+}
+
+// CancelUpgrade drops the pending upgrade
+func (p *ProxyContract) CancelUpgrade() (PendingUpgrade, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if p.pending == nil {
+		return PendingUpgrade{}, errors.New("no upgrade pending")
+	}
+	cancelled := *p.pending
+	p.pending = nil
+	log.Printf("Contract %s upgrade to %s cancelled", p.name, cancelled.Version)
+	return cancelled, nil
+}
+
+// ApplyUpgrade activates the pending upgrade once its timelock has passed
+func (p *ProxyContract) ApplyUpgrade() (ContractVersion, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	if p.pending == nil {
+		return ContractVersion{}, errors.New("no upgrade pending")
+	}
+	now := p.now()
+	if now.Before(p.pending.ETA) {
+		return ContractVersion{}, errors.New("upgrade timelock not expired")
+	}
+	p.version = p.pending.Version
+	p.implementation = p.implementations[p.version]
+	entry := ContractVersion{Version: p.version, ProposalID: p.pending.ProposalID, ActivatedAt: now}
+	p.history = append(p.history, entry)
+	p.pending = nil
+	log.Printf("Contract %s upgraded to version %s", p.name, p.version)
+	return entry, nil
+}
+
+// Implementation returns the active implementation
+func (p *ProxyContract) Implementation() interface{} {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.implementation
+}
+
+// Version returns the active implementation version
+func (p *ProxyContract) Version() string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	return p.version
+}
+
+// Pending returns the upgrade waiting on its timelock, if any
+func (p *ProxyContract) Pending() (PendingUpgrade, bool) {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	p.complianceRecords[participantID] = ComplianceRecord{
-		ParticipantID: participantID,
-		Event:         event,
-		Timestamp:     time.Now(),
-		Details:       details,
+	if p.pending == nil {
+		return PendingUpgrade{}, false
 	}
+	return *p.pending, true
 }
 
-// GetComplianceRecord retrieves a compliance record for a participant
-func (p *ProxyContract) GetComplianceRecord(participantID string) (ComplianceRecord, bool) {
+// History lists the versions the contract has run, oldest first
+func (p *ProxyContract) History() []ContractVersion {
 	p.mutex.Lock()
 	defer p.mutex.Unlock()
-	record, exists := p.complianceRecords[participantID]
-	return record, exists
+	return append([]ContractVersion(nil), p.history...)
 }
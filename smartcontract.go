@@ -1,9 +1,9 @@
 package main
 
 import (
-	"encoding/json"
 	"errors"
 	"log"
+	"strings"
 	"sync"
 	"time"
 )
@@ -25,6 +25,9 @@ type SmartContract struct {
 	// Membership manager for subscription management
 	membershipManager *MembershipManager
 
+	// Governance module proposals are raised and voted through
+	Governance *Governance
+
 	// Benefit registry for subscription benefits
 	benefitRegistry map[string]Benefit
 
@@ -41,6 +44,7 @@ type Benefit struct {
 	Title       string
 	Description string
 	Active      bool
+	Entitlement *Entitlement // runtime feature granted by the benefit, if any
 }
 
 // AddBenefit adds a new benefit to the registry
@@ -85,11 +89,71 @@ func (sc *SmartContract) ListBenefits() []Benefit {
 	return benefits
 }
 
+// SetBenefitEntitlement attaches the runtime entitlement a benefit grants
+func (sc *SmartContract) SetBenefitEntitlement(id string, entitlement Entitlement) error {
+	benefit, exists := sc.benefitRegistry[id]
+	if !exists {
+		return errors.New("benefit not found")
+	}
+	benefit.Entitlement = &entitlement
+	sc.benefitRegistry[id] = benefit
+	return nil
+}
+
+// RegisterDefaultBenefits registers the standard benefits and attaches them
+// to the default membership tiers
+func (sc *SmartContract) RegisterDefaultBenefits() error {
+	if sc.membershipManager == nil {
+		return errors.New("membership manager not initialized")
+	}
+	defaults := []struct {
+		id, title, description string
+		entitlement            Entitlement
+		tiers                  []MembershipType
+	}{
+		{"priority-listing", "Priority listing", "Bids listed ahead of other carriers",
+			Entitlement{Feature: FeaturePriorityListing}, []MembershipType{MembershipCarrier}},
+		{"free-bids", "Free bids", "10 bids per month without a bid fee",
+			Entitlement{Feature: FeatureFreeBids, Quota: 10}, []MembershipType{MembershipCarrier}},
+		{"reduced-fees", "Reduced fees", "25% off platform fees",
+			Entitlement{Feature: FeatureReducedFees, Value: 25}, []MembershipType{MembershipFreightForwarder, MembershipCustomsBroker}},
+		{"extended-escrow", "Extended escrow", "Escrow held 7 extra days",
+			Entitlement{Feature: FeatureExtendedEscrow, Value: 7}, []MembershipType{MembershipFreightForwarder}},
+	}
+	for _, d := range defaults {
+		if err := sc.AddBenefit(d.id, d.title, d.description); err != nil {
+			return err
+		}
+		sc.SetBenefitEntitlement(d.id, d.entitlement)
+		for _, tier := range d.tiers {
+			if err := sc.membershipManager.AttachBenefit(tier, d.id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
 // InitializeServices initializes auxiliary services for the smart contract
 func (sc *SmartContract) InitializeServices() {
-	sc.disputeService = NewDisputeService()
-	sc.transportValidator = NewTransportationValidator()
-	sc.membershipManager = NewMembershipManager()
+	// Share the marketplace's disputes so monitor-raised disputes can be resolved here
+	if sc.Marketplace != nil && sc.Marketplace.Disputes != nil {
+		sc.disputeService = sc.Marketplace.Disputes
+	} else {
+		sc.disputeService = NewDisputeService()
+	}
+	// Share the marketplace's mode rules so quotes and the contract agree
+	if sc.Marketplace != nil && sc.Marketplace.Transport != nil {
+		sc.transportValidator = sc.Marketplace.Transport
+	} else {
+		sc.transportValidator = NewTransportationValidator()
+	}
+	// Share the marketplace's memberships so access checks see the same subscriptions
+	if sc.Marketplace != nil && sc.Marketplace.MembershipManager != nil {
+		sc.membershipManager = sc.Marketplace.MembershipManager
+	} else {
+		sc.membershipManager = NewMembershipManager()
+	}
 	sc.benefitRegistry = make(map[string]Benefit)
 	sc.eventListeners = make(map[string][]func(data interface{}))
 	sc.eventListenersMutex = sync.RWMutex{}
@@ -113,22 +177,47 @@ func (sc *SmartContract) CheckMembershipActive(participantID string) (bool, erro
 	return active, nil
 }
 
-func (sc *SmartContract) InitializeServices() {
-	sc.disputeService = NewDisputeService()
-	sc.transportValidator = NewTransportationValidator()
-	sc.membershipManager = NewMembershipManager()
+// MembershipBenefits lists the active registry benefits included in a
+// participant's membership plan
+func (sc *SmartContract) MembershipBenefits(participantID string) ([]Benefit, error) {
+	if sc.membershipManager == nil {
+		return nil, errors.New("membership manager not initialized")
+	}
+	if !sc.membershipManager.CheckActive(participantID) {
+		return nil, errors.New("participant does not have an active membership")
+	}
+	membership, err := sc.membershipManager.GetMembership(participantID)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := sc.membershipManager.GetPlan(membership.Type)
+	if err != nil {
+		return nil, err
+	}
+	benefits := []Benefit{}
+	for _, id := range plan.BenefitIDs {
+		if b, ok := sc.benefitRegistry[id]; ok && b.Active {
+			benefits = append(benefits, b)
+		}
+	}
+	return benefits, nil
 }
 
-// TransportModeSpecificLogic applies logic based on transport mode
-func (sc *SmartContract) TransportModeSpecificLogic(transportMode string) error {
+// TransportModeSpecificLogic validates a transport mode and returns the
+// business rules it imposes
+func (sc *SmartContract) TransportModeSpecificLogic(transportMode string) (ModeRule, error) {
 	if sc.transportValidator == nil {
-		return errors.New("transportation validator not initialized")
+		return ModeRule{}, errors.New("transportation validator not initialized")
 	}
-	err := sc.transportValidator.ValidateMode(transportMode)
+	mode, err := ParseTransportationMode(transportMode)
 	if err != nil {
-		return err
+		return ModeRule{}, err
 	}
-	return sc.transportValidator.ApplyModeSpecificLogic(transportMode)
+	rule, ok := sc.transportValidator.Rule(mode)
+	if !ok {
+		return ModeRule{}, errors.New("no rules configured for " + string(mode) + "; multimodal routes use each leg's rules")
+	}
+	return rule, nil
 }
 
 // LockTokensInEscrow locks tokens in escrow for a participant
@@ -136,43 +225,59 @@ func (sc *SmartContract) LockTokensInEscrow(participantID, tokenID string, amoun
 	return sc.TokenLedger.LockTokensInEscrow(participantID, tokenID, amount)
 }
 
+// defaultEscrowLock is how long booking escrow is held before release
+const defaultEscrowLock = 72 * time.Hour
+
+// OpenBookingEscrow locks a booking payment, in settlement tokens, from the
+// payer's balance in a time-locked escrow. The lock is extended for payers
+// entitled to extended escrow.
+func (sc *SmartContract) OpenBookingEscrow(payerID, payeeID string, amount float64) (*Escrow, error) {
+	if amount <= 0 {
+		return nil, errors.New("escrow amount must be positive")
+	}
+	lock := defaultEscrowLock
+	if sc.Marketplace != nil && sc.Marketplace.Entitlements != nil {
+		lock = sc.Marketplace.Entitlements.EscrowLockDuration(payerID, lock)
+	}
+	return NewEscrow(sc.TokenLedger, SettlementTokenID, amount, payerID, payeeID, lock)
+}
+
 // ReleaseEscrowTokens releases escrowed tokens back to participant's balance
 func (sc *SmartContract) ReleaseEscrowTokens(participantID, tokenID string, amount float64) error {
 	return sc.TokenLedger.ReleaseEscrowTokens(participantID, tokenID, amount)
 }
 
-// RefundEscrowTokens refunds escrowed tokens to participant's balance
-import (
-	"log"
-	"sync"
-	"time"
-	"errors"
-)
-
-var logger *Logger
-var once sync.Once
+// defaultTokenID is the platform token minted and transferred by the contract
+const defaultTokenID = "TOKEN1"
 
-func getLogger() *Logger {
-	once.Do(func() {
-		var err error
-		logger, err = NewLogger("marketplace.log")
-		if err != nil {
-			log.Fatalf("Failed to initialize logger: %v", err)
-		}
-	})
-	return logger
+// validateAddress checks a participant address is usable as a ledger key
+func validateAddress(participantID string) error {
+	if strings.TrimSpace(participantID) == "" {
+		return errors.New("participant address is required")
+	}
+	return nil
 }
 
+// NewSmartContract creates a new SmartContract instance
 func NewSmartContract(marketplace *Marketplace) *SmartContract {
-	logger := getLogger()
-	logger.LogEvent("SmartContract instance created")
+	log.Printf("SmartContract instance created")
 	return &SmartContract{
 		Marketplace: marketplace,
 		TokenLedger: NewTokenLedger(),
 	}
 }
 
+// MintToken mints platform tokens to a participant
 func (sc *SmartContract) MintToken(participantID string, amount float64) error {
+	return sc.MintTokenID(participantID, defaultTokenID, amount)
+}
+
+// MintTokenID mints amount of tokenID for a participant. An empty tokenID
+// mints the default token.
+func (sc *SmartContract) MintTokenID(participantID, tokenID string, amount float64) error {
+	if tokenID == "" {
+		tokenID = defaultTokenID
+	}
 	sc.reentrancyLock.Lock()
 	defer sc.reentrancyLock.Unlock()
 
@@ -187,10 +292,9 @@ func (sc *SmartContract) MintToken(participantID string, amount float64) error {
 	if err != nil {
 		return err
 	}
-	logger := getLogger()
-	logger.LogEvent("MintToken called for participant: " + participantID)
+	log.Printf("MintToken called for participant: %s", participantID)
 	// State changes happen before external calls inside MintTokens
-	return sc.TokenLedger.MintTokens(participantID, safeAmount)
+	return sc.TokenLedger.MintTokens(participantID, tokenID, safeAmount)
 }
 
 // safeAddFloat64 safely adds two float64 numbers and checks for overflow
@@ -202,6 +306,7 @@ func safeAddFloat64(a, b float64) (float64, error) {
 	return result, nil
 }
 
+// TransferToken transfers platform tokens between participants
 func (sc *SmartContract) TransferToken(fromID, toID string, amount float64) error {
 	sc.reentrancyLock.Lock()
 	defer sc.reentrancyLock.Unlock()
@@ -220,78 +325,16 @@ func (sc *SmartContract) TransferToken(fromID, toID string, amount float64) erro
 	if err != nil {
 		return err
 	}
-	logger := getLogger()
-	logger.LogEvent("TransferToken called from " + fromID + " to " + toID)
+	log.Printf("TransferToken called from %s to %s", fromID, toID)
 	// State changes happen before external calls inside TransferTokens
-	success, err := sc.TokenLedger.TransferTokensWithCheck(fromID, toID, safeAmount)
-	if err != nil {
-		return err
-	}
-	if !success {
-		return errors.New("token transfer failed")
-	}
-	return nil
-}
-
-// safeAddFloat64 safely adds two float64 numbers and checks for overflow
-func safeAddFloat64(a, b float64) (float64, error) {
-	result := a + b
-	if (result < a) != (b < 0) {
-		return 0, errors.New("float64 addition overflow or underflow")
-	}
-	return result, nil
+	return sc.TokenLedger.TransferTokens(fromID, toID, defaultTokenID, safeAmount)
 }
 
+// RefundEscrowTokens refunds escrowed tokens to participant's balance
 func (sc *SmartContract) RefundEscrowTokens(participantID, tokenID string, amount float64) error {
 	return sc.TokenLedger.RefundEscrowTokens(participantID, tokenID, amount)
 }
 
-
-import (
-	"log"
-	"sync"
-	"time"
-	"errors"
-)
-
-var logger *Logger
-var once sync.Once
-
-func getLogger() *Logger {
-	once.Do(func() {
-		var err error
-		logger, err = NewLogger("marketplace.log")
-		if err != nil {
-			log.Fatalf("Failed to initialize logger: %v", err)
-		}
-	})
-	return logger
-}
-
-// NewSmartContract creates a new SmartContract instance
-func NewSmartContract(marketplace *Marketplace) *SmartContract {
-	logger := getLogger()
-	logger.LogEvent("SmartContract instance created")
-	return &SmartContract{
-		Marketplace: marketplace,
-		TokenLedger: NewTokenLedger(),
-	}
-}
-
-func (sc *SmartContract) MintToken(participantID string, amount float64) error {
-	logger := getLogger()
-	logger.LogEvent("MintToken called for participant: " + participantID)
-	return sc.TokenLedger.MintTokens(participantID, amount)
-}
-
-func (sc *SmartContract) TransferToken(fromID, toID string, amount float64) error {
-	logger := getLogger()
-	logger.LogEvent("TransferToken called from " + fromID + " to " + toID)
-	return sc.TokenLedger.TransferTokens(fromID, toID, amount)
-}
-
-import "sync"
-
 // ListenToEvent simulates adding an event listener for contract events
 func (sc *SmartContract) ListenToEvent(eventName string, callback func(data interface{})) {
 	sc.eventListenersMutex.Lock()
@@ -350,82 +393,8 @@ func (sc *SmartContract) ResolveDispute(disputeID, resolverID string, resolution
 	return err
 }
 
-// TransportModeSpecificLogic applies logic based on transport mode
-func (sc *SmartContract) TransportModeSpecificLogic(transportMode string) error {
-	if sc.transportValidator == nil {
-		return errors.New("transportation validator not initialized")
-	}
-	err := sc.transportValidator.ValidateMode(transportMode)
-	if err != nil {
-		return err
-	}
-	return sc.transportValidator.ApplyModeSpecificLogic(transportMode)
-}
-
-// Add eventListeners map and mutex to SmartContract struct
-type SmartContract struct {
-	// existing fields...
-
-	eventListeners      map[string][]func(data interface{})
-	eventListenersMutex sync.RWMutex
-}
-
-// RaiseDispute allows raising a dispute for a booking
-func (sc *SmartContract) RaiseDispute(bookingID, raiserID, reason string) error {
-	if sc.disputeService == nil {
-		return errors.New("dispute service not initialized")
-	}
-	_, err := sc.disputeService.RaiseDispute(bookingID, raiserID, reason)
-	return err
-}
-
-// ResolveDispute resolves a dispute by an authorized participant
-func (sc *SmartContract) ResolveDispute(disputeID, resolverID string, resolution string) error {
-	if sc.disputeService == nil {
-		return errors.New("dispute service not initialized")
-	}
-	err := sc.disputeService.ResolveDispute(disputeID, resolution)
-	return err
-}
-
-// TransportModeSpecificLogic applies logic based on transport mode
-func (sc *SmartContract) TransportModeSpecificLogic(transportMode string) error {
-	// Add transport mode specific logic here
-	return nil
-}
-
-import (
-	"log"
-	"sync"
-	"time"
-	"errors"
-)
-
-var logger *Logger
-var once sync.Once
-
-func getLogger() *Logger {
-	once.Do(func() {
-		var err error
-		logger, err = NewLogger("marketplace.log")
-		if err != nil {
-			log.Fatalf("Failed to initialize logger: %v", err)
-		}
-	})
-	return logger
-}
-
-func NewSmartContract(marketplace *Marketplace) *SmartContract {
-	logger := getLogger()
-	logger.LogEvent("SmartContract instance created")
-	return &SmartContract{
-		Marketplace: marketplace,
-		TokenLedger: NewTokenLedger(),
-	}
-}
-
 // CreateFreightQuote creates a freight quote via smart contract logic
-func (sc *SmartContract) CreateFreightQuote(serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, rate float64, validUntil time.Time) (FreightQuote, error) {
+func (sc *SmartContract) CreateFreightQuote(shipperID string, serviceCategory ServiceCategory, cargoType CargoType, packagingMode PackagingMode, origin, destination string, transportationMode TransportationMode, rate float64, currency string, validUntil time.Time) (FreightQuote, error) {
 	// Restrict function to operate only within validated and predictable conditions to avoid flash loan reliance
 	if !sc.isValidQuoteRequest(origin, destination, rate) {
 		return FreightQuote{}, errors.New("invalid quote request parameters")
@@ -434,9 +403,8 @@ func (sc *SmartContract) CreateFreightQuote(serviceCategory ServiceCategory, car
 	if rate <= 0 {
 		return FreightQuote{}, errors.New("rate must be positive")
 	}
-	quote := sc.Marketplace.CreateFreightQuote(serviceCategory, cargoType, packagingMode, origin, destination, transportationMode, rate, validUntil)
 	// Emit event or add to blockchain handled by marketplace
-	return quote, nil
+	return sc.Marketplace.CreateFreightQuote(shipperID, serviceCategory, cargoType, packagingMode, origin, destination, transportationMode, rate, currency, validUntil)
 }
 
 func (sc *SmartContract) isValidQuoteRequest(origin, destination string, rate float64) bool {
@@ -449,7 +417,7 @@ func (sc *SmartContract) isValidQuoteRequest(origin, destination string, rate fl
 }
 
 // PlaceBid places a bid on a freight quote via smart contract logic
-func (sc *SmartContract) PlaceBid(quoteID, carrierID string, bidAmount float64) (FreightBid, error) {
+func (sc *SmartContract) PlaceBid(quoteID, carrierID string, bidAmount float64, currency string) (FreightBid, error) {
 	// Access control: restrict to authorized participants only
 	if !sc.isAuthorizedParticipant(carrierID) {
 		return FreightBid{}, errors.New("unauthorized participant")
@@ -457,7 +425,7 @@ func (sc *SmartContract) PlaceBid(quoteID, carrierID string, bidAmount float64)
 	if bidAmount <= 0 {
 		return FreightBid{}, errors.New("bid amount must be positive")
 	}
-	bid, err := sc.Marketplace.PlaceBid(quoteID, carrierID, bidAmount)
+	bid, err := sc.Marketplace.PlaceBid(quoteID, carrierID, bidAmount, currency)
 	return bid, err
 }
 
@@ -490,8 +458,10 @@ func (sc *SmartContract) CreateProposal(title, description, proposerID string) (
 	if title == "" || description == "" {
 		return Proposal{}, errors.New("title and description cannot be empty")
 	}
-	proposal := sc.Marketplace.blockchain.governance.CreateProposal(title, description, proposerID)
-	return proposal, nil
+	if sc.Governance == nil {
+		return Proposal{}, errors.New("governance not initialized")
+	}
+	return sc.Governance.CreateProposal(title, description, proposerID)
 }
 
 // VoteProposal casts a vote on a proposal via smart contract logic
@@ -500,6 +470,8 @@ func (sc *SmartContract) VoteProposal(proposalID, participantID string, approve
 	if !sc.isAuthorizedParticipant(participantID) {
 		return errors.New("unauthorized participant")
 	}
-	err := sc.Marketplace.blockchain.governance.VoteProposal(proposalID, participantID, approve)
-	return err
+	if sc.Governance == nil {
+		return errors.New("governance not initialized")
+	}
+	return sc.Governance.VoteProposal(proposalID, participantID, approve)
 }
@@ -2,7 +2,6 @@ package main
 
 import (
 	"testing"
-	"time"
 )
 
 func TestMintAndTransferToken(t *testing.T) {
@@ -83,6 +82,37 @@ func TestEscrowLockReleaseRefund(t *testing.T) {
 	}
 }
 
+func TestEscrowPayAndRelease(t *testing.T) {
+	ledger := NewTokenLedger()
+	ledger.MintTokens("shipper", SettlementTokenID, 500)
+
+	if _, err := NewEscrow(ledger, SettlementTokenID, 600, "shipper", "carrier", 0); err == nil {
+		t.Errorf("Expected escrow beyond the payer's balance to fail")
+	}
+	escrow, err := NewEscrow(ledger, SettlementTokenID, 300, "shipper", "carrier", 0)
+	if err != nil {
+		t.Fatalf("NewEscrow failed: %v", err)
+	}
+	if err := escrow.Pay(400); err == nil {
+		t.Errorf("Expected paying more than is held to fail")
+	}
+	if err := escrow.Pay(100); err != nil {
+		t.Fatalf("Pay failed: %v", err)
+	}
+	if err := escrow.Release(); err != nil {
+		t.Fatalf("Release failed: %v", err)
+	}
+	if balance := ledger.GetBalance("carrier", SettlementTokenID); balance != 300 {
+		t.Errorf("Expected the carrier paid 300, got %f", balance)
+	}
+	if held := ledger.EscrowedBalance("shipper", SettlementTokenID); held != 0 || escrow.Held() != 0 {
+		t.Errorf("Expected nothing left in escrow, got %f", held)
+	}
+	if err := escrow.Refund(); err == nil {
+		t.Errorf("Expected a released escrow not to refund")
+	}
+}
+
 func TestDisputeRaiseResolve(t *testing.T) {
 	ds := NewDisputeService()
 
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"sync"
+	"time"
+)
+
+// defaultTreasuryID is the ledger account that receives membership fees
+const defaultTreasuryID = "treasury"
+
+// RenewalResult reports the outcome of an automatic renewal attempt
+type RenewalResult struct {
+	ParticipantID string
+	Membership    Membership
+	Err           error
+}
+
+// SubscriptionService bills memberships in tokens and handles renewals
+type SubscriptionService struct {
+	memberships *MembershipManager
+	tokenLedger *TokenLedger
+	treasuryID  string
+	mutex       sync.Mutex
+}
+
+// NewSubscriptionService creates a new SubscriptionService over a MembershipManager
+func NewSubscriptionService(mm *MembershipManager) *SubscriptionService {
+	return &SubscriptionService{
+		memberships: mm,
+		treasuryID:  defaultTreasuryID,
+	}
+}
+
+// SetTokenLedger configures the ledger membership fees are charged against
+func (ss *SubscriptionService) SetTokenLedger(ledger *TokenLedger) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+	ss.tokenLedger = ledger
+}
+
+// Subscribe registers a participant for a plan and pays for the first period
+func (ss *SubscriptionService) Subscribe(participantID string, mType MembershipType) (Membership, error) {
+	membership, err := ss.memberships.Subscribe(participantID, mType)
+	if err != nil {
+		return Membership{}, err
+	}
+	if membership.Status == MembershipActive {
+		return membership, nil
+	}
+	return ss.Renew(participantID)
+}
+
+// Renew charges a participant for the next billing period of their plan
+func (ss *SubscriptionService) Renew(participantID string) (Membership, error) {
+	ss.mutex.Lock()
+	defer ss.mutex.Unlock()
+
+	membership, err := ss.memberships.GetMembership(participantID)
+	if err != nil {
+		return Membership{}, err
+	}
+	plan, err := ss.memberships.GetPlan(membership.Type)
+	if err != nil {
+		return Membership{}, err
+	}
+
+	if plan.Price > 0 {
+		if ss.tokenLedger == nil {
+			return Membership{}, errors.New("token ledger not configured for subscription billing")
+		}
+		err = ss.tokenLedger.TransferTokens(participantID, ss.treasuryID, plan.TokenID, plan.Price)
+		if err != nil {
+			return Membership{}, err
+		}
+	}
+
+	renewed, err := ss.memberships.extend(participantID, time.Now())
+	if err != nil {
+		// Return the fee if the membership could not be extended
+		if plan.Price > 0 {
+			ss.tokenLedger.TransferTokens(ss.treasuryID, participantID, plan.TokenID, plan.Price)
+		}
+		return Membership{}, err
+	}
+	log.Printf("Membership %s renewed for %s until %s", renewed.Type, participantID, renewed.ExpiresAt.Format(time.RFC3339))
+	return renewed, nil
+}
+
+// ProcessRenewals renews auto-renewing memberships that have reached expiry
+// and expires those whose grace period has run out
+func (ss *SubscriptionService) ProcessRenewals(now time.Time) []RenewalResult {
+	results := []RenewalResult{}
+	for _, due := range ss.memberships.expireLapsed(now) {
+		membership, err := ss.Renew(due.ParticipantID)
+		if err != nil {
+			log.Printf("Renewal failed for %s, grace period applies: %v", due.ParticipantID, err)
+			membership = due
+		}
+		results = append(results, RenewalResult{
+			ParticipantID: due.ParticipantID,
+			Membership:    membership,
+			Err:           err,
+		})
+	}
+	return results
+}
+
+// CheckActive checks whether a participant has an active subscription
+func (ss *SubscriptionService) CheckActive(participantID string) bool {
+	return ss.memberships.CheckActive(participantID)
+}
@@ -0,0 +1,510 @@
+package main
+
+import (
+	"crypto/sha256"
+	_ "embed"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bundledSurchargeFormulas holds the default surcharge formulas
+//
+//go:embed data/surcharges.yaml
+var bundledSurchargeFormulas []byte
+
+// SurchargeKind is the oracle feed a surcharge formula is driven by
+type SurchargeKind string
+
+const (
+	FuelAdjustment     SurchargeKind = "fuel"          // bunker/fuel price index
+	PeakSeason         SurchargeKind = "peak_season"   // departure date windows
+	PortHandling       SurchargeKind = "port_handling" // port fee schedules
+	CurrencyAdjustment SurchargeKind = "currency"      // exchange rate movement
+)
+
+// Port ends a port handling formula charges
+const (
+	OriginEnd      = "origin"
+	DestinationEnd = "destination"
+)
+
+// SeasonWindow is a yearly date range in MM-DD form. A window whose end is
+// before its start wraps over the new year.
+type SeasonWindow struct {
+	From string `yaml:"from"`
+	To   string `yaml:"to"`
+}
+
+// SurchargeFormula configures how one surcharge is computed
+type SurchargeFormula struct {
+	Code         string               `yaml:"code"`
+	Description  string               `yaml:"description"`
+	Kind         SurchargeKind        `yaml:"kind"`
+	Modes        []TransportationMode `yaml:"modes"` // empty applies to every mode
+	Basis        SurchargeBasis       `yaml:"basis"`
+	Currency     string               `yaml:"currency"` // of flat and per-unit amounts, DefaultCurrency if empty
+	Factor       float64              `yaml:"factor"`
+	BaseIndex    float64              `yaml:"base_index"`    // fuel
+	Amount       float64              `yaml:"amount"`        // peak_season
+	Windows      []SeasonWindow       `yaml:"windows"`       // peak_season
+	Ends         []string             `yaml:"ends"`          // port_handling
+	ScheduleKey  string               `yaml:"schedule_key"`  // port_handling
+	CostCurrency string               `yaml:"cost_currency"` // currency
+	BaseRates    map[string]float64   `yaml:"base_rates"`    // currency
+}
+
+// SurchargeFormulaSet is the YAML document of surcharge formulas
+type SurchargeFormulaSet struct {
+	Formulas []SurchargeFormula `yaml:"formulas"`
+}
+
+// SurchargeLine is one surcharge priced for a shipment
+type SurchargeLine struct {
+	Code        string         `json:"code"`
+	Description string         `json:"description"`
+	Kind        SurchargeKind  `json:"kind"`
+	Basis       SurchargeBasis `json:"basis"`
+	Input       float64        `json:"input"`             // oracle reading the line was computed from
+	Sources     []string       `json:"sources,omitempty"` // oracle sources aggregated into the input
+	Rate        float64        `json:"rate"`              // percent, per-unit or flat amount charged
+	Quantity    float64        `json:"quantity"`          // units the rate was charged on
+	Amount      float64        `json:"amount"`
+}
+
+// SurchargeGap is a surcharge that could not be priced because its oracle
+// feed failed
+type SurchargeGap struct {
+	Code   string `json:"code"`
+	Reason string `json:"reason"`
+}
+
+// SurchargeSnapshot is the surcharges priced for a freight charge at a point
+// in time. Bookings keep the snapshot taken when they were confirmed so later
+// oracle movements do not change what was agreed.
+type SurchargeSnapshot struct {
+	Currency   string          `json:"currency"`
+	Freight    float64         `json:"freight"`
+	Lines      []SurchargeLine `json:"lines"`
+	Unpriced   []SurchargeGap  `json:"unpriced,omitempty"` // surcharges left out for want of a reading
+	Total      float64         `json:"total"`
+	ShipDate   time.Time       `json:"ship_date"`
+	ComputedAt time.Time       `json:"computed_at"`
+	Hash       string          `json:"hash"`
+}
+
+// Verify checks the snapshot has not been altered since it was computed
+func (s SurchargeSnapshot) Verify() error {
+	if hashSurcharges(s) != s.Hash {
+		return errors.New("surcharge snapshot hash mismatch")
+	}
+	return nil
+}
+
+// hashSurcharges fingerprints a snapshot's priced lines
+func hashSurcharges(s SurchargeSnapshot) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%.2f\n%.2f\n%d\n%d", s.Currency, s.Freight, s.Total, s.ShipDate.UnixNano(), s.ComputedAt.UnixNano())
+	for _, line := range s.Lines {
+		fmt.Fprintf(h, "\n%s\n%s\n%s\n%.6f\n%s\n%.6f\n%.3f\n%.2f", line.Code, line.Kind, line.Basis, line.Input, strings.Join(line.Sources, ","), line.Rate, line.Quantity, line.Amount)
+	}
+	for _, gap := range s.Unpriced {
+		fmt.Fprintf(h, "\nunpriced\n%s\n%s", gap.Code, gap.Reason)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// SurchargeEngine prices surcharges from oracle feeds with configurable formulas
+type SurchargeEngine struct {
+	oracle   *OracleIntegration
+	formulas []SurchargeFormula
+	mutex    sync.RWMutex
+}
+
+// NewSurchargeEngine creates a new SurchargeEngine running the bundled formulas
+func NewSurchargeEngine(oracle *OracleIntegration) *SurchargeEngine {
+	se := &SurchargeEngine{oracle: oracle}
+	if err := se.LoadFormulas(bundledSurchargeFormulas); err != nil {
+		log.Fatalf("Invalid bundled surcharge formulas: %v", err)
+	}
+	return se
+}
+
+// LoadSurchargeFile creates a SurchargeEngine from a YAML formula file
+func LoadSurchargeFile(path string, oracle *OracleIntegration) (*SurchargeEngine, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	se := &SurchargeEngine{oracle: oracle}
+	if err := se.LoadFormulas(data); err != nil {
+		return nil, fmt.Errorf("invalid surcharge file %s: %v", path, err)
+	}
+	return se, nil
+}
+
+// LoadFormulas replaces the engine's formulas with a YAML formula set
+func (se *SurchargeEngine) LoadFormulas(data []byte) error {
+	var set SurchargeFormulaSet
+	if err := yaml.UnmarshalStrict(data, &set); err != nil {
+		return err
+	}
+	codes := make(map[string]bool)
+	for i := range set.Formulas {
+		formula := &set.Formulas[i]
+		if err := normalizeSurchargeFormula(formula); err != nil {
+			return fmt.Errorf("formula %d (%s): %v", i, formula.Code, err)
+		}
+		if codes[formula.Code] {
+			return fmt.Errorf("formula %d: duplicate code %s", i, formula.Code)
+		}
+		codes[formula.Code] = true
+	}
+
+	se.mutex.Lock()
+	defer se.mutex.Unlock()
+	se.formulas = set.Formulas
+	return nil
+}
+
+// Formulas returns the formulas the engine prices with
+func (se *SurchargeEngine) Formulas() []SurchargeFormula {
+	se.mutex.RLock()
+	defer se.mutex.RUnlock()
+	return append([]SurchargeFormula{}, se.formulas...)
+}
+
+// normalizeSurchargeFormula checks a formula is consistent and fills defaults
+func normalizeSurchargeFormula(formula *SurchargeFormula) error {
+	formula.Code = strings.ToUpper(strings.TrimSpace(formula.Code))
+	if formula.Code == "" {
+		return errors.New("code is required")
+	}
+	switch formula.Basis {
+	case SurchargeFlat, SurchargePercent, SurchargePerUnit:
+	default:
+		return errors.New("unknown basis " + string(formula.Basis))
+	}
+	currency, err := NormalizeCurrencyCode(formula.Currency, DefaultCurrency)
+	if err != nil {
+		return err
+	}
+	formula.Currency = currency
+	for i, mode := range formula.Modes {
+		parsed, err := ParseTransportationMode(string(mode))
+		if err != nil {
+			return err
+		}
+		if parsed == Multimodal {
+			return errors.New("multimodal routes pick up the formulas of their legs' modes")
+		}
+		formula.Modes[i] = parsed
+	}
+	if formula.Factor < 0 || formula.Amount < 0 {
+		return errors.New("factor and amount must not be negative")
+	}
+
+	switch formula.Kind {
+	case FuelAdjustment:
+		if formula.Factor == 0 || formula.BaseIndex < 0 {
+			return errors.New("fuel formulas need a factor and a non-negative base index")
+		}
+	case PeakSeason:
+		if formula.Amount == 0 || len(formula.Windows) == 0 {
+			return errors.New("peak season formulas need an amount and at least one window")
+		}
+		for _, window := range formula.Windows {
+			if _, err := time.Parse("01-02", window.From); err != nil {
+				return errors.New("invalid window start " + window.From)
+			}
+			if _, err := time.Parse("01-02", window.To); err != nil {
+				return errors.New("invalid window end " + window.To)
+			}
+		}
+	case PortHandling:
+		if formula.Factor == 0 || len(formula.Ends) == 0 {
+			return errors.New("port handling formulas need a factor and at least one end")
+		}
+		for _, end := range formula.Ends {
+			if end != OriginEnd && end != DestinationEnd {
+				return errors.New("unknown port end " + end)
+			}
+		}
+		if formula.ScheduleKey == "" {
+			formula.ScheduleKey = "total"
+		}
+		if !portFeeKeys[formula.ScheduleKey] {
+			return errors.New("unknown port fee " + formula.ScheduleKey)
+		}
+	case CurrencyAdjustment:
+		if formula.Basis != SurchargePercent {
+			return errors.New("currency adjustments are charged as a percent of freight")
+		}
+		if formula.Factor == 0 || len(formula.BaseRates) == 0 {
+			return errors.New("currency formulas need a factor and base rates")
+		}
+		if formula.CostCurrency, err = NormalizeCurrencyCode(formula.CostCurrency, DefaultCurrency); err != nil {
+			return err
+		}
+		rates := make(map[string]float64)
+		for code, rate := range formula.BaseRates {
+			if code, err = NormalizeCurrencyCode(code, ""); err != nil {
+				return err
+			}
+			if rate <= 0 {
+				return errors.New("base rate for " + code + " must be positive")
+			}
+			rates[code] = rate
+		}
+		formula.BaseRates = rates
+	default:
+		return errors.New("unknown kind " + string(formula.Kind))
+	}
+	return nil
+}
+
+// Calculate prices the surcharges on a freight charge for a quote's route.
+// The ship date is the first leg's planned departure, or at if not planned.
+// A surcharge whose oracle feed fails is left out and recorded as unpriced.
+func (se *SurchargeEngine) Calculate(quote FreightQuote, freight float64, currency string, at time.Time) (SurchargeSnapshot, error) {
+	currency, err := NormalizeCurrencyCode(currency, DefaultCurrency)
+	if err != nil {
+		return SurchargeSnapshot{}, err
+	}
+	if se.oracle == nil {
+		return SurchargeSnapshot{}, errors.New("no oracle configured for surcharges")
+	}
+	snapshot := SurchargeSnapshot{
+		Currency:   currency,
+		Freight:    roundAmount(freight),
+		Lines:      []SurchargeLine{},
+		ShipDate:   at,
+		ComputedAt: time.Now(),
+	}
+	if len(quote.Legs) > 0 && !quote.Legs[0].PlannedDeparture.IsZero() {
+		snapshot.ShipDate = quote.Legs[0].PlannedDeparture
+	}
+	quantity := quote.Chargeable.Quantity
+	if quantity <= 0 {
+		quantity = 1
+	}
+
+	for _, formula := range se.Formulas() {
+		if !formulaAppliesTo(formula, quote) {
+			continue
+		}
+		line, err := se.priceFormula(formula, quote, freight, currency, quantity, snapshot.ShipDate)
+		if err != nil {
+			log.Printf("Surcharge %s not priced: %v", formula.Code, err)
+			snapshot.Unpriced = append(snapshot.Unpriced, SurchargeGap{Code: formula.Code, Reason: err.Error()})
+			continue
+		}
+		if line.Amount <= 0 {
+			continue
+		}
+		snapshot.Lines = append(snapshot.Lines, line)
+		snapshot.Total += line.Amount
+	}
+	snapshot.Total = roundAmount(snapshot.Total)
+	snapshot.Hash = hashSurcharges(snapshot)
+	return snapshot, nil
+}
+
+// priceFormula reads a formula's oracle feed and prices its line
+func (se *SurchargeEngine) priceFormula(formula SurchargeFormula, quote FreightQuote, freight float64, currency string, quantity float64, shipDate time.Time) (SurchargeLine, error) {
+	line := SurchargeLine{
+		Code:        formula.Code,
+		Description: formula.Description,
+		Kind:        formula.Kind,
+		Basis:       formula.Basis,
+		Quantity:    1,
+	}
+
+	switch formula.Kind {
+	case FuelAdjustment:
+		index, err := se.oracle.FetchFuelPriceIndex(quote.OriginCode)
+		if err != nil {
+			return SurchargeLine{}, err
+		}
+		line.Input = index.Index
+		line.Sources = index.Reading.Sources
+		line.Rate = math.Max(0, (index.Index-formula.BaseIndex)*formula.Factor)
+	case PeakSeason:
+		if inSeason(formula.Windows, shipDate) {
+			line.Input = 1
+			line.Rate = formula.Amount
+		}
+	case PortHandling:
+		for _, port := range formulaPorts(formula, quote) {
+			schedule, err := se.oracle.FetchPortFeeSchedule(port)
+			if err != nil {
+				return SurchargeLine{}, err
+			}
+			line.Input += schedule.Fee(formula.ScheduleKey)
+			for _, source := range schedule.Reading.Sources {
+				line.Sources = appendUnique(line.Sources, source)
+			}
+		}
+		line.Rate = line.Input * formula.Factor
+	case CurrencyAdjustment:
+		base, ok := formula.BaseRates[currency]
+		if !ok || currency == formula.CostCurrency {
+			return line, nil
+		}
+		rate, err := se.oracle.FetchExchangeRate(formula.CostCurrency, currency)
+		if err != nil {
+			return SurchargeLine{}, err
+		}
+		// The quote currency buying less of the cost currency is charged back
+		line.Input = rate
+		line.Rate = math.Max(0, (rate-base)/base*100*formula.Factor)
+	}
+
+	switch formula.Basis {
+	case SurchargePercent:
+		line.Rate = roundMeasure(line.Rate)
+		line.Amount = freight * line.Rate / 100
+	case SurchargePerUnit, SurchargeFlat:
+		rate, err := se.oracle.ConvertAmount(line.Rate, formula.Currency, currency)
+		if err != nil {
+			return SurchargeLine{}, err
+		}
+		line.Rate = roundMeasure(rate)
+		if formula.Basis == SurchargePerUnit {
+			line.Quantity = quantity
+		}
+		line.Amount = line.Rate * line.Quantity
+	}
+	line.Amount = roundAmount(line.Amount)
+	return line, nil
+}
+
+// formulaAppliesTo reports whether a formula covers any mode on a quote's route
+func formulaAppliesTo(formula SurchargeFormula, quote FreightQuote) bool {
+	if len(formula.Modes) == 0 {
+		return true
+	}
+	for _, mode := range formula.Modes {
+		if mode == quote.TransportationMode {
+			return true
+		}
+		for _, leg := range quote.Legs {
+			if mode == leg.Mode {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// formulaPorts returns the ports a port handling formula charges: the ends
+// of each route leg by one of its modes, or of the whole route without modes
+func formulaPorts(formula SurchargeFormula, quote FreightQuote) []string {
+	legs := quote.Legs
+	if len(formula.Modes) == 0 || len(legs) == 0 {
+		legs = []RouteLeg{{Mode: quote.TransportationMode, OriginCode: quote.OriginCode, DestinationCode: quote.DestinationCode}}
+	}
+	ports := []string{}
+	for _, leg := range legs {
+		applies := len(formula.Modes) == 0
+		for _, mode := range formula.Modes {
+			applies = applies || mode == leg.Mode
+		}
+		if !applies {
+			continue
+		}
+		for _, end := range formula.Ends {
+			port := leg.OriginCode
+			if end == DestinationEnd {
+				port = leg.DestinationCode
+			}
+			ports = append(ports, port)
+		}
+	}
+	return ports
+}
+
+// inSeason reports whether a date falls inside any of the yearly windows
+func inSeason(windows []SeasonWindow, date time.Time) bool {
+	day := date.Format("01-02")
+	for _, window := range windows {
+		if window.From <= window.To {
+			if day >= window.From && day <= window.To {
+				return true
+			}
+		} else if day >= window.From || day <= window.To {
+			return true
+		}
+	}
+	return false
+}
+
+// surchargeView narrows a quote to the route leg a bid covers, so a leg is
+// charged the surcharges of its own ports and mode
+func surchargeView(quote FreightQuote, legSequence int) FreightQuote {
+	for _, leg := range quote.Legs {
+		if leg.Sequence == legSequence {
+			quote.OriginCode, quote.DestinationCode = leg.OriginCode, leg.DestinationCode
+			quote.TransportationMode = leg.Mode
+			quote.Legs = []RouteLeg{leg}
+			break
+		}
+	}
+	return quote
+}
+
+// surchargeLineItemTypes maps surcharge kinds to invoice line types
+var surchargeLineItemTypes = map[SurchargeKind]LineItemType{
+	FuelAdjustment:     FuelSurcharge,
+	PeakSeason:         PeakSeasonSurcharge,
+	PortHandling:       PortFeeCharge,
+	CurrencyAdjustment: CurrencyAdjustmentCharge,
+}
+
+// surchargeUnitPrice is the invoice unit price of a surcharge line. Percentage
+// lines are billed once at their amount.
+func surchargeUnitPrice(line SurchargeLine) float64 {
+	if line.Basis == SurchargePercent {
+		return line.Amount
+	}
+	return line.Rate
+}
+
+// PreviewSurcharges prices the surcharges a bid amount on a quote would carry
+// if it were accepted now. A leg sequence narrows the route to that leg.
+func (m *Marketplace) PreviewSurcharges(quoteID string, amount float64, currency string, legSequence int) (SurchargeSnapshot, error) {
+	if m.Surcharges == nil {
+		return SurchargeSnapshot{}, errors.New("surcharges not configured")
+	}
+	if amount <= 0 {
+		return SurchargeSnapshot{}, errors.New("amount must be positive")
+	}
+	quote, err := m.GetQuote(quoteID)
+	if err != nil {
+		return SurchargeSnapshot{}, err
+	}
+	if currency == "" {
+		currency = quote.Currency
+	}
+	return m.Surcharges.Calculate(surchargeView(quote, legSequence), amount, currency, time.Now())
+}
+
+// BookingSurcharges returns the surcharge snapshot fixed when a booking was confirmed
+func (m *Marketplace) BookingSurcharges(bookingID string) (SurchargeSnapshot, error) {
+	booking, err := m.GetBooking(bookingID)
+	if err != nil {
+		return SurchargeSnapshot{}, err
+	}
+	if booking.Surcharges == nil {
+		return SurchargeSnapshot{}, errors.New("booking has no surcharge snapshot")
+	}
+	return *booking.Surcharges, nil
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newStubOracle() *OracleIntegration {
+	oracle := NewOracleIntegration()
+	oracle.SetFXRateProvider(NewStubFXRateProvider())
+	return oracle
+}
+
+func TestSurchargeEngine_BundledFormulas(t *testing.T) {
+	se := NewSurchargeEngine(newStubOracle())
+	departure := time.Date(2026, 9, 1, 0, 0, 0, 0, time.UTC)
+	quote := FreightQuote{
+		OriginCode:         "CNSHA",
+		DestinationCode:    "NLRTM",
+		TransportationMode: Sea,
+		Chargeable:         ChargeableMeasure{Quantity: 1, Unit: PerShipment},
+		Legs:               []RouteLeg{{Sequence: 1, Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM", PlannedDeparture: departure}},
+	}
+
+	snapshot, err := se.Calculate(quote, 1000, "eur", time.Now())
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	// BAF 3.8% for the 3.45 index, peak season 8%, 2 x 125 USD port fees
+	// and 2.222% for the euro weakening from 0.90 to 0.92 to the dollar
+	want := map[string]float64{"BAF": 38, "PSS": 80, "PORT": 230, "CAF": 22.22}
+	if len(snapshot.Lines) != len(want) {
+		t.Fatalf("Expected %d surcharge lines, got %+v", len(want), snapshot.Lines)
+	}
+	for _, line := range snapshot.Lines {
+		if want[line.Code] != line.Amount {
+			t.Errorf("%s: expected %v, got %+v", line.Code, want[line.Code], line)
+		}
+	}
+	if snapshot.Currency != "EUR" || snapshot.Total != 370.22 || !snapshot.ShipDate.Equal(departure) {
+		t.Errorf("Unexpected snapshot %+v", snapshot)
+	}
+	if err := snapshot.Verify(); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+
+	// Off season in dollars only the fuel and port fees apply
+	quote.Legs[0].PlannedDeparture = time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	snapshot, err = se.Calculate(quote, 1000, "USD", time.Now())
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	if len(snapshot.Lines) != 2 || snapshot.Total != 288 {
+		t.Errorf("Expected BAF and port fees of 288, got %+v", snapshot)
+	}
+}
+
+func TestSurchargeEngine_LoadFormulasValidates(t *testing.T) {
+	se := NewSurchargeEngine(newStubOracle())
+	invalid := map[string]string{
+		"unknown kind":     "formulas:\n  - {code: X, kind: tolls, basis: flat}\n",
+		"unknown basis":    "formulas:\n  - {code: X, kind: fuel, basis: per_teu, factor: 1}\n",
+		"fuel factor":      "formulas:\n  - {code: X, kind: fuel, basis: percent}\n",
+		"window":           "formulas:\n  - {code: X, kind: peak_season, basis: flat, amount: 50, windows: [{from: \"13-01\", to: \"12-31\"}]}\n",
+		"port end":         "formulas:\n  - {code: X, kind: port_handling, basis: flat, factor: 1, ends: [transit]}\n",
+		"currency basis":   "formulas:\n  - {code: X, kind: currency, basis: flat, factor: 1, base_rates: {EUR: 0.9}}\n",
+		"multimodal":       "formulas:\n  - {code: X, kind: fuel, basis: percent, factor: 1, modes: [Multimodal]}\n",
+		"duplicate code":   "formulas:\n  - {code: X, kind: fuel, basis: percent, factor: 1}\n  - {code: x, kind: fuel, basis: percent, factor: 2}\n",
+		"unknown field":    "formulas:\n  - {code: X, kind: fuel, basis: percent, factor: 1, cap: 10}\n",
+		"negative factor":  "formulas:\n  - {code: X, kind: fuel, basis: percent, factor: -1}\n",
+		"negative base fx": "formulas:\n  - {code: X, kind: currency, basis: percent, factor: 1, base_rates: {EUR: -1}}\n",
+	}
+	for name, data := range invalid {
+		if err := se.LoadFormulas([]byte(data)); err == nil {
+			t.Errorf("%s: expected the formulas to be rejected", name)
+		}
+	}
+	if len(se.Formulas()) != 6 {
+		t.Errorf("Expected rejected formulas to leave the bundled set in place")
+	}
+}
+
+func TestMarketplace_SurchargesSnapshottedAtBooking(t *testing.T) {
+	oracle := newStubOracle()
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Surcharges = NewSurchargeEngine(oracle)
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+	carrier := marketplace.RegisterParticipant("Ocean Carrier", Carrier)
+
+	departure := time.Date(time.Now().Year()+1, 12, 1, 0, 0, 0, 0, time.UTC)
+	quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM", PlannedDeparture: departure, PlannedArrival: departure.Add(30 * 24 * time.Hour)},
+	}, 1000.0, "USD", time.Now().Add(24*time.Hour), CargoDetails{})
+	if err != nil {
+		t.Fatalf("CreateMultimodalQuote failed: %v", err)
+	}
+	if quote.Surcharges == nil || quote.Surcharges.Freight != 1000 || quote.Surcharges.Total != 288 {
+		t.Errorf("Expected surcharges estimated on the quote, got %+v", quote.Surcharges)
+	}
+
+	preview, err := marketplace.PreviewSurcharges(quote.ID, 900, "EUR", 0)
+	if err != nil {
+		t.Fatalf("PreviewSurcharges failed: %v", err)
+	}
+	if preview.Currency != "EUR" || len(preview.Lines) != 3 {
+		t.Errorf("Expected fuel, port and currency surcharges in euros, got %+v", preview)
+	}
+
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+	snapshot, err := marketplace.BookingSurcharges(booking.ID)
+	if err != nil {
+		t.Fatalf("BookingSurcharges failed: %v", err)
+	}
+	if snapshot.Freight != 900 || snapshot.Total != 284.2 {
+		t.Errorf("Expected surcharges on the accepted bid, got %+v", snapshot)
+	}
+
+	// A later formula change does not reach the booked surcharges
+	path := filepath.Join(t.TempDir(), "surcharges.yaml")
+	if err := os.WriteFile(path, []byte("formulas:\n  - {code: BAF, kind: fuel, basis: percent, base_index: 2.5, factor: 10}\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if marketplace.Surcharges, err = LoadSurchargeFile(path, oracle); err != nil {
+		t.Fatalf("LoadSurchargeFile failed: %v", err)
+	}
+	is := NewInvoiceService(marketplace, oracle)
+	invoice, err := is.GenerateInvoice(booking.ID, time.Now().Add(30*24*time.Hour))
+	if err != nil {
+		t.Fatalf("GenerateInvoice failed: %v", err)
+	}
+	if len(invoice.LineItems) != 3 || invoice.Total != 1184.2 {
+		t.Fatalf("Expected freight plus the snapshot surcharges, got %+v", invoice)
+	}
+	if fuel := invoice.LineItems[1]; fuel.Type != FuelSurcharge || fuel.Amount != 34.2 || !strings.Contains(fuel.Description, "BAF") {
+		t.Errorf("Unexpected fuel line %+v", fuel)
+	}
+
+	tampered := snapshot
+	tampered.Total = 0
+	if err := tampered.Verify(); err == nil {
+		t.Errorf("Expected an altered snapshot to fail verification")
+	}
+}
+
+func TestSurchargeEngine_RecordsUnpricedSurcharges(t *testing.T) {
+	// Fuel and the origin port are published; the destination port is not
+	provider := NewMemoryOracleProvider("feeds", nil)
+	provider.Publish(FuelPriceFeed, "CNSHA", map[string]float64{"index": 3.5}, time.Now())
+	provider.Publish(PortFeeFeed, "CNSHA", map[string]float64{"port_dues": 100, "terminal_handling": 50}, time.Now())
+	se := NewSurchargeEngine(NewOracleIntegration(provider))
+	departure := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	quote := FreightQuote{
+		OriginCode:         "CNSHA",
+		DestinationCode:    "NLRTM",
+		TransportationMode: Sea,
+		Chargeable:         ChargeableMeasure{Quantity: 1, Unit: PerShipment},
+		Legs:               []RouteLeg{{Sequence: 1, Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM", PlannedDeparture: departure}},
+	}
+
+	snapshot, err := se.Calculate(quote, 1000, "USD", time.Now())
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	if len(snapshot.Lines) != 1 || snapshot.Lines[0].Code != "BAF" || snapshot.Total != 40 {
+		t.Errorf("Expected only the 4%% BAF to be priced, got %+v", snapshot.Lines)
+	}
+	unpriced := map[string]bool{}
+	for _, gap := range snapshot.Unpriced {
+		unpriced[gap.Code] = gap.Reason != ""
+	}
+	if len(unpriced) != 2 || !unpriced["PORT"] || !unpriced["THC"] {
+		t.Errorf("Expected PORT and THC recorded as unpriced, got %+v", snapshot.Unpriced)
+	}
+	if err := snapshot.Verify(); err != nil {
+		t.Errorf("Verify failed: %v", err)
+	}
+}
+
+func TestSurchargeEngine_PortFeesOnSeaLegs(t *testing.T) {
+	se := NewSurchargeEngine(newStubOracle())
+	departure := time.Date(2026, 12, 1, 0, 0, 0, 0, time.UTC)
+	quote := FreightQuote{
+		OriginCode:         "CNSHA",
+		DestinationCode:    "PLWAW",
+		TransportationMode: Multimodal,
+		Chargeable:         ChargeableMeasure{Quantity: 1, Unit: PerShipment},
+		Legs: []RouteLeg{
+			{Sequence: 1, Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM", PlannedDeparture: departure},
+			{Sequence: 2, Mode: Road, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+		},
+	}
+
+	snapshot, err := se.Calculate(quote, 1000, "USD", time.Now())
+	if err != nil {
+		t.Fatalf("Calculate failed: %v", err)
+	}
+	port := SurchargeLine{}
+	for _, line := range snapshot.Lines {
+		if line.Code == "PORT" {
+			port = line
+		}
+	}
+	if port.Amount != 250 {
+		t.Errorf("Expected port fees at the two sea ports only, got %+v", snapshot.Lines)
+	}
+	if len(snapshot.Unpriced) != 0 {
+		t.Errorf("Unexpected unpriced surcharges %+v", snapshot.Unpriced)
+	}
+
+	// A road-only route passes no port
+	road := surchargeView(quote, 2)
+	if snapshot, _ := se.Calculate(road, 1000, "USD", time.Now()); len(snapshot.Lines) != 1 || snapshot.Lines[0].Code != "FSC" {
+		t.Errorf("Expected only the fuel surcharge on the road leg, got %+v", snapshot.Lines)
+	}
+}
@@ -2,12 +2,16 @@ package tests
 
 import (
 	"net/http"
+	"strings"
 	"testing"
 	"time"
 )
 
 func TestEndToEnd(t *testing.T) {
 	client := &http.Client{Timeout: 10 * time.Second}
+	if _, err := client.Get("http://localhost:8080/"); err != nil {
+		t.Skipf("Marketplace server not running on localhost:8080: %v", err)
+	}
 
 	// Register participant
 	resp, err := client.Post("http://localhost:8080/api/participants", "application/json", 
@@ -22,8 +26,8 @@ func TestEndToEnd(t *testing.T) {
 			"service_category":"Import",
 			"cargo_type":"GeneralCargo",
 			"packaging_mode":"Container",
-			"origin":"NYC",
-			"destination":"LON",
+			"origin":"USNYC",
+			"destination":"GBLON",
 			"transportation_mode":"Sea",
 			"rate":1000,
 			"valid_until":"2024-12-31T23:59:59Z"
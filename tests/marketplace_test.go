@@ -1,4 +1,4 @@
-package main
+package tests
 
 import (
 	"testing"
@@ -23,11 +23,11 @@ func TestMarketplace_CreateFreightQuote(t *testing.T) {
 	marketplace := NewMarketplace(bc)
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "NYC", "LON", TransportationMode("Sea"), 1000.0, validUntil)
+	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "USNYC", "GBLON", TransportationMode("Sea"), 1000.0, validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
-	if quote.Origin != "NYC" || quote.Destination != "LON" {
+	if quote.Origin != "USNYC" || quote.Destination != "GBLON" {
 		t.Errorf("Quote origin or destination mismatch")
 	}
 }
@@ -36,11 +36,10 @@ func TestMarketplace_PlaceBid(t *testing.T) {
 	bc := NewBlockchain()
 	marketplace := NewMarketplace(bc)
 
-	shipper := marketplace.RegisterParticipant("Shipper1", ParticipantType("Shipper"))
 	carrier := marketplace.RegisterParticipant("Carrier1", ParticipantType("Carrier"))
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "NYC", "LON", TransportationMode("Sea"), 1000.0, validUntil)
+	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "USNYC", "GBLON", TransportationMode("Sea"), 1000.0, validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
@@ -62,7 +61,7 @@ func TestMarketplace_ConfirmBooking(t *testing.T) {
 	carrier := marketplace.RegisterParticipant("Carrier1", ParticipantType("Carrier"))
 
 	validUntil := time.Now().Add(24 * time.Hour)
-	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "NYC", "LON", TransportationMode("Sea"), 1000.0, validUntil)
+	quote, err := marketplace.CreateFreightQuote(ServiceCategory("Import"), CargoType("GeneralCargo"), PackagingMode("Container"), "USNYC", "GBLON", TransportationMode("Sea"), 1000.0, validUntil)
 	if err != nil {
 		t.Fatalf("CreateFreightQuote failed: %v", err)
 	}
@@ -1,7 +1,6 @@
 package tests
 
 import (
-	"errors"
 	"time"
 )
 
@@ -38,12 +37,13 @@ func NewMarketplace(bc *Blockchain) *Marketplace {
 }
 
 type Participant struct {
+	ID   string
 	Name string
 	Type ParticipantType
 }
 
 func (m *Marketplace) RegisterParticipant(name string, pType ParticipantType) Participant {
-	return Participant{Name: name, Type: pType}
+	return Participant{ID: name, Name: name, Type: pType}
 }
 
 type FreightQuote struct {
@@ -57,6 +57,7 @@ func (m *Marketplace) CreateFreightQuote(serviceCategory ServiceCategory, cargoT
 }
 
 type FreightBid struct {
+	ID        string
 	BidAmount float64
 }
 
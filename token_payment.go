@@ -1,7 +1,9 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
+	"log"
 	"sync"
 	"time"
 )
@@ -63,6 +65,37 @@ func (tl *TokenLedger) ReleaseEscrowTokens(participantID, tokenID string, amount
 	return nil
 }
 
+// SettleEscrowTokens pays escrowed tokens of a payer to a payee
+func (tl *TokenLedger) SettleEscrowTokens(payerID, payeeID, tokenID string, amount float64) error {
+	if amount <= 0 {
+		return errors.New("amount must be positive")
+	}
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	if tl.escrowed[payerID] == nil || tl.escrowed[payerID][tokenID] < amount {
+		return errors.New("insufficient escrowed tokens to settle")
+	}
+	if tl.balances[payeeID] == nil {
+		tl.balances[payeeID] = make(map[string]float64)
+	}
+
+	tl.escrowed[payerID][tokenID] -= amount
+	tl.balances[payeeID][tokenID] += amount
+	return nil
+}
+
+// EscrowedBalance returns the tokens a participant holds in escrow for a specific tokenID
+func (tl *TokenLedger) EscrowedBalance(participantID, tokenID string) float64 {
+	tl.mutex.Lock()
+	defer tl.mutex.Unlock()
+
+	if tl.escrowed[participantID] == nil {
+		return 0
+	}
+	return tl.escrowed[participantID][tokenID]
+}
+
 // RefundEscrowTokens refunds escrowed tokens to participant's balance (similar to release)
 func (tl *TokenLedger) RefundEscrowTokens(participantID, tokenID string, amount float64) error {
 	// For now, same as ReleaseEscrowTokens
@@ -73,6 +106,7 @@ func (tl *TokenLedger) RefundEscrowTokens(participantID, tokenID string, amount
 func NewTokenLedger() *TokenLedger {
 	return &TokenLedger{
 		balances:   make(map[string]map[string]float64),
+		escrowed:   make(map[string]map[string]float64),
 		allowances: make(map[string]map[string]map[string]float64),
 	}
 }
@@ -205,8 +239,9 @@ func (tl *TokenLedger) BatchTransferTokens(fromID, toID string, tokenAmounts map
 
 // TokenPaymentSystem integrates token payments with marketplace and blockchain
 type TokenPaymentSystem struct {
-	tokenLedger *TokenLedger
-	blockchain  *Blockchain
+	tokenLedger    *TokenLedger
+	blockchain     *Blockchain
+	invoiceService *InvoiceService
 }
 
 // NewTokenPaymentSystem creates a new TokenPaymentSystem instance
@@ -217,16 +252,58 @@ func NewTokenPaymentSystem(blockchain *Blockchain) *TokenPaymentSystem {
 	}
 }
 
-// PayFreightBooking processes payment for a booking using tokens
-func (tps *TokenPaymentSystem) PayFreightBooking(payerID, payeeID, tokenID string, amount float64, bookingID string) error {
+// SetInvoiceService links settlements to the invoices issued for bookings
+func (tps *TokenPaymentSystem) SetInvoiceService(is *InvoiceService) {
+	tps.invoiceService = is
+}
+
+// SetTokenLedger configures the ledger booking payments are transferred on
+func (tps *TokenPaymentSystem) SetTokenLedger(ledger *TokenLedger) {
+	tps.tokenLedger = ledger
+}
+
+// PayFreightBooking processes payment for a booking in settlement tokens.
+// With an open booking escrow the payment is settled from it, topped up from
+// the payer's balance when the escrow holds less. With an invoice service the
+// payment must settle the booking's open invoice; the transfer is reversed if
+// the invoice cannot take it.
+func (tps *TokenPaymentSystem) PayFreightBooking(payerID, payeeID, tokenID string, amount float64, bookingID string, escrow *Escrow) error {
 	if amount <= 0 {
 		return errors.New("amount must be positive")
 	}
+	if tokenID != SettlementTokenID {
+		return errors.New("booking payments settle in " + SettlementTokenID)
+	}
+	if tps.invoiceService != nil {
+		if _, err := tps.invoiceService.CheckBookingPayment(bookingID, amount); err != nil {
+			return err
+		}
+	}
 
-	// Transfer tokens
-	err := tps.tokenLedger.TransferTokens(payerID, payeeID, tokenID, amount)
-	if err != nil {
-		return err
+	// Transfer tokens, from escrow when the booking has one
+	topUp := 0.0
+	if escrow != nil && !escrow.Released() {
+		if topUp = roundAmount(amount - escrow.Held()); topUp > 0 {
+			if err := escrow.Add(topUp); err != nil {
+				return err
+			}
+		}
+		if err := escrow.Pay(amount); err != nil {
+			return err
+		}
+	} else {
+		escrow = nil
+		if err := tps.tokenLedger.TransferTokens(payerID, payeeID, tokenID, amount); err != nil {
+			return err
+		}
+	}
+
+	// Mark the booking's invoice as (partially) paid
+	if tps.invoiceService != nil {
+		if _, err := tps.invoiceService.ApplyBookingPayment(bookingID, amount, tokenID); err != nil {
+			tps.reversePayment(payerID, payeeID, tokenID, amount, topUp, bookingID, escrow)
+			return err
+		}
 	}
 
 	// Record payment on blockchain
@@ -251,98 +328,35 @@ func (tps *TokenPaymentSystem) PayFreightBooking(payerID, payeeID, tokenID strin
 	return nil
 }
 
-// TokenLedger manages token balances and transfers
-type TokenLedger struct {
-	balances map[string]float64
-	mutex    sync.Mutex
-}
-
-// NewTokenLedger creates a new TokenLedger instance
-func NewTokenLedger() *TokenLedger {
-	return &TokenLedger{
-		balances: make(map[string]float64),
+// reversePayment returns a booking payment to the payer, putting back into
+// escrow what was settled from it
+func (tps *TokenPaymentSystem) reversePayment(payerID, payeeID, tokenID string, amount, topUp float64, bookingID string, escrow *Escrow) {
+	if err := tps.tokenLedger.TransferTokens(payeeID, payerID, tokenID, amount); err != nil {
+		log.Printf("Failed to reverse payment for booking %s: %v", bookingID, err)
+		return
 	}
-}
-
-// MintTokens mints tokens to a participant
-func (tl *TokenLedger) MintTokens(participantID string, amount float64) error {
-	if amount <= 0 {
-		return errors.New("amount must be positive")
+	if escrow == nil {
+		return
 	}
-	tl.mutex.Lock()
-	defer tl.mutex.Unlock()
-
-	tl.balances[participantID] += amount
-	return nil
-}
-
-// GetBalance returns the token balance of a participant
-func (tl *TokenLedger) GetBalance(participantID string) float64 {
-	tl.mutex.Lock()
-	defer tl.mutex.Unlock()
-
-	return tl.balances[participantID]
-}
-
-// TransferTokens transfers tokens from one participant to another
-func (tl *TokenLedger) TransferTokens(fromID, toID string, amount float64) error {
-	if amount <= 0 {
-		return errors.New("amount must be positive")
-	}
-	tl.mutex.Lock()
-	defer tl.mutex.Unlock()
-
-	if tl.balances[fromID] < amount {
-		return errors.New("insufficient balance")
-	}
-
-	tl.balances[fromID] -= amount
-	tl.balances[toID] += amount
-	return nil
-}
-
-// TokenPaymentSystem integrates token payments with marketplace and blockchain
-type TokenPaymentSystem struct {
-	tokenLedger *TokenLedger
-	blockchain  *Blockchain
-}
-
-// NewTokenPaymentSystem creates a new TokenPaymentSystem instance
-func NewTokenPaymentSystem(blockchain *Blockchain) *TokenPaymentSystem {
-	return &TokenPaymentSystem{
-		tokenLedger: NewTokenLedger(),
-		blockchain:  blockchain,
+	if relock := roundAmount(amount - topUp); relock > 0 {
+		if err := escrow.Add(relock); err != nil {
+			log.Printf("Failed to restore escrow for booking %s: %v", bookingID, err)
+		}
 	}
 }
 
-// PayFreightBooking processes payment for a booking using tokens
-func (tps *TokenPaymentSystem) PayFreightBooking(payerID, payeeID string, amount float64, bookingID string) error {
-	if amount <= 0 {
-		return errors.New("amount must be positive")
+// PayBooking settles a booking in tokens from its shipper to its carrier
+func (m *Marketplace) PayBooking(bookingID, payerID, tokenID string, amount float64) error {
+	if m.Payments == nil {
+		return errors.New("token payments not configured")
 	}
-
-	// Transfer tokens
-	err := tps.tokenLedger.TransferTokens(payerID, payeeID, amount)
+	booking, err := m.GetBooking(bookingID)
 	if err != nil {
 		return err
 	}
-
-	// Record payment on blockchain
-	paymentRecord := struct {
-		PayerID   string
-		PayeeID   string
-		Amount    float64
-		BookingID string
-		Timestamp time.Time
-	}{
-		PayerID:   payerID,
-		PayeeID:   payeeID,
-		Amount:    amount,
-		BookingID: bookingID,
-		Timestamp: time.Now(),
+	if payerID != booking.ShipperID {
+		return errors.New("only the booking's shipper can pay for it")
 	}
-	data, _ := json.Marshal(paymentRecord)
-	tps.blockchain.AddBlock(string(data))
-
-	return nil
+	escrow, _ := m.BookingEscrow(bookingID)
+	return m.Payments.PayFreightBooking(payerID, booking.CarrierID, tokenID, amount, bookingID, escrow)
 }
@@ -1,56 +1,404 @@
 package main
 
 import (
+	_ "embed"
 	"errors"
+	"fmt"
+	"log"
+	"os"
 	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bundledModeRules holds the default per-mode business rules
+//
+//go:embed data/mode_rules.yaml
+var bundledModeRules []byte
+
+// ShipmentDocument is a transport document a mode requires before departure
+type ShipmentDocument string
+
+const (
+	AirWaybill                ShipmentDocument = "AirWaybill"
+	BillOfLading              ShipmentDocument = "BillOfLading"
+	CMRConsignmentNote        ShipmentDocument = "CMR" // road consignment note
+	CIMConsignmentNote        ShipmentDocument = "CIM" // rail consignment note
+	CommercialInvoice         ShipmentDocument = "CommercialInvoice"
+	PackingList               ShipmentDocument = "PackingList"
+	DangerousGoodsDeclaration ShipmentDocument = "DangerousGoodsDeclaration"
+	CustomsDeclaration        ShipmentDocument = "CustomsDeclaration"
 )
 
+// knownShipmentDocuments lists the documents mode rules may require
+var knownShipmentDocuments = map[ShipmentDocument]bool{
+	AirWaybill:                true,
+	BillOfLading:              true,
+	CMRConsignmentNote:        true,
+	CIMConsignmentNote:        true,
+	CommercialInvoice:         true,
+	PackingList:               true,
+	DangerousGoodsDeclaration: true,
+	CustomsDeclaration:        true,
+}
+
+// HazardousRule restricts dangerous goods on a mode
+type HazardousRule struct {
+	Allowed           bool               `yaml:"allowed"`
+	ForbiddenClasses  []string           `yaml:"forbidden_classes"` // a class forbids its divisions, e.g. "1" forbids "1.4S"
+	RequiredDocuments []ShipmentDocument `yaml:"required_documents"`
+}
+
+// ModeRule is the business rules a transportation mode imposes on shipments.
+// Zero limits are unlimited and an empty packaging list allows any packaging.
+type ModeRule struct {
+	Mode              TransportationMode `yaml:"mode"`
+	MaxGrossWeightKg  float64            `yaml:"max_gross_weight_kg"` // per shipment
+	MaxPieceWeightKg  float64            `yaml:"max_piece_weight_kg"`
+	MaxLengthCm       float64            `yaml:"max_length_cm"`
+	MaxWidthCm        float64            `yaml:"max_width_cm"`
+	MaxHeightCm       float64            `yaml:"max_height_cm"`
+	AllowedPackaging  []PackagingMode    `yaml:"allowed_packaging"`
+	Hazardous         HazardousRule      `yaml:"hazardous"`
+	RequiredDocuments []ShipmentDocument `yaml:"required_documents"`
+	MinTransitHours   int                `yaml:"min_transit_hours"`
+	MaxTransitHours   int                `yaml:"max_transit_hours"`
+}
+
+// ModeRuleSet is the YAML document of per-mode rules
+type ModeRuleSet struct {
+	Modes []ModeRule `yaml:"modes"`
+}
+
+// RuleViolation is a shipment breaking one of its mode's rules
+type RuleViolation struct {
+	Mode    TransportationMode `json:"mode"`
+	Leg     int                `json:"leg,omitempty"`
+	Rule    string             `json:"rule"`
+	Message string             `json:"message"`
+}
+
+// RuleViolations reports every rule a shipment breaks as one error
+type RuleViolations []RuleViolation
+
+// Error implements error
+func (v RuleViolations) Error() string {
+	messages := make([]string, len(v))
+	for i, violation := range v {
+		messages[i] = violation.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// transportationModes lists the modes the marketplace moves freight by
+var transportationModes = []TransportationMode{Air, Sea, Land, Road, Rail, Multimodal}
+
 // TransportationValidator validates transport modes and applies specific rules
 type TransportationValidator struct {
-	allowedModes map[string]bool
+	rules map[TransportationMode]ModeRule
+	mutex sync.RWMutex
 }
 
 // NewTransportationValidator creates a new TransportationValidator instance
+// running the bundled mode rules
 func NewTransportationValidator() *TransportationValidator {
-	return &TransportationValidator{
-		allowedModes: map[string]bool{
-			"air":       true,
-			"sea":       true,
-			"road":      true,
-			"rail":      true,
-			"pipeline":  true,
-			"multimodal": true,
-		},
+	tv := &TransportationValidator{}
+	if err := tv.LoadRules(bundledModeRules); err != nil {
+		log.Fatalf("Invalid bundled mode rules: %v", err)
 	}
+	return tv
+}
+
+// LoadModeRulesFile creates a TransportationValidator from a YAML rules file
+func LoadModeRulesFile(path string) (*TransportationValidator, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	tv := &TransportationValidator{}
+	if err := tv.LoadRules(data); err != nil {
+		return nil, fmt.Errorf("invalid mode rules file %s: %v", path, err)
+	}
+	return tv, nil
+}
+
+// LoadRules replaces the validator's rules with a YAML rule set
+func (tv *TransportationValidator) LoadRules(data []byte) error {
+	var set ModeRuleSet
+	if err := yaml.UnmarshalStrict(data, &set); err != nil {
+		return err
+	}
+	rules := make(map[TransportationMode]ModeRule)
+	for i, rule := range set.Modes {
+		if err := validateModeRule(rule); err != nil {
+			return fmt.Errorf("rule %d (%s): %v", i, rule.Mode, err)
+		}
+		if _, exists := rules[rule.Mode]; exists {
+			return fmt.Errorf("rule %d: duplicate rules for %s", i, rule.Mode)
+		}
+		rules[rule.Mode] = rule
+	}
+
+	tv.mutex.Lock()
+	defer tv.mutex.Unlock()
+	tv.rules = rules
+	return nil
+}
+
+// validateModeRule checks a rule is consistent
+func validateModeRule(rule ModeRule) error {
+	if rule.Mode == Multimodal {
+		return errors.New("multimodal routes are checked against each leg's mode")
+	}
+	if _, err := ParseTransportationMode(string(rule.Mode)); err != nil {
+		return err
+	}
+	for _, limit := range []float64{rule.MaxGrossWeightKg, rule.MaxPieceWeightKg, rule.MaxLengthCm, rule.MaxWidthCm, rule.MaxHeightCm} {
+		if limit < 0 {
+			return errors.New("limits must not be negative")
+		}
+	}
+	if rule.MinTransitHours < 0 || (rule.MaxTransitHours > 0 && rule.MinTransitHours > rule.MaxTransitHours) {
+		return errors.New("transit time bounds are inconsistent")
+	}
+	for _, doc := range append(append([]ShipmentDocument{}, rule.RequiredDocuments...), rule.Hazardous.RequiredDocuments...) {
+		if !knownShipmentDocuments[doc] {
+			return fmt.Errorf("unknown document %s", doc)
+		}
+	}
+	return nil
+}
+
+// ParseTransportationMode matches a mode name case-insensitively
+func ParseTransportationMode(mode string) (TransportationMode, error) {
+	mode = strings.TrimSpace(mode)
+	for _, known := range transportationModes {
+		if strings.EqualFold(mode, string(known)) {
+			return known, nil
+		}
+	}
+	return "", errors.New("invalid transport mode: " + mode)
 }
 
 // ValidateMode checks if the transport mode is allowed
 func (tv *TransportationValidator) ValidateMode(mode string) error {
-	mode = strings.ToLower(strings.TrimSpace(mode))
-	if !tv.allowedModes[mode] {
-		return errors.New("invalid transport mode: " + mode)
+	_, err := ParseTransportationMode(mode)
+	return err
+}
+
+// Rule returns the rules configured for a mode
+func (tv *TransportationValidator) Rule(mode TransportationMode) (ModeRule, bool) {
+	tv.mutex.RLock()
+	defer tv.mutex.RUnlock()
+	rule, ok := tv.rules[mode]
+	return rule, ok
+}
+
+// ApplyModeSpecificLogic checks a quote, and the booking on it if given,
+// against the rules of each leg's mode and returns every violation as a
+// RuleViolations error
+func (tv *TransportationValidator) ApplyModeSpecificLogic(quote FreightQuote, booking *Booking) error {
+	if violations := tv.Evaluate(quote, booking); len(violations) > 0 {
+		return violations
 	}
 	return nil
 }
 
-// ApplyModeSpecificLogic applies specific rules based on transport mode
-func (tv *TransportationValidator) ApplyModeSpecificLogic(mode string) error {
-	// Example: add custom logic per mode
-	switch strings.ToLower(mode) {
-	case "air":
-		// Air transport specific rules
-	case "sea":
-		// Sea transport specific rules
-	case "road":
-		// Road transport specific rules
-	case "rail":
-		// Rail transport specific rules
-	case "pipeline":
-		// Pipeline transport specific rules
-	case "multimodal":
-		// Multimodal transport specific rules
-	default:
-		return errors.New("unsupported transport mode: " + mode)
+// Evaluate checks a quote against the rules of each of its legs' modes:
+// weight and dimension limits, packaging, hazardous restrictions and planned
+// transit time. With a booking it also checks the documents attached to it
+// and the actual transit time of the legs it covers.
+func (tv *TransportationValidator) Evaluate(quote FreightQuote, booking *Booking) RuleViolations {
+	legs := quote.Legs
+	if len(legs) == 0 {
+		legs = []RouteLeg{{Sequence: 1, Mode: quote.TransportationMode}}
+	}
+
+	violations := RuleViolations{}
+	checkedModes := make(map[TransportationMode]bool)
+	for _, leg := range legs {
+		rule, ok := tv.Rule(leg.Mode)
+		if !ok {
+			violations = append(violations, RuleViolation{Mode: leg.Mode, Leg: leg.Sequence, Rule: "mode", Message: fmt.Sprintf("no rules configured for %s", leg.Mode)})
+			continue
+		}
+		// Cargo rules apply once per mode however many legs use it
+		if !checkedModes[leg.Mode] {
+			checkedModes[leg.Mode] = true
+			violations = append(violations, rule.checkCargo(quote)...)
+		}
+		if !leg.PlannedDeparture.IsZero() && !leg.PlannedArrival.IsZero() {
+			violations = append(violations, rule.checkTransit(leg, "planned", leg.PlannedArrival.Sub(leg.PlannedDeparture))...)
+		}
+		if booking == nil || (booking.LegSequence != 0 && booking.LegSequence != leg.Sequence) {
+			continue
+		}
+		violations = append(violations, rule.checkDocuments(quote, leg, booking.Documents)...)
+		if leg.Status == LegArrived {
+			violations = append(violations, rule.checkTransit(leg, "actual", leg.ArrivedAt.Sub(leg.DepartedAt))...)
+		}
+	}
+	return violations
+}
+
+// checkCargo checks the quote's cargo against the rule's weight, dimension,
+// packaging and hazardous limits
+func (rule ModeRule) checkCargo(quote FreightQuote) RuleViolations {
+	violations := RuleViolations{}
+	add := func(name, format string, args ...interface{}) {
+		violations = append(violations, RuleViolation{Mode: rule.Mode, Rule: name, Message: string(rule.Mode) + ": " + fmt.Sprintf(format, args...)})
+	}
+
+	gross := 0.0
+	for i, item := range quote.Cargo.Items {
+		gross += item.GrossWeightKg
+		if item.Pieces > 0 && rule.MaxPieceWeightKg > 0 && item.GrossWeightKg/float64(item.Pieces) > rule.MaxPieceWeightKg {
+			add("max_piece_weight_kg", "line %d piece weight exceeds %.0f kg", i+1, rule.MaxPieceWeightKg)
+		}
+		for _, dim := range []struct {
+			name         string
+			value, limit float64
+		}{
+			{"max_length_cm", item.LengthCm, rule.MaxLengthCm},
+			{"max_width_cm", item.WidthCm, rule.MaxWidthCm},
+			{"max_height_cm", item.HeightCm, rule.MaxHeightCm},
+		} {
+			if dim.limit > 0 && dim.value > dim.limit {
+				add(dim.name, "line %d exceeds %s of %.0f cm", i+1, strings.TrimSuffix(strings.TrimPrefix(dim.name, "max_"), "_cm"), dim.limit)
+			}
+		}
+	}
+	if rule.MaxGrossWeightKg > 0 && gross > rule.MaxGrossWeightKg {
+		add("max_gross_weight_kg", "gross weight %.0f kg exceeds %.0f kg", gross, rule.MaxGrossWeightKg)
+	}
+
+	if len(rule.AllowedPackaging) > 0 {
+		allowed := false
+		for _, packaging := range rule.AllowedPackaging {
+			allowed = allowed || packaging == quote.PackagingMode
+		}
+		if !allowed {
+			add("allowed_packaging", "%s packaging is not allowed", quote.PackagingMode)
+		}
+	}
+
+	if quote.CargoType == Hazardous || len(quote.Cargo.DangerousGoods) > 0 {
+		if !rule.Hazardous.Allowed {
+			add("hazardous", "hazardous cargo is not allowed")
+		}
+		for _, item := range quote.Cargo.DangerousGoods {
+			for _, class := range rule.Hazardous.ForbiddenClasses {
+				if hazardClassIn(item.Class, class) {
+					add("hazardous", "%s class %s is forbidden", item.UNNumber, item.Class)
+				}
+			}
+		}
+	}
+	return violations
+}
+
+// checkTransit checks a leg's transit time against the rule's bounds
+func (rule ModeRule) checkTransit(leg RouteLeg, kind string, transit time.Duration) RuleViolations {
+	hours := transit.Hours()
+	if (rule.MinTransitHours > 0 && hours < float64(rule.MinTransitHours)) || (rule.MaxTransitHours > 0 && hours > float64(rule.MaxTransitHours)) {
+		return RuleViolations{{
+			Mode:    rule.Mode,
+			Leg:     leg.Sequence,
+			Rule:    "transit_hours",
+			Message: fmt.Sprintf("%s: leg %d %s transit of %.1f h is outside %d-%d h", rule.Mode, leg.Sequence, kind, hours, rule.MinTransitHours, rule.MaxTransitHours),
+		}}
 	}
 	return nil
 }
+
+// checkDocuments checks the documents a leg's mode requires are attached
+func (rule ModeRule) checkDocuments(quote FreightQuote, leg RouteLeg, attached []ShipmentDocument) RuleViolations {
+	required := rule.RequiredDocuments
+	if quote.CargoType == Hazardous || len(quote.Cargo.DangerousGoods) > 0 {
+		required = append(append([]ShipmentDocument{}, required...), rule.Hazardous.RequiredDocuments...)
+	}
+	violations := RuleViolations{}
+	for _, doc := range required {
+		found := false
+		for _, a := range attached {
+			found = found || a == doc
+		}
+		if !found {
+			violations = append(violations, RuleViolation{
+				Mode:    rule.Mode,
+				Leg:     leg.Sequence,
+				Rule:    "required_documents",
+				Message: fmt.Sprintf("%s: leg %d requires %s", rule.Mode, leg.Sequence, doc),
+			})
+		}
+	}
+	return violations
+}
+
+// hazardClassIn reports whether a class or division such as "1.1D" falls
+// under a forbidden class ("1") or division ("1.1")
+func hazardClassIn(class, forbidden string) bool {
+	division := strings.TrimRight(class, "ABCDEFGHJKLNS")
+	return division == forbidden || strings.HasPrefix(division, forbidden+".")
+}
+
+// AttachDocuments records transport documents issued for a booking. Filing a
+// customs declaration is written to the compliance log before it is attached.
+func (m *Marketplace) AttachDocuments(bookingID string, documents []ShipmentDocument) (Booking, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	booking, exists := m.bookings[bookingID]
+	if !exists {
+		return Booking{}, errors.New("booking not found")
+	}
+	var added []ShipmentDocument
+	for _, doc := range documents {
+		if !knownShipmentDocuments[doc] {
+			return Booking{}, errors.New("unknown document " + string(doc))
+		}
+		if !hasDocument(booking.Documents, doc) && !hasDocument(added, doc) {
+			added = append(added, doc)
+		}
+	}
+	for _, doc := range added {
+		if doc != CustomsDeclaration || m.Compliance == nil {
+			continue
+		}
+		quote := m.quotes[booking.QuoteID]
+		details := fmt.Sprintf("%s declaration for quote %s", quote.ServiceCategory, quote.ID)
+		if _, err := m.Compliance.Record(ComplianceCustomsDeclarationFiled, booking.ShipperID, booking.ID, details, "marketplace"); err != nil {
+			return Booking{}, err
+		}
+	}
+	booking.Documents = append(booking.Documents, added...)
+	m.bookings[bookingID] = booking
+	return booking, nil
+}
+
+// hasDocument reports whether a document is in a list
+func hasDocument(documents []ShipmentDocument, doc ShipmentDocument) bool {
+	for _, existing := range documents {
+		if existing == doc {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckModeRules evaluates a booking and its quote against the mode rules
+func (m *Marketplace) CheckModeRules(bookingID string) (RuleViolations, error) {
+	if m.Transport == nil {
+		return nil, errors.New("mode rules not configured")
+	}
+	m.mutex.RLock()
+	booking, exists := m.bookings[bookingID]
+	quote := m.quotes[booking.QuoteID]
+	m.mutex.RUnlock()
+	if !exists {
+		return nil, errors.New("booking not found")
+	}
+	return m.Transport.Evaluate(quote, &booking), nil
+}
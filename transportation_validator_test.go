@@ -0,0 +1,132 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTransportationMode(t *testing.T) {
+	for name, want := range map[string]TransportationMode{"air": Air, " SEA ": Sea, "rail": Rail, "Road": Road, "multimodal": Multimodal} {
+		if mode, err := ParseTransportationMode(name); err != nil || mode != want {
+			t.Errorf("ParseTransportationMode(%q) = %s, %v; want %s", name, mode, err, want)
+		}
+	}
+	if _, err := ParseTransportationMode("pipeline"); err == nil {
+		t.Errorf("Expected unknown mode to be rejected")
+	}
+}
+
+func TestModeRules_LoadRejectsInvalidRules(t *testing.T) {
+	tv := NewTransportationValidator()
+	if _, ok := tv.Rule(Rail); !ok {
+		t.Fatalf("Expected bundled rules for Rail")
+	}
+	invalid := map[string]string{
+		"unknown mode":     "modes:\n  - mode: Pipeline\n",
+		"multimodal rule":  "modes:\n  - mode: Multimodal\n",
+		"duplicate mode":   "modes:\n  - mode: Air\n  - mode: Air\n",
+		"unknown document": "modes:\n  - mode: Sea\n    required_documents: [Passport]\n",
+		"transit bounds":   "modes:\n  - mode: Sea\n    min_transit_hours: 48\n    max_transit_hours: 24\n",
+		"unknown field":    "modes:\n  - mode: Sea\n    max_weight: 10\n",
+	}
+	for name, data := range invalid {
+		if err := tv.LoadRules([]byte(data)); err == nil {
+			t.Errorf("%s: expected rules to be rejected", name)
+		}
+	}
+}
+
+func TestModeRules_EvaluateReportsAllViolations(t *testing.T) {
+	tv := NewTransportationValidator()
+	quote := FreightQuote{
+		CargoType:          Hazardous,
+		PackagingMode:      Container,
+		TransportationMode: Air,
+		Cargo: CargoDetails{
+			Items:          []CargoLineItem{{Pieces: 2, GrossWeightKg: 12000, LengthCm: 400, WidthCm: 200, HeightCm: 150}},
+			DangerousGoods: []DangerousGoodsItem{{UNNumber: "UN0004", Class: "1.1D", PackingGroup: "II", ProperShippingName: "AMMONIUM PICRATE"}},
+		},
+	}
+
+	violated := make(map[string]bool)
+	for _, v := range tv.Evaluate(quote, nil) {
+		violated[v.Rule] = true
+	}
+	for _, rule := range []string{"max_piece_weight_kg", "max_length_cm", "hazardous"} {
+		if !violated[rule] {
+			t.Errorf("Expected a %s violation, got %v", rule, violated)
+		}
+	}
+	if violated["max_gross_weight_kg"] || violated["max_width_cm"] {
+		t.Errorf("Unexpected violations %v", violated)
+	}
+
+	// Rail wagons take containers and pallets, not loose cargo
+	loose := FreightQuote{CargoType: GeneralCargo, PackagingMode: Loose, TransportationMode: Rail}
+	if violations := tv.Evaluate(loose, nil); len(violations) != 1 || violations[0].Rule != "allowed_packaging" {
+		t.Errorf("Expected an allowed_packaging violation, got %v", violations)
+	}
+
+	quote.TransportationMode = Sea
+	if err := tv.ApplyModeSpecificLogic(quote, nil); err != nil {
+		t.Errorf("Unexpected sea violations: %v", err)
+	}
+}
+
+func TestModeRules_EnforcedOnQuotesAndDepartures(t *testing.T) {
+	marketplace := NewMarketplace(NewBlockchain())
+	marketplace.Transport = NewTransportationValidator()
+	validUntil := time.Now().Add(24 * time.Hour)
+	departure := time.Now().Add(48 * time.Hour)
+	shipper := marketplace.RegisterParticipant("Importer", Shipper)
+
+	// A one-hour ocean crossing is outside the sea transit bounds
+	if _, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM", PlannedDeparture: departure, PlannedArrival: departure.Add(time.Hour)},
+	}, 1000.0, "EUR", validUntil, CargoDetails{}); err == nil {
+		t.Errorf("Expected planned transit outside the mode's bounds to be rejected")
+	}
+	// Rail does not carry loose cargo
+	legs := []RouteLeg{
+		{Mode: Sea, OriginCode: "CNSHA", DestinationCode: "NLRTM"},
+		{Mode: Rail, OriginCode: "NLRTM", DestinationCode: "PLWAW"},
+	}
+	if _, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Loose, legs, 1000.0, "EUR", validUntil, CargoDetails{}); err == nil {
+		t.Errorf("Expected loose cargo on a rail leg to be rejected")
+	}
+	quote, err := marketplace.CreateMultimodalQuote(shipper.ID, Import, GeneralCargo, Container, legs, 1000.0, "EUR", validUntil, CargoDetails{})
+	if err != nil {
+		t.Fatalf("CreateMultimodalQuote failed: %v", err)
+	}
+
+	carrier := marketplace.RegisterParticipant("Door-to-Door Forwarder", Carrier)
+	bid, err := marketplace.PlaceBid(quote.ID, carrier.ID, 900.0, "")
+	if err != nil {
+		t.Fatalf("PlaceBid failed: %v", err)
+	}
+	booking, err := marketplace.ConfirmBooking(quote.ID, bid.ID, shipper.ID)
+	if err != nil {
+		t.Fatalf("ConfirmBooking failed: %v", err)
+	}
+
+	if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegDeparted, "", time.Time{}); err == nil {
+		t.Errorf("Expected departure without a bill of lading to be refused")
+	}
+	if _, err := marketplace.AttachDocuments(booking.ID, []ShipmentDocument{"Passport"}); err == nil {
+		t.Errorf("Expected unknown documents to be rejected")
+	}
+	if _, err := marketplace.AttachDocuments(booking.ID, []ShipmentDocument{BillOfLading, CommercialInvoice, PackingList}); err != nil {
+		t.Fatalf("AttachDocuments failed: %v", err)
+	}
+	if _, err := marketplace.RecordLegEvent(booking.ID, 1, LegDeparted, "", time.Time{}); err != nil {
+		t.Errorf("RecordLegEvent failed with documents attached: %v", err)
+	}
+
+	violations, err := marketplace.CheckModeRules(booking.ID)
+	if err != nil {
+		t.Fatalf("CheckModeRules failed: %v", err)
+	}
+	if len(violations) != 1 || violations[0].Leg != 2 || violations[0].Rule != "required_documents" {
+		t.Errorf("Expected only the rail consignment note missing, got %+v", violations)
+	}
+}